@@ -0,0 +1,329 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package audit provides an audit log of pin activity, written to a rotating
+// file, for applications such as door sensors and machine interlocks that
+// require a record of inputs and outputs.
+//
+// Each entry records the wall clock time, the name of the pin, the event, and
+// the level of the pin.  Entries are written either as JSON lines:
+//
+//	{"time":"2020-06-01T12:00:00.123456789Z","pin":"door","event":"edge","level":1}
+//
+// or as CSV, with a header at the start of each file:
+//
+//	time,pin,event,level
+//	2020-06-01T12:00:00.123456789Z,door,edge,1
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// Events logged for pins.
+const (
+	// EventEdge is the level of the pin at an edge.
+	EventEdge = "edge"
+
+	// EventWrite is the level set by a Write.
+	EventWrite = "write"
+)
+
+// Format is the format of the log entries.
+type Format int
+
+const (
+	// JSON writes each entry as a JSON object on a single line.
+	JSON Format = iota
+
+	// CSV writes each entry as a CSV record.
+	CSV
+)
+
+// Log is an audit log written to a file, which is rotated when it reaches a
+// maximum size.
+//
+// Rotated files are renamed with a numeric suffix, .1 being the most recent,
+// and the oldest discarded when the maximum number of files is reached.
+type Log struct {
+	path     string
+	format   Format
+	maxSize  int64
+	maxFiles int
+	errh     func(error)
+	// Guards the following
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	err    error
+	closed bool
+}
+
+// Option defines an option that can be applied when opening a Log.
+type Option func(*Log)
+
+// WithFormat sets the format of the log entries.
+//
+// The default is JSON.
+func WithFormat(format Format) Option {
+	return func(l *Log) {
+		l.format = format
+	}
+}
+
+// WithMaxSize sets the size, in bytes, at which the file is rotated.
+//
+// The default is 10MB.  A size of 0 disables rotation.
+func WithMaxSize(size int64) Option {
+	return func(l *Log) {
+		l.maxSize = size
+	}
+}
+
+// WithMaxFiles sets the number of rotated files retained, in addition to the
+// current file.
+//
+// The default is 5.
+func WithMaxFiles(n int) Option {
+	return func(l *Log) {
+		l.maxFiles = n
+	}
+}
+
+// WithErrorHandler sets a handler called with each error encountered writing
+// the log, so failures are reported as they occur.
+//
+// The handler is called from the goroutine recording the entry, so should not
+// block.
+func WithErrorHandler(handler func(error)) Option {
+	return func(l *Log) {
+		l.errh = handler
+	}
+}
+
+// Open opens the Log, appending to the file if it already exists.
+func Open(path string, options ...Option) (*Log, error) {
+	l := &Log{
+		path:     path,
+		maxSize:  10 << 20,
+		maxFiles: 5,
+	}
+	for _, option := range options {
+		option(l)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Err returns the most recent error encountered writing the log, if any.
+//
+// An entry that cannot be written is dropped, and the write of the next entry
+// is retried, reopening the file if necessary, so a transient failure, such
+// as the disk filling, does not end the log.  Errors are also reported to the
+// handler set by WithErrorHandler, if any.
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Pin wraps the pin so that its edges and writes are logged under the given
+// name.
+//
+// Watch handlers on the wrapped pin are logged, so edges are only logged while
+// the pin is watched.
+func (l *Log) Pin(name string, pin gpio.Pinner) gpio.Pinner {
+	return &auditPin{l: l, name: name, pin: pin}
+}
+
+// Record adds an entry to the log, e.g. for events not visible through a
+// wrapped pin.
+func (l *Log) Record(name, event string, level gpio.Level) {
+	l.record(time.Now(), name, event, level)
+}
+
+// record adds an entry with the time to the log.
+func (l *Log) record(t time.Time, name, event string, level gpio.Level) {
+	entry, err := l.encode(t, name, event, level)
+	if err == nil {
+		err = l.write(entry)
+	}
+	if err != nil && l.errh != nil {
+		l.errh(err)
+	}
+}
+
+// write writes the entry to the file, reopening the file if a previous write
+// or rotation failed.
+func (l *Log) write(entry []byte) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer func() {
+		if err != nil {
+			l.err = err
+		}
+	}()
+	if l.closed {
+		return os.ErrClosed
+	}
+	if l.f == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(entry)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	if l.size == 0 && l.format == CSV {
+		entry = append([]byte("time,pin,event,level\n"), entry...)
+	}
+	n, err := l.f.Write(entry)
+	l.size += int64(n)
+	return err
+}
+
+func (l *Log) encode(t time.Time, name, event string, level gpio.Level) ([]byte, error) {
+	ts := t.Format(time.RFC3339Nano)
+	v := 0
+	if level {
+		v = 1
+	}
+	if l.format == CSV {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{ts, name, event, strconv.Itoa(v)})
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	}
+	b, err := json.Marshal(struct {
+		Time  string `json:"time"`
+		Pin   string `json:"pin"`
+		Event string `json:"event"`
+		Level int    `json:"level"`
+	}{ts, name, event, v})
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Assumes caller holds the mu lock.
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = fi.Size()
+	return nil
+}
+
+// rotate closes the current file, shuffles the rotated files along, and opens
+// a new file.
+// Assumes caller holds the mu lock.
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+	if l.maxFiles > 0 {
+		os.Remove(l.rotated(l.maxFiles))
+		for n := l.maxFiles - 1; n > 0; n-- {
+			os.Rename(l.rotated(n), l.rotated(n+1))
+		}
+		if err := os.Rename(l.path, l.rotated(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *Log) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// auditPin is a Pinner that logs the edges and writes of the wrapped pin.
+type auditPin struct {
+	l    *Log
+	name string
+	pin  gpio.Pinner
+}
+
+func (p *auditPin) Read() gpio.Level {
+	return p.pin.Read()
+}
+
+func (p *auditPin) Write(level gpio.Level) {
+	p.pin.Write(level)
+	p.l.Record(p.name, EventWrite, level)
+}
+
+func (p *auditPin) SetMode(mode gpio.Mode) {
+	p.pin.SetMode(mode)
+}
+
+// optionWatcher is implemented by pins that support watch options, such as
+// *gpio.Pin.
+type optionWatcher interface {
+	WatchWith(edge gpio.Edge, handler func(gpio.Pinner), options ...gpio.WatchOption) error
+}
+
+// Watch watches the wrapped pin, logging each edge.
+//
+// If the pin supports WatchWith, as *gpio.Pin does, then each edge is logged
+// by a filter called from the watcher, with the level and time of the event,
+// rather than the level when the handler runs.  The entries are then written
+// from the watcher goroutine, so a slow log delays the handling of edges.
+func (p *auditPin) Watch(edge gpio.Edge, handler func(gpio.Pinner)) error {
+	if w, ok := p.pin.(optionWatcher); ok {
+		return w.WatchWith(edge, func(gpio.Pinner) {
+			handler(p)
+		}, gpio.WithFilter(func(evt gpio.Event) bool {
+			p.l.record(evt.Time, p.name, EventEdge, evt.Level)
+			return true
+		}))
+	}
+	return p.pin.Watch(edge, func(pin gpio.Pinner) {
+		p.l.Record(p.name, EventEdge, pin.Read())
+		handler(p)
+	})
+}
+
+func (p *auditPin) Unwatch() {
+	p.pin.Unwatch()
+}
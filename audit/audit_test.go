@@ -0,0 +1,171 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package audit_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/audit"
+	"github.com/warthog618/gpio/mock"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "audit")
+	require.Nil(t, err)
+	return dir
+}
+
+func lines(t *testing.T, path string) []string {
+	buf, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	return strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+}
+
+type entry struct {
+	Time  string
+	Pin   string
+	Event string
+	Level int
+}
+
+func TestJSON(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	l, err := audit.Open(path)
+	require.Nil(t, err)
+	door := mock.NewPin(1)
+	lock := mock.NewPin(2)
+	ad := l.Pin("door", door)
+	al := l.Pin("lock", lock)
+	al.SetMode(gpio.Output)
+	assert.Nil(t, ad.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		al.Write(pin.Read())
+	}))
+	door.Set(gpio.High)
+	al.Read()
+	l.Record("alarm", "armed", gpio.High)
+	assert.Nil(t, l.Err())
+	assert.Nil(t, l.Close())
+
+	var got []string
+	for _, line := range lines(t, path) {
+		var e entry
+		require.Nil(t, json.Unmarshal([]byte(line), &e), line)
+		assert.NotEmpty(t, e.Time)
+		got = append(got, e.Pin+" "+e.Event+" "+string('0'+rune(e.Level)))
+	}
+	assert.Equal(t, []string{
+		"door edge 0", "lock write 0",
+		"door edge 1", "lock write 1",
+		"alarm armed 1",
+	}, got)
+
+	// closed
+	l.Record("door", audit.EventEdge, gpio.Low)
+	assert.Equal(t, os.ErrClosed, l.Err())
+
+	// append
+	l, err = audit.Open(path)
+	require.Nil(t, err)
+	l.Record("door", audit.EventEdge, gpio.Low)
+	assert.Nil(t, l.Close())
+	assert.Len(t, lines(t, path), 6)
+}
+
+func TestCSV(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.csv")
+	l, err := audit.Open(path, audit.WithFormat(audit.CSV))
+	require.Nil(t, err)
+	l.Record("door", audit.EventEdge, gpio.High)
+	l.Record("a,b", audit.EventWrite, gpio.Low)
+	assert.Nil(t, l.Close())
+	ll := lines(t, path)
+	require.Len(t, ll, 3)
+	assert.Equal(t, "time,pin,event,level", ll[0])
+	assert.True(t, strings.HasSuffix(ll[1], ",door,edge,1"), ll[1])
+	assert.True(t, strings.HasSuffix(ll[2], `,"a,b",write,0`), ll[2])
+}
+
+func TestRotate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.csv")
+	l, err := audit.Open(path,
+		audit.WithFormat(audit.CSV),
+		audit.WithMaxSize(200),
+		audit.WithMaxFiles(2))
+	require.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		l.Record("door", audit.EventEdge, i%2 == 1)
+	}
+	assert.Nil(t, l.Err())
+	assert.Nil(t, l.Close())
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		fi, err := os.Stat(p)
+		require.Nil(t, err)
+		assert.True(t, fi.Size() <= 200, p)
+		ll := lines(t, p)
+		assert.True(t, len(ll) > 1, p)
+		assert.Equal(t, "time,pin,event,level", ll[0])
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpenFail(t *testing.T) {
+	_, err := audit.Open(filepath.Join("nonexistent", "dir", "audit.log"))
+	assert.NotNil(t, err)
+}
+
+func TestRetry(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "logs", "audit.csv")
+	require.Nil(t, os.Mkdir(filepath.Dir(path), 0755))
+	var errs []error
+	l, err := audit.Open(path,
+		audit.WithFormat(audit.CSV),
+		audit.WithMaxSize(100),
+		audit.WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}))
+	require.Nil(t, err)
+	l.Record("door", audit.EventEdge, gpio.High)
+	assert.Nil(t, l.Err())
+
+	// the rotation, and then the reopen, fail.
+	require.Nil(t, os.RemoveAll(filepath.Dir(path)))
+	for i := 0; i < 5; i++ {
+		l.Record("door", audit.EventEdge, gpio.Low)
+	}
+	assert.NotNil(t, l.Err())
+	assert.NotEmpty(t, errs)
+
+	// logging resumes once the fault clears.
+	n := len(errs)
+	require.Nil(t, os.Mkdir(filepath.Dir(path), 0755))
+	l.Record("door", audit.EventEdge, gpio.High)
+	assert.Len(t, errs, n)
+	assert.Nil(t, l.Close())
+	ll := lines(t, path)
+	require.Len(t, ll, 2)
+	assert.True(t, strings.HasSuffix(ll[1], ",door,edge,1"), ll[1])
+
+	// closed
+	l.Record("door", audit.EventEdge, gpio.Low)
+	assert.Equal(t, os.ErrClosed, errs[len(errs)-1])
+}
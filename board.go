@@ -0,0 +1,322 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Header maps for single board computers.
+
+package gpio
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Line identifies a GPIO line on a GPIO character device.
+type Line struct {
+	// Chip is the name, e.g. "gpiochip0", or label, e.g. "1c20800.pinctrl",
+	// of the GPIO chip providing the line.
+	Chip string
+
+	// Offset is the offset of the line on the chip.
+	Offset int
+}
+
+// Board describes the GPIO header(s) of a single board computer.
+//
+// Pins on the board are accessed via the GPIO character device, so boards
+// other than the Raspberry Pi can be supported, and the pins provide the same
+// API as for the Raspberry Pi.
+type Board struct {
+	// Name is the name of the board.
+	Name string
+
+	// Header maps header pin names to the corresponding GPIO lines.
+	Header map[string]Line
+}
+
+// Lookup returns the line corresponding to the header pin name.
+//
+// The name is case insensitive.
+func (b *Board) Lookup(name string) (Line, bool) {
+	l, ok := b.Header[strings.ToUpper(name)]
+	return l, ok
+}
+
+// Pin creates a Pin for the named header pin.
+//
+// The chip providing the pin is opened as required.  The package must have been
+// opened, either with or without the character device, before creating pins.
+func (b *Board) Pin(name string, options ...PinOption) (*Pin, error) {
+	l, ok := b.Lookup(name)
+	if !ok {
+		return nil, ErrInvalidPin
+	}
+	return l.Pin(options...)
+}
+
+// allwinner returns the line offset of an Allwinner port pin, e.g. PA12.
+func allwinner(port byte, pin int) Line {
+	return Line{"1c20800.pinctrl", int(port-'A')*32 + pin}
+}
+
+// am335x returns the line of an AM335x GPIO, e.g. gpio1_6.
+func am335x(bank, pin int) Line {
+	return Line{"gpiochip" + strconv.Itoa(bank), pin}
+}
+
+// computeModuleHeader returns the SODIMM pins of GPIO0-45.
+//
+// GPIO0-27 are on odd pins, and GPIO28-45 on even pins, in pairs separated by
+// ground pins.
+func computeModuleHeader() map[string]Line {
+	h := map[string]Line{}
+	for gpio := 0; gpio < MaxCMGPIOPin; gpio++ {
+		var pin int
+		if gpio < 28 {
+			pin = 3 + gpio/2*6 + gpio%2*2
+			if gpio >= 12 {
+				// GPIO12 onwards are displaced by the GPIO0-27 VDD pins.
+				pin += 6
+			}
+		} else {
+			g := gpio - 28
+			pin = 28 + g/2*6 + g%2*2
+		}
+		h["SODIMM"+strconv.Itoa(pin)] = Line{"gpiochip0", gpio}
+	}
+	return h
+}
+
+var (
+	// RaspberryPi is the 40 pin J8 header of the Raspberry Pi, from the B+
+	// onwards.
+	RaspberryPi = &Board{
+		Name: "Raspberry Pi",
+		Header: map[string]Line{
+			"J8P3":  {"gpiochip0", J8p3},
+			"J8P5":  {"gpiochip0", J8p5},
+			"J8P7":  {"gpiochip0", J8p7},
+			"J8P8":  {"gpiochip0", J8p8},
+			"J8P10": {"gpiochip0", J8p10},
+			"J8P11": {"gpiochip0", J8p11},
+			"J8P12": {"gpiochip0", J8p12},
+			"J8P13": {"gpiochip0", J8p13},
+			"J8P15": {"gpiochip0", J8p15},
+			"J8P16": {"gpiochip0", J8p16},
+			"J8P18": {"gpiochip0", J8p18},
+			"J8P19": {"gpiochip0", J8p19},
+			"J8P21": {"gpiochip0", J8p21},
+			"J8P22": {"gpiochip0", J8p22},
+			"J8P23": {"gpiochip0", J8p23},
+			"J8P24": {"gpiochip0", J8p24},
+			"J8P26": {"gpiochip0", J8p26},
+			"J8P27": {"gpiochip0", J8p27},
+			"J8P28": {"gpiochip0", J8p28},
+			"J8P29": {"gpiochip0", J8p29},
+			"J8P31": {"gpiochip0", J8p31},
+			"J8P32": {"gpiochip0", J8p32},
+			"J8P33": {"gpiochip0", J8p33},
+			"J8P35": {"gpiochip0", J8p35},
+			"J8P36": {"gpiochip0", J8p36},
+			"J8P37": {"gpiochip0", J8p37},
+			"J8P38": {"gpiochip0", J8p38},
+			"J8P40": {"gpiochip0", J8p40},
+		},
+	}
+
+	// RaspberryPiZero is the 40 pin J8 header of the Raspberry Pi Zero, which
+	// is identical to that of the RaspberryPi, though usually unpopulated.
+	RaspberryPiZero = &Board{
+		Name:   "Raspberry Pi Zero",
+		Header: RaspberryPi.Header,
+	}
+
+	// RaspberryPiRev1 is the 26 pin P1 header of the original Model B (rev 1).
+	RaspberryPiRev1 = &Board{
+		Name: "Raspberry Pi Rev 1",
+		Header: map[string]Line{
+			"P1P3":  {"gpiochip0", P1p3Rev1},
+			"P1P5":  {"gpiochip0", P1p5Rev1},
+			"P1P7":  {"gpiochip0", J8p7},
+			"P1P8":  {"gpiochip0", J8p8},
+			"P1P10": {"gpiochip0", J8p10},
+			"P1P11": {"gpiochip0", J8p11},
+			"P1P12": {"gpiochip0", J8p12},
+			"P1P13": {"gpiochip0", P1p13Rev1},
+			"P1P15": {"gpiochip0", J8p15},
+			"P1P16": {"gpiochip0", J8p16},
+			"P1P18": {"gpiochip0", J8p18},
+			"P1P19": {"gpiochip0", J8p19},
+			"P1P21": {"gpiochip0", J8p21},
+			"P1P22": {"gpiochip0", J8p22},
+			"P1P23": {"gpiochip0", J8p23},
+			"P1P24": {"gpiochip0", J8p24},
+			"P1P26": {"gpiochip0", J8p26},
+		},
+	}
+
+	// RaspberryPiRev2 is the 26 pin P1 header, and the P5 header, of the Model
+	// A and B (rev 2).
+	//
+	// The P1 pins match the first 26 pins of the J8 header.
+	RaspberryPiRev2 = &Board{
+		Name: "Raspberry Pi Rev 2",
+		Header: map[string]Line{
+			"P1P3":  {"gpiochip0", J8p3},
+			"P1P5":  {"gpiochip0", J8p5},
+			"P1P7":  {"gpiochip0", J8p7},
+			"P1P8":  {"gpiochip0", J8p8},
+			"P1P10": {"gpiochip0", J8p10},
+			"P1P11": {"gpiochip0", J8p11},
+			"P1P12": {"gpiochip0", J8p12},
+			"P1P13": {"gpiochip0", J8p13},
+			"P1P15": {"gpiochip0", J8p15},
+			"P1P16": {"gpiochip0", J8p16},
+			"P1P18": {"gpiochip0", J8p18},
+			"P1P19": {"gpiochip0", J8p19},
+			"P1P21": {"gpiochip0", J8p21},
+			"P1P22": {"gpiochip0", J8p22},
+			"P1P23": {"gpiochip0", J8p23},
+			"P1P24": {"gpiochip0", J8p24},
+			"P1P26": {"gpiochip0", J8p26},
+			"P5P3":  {"gpiochip0", P5p3},
+			"P5P4":  {"gpiochip0", P5p4},
+			"P5P5":  {"gpiochip0", P5p5},
+			"P5P6":  {"gpiochip0", P5p6},
+		},
+	}
+
+	// ComputeModule is the SODIMM edge connector of the Compute Module 1, 3,
+	// 3+ and 4S, which provides GPIO0-45.
+	ComputeModule = &Board{
+		Name:   "Compute Module",
+		Header: computeModuleHeader(),
+	}
+
+	// OrangePiZero is the 26 pin header of the Orange Pi Zero (Allwinner H2+).
+	OrangePiZero = &Board{
+		Name: "Orange Pi Zero",
+		Header: map[string]Line{
+			"P3":  allwinner('A', 12),
+			"P5":  allwinner('A', 11),
+			"P7":  allwinner('A', 6),
+			"P8":  allwinner('G', 6),
+			"P10": allwinner('G', 7),
+			"P11": allwinner('A', 1),
+			"P12": allwinner('A', 7),
+			"P13": allwinner('A', 0),
+			"P15": allwinner('A', 3),
+			"P16": allwinner('A', 19),
+			"P18": allwinner('A', 18),
+			"P19": allwinner('A', 15),
+			"P21": allwinner('A', 16),
+			"P22": allwinner('A', 2),
+			"P23": allwinner('A', 14),
+			"P24": allwinner('A', 13),
+			"P26": allwinner('A', 10),
+		},
+	}
+
+	// OrangePiPC is the 40 pin header of the Orange Pi PC, One and Lite
+	// (Allwinner H3).
+	OrangePiPC = &Board{
+		Name: "Orange Pi PC",
+		Header: map[string]Line{
+			"P3":  allwinner('A', 12),
+			"P5":  allwinner('A', 11),
+			"P7":  allwinner('A', 6),
+			"P8":  allwinner('A', 13),
+			"P10": allwinner('A', 14),
+			"P11": allwinner('A', 1),
+			"P12": allwinner('D', 14),
+			"P13": allwinner('A', 0),
+			"P15": allwinner('A', 3),
+			"P16": allwinner('C', 4),
+			"P18": allwinner('C', 7),
+			"P19": allwinner('C', 0),
+			"P21": allwinner('C', 1),
+			"P22": allwinner('A', 2),
+			"P23": allwinner('C', 2),
+			"P24": allwinner('C', 3),
+			"P26": allwinner('A', 21),
+			"P27": allwinner('A', 19),
+			"P28": allwinner('A', 18),
+			"P29": allwinner('A', 7),
+			"P31": allwinner('A', 8),
+			"P32": allwinner('G', 8),
+			"P33": allwinner('A', 9),
+			"P35": allwinner('A', 10),
+			"P36": allwinner('G', 9),
+			"P37": allwinner('A', 20),
+			"P38": allwinner('G', 6),
+			"P40": allwinner('G', 7),
+		},
+	}
+
+	// BananaPi is the 26 pin CON3 header of the Banana Pi M1 (Allwinner A20).
+	BananaPi = &Board{
+		Name: "Banana Pi",
+		Header: map[string]Line{
+			"CON3P3":  allwinner('B', 21),
+			"CON3P5":  allwinner('B', 20),
+			"CON3P7":  allwinner('I', 3),
+			"CON3P8":  allwinner('H', 0),
+			"CON3P10": allwinner('H', 1),
+			"CON3P11": allwinner('I', 19),
+			"CON3P12": allwinner('H', 2),
+			"CON3P13": allwinner('I', 18),
+			"CON3P15": allwinner('I', 17),
+			"CON3P16": allwinner('H', 20),
+			"CON3P18": allwinner('H', 21),
+			"CON3P19": allwinner('I', 12),
+			"CON3P21": allwinner('I', 13),
+			"CON3P22": allwinner('I', 16),
+			"CON3P23": allwinner('I', 11),
+			"CON3P24": allwinner('I', 10),
+			"CON3P26": allwinner('I', 14),
+		},
+	}
+
+	// BeagleBoneBlack is the P8 and P9 headers of the BeagleBone Black
+	// (TI AM335x).
+	//
+	// Only the pins available as GPIOs by default, i.e. not used by the eMMC
+	// or HDMI, are included.
+	BeagleBoneBlack = &Board{
+		Name: "BeagleBone Black",
+		Header: map[string]Line{
+			"P8_7":  am335x(2, 2),
+			"P8_8":  am335x(2, 3),
+			"P8_9":  am335x(2, 5),
+			"P8_10": am335x(2, 4),
+			"P8_11": am335x(1, 13),
+			"P8_12": am335x(1, 12),
+			"P8_13": am335x(0, 23),
+			"P8_14": am335x(0, 26),
+			"P8_15": am335x(1, 15),
+			"P8_16": am335x(1, 14),
+			"P8_17": am335x(0, 27),
+			"P8_18": am335x(2, 1),
+			"P8_19": am335x(0, 22),
+			"P8_26": am335x(1, 29),
+			"P9_11": am335x(0, 30),
+			"P9_12": am335x(1, 28),
+			"P9_13": am335x(0, 31),
+			"P9_14": am335x(1, 18),
+			"P9_15": am335x(1, 16),
+			"P9_16": am335x(1, 19),
+			"P9_17": am335x(0, 5),
+			"P9_18": am335x(0, 4),
+			"P9_21": am335x(0, 3),
+			"P9_22": am335x(0, 2),
+			"P9_23": am335x(1, 17),
+			"P9_24": am335x(0, 15),
+			"P9_26": am335x(0, 14),
+			"P9_27": am335x(3, 19),
+			"P9_30": am335x(3, 16),
+			"P9_41": am335x(0, 20),
+			"P9_42": am335x(0, 7),
+		},
+	}
+)
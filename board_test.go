@@ -0,0 +1,98 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//
+//  Test suite for board module.
+//
+//	Hardware tests use J8 pins 15 and 16 of a Raspberry Pi.
+//
+package gpio_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+var boards = []*gpio.Board{
+	gpio.RaspberryPi,
+	gpio.RaspberryPiZero,
+	gpio.RaspberryPiRev1,
+	gpio.RaspberryPiRev2,
+	gpio.ComputeModule,
+	gpio.OrangePiZero,
+	gpio.OrangePiPC,
+	gpio.BananaPi,
+	gpio.BeagleBoneBlack,
+}
+
+func TestBoardHeaders(t *testing.T) {
+	for _, b := range boards {
+		assert.NotEmpty(t, b.Name)
+		assert.NotEmpty(t, b.Header, b.Name)
+		lines := map[gpio.Line]string{}
+		for name, l := range b.Header {
+			assert.NotEmpty(t, l.Chip, name)
+			if other, ok := lines[l]; ok {
+				t.Errorf("%s: %s and %s share line %v", b.Name, name, other, l)
+			}
+			lines[l] = name
+		}
+	}
+}
+
+func TestBoardLookup(t *testing.T) {
+	l, ok := gpio.RaspberryPi.Lookup("J8p7")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "gpiochip0", Offset: gpio.J8p7}, l)
+	l, ok = gpio.OrangePiZero.Lookup("p8")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "1c20800.pinctrl", Offset: 198}, l)
+	l, ok = gpio.BeagleBoneBlack.Lookup("P9_12")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "gpiochip1", Offset: 28}, l)
+	_, ok = gpio.RaspberryPi.Lookup("J8p1")
+	assert.False(t, ok)
+	l, ok = gpio.RaspberryPiRev1.Lookup("P1p3")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "gpiochip0", Offset: gpio.GPIO0}, l)
+	l, ok = gpio.RaspberryPiRev2.Lookup("P1p3")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "gpiochip0", Offset: gpio.GPIO2}, l)
+	l, ok = gpio.RaspberryPiRev2.Lookup("P5p6")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "gpiochip0", Offset: 31}, l)
+	assert.Len(t, gpio.ComputeModule.Header, gpio.MaxCMGPIOPin)
+	l, ok = gpio.ComputeModule.Lookup("sodimm45")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "gpiochip0", Offset: 12}, l)
+	l, ok = gpio.ComputeModule.Lookup("SODIMM78")
+	assert.True(t, ok)
+	assert.Equal(t, gpio.Line{Chip: "gpiochip0", Offset: 45}, l)
+}
+
+func TestBoardPinUnknown(t *testing.T) {
+	pin, err := gpio.RaspberryPi.Pin("J8p2")
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+	assert.Nil(t, pin)
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestBoardPinLooped(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinIn, err := gpio.RaspberryPi.Pin("J8p15", gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.J8p15, pinIn.Pin())
+	pinOut, err := gpio.RaspberryPi.Pin("J8p16",
+		gpio.WithInitialLevel(gpio.High),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	assert.Equal(t, gpio.High, pinIn.Read())
+	pinOut.Low()
+	assert.Equal(t, gpio.Low, pinIn.Read())
+}
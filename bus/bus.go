@@ -0,0 +1,246 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package bus provides a bit bashed parallel bus on GPIO pins, such as for
+// character LCDs, printer ports, and parallel ADCs and DACs.
+package bus
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// Bus is a parallel bus of data pins, with optional strobe and direction
+// pins.
+//
+// Words are written by setting the data pins, waiting the setup time,
+// pulsing the strobe for the strobe width, then waiting the hold time.  Words
+// are read by asserting the strobe, waiting the setup time, reading the data
+// pins, then releasing the strobe and waiting the hold time.
+//
+// The data pins are tri-stated, i.e. set to Input, before the bus is read, and
+// are only driven while writing.  If a direction pin is provided, e.g. for
+// the DIR input of a bus transceiver, it is switched while the data pins are
+// tri-stated, followed by the turnaround time, so the pins and the device are
+// never both driving the bus.
+type Bus struct {
+	data       []gpio.Pinner
+	strobe     gpio.Pinner
+	active     gpio.Level
+	dir        gpio.Pinner
+	dirWrite   gpio.Level
+	setup      time.Duration
+	hold       time.Duration
+	width      time.Duration
+	turnaround time.Duration
+	// Guards the following and the sequencing of bus cycles.
+	mu sync.Mutex
+	// true while the data pins are driven.
+	driving bool
+}
+
+// Option defines an option that can be applied when creating a Bus.
+type Option func(*Bus)
+
+// WithStrobe provides the strobe, or enable, pin, and the level at which the
+// strobe is active.
+//
+// Without a strobe the data pins are simply set and read, subject to the
+// setup and hold times.
+func WithStrobe(pin gpio.Pinner, active gpio.Level) Option {
+	return func(b *Bus) {
+		b.strobe = pin
+		b.active = active
+	}
+}
+
+// WithDirection provides the direction pin, and the level which indicates
+// the bus is being written.
+func WithDirection(pin gpio.Pinner, write gpio.Level) Option {
+	return func(b *Bus) {
+		b.dir = pin
+		b.dirWrite = write
+	}
+}
+
+// WithSetup sets the time the data must be stable before the strobe.
+//
+// For reads this is the time from the strobe becoming active to the data
+// being read, i.e. the access time of the device.
+func WithSetup(d time.Duration) Option {
+	return func(b *Bus) {
+		b.setup = d
+	}
+}
+
+// WithHold sets the time the data must remain stable after the strobe.
+func WithHold(d time.Duration) Option {
+	return func(b *Bus) {
+		b.hold = d
+	}
+}
+
+// WithStrobeWidth sets the width of the strobe pulse for writes.
+func WithStrobeWidth(d time.Duration) Option {
+	return func(b *Bus) {
+		b.width = d
+	}
+}
+
+// WithTurnaround sets the time between the data pins being tri-stated and
+// either the device or the pins driving the bus, when the bus changes
+// direction.
+func WithTurnaround(d time.Duration) Option {
+	return func(b *Bus) {
+		b.turnaround = d
+	}
+}
+
+// New creates a Bus on the data pins, with the first pin being bit 0 of each
+// word.
+//
+// The data pins are initially tri-stated, and the strobe inactive.
+// At most 64 data pins are supported.
+func New(data []gpio.Pinner, options ...Option) (*Bus, error) {
+	if len(data) == 0 || len(data) > 64 {
+		return nil, ErrInvalidBus
+	}
+	b := &Bus{data: append([]gpio.Pinner(nil), data...)}
+	for _, option := range options {
+		option(b)
+	}
+	for _, p := range b.data {
+		p.SetMode(gpio.Input)
+	}
+	if b.strobe != nil {
+		b.strobe.Write(!b.active)
+		b.strobe.SetMode(gpio.Output)
+	}
+	if b.dir != nil {
+		b.dir.Write(!b.dirWrite)
+		b.dir.SetMode(gpio.Output)
+	}
+	return b, nil
+}
+
+// Close tri-states the data pins, and releases the strobe and direction pins.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.release()
+	if b.strobe != nil {
+		b.strobe.SetMode(gpio.Input)
+	}
+	if b.dir != nil {
+		b.dir.SetMode(gpio.Input)
+	}
+}
+
+// Width returns the number of data pins.
+func (b *Bus) Width() int {
+	return len(b.data)
+}
+
+// Release tri-states the data pins, so the bus may be driven by the device.
+//
+// This is performed automatically by ReadWord, so is only required if the
+// device drives the bus independently of the strobe.
+func (b *Bus) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.release()
+}
+
+// WriteWord writes the word to the bus, with bit n of the word driving the
+// nth data pin.
+func (b *Bus) WriteWord(w uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, p := range b.data {
+		p.Write(w&(1<<uint(i)) != 0)
+	}
+	if !b.driving {
+		if b.dir != nil {
+			b.dir.Write(b.dirWrite)
+		}
+		delay(b.turnaround)
+		for _, p := range b.data {
+			p.SetMode(gpio.Output)
+		}
+		b.driving = true
+	}
+	delay(b.setup)
+	if b.strobe != nil {
+		b.strobe.Write(b.active)
+		delay(b.width)
+		b.strobe.Write(!b.active)
+	}
+	delay(b.hold)
+}
+
+// ReadWord reads a word from the bus, with bit n of the word being the level
+// of the nth data pin.
+func (b *Bus) ReadWord() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.release()
+	if b.strobe != nil {
+		b.strobe.Write(b.active)
+	}
+	delay(b.setup)
+	var w uint64
+	for i, p := range b.data {
+		if p.Read() {
+			w |= 1 << uint(i)
+		}
+	}
+	if b.strobe != nil {
+		b.strobe.Write(!b.active)
+	}
+	delay(b.hold)
+	return w
+}
+
+// release tri-states the data pins and switches the direction to read.
+//
+// Assumes the caller holds the mu lock.
+func (b *Bus) release() {
+	if !b.driving {
+		return
+	}
+	for _, p := range b.data {
+		p.SetMode(gpio.Input)
+	}
+	b.driving = false
+	if b.dir != nil {
+		b.dir.Write(!b.dirWrite)
+	}
+	delay(b.turnaround)
+}
+
+// spinLimit is the longest delay that is busy-waited, as time.Sleep overshoots
+// short delays by tens of microseconds.
+const spinLimit = time.Millisecond
+
+// delay waits for at least the duration.
+func delay(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if d >= spinLimit {
+		time.Sleep(d)
+		return
+	}
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+var (
+	// ErrInvalidBus indicates the number of data pins is invalid.
+	ErrInvalidBus = errors.New("invalid bus")
+)
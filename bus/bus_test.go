@@ -0,0 +1,144 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package bus_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/bus"
+	"github.com/warthog618/gpio/mock"
+)
+
+func newPins(n int) ([]*mock.Pin, []gpio.Pinner) {
+	pins := make([]*mock.Pin, n)
+	pp := make([]gpio.Pinner, n)
+	for i := range pins {
+		pins[i] = mock.NewPin(i)
+		pp[i] = pins[i]
+	}
+	return pins, pp
+}
+
+func word(pins []*mock.Pin) uint64 {
+	var w uint64
+	for i, p := range pins {
+		if p.Read() {
+			w |= 1 << uint(i)
+		}
+	}
+	return w
+}
+
+func TestNew(t *testing.T) {
+	_, err := bus.New(nil)
+	assert.Equal(t, bus.ErrInvalidBus, err)
+	_, pp := newPins(65)
+	_, err = bus.New(pp)
+	assert.Equal(t, bus.ErrInvalidBus, err)
+
+	pins, pp := newPins(4)
+	strobe := mock.NewPin(10)
+	dir := mock.NewPin(11)
+	b, err := bus.New(pp, bus.WithStrobe(strobe, gpio.Low), bus.WithDirection(dir, gpio.High))
+	require.Nil(t, err)
+	assert.Equal(t, 4, b.Width())
+	for _, p := range pins {
+		assert.Equal(t, gpio.Input, p.Mode())
+	}
+	assert.Equal(t, gpio.Output, strobe.Mode())
+	assert.Equal(t, gpio.High, strobe.Read())
+	assert.Equal(t, gpio.Output, dir.Mode())
+	assert.Equal(t, gpio.Low, dir.Read())
+	b.Close()
+	assert.Equal(t, gpio.Input, strobe.Mode())
+	assert.Equal(t, gpio.Input, dir.Mode())
+}
+
+func TestWriteWord(t *testing.T) {
+	pins, pp := newPins(8)
+	strobe := mock.NewPin(10)
+	dir := mock.NewPin(11)
+	b, err := bus.New(pp,
+		bus.WithStrobe(strobe, gpio.High),
+		bus.WithDirection(dir, gpio.High),
+		bus.WithSetup(10*time.Microsecond),
+		bus.WithStrobeWidth(10*time.Microsecond),
+		bus.WithHold(10*time.Microsecond))
+	require.Nil(t, err)
+	defer b.Close()
+
+	// capture the data, and its direction, on the strobe.
+	var strobed []uint64
+	var driven []bool
+	require.Nil(t, strobe.Watch(gpio.EdgeRising, func(gpio.Pinner) {
+		strobed = append(strobed, word(pins))
+		driven = append(driven, pins[0].Mode() == gpio.Output && dir.Read() == gpio.High)
+	}))
+	// discard the initial call.
+	strobed, driven = nil, nil
+	b.WriteWord(0xa5)
+	b.WriteWord(0x13c)
+	assert.Equal(t, []uint64{0xa5, 0x3c}, strobed)
+	assert.Equal(t, []bool{true, true}, driven)
+	assert.Equal(t, gpio.Low, strobe.Read())
+	for _, p := range pins {
+		assert.Equal(t, gpio.Output, p.Mode())
+	}
+
+	b.Release()
+	for _, p := range pins {
+		assert.Equal(t, gpio.Input, p.Mode())
+	}
+	assert.Equal(t, gpio.Low, dir.Read())
+}
+
+func TestReadWord(t *testing.T) {
+	pins, pp := newPins(4)
+	strobe := mock.NewPin(10)
+	dir := mock.NewPin(11)
+	b, err := bus.New(pp,
+		bus.WithStrobe(strobe, gpio.Low),
+		bus.WithDirection(dir, gpio.High),
+		bus.WithTurnaround(10*time.Microsecond))
+	require.Nil(t, err)
+	defer b.Close()
+
+	// the device drives the bus while the strobe is active.
+	var levels uint64 = 0x9
+	var turned bool
+	require.Nil(t, strobe.Watch(gpio.EdgeBoth, func(gpio.Pinner) {
+		if strobe.Read() == gpio.High {
+			return
+		}
+		turned = pins[0].Mode() == gpio.Input && dir.Read() == gpio.Low
+		for i, p := range pins {
+			p.Set(levels&(1<<uint(i)) != 0)
+		}
+	}))
+	b.WriteWord(0x6)
+	assert.Equal(t, uint64(0x9), b.ReadWord())
+	assert.True(t, turned)
+	assert.Equal(t, gpio.High, strobe.Read())
+
+	levels = 0x6
+	assert.Equal(t, uint64(0x6), b.ReadWord())
+}
+
+func TestNoStrobe(t *testing.T) {
+	pins, pp := newPins(2)
+	b, err := bus.New(pp)
+	require.Nil(t, err)
+	b.WriteWord(0x2)
+	assert.Equal(t, uint64(0x2), word(pins))
+	pins[0].Set(gpio.High)
+	pins[1].Set(gpio.Low)
+	assert.Equal(t, uint64(0x1), b.ReadWord())
+	b.Close()
+}
@@ -0,0 +1,408 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Logic analyzer style capture of pin levels.
+
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Sample is the levels of the captured pins at a point in time.
+type Sample struct {
+	// Time is the time of the sample, relative to the start of the capture.
+	Time time.Duration
+
+	// Levels contains the level of each captured pin, with bit n
+	// corresponding to the nth pin of the capture.
+	Levels uint64
+}
+
+// Level returns the level of the nth pin of the capture in the sample.
+func (s Sample) Level(n int) Level {
+	return s.Levels&(1<<uint(n)) != 0
+}
+
+// Capture samples the levels of a set of pins into a ring buffer, in the
+// manner of a logic analyzer.
+//
+// Sampling is performed by a tight loop reading the level registers, so the
+// sample rate is limited by the CPU and will jitter with system load.
+// Each sample is timestamped so the exported traces reflect the actual
+// sample times.
+type Capture struct {
+	pins []*Pin
+	// the mappings from the level registers, and lines, to the sample bits.
+	banks   []sampleBank
+	lines   []sampleLine
+	period  time.Duration
+	start   *trigger
+	stop    *trigger
+	done    chan struct{}
+	stopped chan struct{}
+	// Guards the following
+	mu      sync.Mutex
+	running bool
+	buf     []Sample
+	head    int
+	count   int
+}
+
+// sampleBank maps the pins in a level register to their bits in a sample.
+type sampleBank struct {
+	reg   int
+	masks []uint32
+	bits  []uint64
+}
+
+// sampleLine maps a line on a character device to its bit in a sample.
+type sampleLine struct {
+	line *line
+	bit  uint64
+}
+
+type trigger struct {
+	pin  int
+	edge Edge
+}
+
+// fired returns true if the trigger pin transitioned between samples.
+func (t *trigger) fired(prev, next uint64) bool {
+	mask := uint64(1) << uint(t.pin)
+	if (prev^next)&mask == 0 {
+		return false
+	}
+	switch t.edge {
+	case EdgeRising:
+		return next&mask != 0
+	case EdgeFalling:
+		return next&mask == 0
+	case EdgeBoth:
+		return true
+	}
+	return false
+}
+
+// CaptureOption defines an option that can be applied when creating a
+// Capture.
+type CaptureOption func(*Capture)
+
+// WithSamplePeriod sets the minimum period between samples.
+//
+// The default is 0, which samples as fast as possible.
+func WithSamplePeriod(period time.Duration) CaptureOption {
+	return func(c *Capture) {
+		c.period = period
+	}
+}
+
+// WithBufferSize sets the number of samples retained by the capture.
+//
+// Once the buffer is full, the oldest samples are overwritten.
+// The default is 65536.
+func WithBufferSize(size int) CaptureOption {
+	return func(c *Capture) {
+		if size > 0 {
+			c.buf = make([]Sample, size)
+		}
+	}
+}
+
+// WithStartTrigger delays recording samples until the given edge is detected
+// on the nth pin of the capture.
+func WithStartTrigger(n int, edge Edge) CaptureOption {
+	return func(c *Capture) {
+		c.start = &trigger{n, edge}
+	}
+}
+
+// WithStopTrigger stops the capture when the given edge is detected on the
+// nth pin of the capture.
+func WithStopTrigger(n int, edge Edge) CaptureOption {
+	return func(c *Capture) {
+		c.stop = &trigger{n, edge}
+	}
+}
+
+// NewCapture creates a Capture of the pins.
+//
+// At most 64 pins can be captured.
+func NewCapture(pins []*Pin, options ...CaptureOption) (*Capture, error) {
+	if len(pins) == 0 || len(pins) > 64 {
+		return nil, ErrInvalidCapture
+	}
+	c := &Capture{pins: pins}
+	for _, option := range options {
+		option(c)
+	}
+	if c.buf == nil {
+		c.buf = make([]Sample, 65536)
+	}
+	for _, t := range []*trigger{c.start, c.stop} {
+		if t != nil && (t.pin < 0 || t.pin >= len(pins)) {
+			return nil, ErrInvalidCapture
+		}
+	}
+	for i, p := range pins {
+		if p == nil {
+			return nil, ErrInvalidCapture
+		}
+		bit := uint64(1) << uint(i)
+		if p.line != nil {
+			c.lines = append(c.lines, sampleLine{p.line, bit})
+			continue
+		}
+		c.addBankPin(p.levelReg, p.mask, bit)
+	}
+	return c, nil
+}
+
+// addBankPin adds a pin to the mapping of its level register.
+func (c *Capture) addBankPin(reg int, mask uint32, bit uint64) {
+	for i := range c.banks {
+		if b := &c.banks[i]; b.reg == reg {
+			b.masks = append(b.masks, mask)
+			b.bits = append(b.bits, bit)
+			return
+		}
+	}
+	c.banks = append(c.banks, sampleBank{reg, []uint32{mask}, []uint64{bit}})
+}
+
+// Start starts capturing samples.
+//
+// Any samples from a previous capture are discarded.
+func (c *Capture) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		return ErrBusy
+	}
+	c.running = true
+	c.head = 0
+	c.count = 0
+	c.done = make(chan struct{})
+	c.stopped = make(chan struct{})
+	go c.run(c.done, c.stopped)
+	return nil
+}
+
+// Stop stops the capture, if it is running.
+func (c *Capture) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	// closed while holding the lock, so concurrent Stops close it once.
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	stopped := c.stopped
+	c.mu.Unlock()
+	<-stopped
+}
+
+// Wait blocks until the capture is stopped, either by Stop or by the stop
+// trigger, or the timeout expires.
+//
+// Returns ErrTimeout if the timeout expires.
+func (c *Capture) Wait(timeout time.Duration) error {
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	if stopped == nil {
+		return nil
+	}
+	select {
+	case <-stopped:
+		return nil
+	case <-time.After(timeout):
+		return ErrTimeout
+	}
+}
+
+// Samples returns the captured samples, oldest first.
+func (c *Capture) Samples() []Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ss := make([]Sample, 0, c.count)
+	first := c.head - c.count
+	if first < 0 {
+		first += len(c.buf)
+	}
+	for i := 0; i < c.count; i++ {
+		ss = append(ss, c.buf[(first+i)%len(c.buf)])
+	}
+	return ss
+}
+
+func (c *Capture) run(done, stopped chan struct{}) {
+	defer func() {
+		c.mu.Lock()
+		c.running = false
+		c.mu.Unlock()
+		close(stopped)
+	}()
+	armed := c.start == nil
+	prev := c.sample()
+	start := time.Now()
+	last := start
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if c.period > 0 {
+			for time.Since(last) < c.period {
+			}
+		}
+		now := time.Now()
+		next := c.sample()
+		last = now
+		if !armed {
+			if !c.start.fired(prev, next) {
+				prev = next
+				continue
+			}
+			armed = true
+			start = now
+		}
+		c.mu.Lock()
+		c.buf[c.head] = Sample{now.Sub(start), next}
+		c.head = (c.head + 1) % len(c.buf)
+		if c.count < len(c.buf) {
+			c.count++
+		}
+		c.mu.Unlock()
+		if c.stop != nil && c.stop.fired(prev, next) {
+			return
+		}
+		prev = next
+	}
+}
+
+// sample reads the levels of the pins.
+//
+// The level registers are read directly, rather than via Read, to minimise
+// the time taken and to avoid altering the pin shadows.  Each level register
+// is read once per sample, so the pins in a bank are sampled together, while
+// lines on a character device are read individually.
+func (c *Capture) sample() uint64 {
+	var levels uint64
+	for i := range c.banks {
+		b := &c.banks[i]
+		l := mem[b.reg]
+		for j, mask := range b.masks {
+			if l&mask != 0 {
+				levels |= b.bits[j]
+			}
+		}
+	}
+	for _, sl := range c.lines {
+		if sl.line.read() {
+			levels |= sl.bit
+		}
+	}
+	return levels
+}
+
+// pinName returns the name used for the pin in exported traces.
+func pinName(p *Pin) string {
+	return fmt.Sprintf("GPIO%d", p.pin)
+}
+
+// WriteVCD writes the captured samples to w in Value Change Dump format, as
+// used by PulseView and GTKWave.
+func (c *Capture) WriteVCD(w io.Writer) error {
+	ss := c.Samples()
+	ew := &errWriter{w: w}
+	ew.printf("$timescale 1ns $end\n")
+	ew.printf("$scope module gpio $end\n")
+	for i, p := range c.pins {
+		ew.printf("$var wire 1 %c %s $end\n", vcdID(i), pinName(p))
+	}
+	ew.printf("$upscope $end\n$enddefinitions $end\n")
+	var prev uint64
+	for n, s := range ss {
+		changed := s.Levels ^ prev
+		if n != 0 && changed == 0 {
+			continue
+		}
+		ew.printf("#%d\n", s.Time.Nanoseconds())
+		if n == 0 {
+			ew.printf("$dumpvars\n")
+		}
+		for i := range c.pins {
+			if n == 0 || changed&(1<<uint(i)) != 0 {
+				v := 0
+				if s.Level(i) {
+					v = 1
+				}
+				ew.printf("%d%c\n", v, vcdID(i))
+			}
+		}
+		if n == 0 {
+			ew.printf("$end\n")
+		}
+		prev = s.Levels
+	}
+	return ew.err
+}
+
+// vcdID returns the VCD identifier code for the nth pin.
+func vcdID(n int) rune {
+	return rune('!' + n)
+}
+
+// WriteCSV writes the captured samples to w as comma separated values, with
+// the sample time in nanoseconds followed by the level of each pin.
+func (c *Capture) WriteCSV(w io.Writer) error {
+	ss := c.Samples()
+	ew := &errWriter{w: w}
+	ew.printf("time")
+	for _, p := range c.pins {
+		ew.printf(",%s", pinName(p))
+	}
+	ew.printf("\n")
+	for _, s := range ss {
+		ew.printf("%d", s.Time.Nanoseconds())
+		for i := range c.pins {
+			v := 0
+			if s.Level(i) {
+				v = 1
+			}
+			ew.printf(",%d", v)
+		}
+		ew.printf("\n")
+	}
+	return ew.err
+}
+
+// errWriter latches the first error from a sequence of writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, a ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, a...)
+}
+
+var (
+	// ErrInvalidCapture indicates the capture pins or triggers are invalid.
+	ErrInvalidCapture = errors.New("invalid capture")
+)
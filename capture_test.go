@@ -0,0 +1,96 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//
+//  Test suite for capture module.
+//
+//	Tests use J8 pins 15 and 16 (for looped tests)
+//
+package gpio_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+func TestNewCaptureInvalid(t *testing.T) {
+	c, err := gpio.NewCapture(nil)
+	assert.Equal(t, gpio.ErrInvalidCapture, err)
+	assert.Nil(t, c)
+	c, err = gpio.NewCapture(make([]*gpio.Pin, 65))
+	assert.Equal(t, gpio.ErrInvalidCapture, err)
+	assert.Nil(t, c)
+	c, err = gpio.NewCapture(make([]*gpio.Pin, 1),
+		gpio.WithStopTrigger(1, gpio.EdgeBoth))
+	assert.Equal(t, gpio.ErrInvalidCapture, err)
+	assert.Nil(t, c)
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestCaptureLooped(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinIn, err := gpio.NewPin(gpio.J8p15, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	c, err := gpio.NewCapture([]*gpio.Pin{pinIn},
+		gpio.WithBufferSize(1024),
+		gpio.WithStartTrigger(0, gpio.EdgeRising),
+		gpio.WithStopTrigger(0, gpio.EdgeFalling))
+	assert.Nil(t, err)
+	assert.Nil(t, c.Start())
+	assert.Equal(t, gpio.ErrBusy, c.Start())
+	time.Sleep(time.Millisecond)
+	pinOut.High()
+	time.Sleep(time.Millisecond)
+	pinOut.Low()
+	assert.Nil(t, c.Wait(10*time.Millisecond))
+	ss := c.Samples()
+	if assert.True(t, len(ss) > 1) {
+		assert.Equal(t, gpio.High, ss[0].Level(0))
+		assert.Equal(t, time.Duration(0), ss[0].Time)
+		assert.Equal(t, gpio.Low, ss[len(ss)-1].Level(0))
+	}
+	var vcd bytes.Buffer
+	assert.Nil(t, c.WriteVCD(&vcd))
+	assert.True(t, strings.HasPrefix(vcd.String(), "$timescale 1ns $end\n"))
+	assert.Contains(t, vcd.String(), "$var wire 1 ! GPIO22 $end\n")
+	assert.Contains(t, vcd.String(), "$dumpvars\n1!\n$end\n")
+	var csv bytes.Buffer
+	assert.Nil(t, c.WriteCSV(&csv))
+	assert.True(t, strings.HasPrefix(csv.String(), "time,GPIO22\n0,1\n"))
+}
+
+func TestCaptureConcurrentStop(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pin, err := gpio.NewPin(gpio.J8p15, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	c, err := gpio.NewCapture([]*gpio.Pin{pin}, gpio.WithBufferSize(16))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, c.Start())
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Stop()
+			}()
+		}
+		wg.Wait()
+		assert.Nil(t, c.Wait(time.Second))
+	}
+}
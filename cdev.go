@@ -0,0 +1,579 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Access to GPIO lines via the GPIO character device.
+//
+// This uses the v1 GPIO uAPI.  Bias flags and line reconfiguration require
+// Linux v5.5 or later.
+
+// +build linux
+
+package gpio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Request flags, from linux/gpio.h
+const (
+	handleRequestInput       = 1 << 0
+	handleRequestOutput      = 1 << 1
+	handleRequestOpenDrain   = 1 << 3
+	handleRequestOpenSource  = 1 << 4
+	handleRequestPullUp      = 1 << 5
+	handleRequestPullDown    = 1 << 6
+	handleRequestBiasDisable = 1 << 7
+
+	handleRequestDirectionMask = handleRequestInput | handleRequestOutput
+	handleRequestDriveMask     = handleRequestOpenDrain | handleRequestOpenSource
+	handleRequestBiasMask      = handleRequestPullUp | handleRequestPullDown | handleRequestBiasDisable
+)
+
+// Line info flags, from linux/gpio.h
+const (
+	lineFlagKernel      = 1 << 0
+	lineFlagIsOut       = 1 << 1
+	lineFlagOpenDrain   = 1 << 3
+	lineFlagOpenSource  = 1 << 4
+	lineFlagPullUp      = 1 << 5
+	lineFlagPullDown    = 1 << 6
+	lineFlagBiasDisable = 1 << 7
+)
+
+// Event request flags, from linux/gpio.h
+const (
+	eventRequestRisingEdge  = 1 << 0
+	eventRequestFallingEdge = 1 << 1
+	eventRequestBothEdges   = eventRequestRisingEdge | eventRequestFallingEdge
+
+	// event IDs
+	eventRisingEdge  = 0x01
+	eventFallingEdge = 0x02
+)
+
+const (
+	consumerLabel = "gpio"
+
+	// the maximum number of events read from an event request at once.
+	maxEvents = 16
+)
+
+type chipInfo struct {
+	Name  [32]byte
+	Label [32]byte
+	Lines uint32
+}
+
+type lineInfo struct {
+	Offset   uint32
+	Flags    uint32
+	Name     [32]byte
+	Consumer [32]byte
+}
+
+type handleRequest struct {
+	Offsets       [64]uint32
+	Flags         uint32
+	DefaultValues [64]uint8
+	Consumer      [32]byte
+	Lines         uint32
+	Fd            int32
+}
+
+type handleConfig struct {
+	Flags         uint32
+	DefaultValues [64]uint8
+	Padding       [4]uint32
+}
+
+type handleData struct {
+	Values [64]uint8
+}
+
+type eventRequest struct {
+	Offset      uint32
+	HandleFlags uint32
+	EventFlags  uint32
+	Consumer    [32]byte
+	Fd          int32
+}
+
+type eventData struct {
+	Timestamp uint64
+	ID        uint32
+	_         uint32
+}
+
+func ior(nr, size uintptr) uintptr {
+	return (2 << 30) | (size << 16) | (0xB4 << 8) | nr
+}
+
+func iorw(nr, size uintptr) uintptr {
+	return (3 << 30) | (size << 16) | (0xB4 << 8) | nr
+}
+
+var (
+	getChipInfoIoctl   = ior(0x01, unsafe.Sizeof(chipInfo{}))
+	getLineInfoIoctl   = iorw(0x02, unsafe.Sizeof(lineInfo{}))
+	getLineHandleIoctl = iorw(0x03, unsafe.Sizeof(handleRequest{}))
+	getLineEventIoctl  = iorw(0x04, unsafe.Sizeof(eventRequest{}))
+	getLineValuesIoctl = iorw(0x08, unsafe.Sizeof(handleData{}))
+	setLineValuesIoctl = iorw(0x09, unsafe.Sizeof(handleData{}))
+	setLineConfigIoctl = iorw(0x0a, unsafe.Sizeof(handleConfig{}))
+	eventDataSize      = int(unsafe.Sizeof(eventData{}))
+)
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// charDev is an open GPIO character device.
+type charDev struct {
+	// Guards requested
+	mu    sync.Mutex
+	fd    int
+	name  string
+	label string
+	// the number of lines on the chip
+	lines int
+	// the lines currently requested from the chip, by offset.
+	requested map[int]*line
+}
+
+func openCharDev(chip string) (*charDev, error) {
+	path := chip
+	if !strings.HasPrefix(path, "/") {
+		path = "/dev/" + path
+	}
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	var ci chipInfo
+	if err = ioctl(fd, getChipInfoIoctl, unsafe.Pointer(&ci)); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return &charDev{
+		fd:        fd,
+		name:      cstring(ci.Name[:]),
+		label:     cstring(ci.Label[:]),
+		lines:     int(ci.Lines),
+		requested: make(map[int]*line),
+	}, nil
+}
+
+// findCharDev opens the character device identified by name, path or label.
+func findCharDev(id string) (*charDev, error) {
+	c, err := openCharDev(id)
+	if err == nil {
+		return c, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	paths, _ := filepath.Glob("/dev/gpiochip*")
+	for _, path := range paths {
+		c, err := openCharDev(path)
+		if err != nil {
+			continue
+		}
+		if c.label == id {
+			return c, nil
+		}
+		c.close()
+	}
+	return nil, ErrUnknownChip
+}
+
+// matches returns true if the chip is identified by id.
+func (c *charDev) matches(id string) bool {
+	return id == c.name || id == c.label || id == "/dev/"+c.name
+}
+
+func (c *charDev) close() error {
+	c.mu.Lock()
+	for _, l := range c.requested {
+		l.close()
+	}
+	c.requested = nil
+	c.mu.Unlock()
+	return unix.Close(c.fd)
+}
+
+// readRequested returns the levels of the requested lines, with bit n
+// corresponding to line offset n.  Lines that have not been requested, or
+// that are beyond bit 63, read as Low.
+func (c *charDev) readRequested() uint64 {
+	c.mu.Lock()
+	ll := make([]*line, 0, len(c.requested))
+	for _, l := range c.requested {
+		ll = append(ll, l)
+	}
+	c.mu.Unlock()
+	var levels uint64
+	for _, l := range ll {
+		if l.offset < 64 && l.read() {
+			levels |= 1 << uint(l.offset)
+		}
+	}
+	return levels
+}
+
+// chipset infers the chipset from the chip label.
+func (c *charDev) chipset() Chipset {
+	switch c.label {
+	case "pinctrl-bcm2835":
+		return BCM2835
+	case "pinctrl-bcm2711":
+		return BCM2711
+	}
+	return 0
+}
+
+func (c *charDev) lineInfo(offset int) (li lineInfo, err error) {
+	li.Offset = uint32(offset)
+	err = ioctl(c.fd, getLineInfoIoctl, unsafe.Pointer(&li))
+	return
+}
+
+// requestLine requests the line from the chip, leaving the line in its
+// current configuration.
+//
+// Lines remain requested until the chip is closed, so subsequent requests for
+// the same line return the existing line.
+func (c *charDev) requestLine(offset int) (*line, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.requested[offset]; ok {
+		return l, nil
+	}
+	li, err := c.lineInfo(offset)
+	if err != nil {
+		return nil, err
+	}
+	var drive uint32
+	switch {
+	case li.Flags&lineFlagOpenDrain != 0:
+		drive = handleRequestOpenDrain
+	case li.Flags&lineFlagOpenSource != 0:
+		drive = handleRequestOpenSource
+	}
+	flags := uint32(handleRequestInput)
+	if li.Flags&lineFlagIsOut != 0 {
+		flags = handleRequestOutput | drive
+	}
+	switch {
+	case li.Flags&lineFlagPullUp != 0:
+		flags |= handleRequestPullUp
+	case li.Flags&lineFlagPullDown != 0:
+		flags |= handleRequestPullDown
+	case li.Flags&lineFlagBiasDisable != 0:
+		flags |= handleRequestBiasDisable
+	}
+	// request as-is to avoid glitching the line.
+	fd, err := c.requestHandle(offset, 0, Low)
+	if err != nil {
+		return nil, err
+	}
+	l := &line{chip: c, offset: offset, fd: fd, flags: flags, drive: drive}
+	c.requested[offset] = l
+	return l, nil
+}
+
+// requestHandle requests a line handle from the chip.
+//
+// Returns an fd of -1 on error, so a failed request is never mistaken for a
+// valid fd.
+func (c *charDev) requestHandle(offset int, flags uint32, level Level) (int, error) {
+	hr := handleRequest{Flags: flags, Lines: 1}
+	hr.Offsets[0] = uint32(offset)
+	if level == High {
+		hr.DefaultValues[0] = 1
+	}
+	copy(hr.Consumer[:], consumerLabel)
+	if err := ioctl(c.fd, getLineHandleIoctl, unsafe.Pointer(&hr)); err != nil {
+		return -1, err
+	}
+	return int(hr.Fd), nil
+}
+
+func (c *charDev) requestEvent(offset int, flags uint32, edge Edge) (int, error) {
+	er := eventRequest{Offset: uint32(offset), HandleFlags: flags}
+	switch edge {
+	case EdgeRising:
+		er.EventFlags = eventRequestRisingEdge
+	case EdgeFalling:
+		er.EventFlags = eventRequestFallingEdge
+	default:
+		er.EventFlags = eventRequestBothEdges
+	}
+	copy(er.Consumer[:], consumerLabel)
+	if err := ioctl(c.fd, getLineEventIoctl, unsafe.Pointer(&er)); err != nil {
+		return -1, err
+	}
+	return int(er.Fd), nil
+}
+
+// line is a GPIO line requested from the character device.
+type line struct {
+	// Guards the following
+	mu     sync.Mutex
+	chip   *charDev
+	offset int
+	// fd of the line handle or event request, or -1 if the line could not
+	// be re-requested.
+	fd int
+	// the flags defining the direction, drive and bias of the line.
+	flags uint32
+	// the drive flags applied when the line is an output.
+	drive uint32
+	// true while the line is requested for edge events.
+	watched bool
+}
+
+func (l *line) mode() Mode {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.flags&handleRequestOutput != 0 {
+		return Output
+	}
+	return Input
+}
+
+func (l *line) driveMode() Drive {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch l.drive {
+	case handleRequestOpenDrain:
+		return DriveOpenDrain
+	case handleRequestOpenSource:
+		return DriveOpenSource
+	}
+	return DrivePushPull
+}
+
+func (l *line) read() Level {
+	var hd handleData
+	l.mu.Lock()
+	ioctl(l.fd, getLineValuesIoctl, unsafe.Pointer(&hd))
+	l.mu.Unlock()
+	return hd.Values[0] != 0
+}
+
+func (l *line) write(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.flags&handleRequestOutput == 0 {
+		// the level is applied when the line becomes an output.
+		return
+	}
+	var hd handleData
+	if level == High {
+		hd.Values[0] = 1
+	}
+	ioctl(l.fd, setLineValuesIoctl, unsafe.Pointer(&hd))
+}
+
+// setMode sets the direction of the line.
+//
+// Only Input and Output are supported by the character device, so other modes
+// are ignored.
+func (l *line) setMode(mode Mode, level Level) {
+	var dir uint32
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch mode {
+	case Input:
+		dir = handleRequestInput
+	case Output:
+		dir = handleRequestOutput | l.drive
+	default:
+		return
+	}
+	l.reconfigure(l.flags&^(handleRequestDirectionMask|handleRequestDriveMask)|dir, level)
+}
+
+// setDrive sets the drive flags of the line.
+//
+// The drive flags are only applied while the line is an output.
+func (l *line) setDrive(drive Drive, level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch drive {
+	case DriveOpenDrain:
+		l.drive = handleRequestOpenDrain
+	case DriveOpenSource:
+		l.drive = handleRequestOpenSource
+	default:
+		l.drive = 0
+	}
+	if l.flags&handleRequestOutput != 0 {
+		l.reconfigure(l.flags&^handleRequestDriveMask|l.drive, level)
+	}
+}
+
+// setPull sets the bias flags of the line.
+func (l *line) setPull(pull Pull, level Level) {
+	var bias uint32
+	switch pull {
+	case PullUp:
+		bias = handleRequestPullUp
+	case PullDown:
+		bias = handleRequestPullDown
+	default:
+		bias = handleRequestBiasDisable
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reconfigure(l.flags&^handleRequestBiasMask|bias, level)
+}
+
+// reconfigure applies the flags to the line request.
+//
+// If the kernel does not support reconfiguration then the line is re-requested.
+// If that fails then the line is re-requested with its previous flags, so it
+// remains held in its previous configuration.
+// While the line is watched the flags are recorded and applied when the watch
+// is removed.
+//
+// Assumes the caller holds the mu lock.
+func (l *line) reconfigure(flags uint32, level Level) {
+	old := l.flags
+	l.flags = flags
+	if l.watched {
+		return
+	}
+	hc := handleConfig{Flags: flags}
+	if level == High {
+		hc.DefaultValues[0] = 1
+	}
+	if ioctl(l.fd, setLineConfigIoctl, unsafe.Pointer(&hc)) == nil {
+		return
+	}
+	l.closeFd()
+	fd, err := l.chip.requestHandle(l.offset, flags, level)
+	if err != nil {
+		logWarn("line reconfiguration failed", "offset", l.offset, "err", err)
+		l.flags = old
+		fd, err = l.chip.requestHandle(l.offset, old, level)
+		if err != nil {
+			logError("line lost", "offset", l.offset, "err", err)
+		}
+	}
+	l.fd = fd
+}
+
+// watch replaces the line handle with an event request.
+//
+// The line is forced to be an input.  If the event request fails then the
+// line handle is re-requested with the original flags and the level.
+func (l *line) watch(edge Edge, level Level) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	flags := l.flags&^(handleRequestDirectionMask|handleRequestDriveMask) | handleRequestInput
+	l.closeFd()
+	fd, err := l.chip.requestEvent(l.offset, flags, edge)
+	if err != nil {
+		var rerr error
+		if l.fd, rerr = l.chip.requestHandle(l.offset, l.flags, level); rerr != nil {
+			logError("line lost", "offset", l.offset, "err", rerr)
+		}
+		return 0, err
+	}
+	l.flags = flags
+	l.fd = fd
+	l.watched = true
+	return fd, nil
+}
+
+// unwatch replaces the event request with a line handle.
+func (l *line) unwatch(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.watched {
+		return
+	}
+	l.closeFd()
+	var err error
+	if l.fd, err = l.chip.requestHandle(l.offset, l.flags, level); err != nil {
+		logError("line lost", "offset", l.offset, "err", err)
+	}
+	l.watched = false
+}
+
+// readEvents drains the pending events from the line, and returns the kernel
+// timestamp of the most recent, or 0 if there were none, and the number of
+// events read.
+//
+// If each is not nil then it is called for each event, in order, after the
+// events have been read, so each may access the line.
+func (l *line) readEvents(each func(eventData)) (ts uint64, count int) {
+	buf := make([]byte, eventDataSize*maxEvents)
+	var events []eventData
+	l.mu.Lock()
+	for {
+		n, err := unix.Read(l.fd, buf)
+		if err == nil && n >= eventDataSize {
+			count += n / eventDataSize
+			for off := 0; off+eventDataSize <= n; off += eventDataSize {
+				ed := *(*eventData)(unsafe.Pointer(&buf[off]))
+				ts = ed.Timestamp
+				if each != nil {
+					events = append(events, ed)
+				}
+			}
+		}
+		if err != nil || n < len(buf) {
+			break
+		}
+	}
+	l.mu.Unlock()
+	for _, ed := range events {
+		each(ed)
+	}
+	return
+}
+
+func (l *line) close() {
+	l.mu.Lock()
+	l.closeFd()
+	l.mu.Unlock()
+}
+
+// closeFd closes the fd of the line, if any.
+//
+// Assumes the caller holds the mu lock.
+func (l *line) closeFd() {
+	if l.fd >= 0 {
+		unix.Close(l.fd)
+	}
+	l.fd = -1
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+var (
+	// ErrUnknownChip indicates no GPIO chip matches the name or label.
+	ErrUnknownChip = errors.New("unknown chip")
+)
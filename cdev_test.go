@@ -0,0 +1,195 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//
+//  Test suite for the character device backend.
+//
+//	Tests use J8 pins 7 (mostly) and 15 and 16 (for looped tests), on gpiochip0.
+//
+package gpio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+func setupCharDev(t *testing.T) {
+	assert.Nil(t, gpio.Open(gpio.WithCharDev("gpiochip0")))
+}
+
+func TestCharDevOpen(t *testing.T) {
+	setupCharDev(t)
+	assert.NotNil(t, gpio.Open(gpio.WithCharDev("gpiochip0")))
+	assert.NotNil(t, gpio.Open())
+	gpio.Close()
+	assert.NotNil(t, gpio.Open(gpio.WithCharDev("nonexistent")))
+}
+
+func TestCharDevNew(t *testing.T) {
+	setupCharDev(t)
+	defer teardownDIO()
+	pin, err := gpio.NewPin(-1)
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+	assert.Nil(t, pin)
+	pin, err = gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.J8p7, pin.Pin())
+	// repeated requests for the same line share the line request.
+	pin, err = gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
+	assert.NotNil(t, pin)
+}
+
+func TestCharDevPull(t *testing.T) {
+	setupCharDev(t)
+	defer teardownDIO()
+	pin, err := gpio.NewPin(gpio.J8p7, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	defer pin.PullUp()
+	pullSettle := time.Microsecond
+	pin.PullDown()
+	time.Sleep(pullSettle)
+	assert.Equal(t, gpio.Low, pin.Read())
+	pin.PullUp()
+	time.Sleep(pullSettle)
+	assert.Equal(t, gpio.High, pin.Read())
+	pin.SetPull(gpio.PullDown)
+	time.Sleep(pullSettle)
+	assert.Equal(t, gpio.Low, pin.Read())
+	pin.PullNone()
+}
+
+func TestCharDevMode(t *testing.T) {
+	setupCharDev(t)
+	defer teardownDIO()
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.Input, pin.Mode())
+	pin.Output(gpio.Low)
+	assert.Equal(t, gpio.Output, pin.Mode())
+	pin.Input()
+	assert.Equal(t, gpio.Input, pin.Mode())
+	// Alt modes are not supported, and so are ignored.
+	pin.SetMode(gpio.Alt0)
+	assert.Equal(t, gpio.Input, pin.Mode())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestCharDevWriteLooped(t *testing.T) {
+	setupCharDev(t)
+	defer teardownDIO()
+	pinIn, err := gpio.NewPin(gpio.J8p15, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithInitialLevel(gpio.High),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	assert.Equal(t, gpio.High, pinIn.Read())
+	pinOut.Low()
+	assert.Equal(t, gpio.Low, pinIn.Read())
+	pinOut.Toggle()
+	assert.Equal(t, gpio.High, pinIn.Read())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestCharDevDriveLooped(t *testing.T) {
+	setupCharDev(t)
+	defer teardownDIO()
+	pinIn, err := gpio.NewPin(gpio.J8p15,
+		gpio.WithMode(gpio.Input),
+		gpio.WithPull(gpio.PullUp))
+	assert.Nil(t, err)
+	defer pinIn.PullDown()
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithDrive(gpio.DriveOpenDrain),
+		gpio.WithInitialLevel(gpio.High),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	assert.Equal(t, gpio.DriveOpenDrain, pinOut.Drive())
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.High, pinIn.Read())
+	pinOut.Low()
+	assert.Equal(t, gpio.Low, pinIn.Read())
+	pinOut.High()
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.High, pinIn.Read())
+
+	pinIn.PullDown()
+	pinOut.SetDrive(gpio.DriveOpenSource)
+	pinOut.Low()
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.Low, pinIn.Read())
+	pinOut.High()
+	assert.Equal(t, gpio.High, pinIn.Read())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestCharDevWatchLooped(t *testing.T) {
+	setupCharDev(t)
+	defer teardownDIO()
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	pinIn, err := gpio.NewPin(gpio.J8p15, gpio.WithPull(gpio.PullDown))
+	assert.Nil(t, err)
+	ich := make(chan gpio.Level, 3)
+	assert.Nil(t, pinIn.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		ich <- pin.Read()
+	}))
+	assert.Equal(t, gpio.ErrBusy, pinIn.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {}))
+	for i, expected := range []gpio.Level{gpio.Low, gpio.High, gpio.Low} {
+		if i > 0 {
+			pinOut.Toggle()
+		}
+		select {
+		case v := <-ich:
+			assert.Equal(t, expected, v)
+		case <-time.After(10 * time.Millisecond):
+			t.Error("missed interrupt, expected", expected)
+		}
+	}
+	pinIn.Unwatch()
+	pinOut.Toggle()
+	select {
+	case <-ich:
+		t.Error("interrupt after unwatch")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestChips(t *testing.T) {
+	_, err := gpio.FindLine("nonexistent")
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+
+	cc, err := gpio.Chips()
+	assert.Nil(t, err)
+	if len(cc) == 0 {
+		t.Skip("no GPIO chips")
+	}
+	assert.Equal(t, "gpiochip0", cc[0].Name)
+	assert.NotZero(t, cc[0].Lines)
+}
+
+func TestLinePin(t *testing.T) {
+	// lines are available with either backend.
+	assert.Nil(t, gpio.Open())
+	defer teardownDIO()
+	pin, err := gpio.Line{Chip: "gpiochip0", Offset: gpio.J8p7}.Pin(gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	if assert.NotNil(t, pin) {
+		assert.Equal(t, gpio.J8p7, pin.Pin())
+	}
+	_, err = gpio.Line{Chip: "gpiochip0", Offset: -1}.Pin()
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+	_, err = gpio.Line{Chip: "nonexistent"}.Pin()
+	assert.Equal(t, gpio.ErrUnknownChip, err)
+}
@@ -0,0 +1,109 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Enumeration of GPIO chips and lines.
+
+package gpio
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChipInfo describes a GPIO chip.
+type ChipInfo struct {
+	// Name is the name of the chip, e.g. "gpiochip0".
+	Name string
+
+	// Label is the label of the chip, e.g. "pinctrl-bcm2711" or
+	// "raspberrypi-exp-gpio".
+	Label string
+
+	// Lines is the number of lines on the chip.
+	Lines int
+}
+
+// Chips returns the GPIO chips available on the system, ordered by name.
+//
+// This includes the chips providing lines beyond the header, such as the
+// firmware expander controlling the activity LED on the Pi 3 and 4, and
+// chips provided by HAT drivers.
+//
+// This does not require the package to be opened.
+func Chips() ([]ChipInfo, error) {
+	paths, err := filepath.Glob("/dev/gpiochip*")
+	if err != nil {
+		return nil, err
+	}
+	var cc []ChipInfo
+	for _, path := range paths {
+		c, err := openCharDev(path)
+		if err != nil {
+			return nil, err
+		}
+		cc = append(cc, ChipInfo{Name: c.name, Label: c.label, Lines: c.lines})
+		c.close()
+	}
+	sort.Slice(cc, func(i, j int) bool {
+		return chipNumber(cc[i].Name) < chipNumber(cc[j].Name)
+	})
+	return cc, nil
+}
+
+// chipNumber returns the number of a chip from its name, so gpiochip10 sorts
+// after gpiochip2.
+func chipNumber(name string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(name, "gpiochip"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// FindLine returns the line with the given name, e.g. "ACT_LED" or
+// "GLOBAL_RESET", searching all chips.
+//
+// Line names are assigned by the device tree, and are not available on all
+// kernels.
+//
+// This does not require the package to be opened.
+func FindLine(name string) (Line, error) {
+	cc, err := Chips()
+	if err != nil {
+		return Line{}, err
+	}
+	for _, ci := range cc {
+		c, err := openCharDev(ci.Name)
+		if err != nil {
+			return Line{}, err
+		}
+		for offset := 0; offset < c.lines; offset++ {
+			li, err := c.lineInfo(offset)
+			if err == nil && cstring(li.Name[:]) == name {
+				c.close()
+				return Line{Chip: ci.Name, Offset: offset}, nil
+			}
+		}
+		c.close()
+	}
+	return Line{}, ErrInvalidPin
+}
+
+// Pin creates a Pin for the line.
+//
+// The line is accessed via the character device, whichever backend the
+// package was opened with, so lines on chips other than the header, such as
+// the activity LED on the firmware expander, can be used alongside header pins
+// accessed via /dev/gpiomem.  The chip providing the line is opened as
+// required.
+func (l Line) Pin(options ...PinOption) (*Pin, error) {
+	c, err := getCharDev(l.Chip)
+	if err != nil {
+		return nil, err
+	}
+	return newLinePin(c, l.Offset, options)
+}
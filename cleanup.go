@@ -0,0 +1,139 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Cleanup of pins on termination signals.
+
+package gpio
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// CleanupOption defines an option that can be applied to CleanupOnSignal.
+type CleanupOption func(*cleanupConfig)
+
+type cleanupConfig struct {
+	signals []os.Signal
+	restore bool
+}
+
+// WithSignals sets the signals that trigger the cleanup.
+//
+// The default is SIGINT and SIGTERM.
+func WithSignals(signals ...os.Signal) CleanupOption {
+	return func(c *cleanupConfig) {
+		c.signals = signals
+	}
+}
+
+// WithRestore records the mode and level of the header pins when
+// CleanupOnSignal is called, and restores them during the cleanup, so outputs
+// are not left driving whatever was last written.
+//
+// This is only supported when the GPIO registers are memory mapped.
+func WithRestore() CleanupOption {
+	return func(c *cleanupConfig) {
+		c.restore = true
+	}
+}
+
+// CleanupOnSignal installs a handler that cleans up when the process receives
+// a termination signal, by default SIGINT or SIGTERM.
+//
+// The cleanup removes all watches, restores the state of the pins if
+// WithRestore is provided, and closes the package, as per Close.  The signal
+// is then raised again, with the handler removed, so the process terminates as
+// it would have without the handler, or the signal is delivered to any other
+// handler installed by the application.
+//
+// The package must be opened before calling CleanupOnSignal.  The returned
+// function removes the handler, without cleaning up.
+func CleanupOnSignal(options ...CleanupOption) (stop func()) {
+	cfg := cleanupConfig{signals: []os.Signal{syscall.SIGINT, syscall.SIGTERM}}
+	for _, option := range options {
+		option(&cfg)
+	}
+	var state []pinState
+	if cfg.restore {
+		state = snapshot()
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, cfg.signals...)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigs:
+			logInfo("cleaning up on signal", "signal", sig)
+			restore(state)
+			if err := Close(); err != nil {
+				logWarn("cleanup failed", "err", err)
+			}
+			signal.Stop(sigs)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(sig)
+			}
+		case <-done:
+			signal.Stop(sigs)
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// pinState is the recorded state of a pin.
+type pinState struct {
+	pin   int
+	mode  Mode
+	level Level
+}
+
+// snapshot records the state of the header pins, if the GPIO registers are
+// mapped.
+func snapshot() []pinState {
+	memlock.Lock()
+	defer memlock.Unlock()
+	if len(mem) == 0 {
+		return nil
+	}
+	n := maxPin()
+	state := make([]pinState, n)
+	for pin := 0; pin < n; pin++ {
+		state[pin] = pinState{
+			pin:   pin,
+			mode:  Mode((mem[pin/10] >> (uint(pin%10) * 3)) & modeMask),
+			level: mem[13+pin/32]&(1<<uint(pin&0x1f)) != 0,
+		}
+	}
+	return state
+}
+
+// restore restores the recorded state of the pins.
+//
+// The levels are restored before the modes, so restored outputs do not
+// glitch.
+func restore(state []pinState) {
+	memlock.Lock()
+	defer memlock.Unlock()
+	if len(mem) == 0 {
+		return
+	}
+	for _, s := range state {
+		mask := uint32(1) << uint(s.pin&0x1f)
+		if s.level {
+			mem[7+s.pin/32] = mask
+		} else {
+			mem[10+s.pin/32] = mask
+		}
+		shift := uint(s.pin%10) * 3
+		mem[s.pin/10] = mem[s.pin/10]&^(modeMask<<shift) | uint32(s.mode)<<shift
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	assert.Nil(t, snapshot())
+
+	old := mem
+	mem = make([]uint32, memLength/4)
+	defer func() {
+		mem = old
+	}()
+	// pin 4 output high, pin 17 alt0.
+	mem[0] = uint32(Output) << 12
+	mem[1] = uint32(Alt0) << 21
+	mem[13] = 1 << 4
+	state := snapshot()
+	assert.Len(t, state, maxPin())
+	assert.Equal(t, pinState{pin: 4, mode: Output, level: High}, state[4])
+	assert.Equal(t, pinState{pin: 17, mode: Alt0, level: Low}, state[17])
+	assert.Equal(t, pinState{pin: 5, mode: Input, level: Low}, state[5])
+
+	// subsequently changed
+	mem[0] = uint32(Output) << 15
+	mem[1] = 0
+	restore(state)
+	assert.Equal(t, uint32(Output)<<12, mem[0])
+	assert.Equal(t, uint32(Alt0)<<21, mem[1])
+	// the set register holds the last high pin, and the clear register the
+	// last low pin.
+	assert.Equal(t, uint32(1<<4), mem[7])
+	assert.Equal(t, uint32(1)<<uint(maxPin()-1), mem[10])
+}
+
+func TestCleanupOnSignalStop(t *testing.T) {
+	stop := CleanupOnSignal(WithRestore())
+	stop()
+	stop()
+}
@@ -0,0 +1,309 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// General purpose clock outputs.
+
+// +build linux
+
+package gpio
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ClockSource identifies the source of a general purpose clock.
+type ClockSource int
+
+// Clock sources, with values matching the CM_GPxCTL SRC field.
+const (
+	// ClockGround stops the clock.
+	ClockGround ClockSource = 0
+
+	// ClockOscillator is the crystal oscillator, 19.2MHz on the BCM2835
+	// family and 54MHz on the BCM2711.
+	ClockOscillator ClockSource = 1
+
+	// ClockPLLC is PLLC, which is also used by the core, so its frequency
+	// varies with the core clock.
+	ClockPLLC ClockSource = 5
+
+	// ClockPLLD is PLLD, 500MHz on the BCM2835 family and 750MHz on the
+	// BCM2711.
+	ClockPLLD ClockSource = 6
+
+	// ClockHDMI is the HDMI auxiliary clock, 216MHz.
+	ClockHDMI ClockSource = 7
+)
+
+const (
+	// offset of the clock manager from the peripheral base.
+	clockManagerOffset = 0x101000
+
+	clkPasswd = 0x5a000000
+	clkEnab   = 1 << 4
+	clkKill   = 1 << 5
+	clkBusy   = 1 << 7
+
+	clkMaxDivi = 0xfff
+)
+
+var (
+	// Guards clkMem
+	clkLock sync.Mutex
+	clkMem  []uint32
+	clkMem8 []uint8
+)
+
+// Clock is a general purpose clock (GPCLK) output on a pin.
+//
+// The clocks are generated by the clock manager peripheral, and so are
+// stable and independent of the CPU.
+type Clock struct {
+	pin  *Pin
+	mode Mode
+	// the offset of the CM_GPxCTL register in the clock manager.
+	ctl int
+}
+
+// clockPins maps the pins able to output clocks to the GPCLK and the
+// alternate function providing it.
+var clockPins = map[int]struct {
+	gpclk int
+	mode  Mode
+}{
+	GPIO4:  {0, Alt0},
+	GPIO5:  {1, Alt0},
+	GPIO6:  {2, Alt0},
+	GPIO20: {0, Alt5},
+	GPIO21: {1, Alt5},
+}
+
+// NewClock creates a Clock on the pin.
+//
+// Clocks are available on GPIO4, GPIO5 and GPIO6, and on GPIO20 and GPIO21,
+// which provide GPCLK0, GPCLK1, GPCLK2, GPCLK0 and GPCLK1 respectively.
+//
+// The clock manager is not accessible via /dev/gpiomem, so this requires
+// access to /dev/mem, and hence root.  If Open fell back from /dev/mem to
+// /dev/gpiomem then ErrUnsupported is returned.  The clock is not started
+// until the frequency is set.
+func NewClock(pin int) (*Clock, error) {
+	cp, ok := clockPins[pin]
+	if !ok {
+		return nil, ErrInvalidPin
+	}
+	if cdev != nil {
+		// alternate functions are not available via the character device.
+		return nil, ErrInvalidPin
+	}
+	if periphUnavailable {
+		return nil, ErrUnsupported
+	}
+	if err := openClockMem(); err != nil {
+		return nil, err
+	}
+	p, err := NewPin(pin)
+	if err != nil {
+		return nil, err
+	}
+	return &Clock{pin: p, mode: cp.mode, ctl: 28 + cp.gpclk*2}, nil
+}
+
+// openClockMem maps the clock manager registers, if not already mapped.
+func openClockMem() error {
+	clkLock.Lock()
+	defer clkLock.Unlock()
+	if len(clkMem) != 0 {
+		return nil
+	}
+	file, err := os.OpenFile("/dev/mem", os.O_RDWR|os.O_SYNC, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// the clock manager is not aligned to the larger pages used by some 64-bit
+	// kernels, so map from the start of the containing page.
+	addr := peripheralBase() + clockManagerOffset
+	pageOffset := addr % int64(os.Getpagesize())
+	clkMem8, err = unix.Mmap(
+		int(file.Fd()),
+		addr-pageOffset,
+		int(pageOffset)+memLength,
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	clkMem = (*[memLength / 4]uint32)(unsafe.Pointer(&clkMem8[pageOffset]))[:]
+	return nil
+}
+
+// closeClockMem unmaps the clock manager registers, if mapped.
+func closeClockMem() {
+	clkLock.Lock()
+	defer clkLock.Unlock()
+	if len(clkMem) == 0 {
+		return
+	}
+	clkMem = nil
+	unix.Munmap(clkMem8)
+	clkMem8 = nil
+}
+
+// peripheralBase returns the physical address of the peripherals.
+//
+// This is the base provided to Open, if any, else that mapped by the device
+// tree, else that of the detected model, else the default for the chipset.
+func peripheralBase() int64 {
+	if periphBase != 0 {
+		return periphBase
+	}
+	if base, err := DetectPeripheralBase(); err == nil {
+		return base
+	}
+	if m, err := DetectModel(); err == nil && m.base != 0 {
+		return m.base
+	}
+	if chipset == BCM2711 {
+		return 0xfe000000
+	}
+	// assume a Pi 2 or later, as the original Pi uses 0x20000000.
+	return 0x3f000000
+}
+
+// SourceFrequency returns the nominal frequency of the source, in Hz, or 0
+// if the frequency is not fixed.
+func SourceFrequency(src ClockSource) int {
+	switch src {
+	case ClockOscillator:
+		if chipset == BCM2711 {
+			return 54000000
+		}
+		return 19200000
+	case ClockPLLD:
+		if chipset == BCM2711 {
+			return 750000000
+		}
+		return 500000000
+	case ClockHDMI:
+		return 216000000
+	}
+	return 0
+}
+
+// Configure sets the source, divisor and MASH noise shaping of the clock,
+// and starts it.
+//
+// The output frequency is the source frequency divided by
+// (divi + divf/4096).  The fractional part of the divisor is only effective
+// for MASH levels 1 to 3, which dither the divisor to achieve the average
+// frequency, and which require divi to be at least 2, 3 and 5 respectively.
+func (c *Clock) Configure(src ClockSource, divi, divf, mash int) error {
+	if mash < 0 || mash > 3 || divf < 0 || divf > 0xfff || divi > clkMaxDivi ||
+		divi < []int{1, 2, 3, 5}[mash] {
+		return ErrInvalidClock
+	}
+	clkLock.Lock()
+	defer clkLock.Unlock()
+	if len(clkMem) == 0 {
+		return ErrInvalidClock
+	}
+	c.stop()
+	clkMem[c.ctl+1] = clkPasswd | uint32(divi)<<12 | uint32(divf)
+	clkMem[c.ctl] = clkPasswd | uint32(mash)<<9 | uint32(src)
+	clkMem[c.ctl] = clkPasswd | uint32(mash)<<9 | uint32(src) | clkEnab
+	c.pin.SetMode(c.mode)
+	return nil
+}
+
+// SetFrequency sets the clock to the frequency, in Hz, using the source and
+// divisor that most closely match it, and starts the clock.
+//
+// Integer divisors of the oscillator are preferred, as they produce a clean
+// clock.  Otherwise a fractional divisor, with MASH 1 dithering, is used.
+//
+// Returns the actual, average, frequency of the clock.
+func (c *Clock) SetFrequency(freq int) (int, error) {
+	if freq <= 0 {
+		return 0, ErrInvalidClock
+	}
+	type choice struct {
+		src        ClockSource
+		divi, divf int
+		mash       int
+		actual     int
+	}
+	var best *choice
+	for _, src := range []ClockSource{ClockOscillator, ClockPLLD} {
+		sf := SourceFrequency(src)
+		// divisor in 1/4096ths.
+		div := (int64(sf)*4096 + int64(freq)/2) / int64(freq)
+		ch := choice{src: src, divi: int(div >> 12), divf: int(div & 0xfff)}
+		if ch.divf != 0 {
+			ch.mash = 1
+		}
+		if ch.divi < []int{1, 2}[ch.mash] || ch.divi > clkMaxDivi {
+			continue
+		}
+		ch.actual = int(int64(sf) * 4096 / div)
+		if best == nil || abs(ch.actual-freq) < abs(best.actual-freq) ||
+			(best.mash != 0 && ch.mash == 0 && ch.actual == best.actual) {
+			best = &ch
+		}
+		if ch.mash == 0 && ch.actual == freq {
+			break
+		}
+	}
+	if best == nil {
+		return 0, ErrInvalidClock
+	}
+	if err := c.Configure(best.src, best.divi, best.divf, best.mash); err != nil {
+		return 0, err
+	}
+	return best.actual, nil
+}
+
+// Stop stops the clock and returns the pin to an Input.
+func (c *Clock) Stop() {
+	c.pin.SetMode(Input)
+	clkLock.Lock()
+	defer clkLock.Unlock()
+	if len(clkMem) != 0 {
+		c.stop()
+	}
+}
+
+// stop disables the clock and waits for it to stop.
+// Assumes the caller holds the clkLock.
+func (c *Clock) stop() {
+	ctl := clkMem[c.ctl] &^ clkEnab
+	clkMem[c.ctl] = clkPasswd | ctl&0xffffff
+	for i := 0; i < 100 && clkMem[c.ctl]&clkBusy != 0; i++ {
+		time.Sleep(time.Microsecond)
+	}
+	if clkMem[c.ctl]&clkBusy != 0 {
+		// refuses to stop, so kill it.
+		clkMem[c.ctl] = clkPasswd | ctl&0xffffff | clkKill
+		clkMem[c.ctl] = clkPasswd | ctl&0xffffff
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+var (
+	// ErrInvalidClock indicates the clock configuration is invalid.
+	ErrInvalidClock = errors.New("invalid clock")
+)
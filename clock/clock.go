@@ -0,0 +1,280 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package clock provides an injectable source of time, so timing dependent
+// drivers can be tested deterministically, and quickly, using a Fake clock
+// with mock pins.
+//
+// Not to be confused with gpio.Clock, which is a general purpose clock
+// output.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides the time, and timers, as per the time package.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// Sleep pauses the calling goroutine for at least the duration.
+	Sleep(d time.Duration)
+
+	// After waits for the duration to elapse and then sends the current time
+	// on the returned channel.
+	After(d time.Duration) <-chan time.Time
+
+	// NewTimer creates a Timer that sends the current time on its channel
+	// after at least the duration.
+	NewTimer(d time.Duration) Timer
+
+	// AfterFunc waits for the duration to elapse and then calls f in its
+	// own goroutine.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event timer, as per time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	//
+	// This is nil for timers created by AfterFunc.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing, and returns true if the timer was
+	// active.
+	Stop() bool
+
+	// Reset changes the timer to expire after the duration, and returns true
+	// if the timer was active.
+	Reset(d time.Duration) bool
+}
+
+// Real is the Clock provided by the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// Fake is a Clock that only advances when told to, by Advance.
+//
+// Timers fire, in order of expiry, as the clock is advanced past their expiry
+// time.  Functions scheduled by AfterFunc are called by Advance, so have
+// completed by the time Advance returns.  Timers with a duration of zero, or
+// less, fire immediately, as for a real clock.
+type Fake struct {
+	// Guards the following
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake creates a Fake clock, with the time initially set to the start.
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the current time of the fake clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Sleep blocks until the clock has been advanced by at least the duration.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// After returns a channel that receives the time once the clock has been
+// advanced by at least the duration.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer creates a Timer that fires once the clock has been advanced by the
+// duration.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// AfterFunc calls f once the clock has been advanced by the duration.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{f: f, fn: fn}
+	t.Reset(d)
+	return t
+}
+
+// Advance advances the clock by the duration, firing any timers that expire
+// within that time.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	f.mu.Unlock()
+	for f.fireNext(end) {
+	}
+	f.mu.Lock()
+	f.now = end
+	f.mu.Unlock()
+}
+
+// Set sets the clock to the time, firing any timers that expire before then.
+//
+// The clock cannot go backwards, so times before the current time are
+// ignored.
+func (f *Fake) Set(t time.Time) {
+	if d := t.Sub(f.Now()); d > 0 {
+		f.Advance(d)
+	}
+}
+
+// Pending returns the number of active timers, including sleepers.
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+// BlockUntil blocks until at least n timers, including sleepers, are active.
+//
+// This allows a test to wait for a goroutine to arm its timer before
+// advancing the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+// fireNext fires the first timer expiring at or before the end, returning
+// false if there is none.
+func (f *Fake) fireNext(end time.Time) bool {
+	f.mu.Lock()
+	if len(f.timers) == 0 || f.timers[0].when.After(end) {
+		f.mu.Unlock()
+		return false
+	}
+	t := f.timers[0]
+	f.timers = f.timers[1:]
+	if t.when.After(f.now) {
+		f.now = t.when
+	}
+	now := f.now
+	f.mu.Unlock()
+	t.fire(now, false)
+	return true
+}
+
+// add adds the timer to the active timers, in order of expiry.
+//
+// Assumes the caller holds the mu lock.
+func (f *Fake) add(t *fakeTimer) {
+	f.timers = append(f.timers, t)
+	sort.SliceStable(f.timers, func(i, j int) bool {
+		return f.timers[i].when.Before(f.timers[j].when)
+	})
+	f.cond.Broadcast()
+}
+
+// remove removes the timer from the active timers, returning true if it was
+// active.
+//
+// Assumes the caller holds the mu lock.
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, tt := range f.timers {
+		if tt == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	f    *Fake
+	when time.Time
+	c    chan time.Time
+	fn   func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	return t.f.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	f := t.f
+	f.mu.Lock()
+	active := f.remove(t)
+	if d <= 0 {
+		now := f.now
+		f.mu.Unlock()
+		t.fire(now, true)
+		return active
+	}
+	t.when = f.now.Add(d)
+	f.add(t)
+	f.mu.Unlock()
+	return active
+}
+
+// fire delivers the time, or calls the function.
+//
+// Functions are called in their own goroutine if async, as when fired
+// immediately, as the caller may hold locks required by the function.
+func (t *fakeTimer) fire(now time.Time, async bool) {
+	if t.fn == nil {
+		select {
+		case t.c <- now:
+		default:
+		}
+		return
+	}
+	if async {
+		go t.fn()
+		return
+	}
+	t.fn()
+}
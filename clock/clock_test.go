@@ -0,0 +1,107 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio/clock"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestReal(t *testing.T) {
+	c := clock.Real
+	start := c.Now()
+	c.Sleep(time.Millisecond)
+	assert.True(t, c.Now().Sub(start) >= time.Millisecond)
+	<-c.After(time.Millisecond)
+	tm := c.NewTimer(time.Millisecond)
+	<-tm.C()
+	assert.False(t, tm.Stop())
+	done := make(chan struct{})
+	tm = c.AfterFunc(time.Millisecond, func() { close(done) })
+	<-done
+	assert.Nil(t, tm.C())
+}
+
+func TestFakeTimer(t *testing.T) {
+	f := clock.NewFake(epoch)
+	assert.Equal(t, epoch, f.Now())
+	tm := f.NewTimer(10 * time.Millisecond)
+	assert.Equal(t, 1, f.Pending())
+	f.Advance(9 * time.Millisecond)
+	assert.Len(t, tm.C(), 0)
+	f.Advance(time.Millisecond)
+	assert.Equal(t, epoch.Add(10*time.Millisecond), <-tm.C())
+	assert.Zero(t, f.Pending())
+
+	assert.False(t, tm.Reset(5*time.Millisecond))
+	assert.True(t, tm.Reset(5*time.Millisecond))
+	assert.True(t, tm.Stop())
+	assert.False(t, tm.Stop())
+	f.Advance(time.Second)
+	assert.Len(t, tm.C(), 0)
+
+	// immediate
+	tm = f.NewTimer(0)
+	assert.Equal(t, f.Now(), <-tm.C())
+	f.Set(epoch)
+	assert.Equal(t, epoch.Add(1010*time.Millisecond), f.Now())
+}
+
+func TestFakeAfterFunc(t *testing.T) {
+	f := clock.NewFake(epoch)
+	var fired []time.Duration
+	ticks := 0
+	var tick func()
+	tick = func() {
+		fired = append(fired, f.Now().Sub(epoch))
+		ticks++
+		if ticks < 3 {
+			f.AfterFunc(10*time.Millisecond, tick)
+		}
+	}
+	f.AfterFunc(10*time.Millisecond, tick)
+	f.AfterFunc(15*time.Millisecond, func() {
+		fired = append(fired, -f.Now().Sub(epoch))
+	})
+	f.Advance(time.Second)
+	// in order, with rescheduled timers firing within the one advance.
+	assert.Equal(t, []time.Duration{
+		10 * time.Millisecond,
+		-15 * time.Millisecond,
+		20 * time.Millisecond,
+		30 * time.Millisecond,
+	}, fired)
+	assert.Equal(t, epoch.Add(time.Second), f.Now())
+
+	done := make(chan struct{})
+	f.AfterFunc(0, func() { close(done) })
+	<-done
+}
+
+func TestFakeSleep(t *testing.T) {
+	f := clock.NewFake(epoch)
+	done := make(chan time.Time)
+	go func() {
+		f.Sleep(time.Second)
+		done <- f.Now()
+	}()
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	assert.Equal(t, epoch.Add(time.Second), <-done)
+
+	go func() {
+		<-f.After(time.Millisecond)
+		done <- f.Now()
+	}()
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	assert.Equal(t, epoch.Add(time.Second+time.Minute), <-done)
+}
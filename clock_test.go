@@ -0,0 +1,51 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//
+//  Test suite for clock module.
+//
+//	Tests use J8 pin 7 (GPIO4), and require root to access /dev/mem.
+//
+package gpio_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+func TestNewClockInvalid(t *testing.T) {
+	c, err := gpio.NewClock(gpio.GPIO7)
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+	assert.Nil(t, c)
+}
+
+func TestClock(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	c, err := gpio.NewClock(gpio.GPIO4)
+	assert.Nil(t, err)
+	defer c.Stop()
+	pin, err := gpio.NewPin(gpio.GPIO4)
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.Input, pin.Mode())
+	// an integer divisor of the oscillator
+	f, err := c.SetFrequency(gpio.SourceFrequency(gpio.ClockOscillator) / 4)
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.SourceFrequency(gpio.ClockOscillator)/4, f)
+	assert.Equal(t, gpio.Alt0, pin.Mode())
+	// an integer divisor of PLLD
+	f, err = c.SetFrequency(1000000)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000000, f)
+	_, err = c.SetFrequency(0)
+	assert.Equal(t, gpio.ErrInvalidClock, err)
+	assert.Equal(t, gpio.ErrInvalidClock, c.Configure(gpio.ClockOscillator, 1, 1, 1))
+	assert.Equal(t, gpio.ErrInvalidClock, c.Configure(gpio.ClockOscillator, 4, 0, 4))
+	assert.Nil(t, c.Configure(gpio.ClockOscillator, 5, 100, 3))
+	c.Stop()
+	assert.Equal(t, gpio.Input, pin.Mode())
+}
@@ -19,7 +19,7 @@ func init() {
 
 var detectCmd = &cobra.Command{
 	Use:   "detect",
-	Short: "Identify the GPIO chip",
+	Short: "Identify the GPIO chip and board model",
 	Args:  cobra.NoArgs,
 	RunE:  detect,
 }
@@ -38,5 +38,8 @@ func detect(cmd *cobra.Command, args []string) error {
 	default:
 		fmt.Println("unknown")
 	}
+	if m, err := gpio.DetectModel(); err == nil {
+		fmt.Printf("%s (%s, %dMB)\n", m.Name, m.SoC, m.Memory)
+	}
 	return nil
 }
@@ -72,8 +72,10 @@ func get(cmd *cobra.Command, args []string) (err error) {
 	defer gpio.Close()
 	vv := make([]gpio.Level, len(oo))
 	for i, o := range oo {
-		pin := gpio.NewPin(o)
-		pin.Input()
+		pin, err := gpio.NewPin(o, gpio.WithMode(gpio.Input))
+		if err != nil {
+			return err
+		}
 		v := pin.Read()
 		if getOpts.ActiveLow {
 			v = !v
@@ -62,7 +62,10 @@ func mode(cmd *cobra.Command, args []string) (err error) {
 	defer gpio.Close()
 	mm := make([]gpio.Mode, len(oo))
 	for i, o := range oo {
-		pin := gpio.NewPin(o)
+		pin, err := gpio.NewPin(o)
+		if err != nil {
+			return err
+		}
 		m := pin.Mode()
 		mm[i] = m
 	}
@@ -82,19 +82,20 @@ func mon(cmd *cobra.Command, args []string) error {
 		edge = gpio.EdgeFalling
 	}
 	evtchan := make(chan event)
-	eh := func(p *gpio.Pin) {
+	eh := func(p gpio.Pinner) {
 		evt := event{
 			Time:  time.Now(),
-			Pin:   p.Pin(),
+			Pin:   p.(*gpio.Pin).Pin(),
 			Level: p.Read(),
 		}
 		evtchan <- evt
 	}
 	defer gpio.Close()
 	for _, o := range oo {
-		pin := gpio.NewPin(o)
-		pin.Input()
-		pin.Watch(edge, eh)
+		_, err = gpio.NewPin(o, gpio.WithMode(gpio.Input), gpio.WithEdge(edge, eh))
+		if err != nil {
+			return err
+		}
 	}
 	monWait(evtchan)
 	return nil
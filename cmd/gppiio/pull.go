@@ -96,8 +96,10 @@ func pull(cmd *cobra.Command, args []string) (err error) {
 		p = gpio.PullNone
 	}
 	for _, o := range oo {
-		pin := gpio.NewPin(o)
-		pin.SetPull(p)
+		_, err = gpio.NewPin(o, gpio.WithPull(p))
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2019 Kent Gibson <warthog618@gmail.com>.
+
+// +build linux
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/daemon"
+)
+
+func init() {
+	serveCmd.Flags().StringVarP(&serveOpts.Socket, "socket", "s", daemon.DefaultSocket, "the path of the socket")
+	serveCmd.Flags().StringVarP(&serveOpts.Perm, "perm", "p", "0660", "the permissions of the socket")
+	rootCmd.AddCommand(serveCmd)
+}
+
+var (
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the pins to other processes via a Unix socket",
+		Long: `Open the GPIO pins and serve them to other processes, which connect via a
+Unix socket.  This allows unprivileged processes to access the pins, subject
+to the permissions of the socket.`,
+		Args: cobra.NoArgs,
+		RunE: serve,
+	}
+	serveOpts = struct {
+		Socket string
+		Perm   string
+	}{}
+)
+
+func serve(cmd *cobra.Command, args []string) error {
+	perm, err := strconv.ParseUint(serveOpts.Perm, 8, 32)
+	if err != nil {
+		return err
+	}
+	err = gpio.Open()
+	if err != nil {
+		return err
+	}
+	defer gpio.Close()
+	s := daemon.NewServer(daemon.WithPermissions(os.FileMode(perm)))
+	sigdone := make(chan os.Signal, 1)
+	signal.Notify(sigdone, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigdone)
+	go func() {
+		<-sigdone
+		s.Close()
+	}()
+	err = s.ListenAndServe(serveOpts.Socket)
+	os.Remove(serveOpts.Socket)
+	if err == daemon.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -60,12 +60,13 @@ func set(cmd *cobra.Command, args []string) error {
 	}
 	defer gpio.Close()
 	for i, v := range vv {
-		pin := gpio.NewPin(ll[i])
 		if getOpts.ActiveLow {
 			v = !v
 		}
-		pin.Output()
-		pin.Write(v)
+		_, err = gpio.NewPin(ll[i], gpio.WithInitialLevel(v), gpio.WithMode(gpio.Output))
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,271 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/warthog618/gpio"
+)
+
+// Client is a connection to a Server.
+type Client struct {
+	nc   net.Conn
+	resp chan string
+	// edge events awaiting dispatch to handlers.
+	events chan edgeEvent
+	wg     sync.WaitGroup
+	// Guards the sequencing of requests and responses.
+	reqMu sync.Mutex
+	// Guards the following
+	mu       sync.Mutex
+	handlers map[int]func(gpio.Pinner)
+	err      error
+}
+
+type edgeEvent struct {
+	pin   int
+	level gpio.Level
+}
+
+// Dial connects to the Server at the socket path, e.g. DefaultSocket.
+func Dial(path string) (*Client, error) {
+	nc, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		nc:       nc,
+		resp:     make(chan string),
+		events:   make(chan edgeEvent, 64),
+		handlers: make(map[int]func(gpio.Pinner)),
+	}
+	c.wg.Add(2)
+	go c.read()
+	go c.dispatch()
+	return c, nil
+}
+
+// Close closes the connection, removing any watches.
+func (c *Client) Close() error {
+	err := c.nc.Close()
+	c.wg.Wait()
+	return err
+}
+
+// Err returns the first error encountered by a Pin, if any.
+//
+// As the gpio.Pinner methods cannot return errors, errors from those methods
+// are recorded by the Client.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) setErr(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+// Pin returns the pin served by the Server.
+func (c *Client) Pin(pin int) *Pin {
+	return &Pin{c: c, pin: pin}
+}
+
+// request sends the request and returns the value of the response, if any.
+func (c *Client) request(format string, args ...interface{}) (string, error) {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	if _, err := fmt.Fprintf(c.nc, format+"\n", args...); err != nil {
+		return "", err
+	}
+	resp, ok := <-c.resp
+	if !ok {
+		return "", ErrClosed
+	}
+	if resp == "ok" {
+		return "", nil
+	}
+	if strings.HasPrefix(resp, "ok ") {
+		return resp[3:], nil
+	}
+	if strings.HasPrefix(resp, "err ") {
+		msg := resp[4:]
+		for _, e := range []error{gpio.ErrBusy, ErrInvalidRequest, ErrNotSupported} {
+			if msg == e.Error() {
+				return "", e
+			}
+		}
+		return "", errors.New(msg)
+	}
+	return "", ErrInvalidResponse
+}
+
+// read reads the responses and events from the server.
+func (c *Client) read() {
+	defer c.wg.Done()
+	defer close(c.resp)
+	defer close(c.events)
+	sc := bufio.NewScanner(c.nc)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "edge ") {
+			c.resp <- line
+			continue
+		}
+		ff := strings.Fields(line)
+		if len(ff) != 3 {
+			continue
+		}
+		pin, err := strconv.Atoi(ff[1])
+		if err != nil {
+			continue
+		}
+		c.events <- edgeEvent{pin, ff[2] == "1"}
+	}
+}
+
+// dispatch calls the handlers for edge events.
+//
+// Handlers are called from this goroutine, rather than the read goroutine, so
+// they can make requests.
+func (c *Client) dispatch() {
+	defer c.wg.Done()
+	for evt := range c.events {
+		c.mu.Lock()
+		h := c.handlers[evt.pin]
+		c.mu.Unlock()
+		if h != nil {
+			h(&eventPin{Pin{c: c, pin: evt.pin}, evt.level})
+		}
+	}
+}
+
+// Pin is a pin served by a Server.
+//
+// Pin implements gpio.Pinner, with any errors recorded by the Client.
+type Pin struct {
+	c   *Client
+	pin int
+}
+
+// Pin returns the number of the pin, as per gpio.Pin.
+func (p *Pin) Pin() int {
+	return p.pin
+}
+
+// Read returns the level of the pin.
+func (p *Pin) Read() gpio.Level {
+	v, err := p.c.request("read %d", p.pin)
+	if err != nil {
+		p.c.setErr(err)
+	}
+	return v == "1"
+}
+
+// Write sets the level of the pin.
+func (p *Pin) Write(level gpio.Level) {
+	p.do("write %d %s", p.pin, levelString(level))
+}
+
+// High sets the pin high.
+func (p *Pin) High() {
+	p.Write(gpio.High)
+}
+
+// Low sets the pin low.
+func (p *Pin) Low() {
+	p.Write(gpio.Low)
+}
+
+// SetMode sets the mode of the pin.
+func (p *Pin) SetMode(mode gpio.Mode) {
+	p.do("mode %d %d", p.pin, int(mode))
+}
+
+// Mode returns the mode of the pin.
+func (p *Pin) Mode() gpio.Mode {
+	v, err := p.c.request("mode %d", p.pin)
+	if err != nil {
+		p.c.setErr(err)
+		return gpio.Input
+	}
+	m, _ := strconv.Atoi(v)
+	return gpio.Mode(m)
+}
+
+// SetPull sets the pull up/down mode of the pin.
+func (p *Pin) SetPull(pull gpio.Pull) {
+	p.do("pull %d %d", p.pin, int(pull))
+}
+
+// Watch calls the handler when the pin level changes on the given edge.
+//
+// As per gpio.Pin.Watch, the handler is called immediately with the current
+// level.  The pin passed to the handler reads the level reported with the
+// edge, rather than requesting the current level from the Server.
+func (p *Pin) Watch(edge gpio.Edge, handler func(gpio.Pinner)) error {
+	c := p.c
+	c.mu.Lock()
+	if _, ok := c.handlers[p.pin]; ok {
+		c.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	c.handlers[p.pin] = handler
+	c.mu.Unlock()
+	_, err := c.request("watch %d %s", p.pin, edge)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.handlers, p.pin)
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Unwatch removes any watch from the pin.
+func (p *Pin) Unwatch() {
+	c := p.c
+	c.mu.Lock()
+	delete(c.handlers, p.pin)
+	c.mu.Unlock()
+	p.do("unwatch %d", p.pin)
+}
+
+func (p *Pin) do(format string, args ...interface{}) {
+	if _, err := p.c.request(format, args...); err != nil {
+		p.c.setErr(err)
+	}
+}
+
+// eventPin is the pin passed to watch handlers, which returns the level
+// reported with the edge.
+type eventPin struct {
+	Pin
+	level gpio.Level
+}
+
+func (p *eventPin) Read() gpio.Level {
+	return p.level
+}
+
+var (
+	// ErrClosed indicates the connection to the server is closed.
+	ErrClosed = errors.New("connection closed")
+
+	// ErrInvalidResponse indicates the response from the server could not be
+	// parsed.
+	ErrInvalidResponse = errors.New("invalid response")
+)
@@ -0,0 +1,172 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package daemon_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/daemon"
+	"github.com/warthog618/gpio/mock"
+)
+
+// pins is a set of mock pins served by a Server.
+type pins struct {
+	mu   sync.Mutex
+	pins map[int]*mock.Pin
+}
+
+func (pp *pins) open(n int) (gpio.Pinner, error) {
+	if n > 27 {
+		return nil, errors.New("invalid pin")
+	}
+	return pp.pin(n), nil
+}
+
+func (pp *pins) pin(n int) *mock.Pin {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	p, ok := pp.pins[n]
+	if !ok {
+		p = mock.NewPin(n)
+		pp.pins[n] = p
+	}
+	return p
+}
+
+func serve(t *testing.T) (*daemon.Server, *pins, string, func()) {
+	dir, err := ioutil.TempDir("", "daemon")
+	require.Nil(t, err)
+	path := filepath.Join(dir, "gpio.sock")
+	pp := &pins{pins: make(map[int]*mock.Pin)}
+	s := daemon.NewServer(daemon.WithOpener(pp.open))
+	done := make(chan error)
+	go func() {
+		done <- s.ListenAndServe(path)
+	}()
+	// wait for the socket
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return s, pp, path, func() {
+		s.Close()
+		assert.Equal(t, daemon.ErrServerClosed, <-done)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPin(t *testing.T) {
+	_, pp, path, cleanup := serve(t)
+	defer cleanup()
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+
+	c, err := daemon.Dial(path)
+	require.Nil(t, err)
+	defer c.Close()
+	p := c.Pin(4)
+	var _ gpio.Pinner = p
+	assert.Equal(t, 4, p.Pin())
+	mp := pp.pin(4)
+	p.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Output, mp.Mode())
+	assert.Equal(t, gpio.Output, p.Mode())
+	p.High()
+	assert.Equal(t, gpio.High, mp.Read())
+	assert.Equal(t, gpio.High, p.Read())
+	p.Low()
+	assert.Equal(t, gpio.Low, p.Read())
+	p.SetMode(gpio.Input)
+	p.SetPull(gpio.PullUp)
+	assert.Equal(t, gpio.PullUp, mp.Pull())
+	mp.Set(gpio.High)
+	assert.Equal(t, gpio.High, p.Read())
+	assert.Nil(t, c.Err())
+
+	// errors
+	c.Pin(40).High()
+	assert.Equal(t, "invalid pin", c.Err().Error())
+	assert.Equal(t, daemon.ErrInvalidRequest, c.Pin(5).Watch("sideways", func(gpio.Pinner) {}))
+}
+
+func TestWatch(t *testing.T) {
+	_, pp, path, cleanup := serve(t)
+	defer cleanup()
+	c1, err := daemon.Dial(path)
+	require.Nil(t, err)
+	defer c1.Close()
+	c2, err := daemon.Dial(path)
+	require.Nil(t, err)
+
+	levels := make(chan gpio.Level, 10)
+	p := c1.Pin(17)
+	err = p.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		// handlers may make requests
+		c1.Pin(18).Write(pin.Read())
+		levels <- pin.Read()
+	})
+	require.Nil(t, err)
+	expect := func(level gpio.Level) {
+		select {
+		case l := <-levels:
+			assert.Equal(t, level, l)
+		case <-time.After(time.Second):
+			t.Error("no edge")
+		}
+	}
+	expect(gpio.Low)
+	mp := pp.pin(17)
+	out := pp.pin(18)
+	out.SetMode(gpio.Output)
+	mp.Set(gpio.High)
+	expect(gpio.High)
+	assert.Equal(t, gpio.High, out.Read())
+	mp.Set(gpio.Low)
+	expect(gpio.Low)
+	assert.Equal(t, gpio.Low, out.Read())
+	assert.Equal(t, gpio.ErrBusy, p.Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+
+	// pin watched by another client
+	assert.Equal(t, gpio.ErrBusy, c2.Pin(17).Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+	// ...until unwatched
+	p.Unwatch()
+	assert.Nil(t, c2.Pin(17).Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+	// and released when the client disconnects
+	c2.Close()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, p.Watch(gpio.EdgeRising, func(pin gpio.Pinner) {
+		levels <- pin.Read()
+	}))
+	expect(gpio.Low)
+	mp.Set(gpio.High)
+	expect(gpio.High)
+	assert.Nil(t, c1.Err())
+}
+
+func TestServerClose(t *testing.T) {
+	s, _, path, cleanup := serve(t)
+	defer cleanup()
+	c, err := daemon.Dial(path)
+	require.Nil(t, err)
+	defer c.Close()
+	s.Close()
+	c.Pin(1).High()
+	assert.NotNil(t, c.Err())
+	_, err = daemon.Dial(path)
+	assert.NotNil(t, err)
+}
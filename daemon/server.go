@@ -0,0 +1,358 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package daemon provides a server that shares the GPIO pins of one process
+// with others via a line oriented protocol on a Unix domain socket, and a
+// client for that protocol.
+//
+// This allows unprivileged processes to access the pins, and coordinates
+// access between processes, as the server owns the pins and only allows a pin
+// to be watched by one client at a time.
+//
+// Each request is a single line, of the form:
+//
+//	read <pin>
+//	write <pin> <0|1>
+//	mode <pin> [<mode>]
+//	pull <pin> <pull>
+//	watch <pin> <none|rising|falling|both>
+//	unwatch <pin>
+//
+// where modes and pulls are the numeric gpio.Mode and gpio.Pull values.
+//
+// Each request receives a response, in order, of either "ok", optionally
+// followed by a value, or "err" followed by an error message.  Edges on pins
+// watched by the client are reported asynchronously, interleaved with the
+// responses, as:
+//
+//	edge <pin> <0|1>
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/warthog618/gpio"
+)
+
+// DefaultSocket is the default path of the server socket.
+const DefaultSocket = "/run/gppiio.sock"
+
+// Server serves the pins to clients.
+type Server struct {
+	open func(pin int) (gpio.Pinner, error)
+	perm os.FileMode
+	wg   sync.WaitGroup
+	// Guards the following
+	mu        sync.Mutex
+	pins      map[int]gpio.Pinner
+	watchers  map[int]*conn
+	conns     map[*conn]struct{}
+	listeners []net.Listener
+	closed    bool
+}
+
+// ServerOption defines an option that can be applied when creating a Server.
+type ServerOption func(*Server)
+
+// WithOpener sets the function used to open pins, for example to serve mock
+// pins.
+//
+// The default opens pins using gpio.NewPin, so gpio.Open must be called
+// before serving.
+func WithOpener(open func(pin int) (gpio.Pinner, error)) ServerOption {
+	return func(s *Server) {
+		s.open = open
+	}
+}
+
+// WithPermissions sets the permissions of the socket created by
+// ListenAndServe, which control which users may connect.
+//
+// The default is 0660, allowing access to the owner and group.
+func WithPermissions(perm os.FileMode) ServerOption {
+	return func(s *Server) {
+		s.perm = perm
+	}
+}
+
+// NewServer creates a Server.
+func NewServer(options ...ServerOption) *Server {
+	s := &Server{
+		open: func(pin int) (gpio.Pinner, error) {
+			return gpio.NewPin(pin)
+		},
+		perm:     0660,
+		pins:     make(map[int]gpio.Pinner),
+		watchers: make(map[int]*conn),
+		conns:    make(map[*conn]struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ListenAndServe listens on the Unix socket at the path, and serves clients
+// until the Server is closed.
+//
+// Any stale socket left at the path is removed.
+func (s *Server) ListenAndServe(path string) error {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(path, s.perm); err != nil {
+		l.Close()
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves clients connecting to the listener until the Server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		c := &conn{s: s, nc: nc}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// Close stops the Server, disconnecting all clients and removing their
+// watches.
+//
+// The pins are left in their current state.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.listeners = nil
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) pin(n int) (gpio.Pinner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pins[n]; ok {
+		return p, nil
+	}
+	p, err := s.open(n)
+	if err != nil {
+		return nil, err
+	}
+	s.pins[n] = p
+	return p, nil
+}
+
+// conn is a connection from a client.
+type conn struct {
+	s  *Server
+	nc net.Conn
+	// Guards writes to the connection.
+	mu sync.Mutex
+}
+
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer c.close()
+	sc := bufio.NewScanner(c.nc)
+	for sc.Scan() {
+		resp, err := c.exec(strings.Fields(sc.Text()))
+		if err != nil {
+			resp = "err " + err.Error()
+		}
+		if c.send(resp) != nil {
+			return
+		}
+	}
+}
+
+// close removes the watches of the connection.
+func (c *conn) close() {
+	c.nc.Close()
+	s := c.s
+	s.mu.Lock()
+	delete(s.conns, c)
+	var pins []gpio.Pinner
+	for n, w := range s.watchers {
+		if w == c {
+			delete(s.watchers, n)
+			pins = append(pins, s.pins[n])
+		}
+	}
+	s.mu.Unlock()
+	for _, p := range pins {
+		p.Unwatch()
+	}
+}
+
+func (c *conn) send(line string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := fmt.Fprintln(c.nc, line)
+	return err
+}
+
+func (c *conn) exec(args []string) (string, error) {
+	if len(args) < 2 {
+		return "", ErrInvalidRequest
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return "", ErrInvalidRequest
+	}
+	p, err := c.s.pin(n)
+	if err != nil {
+		return "", err
+	}
+	cmd, args := args[0], args[2:]
+	switch {
+	case cmd == "read" && len(args) == 0:
+		return "ok " + levelString(p.Read()), nil
+	case cmd == "write" && len(args) == 1:
+		level, err := parseLevel(args[0])
+		if err != nil {
+			return "", err
+		}
+		p.Write(level)
+	case cmd == "mode" && len(args) == 0:
+		m, ok := p.(interface{ Mode() gpio.Mode })
+		if !ok {
+			return "", ErrNotSupported
+		}
+		return "ok " + strconv.Itoa(int(m.Mode())), nil
+	case cmd == "mode" && len(args) == 1:
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", ErrInvalidRequest
+		}
+		p.SetMode(gpio.Mode(v))
+	case cmd == "pull" && len(args) == 1:
+		pp, ok := p.(interface{ SetPull(gpio.Pull) })
+		if !ok {
+			return "", ErrNotSupported
+		}
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", ErrInvalidRequest
+		}
+		pp.SetPull(gpio.Pull(v))
+	case cmd == "watch" && len(args) == 1:
+		return "ok", c.watch(n, p, gpio.Edge(args[0]))
+	case cmd == "unwatch" && len(args) == 0:
+		c.unwatch(n, p)
+	default:
+		return "", ErrInvalidRequest
+	}
+	return "ok", nil
+}
+
+func (c *conn) watch(n int, p gpio.Pinner, edge gpio.Edge) error {
+	switch edge {
+	case gpio.EdgeNone, gpio.EdgeRising, gpio.EdgeFalling, gpio.EdgeBoth:
+	default:
+		return ErrInvalidRequest
+	}
+	s := c.s
+	s.mu.Lock()
+	if _, ok := s.watchers[n]; ok {
+		s.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	s.watchers[n] = c
+	s.mu.Unlock()
+	err := p.Watch(edge, func(pin gpio.Pinner) {
+		c.send(fmt.Sprintf("edge %d %s", n, levelString(pin.Read())))
+	})
+	if err != nil {
+		s.mu.Lock()
+		delete(s.watchers, n)
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (c *conn) unwatch(n int, p gpio.Pinner) {
+	s := c.s
+	s.mu.Lock()
+	owner := s.watchers[n] == c
+	if owner {
+		delete(s.watchers, n)
+	}
+	s.mu.Unlock()
+	if owner {
+		p.Unwatch()
+	}
+}
+
+func levelString(level gpio.Level) string {
+	if level {
+		return "1"
+	}
+	return "0"
+}
+
+func parseLevel(s string) (gpio.Level, error) {
+	switch s {
+	case "0":
+		return gpio.Low, nil
+	case "1":
+		return gpio.High, nil
+	}
+	return gpio.Low, ErrInvalidRequest
+}
+
+var (
+	// ErrInvalidRequest indicates the request could not be parsed.
+	ErrInvalidRequest = errors.New("invalid request")
+
+	// ErrNotSupported indicates the request is not supported by the pin.
+	ErrNotSupported = errors.New("not supported")
+
+	// ErrServerClosed indicates the server has been closed.
+	ErrServerClosed = errors.New("server closed")
+)
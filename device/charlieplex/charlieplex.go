@@ -0,0 +1,197 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package charlieplex provides a driver for charlieplexed LED matrices.
+package charlieplex
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Matrix is a charlieplexed LED matrix, which controls N×(N-1) LEDs using N
+// pins.
+//
+// Each LED is connected between an ordered pair of pins, its anode and
+// cathode.  The pins are scanned by a background goroutine, with each pin in
+// turn driven High as the anode, and the cathodes of the lit LEDs connected
+// to that anode driven Low.  All other pins are tri-stated, as Inputs.
+//
+// The pins should not have pulls enabled.
+type Matrix struct {
+	pins  []gpio.Pinner
+	slot  time.Duration
+	clock clock.Clock
+	done  chan struct{}
+	wg    sync.WaitGroup
+	// Guards the following
+	mu  sync.Mutex
+	fb  []bool
+	gen int
+}
+
+// Option defines an option that can be applied when creating a Matrix.
+type Option func(*Matrix)
+
+// WithRefreshRate sets the rate, in Hz, at which the whole matrix is
+// refreshed.
+//
+// The default is 100Hz.
+func WithRefreshRate(rate float64) Option {
+	return func(m *Matrix) {
+		m.slot = time.Duration(float64(time.Second) / rate / float64(len(m.pins)))
+	}
+}
+
+// WithClock sets the clock used to time the scan, e.g. a clock.Fake for
+// tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(m *Matrix) {
+		m.clock = c
+	}
+}
+
+// New creates a Matrix with the pins, and starts scanning it.
+//
+// All LEDs are initially off.
+func New(pins []gpio.Pinner, options ...Option) *Matrix {
+	n := len(pins)
+	m := &Matrix{
+		pins:  pins,
+		clock: clock.Real,
+		done:  make(chan struct{}),
+		fb:    make([]bool, n*(n-1)),
+	}
+	WithRefreshRate(100)(m)
+	for _, option := range options {
+		option(m)
+	}
+	for _, p := range pins {
+		p.SetMode(gpio.Input)
+	}
+	m.wg.Add(1)
+	go m.scan()
+	return m
+}
+
+// Close stops scanning the matrix, and tri-states all the pins.
+func (m *Matrix) Close() {
+	close(m.done)
+	m.wg.Wait()
+	for _, p := range m.pins {
+		p.SetMode(gpio.Input)
+	}
+}
+
+// Len returns the number of LEDs in the matrix.
+func (m *Matrix) Len() int {
+	return len(m.fb)
+}
+
+// Index returns the index of the LED between the anode and cathode pins,
+// which are identified by their position in the pins provided to New.
+//
+// Returns -1 if there is no such LED.
+func (m *Matrix) Index(anode, cathode int) int {
+	n := len(m.pins)
+	if anode < 0 || anode >= n || cathode < 0 || cathode >= n || anode == cathode {
+		return -1
+	}
+	if cathode > anode {
+		cathode--
+	}
+	return anode*(n-1) + cathode
+}
+
+// SetLED turns the LED with the index on or off.
+func (m *Matrix) SetLED(index int, on bool) {
+	if index < 0 || index >= len(m.fb) {
+		return
+	}
+	m.mu.Lock()
+	m.fb[index] = on
+	m.mu.Unlock()
+}
+
+// LED returns true if the LED with the index is on.
+func (m *Matrix) LED(index int) bool {
+	if index < 0 || index >= len(m.fb) {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fb[index]
+}
+
+// SetFrame sets the state of all the LEDs, by index.
+//
+// Extra elements are ignored, and missing elements are turned off.
+func (m *Matrix) SetFrame(frame []bool) {
+	m.mu.Lock()
+	for i := range m.fb {
+		m.fb[i] = i < len(frame) && frame[i]
+	}
+	m.mu.Unlock()
+}
+
+// Clear turns off all the LEDs.
+func (m *Matrix) Clear() {
+	m.SetFrame(nil)
+}
+
+func (m *Matrix) scan() {
+	defer m.wg.Done()
+	n := len(m.pins)
+	t := m.clock.NewTimer(0)
+	<-t.C()
+	cathodes := make([]int, 0, n)
+	for {
+		for a, anode := range m.pins {
+			cathodes = cathodes[:0]
+			m.mu.Lock()
+			row := m.fb[a*(n-1) : (a+1)*(n-1)]
+			for i, on := range row {
+				if on {
+					c := i
+					if c >= a {
+						c++
+					}
+					cathodes = append(cathodes, c)
+				}
+			}
+			m.mu.Unlock()
+			// levels are set before the pins become outputs, so the
+			// pins never drive a stale level.
+			for _, c := range cathodes {
+				m.pins[c].Write(gpio.Low)
+				m.pins[c].SetMode(gpio.Output)
+			}
+			if len(cathodes) > 0 {
+				anode.Write(gpio.High)
+				anode.SetMode(gpio.Output)
+			}
+			t.Reset(m.slot)
+			select {
+			case <-m.done:
+				t.Stop()
+				return
+			case <-t.C():
+			}
+			// tri-state the anode first, so no LED is momentarily lit
+			// by the next anode.
+			if len(cathodes) > 0 {
+				anode.SetMode(gpio.Input)
+			}
+			for _, c := range cathodes {
+				m.pins[c].SetMode(gpio.Input)
+			}
+		}
+	}
+}
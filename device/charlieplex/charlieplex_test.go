@@ -0,0 +1,108 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package charlieplex_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/charlieplex"
+	"github.com/warthog618/gpio/mock"
+)
+
+func TestIndex(t *testing.T) {
+	m := charlieplex.New([]gpio.Pinner{mock.NewPin(0), mock.NewPin(1), mock.NewPin(2)})
+	defer m.Close()
+	assert.Equal(t, 6, m.Len())
+	assert.Equal(t, 0, m.Index(0, 1))
+	assert.Equal(t, 1, m.Index(0, 2))
+	assert.Equal(t, 2, m.Index(1, 0))
+	assert.Equal(t, 3, m.Index(1, 2))
+	assert.Equal(t, 4, m.Index(2, 0))
+	assert.Equal(t, 5, m.Index(2, 1))
+	assert.Equal(t, -1, m.Index(1, 1))
+	assert.Equal(t, -1, m.Index(3, 1))
+	assert.Equal(t, -1, m.Index(1, -1))
+}
+
+func TestFramebuffer(t *testing.T) {
+	m := charlieplex.New([]gpio.Pinner{mock.NewPin(0), mock.NewPin(1), mock.NewPin(2)})
+	defer m.Close()
+	m.SetLED(3, true)
+	m.SetLED(6, true)
+	assert.True(t, m.LED(3))
+	assert.False(t, m.LED(6))
+	m.SetFrame([]bool{true, false, true})
+	assert.True(t, m.LED(0))
+	assert.False(t, m.LED(3))
+	assert.True(t, m.LED(2))
+	m.Clear()
+	for i := 0; i < m.Len(); i++ {
+		assert.False(t, m.LED(i))
+	}
+}
+
+// TestScan checks that only the lit LEDs are ever driven, and only while
+// their anode is being scanned.
+func TestScan(t *testing.T) {
+	pins := []*mock.Pin{mock.NewPin(0), mock.NewPin(1), mock.NewPin(2), mock.NewPin(3)}
+	var mu sync.Mutex
+	lit := map[[2]int]bool{}
+	check := func(gpio.Pinner) {
+		mu.Lock()
+		defer mu.Unlock()
+		for a, pa := range pins {
+			for c, pc := range pins {
+				if a != c && pa.Mode() == gpio.Output && pa.Read() &&
+					pc.Mode() == gpio.Output && !pc.Read() {
+					lit[[2]int{a, c}] = true
+				}
+			}
+		}
+	}
+	for _, p := range pins {
+		assert.Nil(t, p.Watch(gpio.EdgeBoth, check))
+	}
+	clk := clock.NewFake(time.Now())
+	m := charlieplex.New([]gpio.Pinner{pins[0], pins[1], pins[2], pins[3]},
+		charlieplex.WithRefreshRate(125), charlieplex.WithClock(clk))
+	// set while the first anode is scanned, so from the next scan of the row.
+	clk.BlockUntil(1)
+	m.SetLED(m.Index(2, 0), true)
+	m.SetLED(m.Index(2, 3), true)
+	modes := func() []gpio.Mode {
+		mm := make([]gpio.Mode, len(pins))
+		for i, p := range pins {
+			mm[i] = p.Mode()
+		}
+		return mm
+	}
+	in, out := gpio.Input, gpio.Output
+	for i := 1; i < 9; i++ {
+		// a 2ms slot per anode.
+		clk.Advance(2 * time.Millisecond)
+		clk.BlockUntil(1)
+		if i%4 != 2 {
+			assert.Equal(t, []gpio.Mode{in, in, in, in}, modes(), i)
+			continue
+		}
+		assert.Equal(t, []gpio.Mode{out, in, out, out}, modes(), i)
+		assert.Equal(t, gpio.High, pins[2].Read())
+		assert.Equal(t, gpio.Low, pins[0].Read())
+		assert.Equal(t, gpio.Low, pins[3].Read())
+	}
+	m.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[[2]int]bool{{2, 0}: true, {2, 3}: true}, lit)
+	for _, p := range pins {
+		assert.Equal(t, gpio.Input, p.Mode())
+	}
+}
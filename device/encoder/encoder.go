@@ -0,0 +1,290 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package encoder provides a decoder for quadrature encoders, providing
+// position and velocity, and odometry for differential drive robots.
+package encoder
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// steps maps the transition from the previous to the current state, indexed
+// by prev<<2|cur, to the change in position.
+//
+// The state is A<<1|B, and the forward sequence is 00, 10, 11, 01, i.e. A
+// leads B.  Invalid transitions, where both inputs change, are ignored.
+var steps = [16]int8{
+	0, -1, 1, 0,
+	1, 0, 0, -1,
+	-1, 0, 0, 1,
+	0, 1, -1, 0,
+}
+
+// Encoder decodes the A and B outputs of a quadrature encoder.
+//
+// All edges are counted, so the position is in quadrature counts, four per
+// cycle of the encoder.
+//
+// The velocity is estimated from the time between transitions, with
+// exponential smoothing.
+type Encoder struct {
+	a, b     gpio.Pinner
+	reversed bool
+	alpha    float64
+	stall    time.Duration
+	// Guards the following
+	mu       sync.Mutex
+	state    uint8
+	position int64
+	velocity float64
+	last     time.Time
+}
+
+// Option defines an option that can be applied when creating an Encoder.
+type Option func(*Encoder)
+
+// WithReversed reverses the direction of the encoder, e.g. for the encoder on
+// the opposite side of a robot.
+func WithReversed() Option {
+	return func(e *Encoder) {
+		e.reversed = true
+	}
+}
+
+// WithSmoothing sets the weight, in the range 0 to 1, given to each new
+// velocity measurement.
+//
+// Lower values are smoother, but slower to respond.  The default is 0.2.
+func WithSmoothing(alpha float64) Option {
+	return func(e *Encoder) {
+		if alpha > 0 && alpha <= 1 {
+			e.alpha = alpha
+		}
+	}
+}
+
+// WithStallTimeout sets the time without transitions after which the encoder
+// is considered stopped.
+//
+// The default is 100ms.
+func WithStallTimeout(d time.Duration) Option {
+	return func(e *Encoder) {
+		e.stall = d
+	}
+}
+
+// New creates an Encoder on the A and B pins.
+//
+// The pins are set to Inputs and watched for transitions.  Either pin may be
+// nil, in which case the transitions must be fed to the Encoder via Update,
+// e.g. from timestamped edge events.
+func New(a, b gpio.Pinner, options ...Option) (*Encoder, error) {
+	e := &Encoder{
+		a:     a,
+		b:     b,
+		alpha: 0.2,
+		stall: 100 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(e)
+	}
+	if a == nil || b == nil {
+		return e, nil
+	}
+	a.SetMode(gpio.Input)
+	b.SetMode(gpio.Input)
+	e.state = state(a.Read(), b.Read())
+	handler := func(gpio.Pinner) {
+		e.Update(a.Read(), b.Read(), time.Now())
+	}
+	if err := a.Watch(gpio.EdgeBoth, handler); err != nil {
+		return nil, err
+	}
+	if err := b.Watch(gpio.EdgeBoth, handler); err != nil {
+		a.Unwatch()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Close stops watching the pins.
+func (e *Encoder) Close() {
+	if e.a == nil || e.b == nil {
+		return
+	}
+	e.a.Unwatch()
+	e.b.Unwatch()
+}
+
+// Position returns the position, in quadrature counts.
+func (e *Encoder) Position() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.position
+}
+
+// Reset sets the position to 0.
+func (e *Encoder) Reset() {
+	e.mu.Lock()
+	e.position = 0
+	e.mu.Unlock()
+}
+
+// Velocity returns the velocity, in counts per second.
+//
+// If no transition has occurred recently then the velocity is limited to
+// that implied by the time since the last transition, and is 0 once the
+// stall timeout has passed.
+func (e *Encoder) Velocity() float64 {
+	return e.velocityAt(time.Now())
+}
+
+func (e *Encoder) velocityAt(now time.Time) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.last.IsZero() {
+		return 0
+	}
+	since := now.Sub(e.last)
+	if since > e.stall {
+		return 0
+	}
+	if since > 0 {
+		if max := float64(time.Second) / float64(since); math.Abs(e.velocity) > max {
+			return math.Copysign(max, e.velocity)
+		}
+	}
+	return e.velocity
+}
+
+// Update updates the encoder with the levels of the A and B inputs at the
+// time t.
+func (e *Encoder) Update(a, b gpio.Level, t time.Time) {
+	cur := state(a, b)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	step := int64(steps[e.state<<2|cur])
+	e.state = cur
+	if step == 0 {
+		return
+	}
+	if e.reversed {
+		step = -step
+	}
+	e.position += step
+	if !e.last.IsZero() {
+		if dt := t.Sub(e.last); dt > 0 && dt <= e.stall {
+			v := float64(step) * float64(time.Second) / float64(dt)
+			if e.velocity == 0 || (v > 0) != (e.velocity > 0) {
+				// starting, or changing direction.
+				e.velocity = v
+			} else {
+				e.velocity += e.alpha * (v - e.velocity)
+			}
+		} else {
+			e.velocity = 0
+		}
+	}
+	e.last = t
+}
+
+func state(a, b gpio.Level) uint8 {
+	var s uint8
+	if a {
+		s |= 2
+	}
+	if b {
+		s |= 1
+	}
+	return s
+}
+
+// Odometry tracks the pose of a differential drive robot from the encoders
+// on its left and right wheels.
+//
+// The encoders should be configured so that both count up when the robot
+// moves forward.
+type Odometry struct {
+	left, right *Encoder
+	// the distance travelled by a wheel per count.
+	scale float64
+	// the distance between the wheels.
+	track float64
+	// Guards the following
+	mu      sync.Mutex
+	lastL   int64
+	lastR   int64
+	x, y    float64
+	heading float64
+}
+
+// NewOdometry creates an Odometry from the encoders, with the distance
+// travelled by each wheel per encoder count, and the distance between the
+// wheels, in the same units.
+//
+// The robot starts at the origin, heading along the x axis.
+func NewOdometry(left, right *Encoder, distancePerCount, trackWidth float64) *Odometry {
+	return &Odometry{
+		left:  left,
+		right: right,
+		scale: distancePerCount,
+		track: trackWidth,
+		lastL: left.Position(),
+		lastR: right.Position(),
+	}
+}
+
+// Update integrates the movement of the wheels since the previous update into
+// the pose.
+//
+// Update should be called frequently, as the path between updates is
+// assumed to be a circular arc.
+func (o *Odometry) Update() {
+	l := o.left.Position()
+	r := o.right.Position()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	dl := float64(l-o.lastL) * o.scale
+	dr := float64(r-o.lastR) * o.scale
+	o.lastL = l
+	o.lastR = r
+	d := (dl + dr) / 2
+	dh := (dr - dl) / o.track
+	// midpoint integration of the arc.
+	mid := o.heading + dh/2
+	o.x += d * math.Cos(mid)
+	o.y += d * math.Sin(mid)
+	o.heading = math.Remainder(o.heading+dh, 2*math.Pi)
+}
+
+// Pose returns the position and heading, in radians anticlockwise from the x
+// axis in the range -π to π, as of the most recent Update.
+func (o *Odometry) Pose() (x, y, heading float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.x, o.y, o.heading
+}
+
+// SetPose sets the position and heading.
+func (o *Odometry) SetPose(x, y, heading float64) {
+	o.mu.Lock()
+	o.x = x
+	o.y = y
+	o.heading = math.Remainder(heading, 2*math.Pi)
+	o.mu.Unlock()
+}
+
+// Velocity returns the linear velocity, in distance units per second, and the
+// angular velocity, in radians per second, of the robot.
+func (o *Odometry) Velocity() (linear, angular float64) {
+	vl := o.left.Velocity() * o.scale
+	vr := o.right.Velocity() * o.scale
+	return (vl + vr) / 2, (vr - vl) / o.track
+}
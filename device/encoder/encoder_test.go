@@ -0,0 +1,176 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package encoder_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/device/encoder"
+	"github.com/warthog618/gpio/mock"
+)
+
+// forward is the sequence of A and B levels for forward rotation.
+var forward = [][2]gpio.Level{
+	{gpio.High, gpio.Low},
+	{gpio.High, gpio.High},
+	{gpio.Low, gpio.High},
+	{gpio.Low, gpio.Low},
+}
+
+// step feeds n steps to the encoder, ending now, with the given interval
+// between steps.  Negative n steps in reverse.
+func step(e *encoder.Encoder, pos *int, n int, interval time.Duration) {
+	dir := 1
+	if n < 0 {
+		dir = -1
+		n = -n
+	}
+	start := time.Now().Add(-time.Duration(n-1) * interval)
+	for i := 0; i < n; i++ {
+		*pos = (*pos + dir + 4) % 4
+		s := forward[(*pos+3)%4]
+		e.Update(s[0], s[1], start.Add(time.Duration(i)*interval))
+	}
+}
+
+func TestEncoderPins(t *testing.T) {
+	a := mock.NewPin(1)
+	b := mock.NewPin(2)
+	e, err := encoder.New(a, b)
+	require.Nil(t, err)
+	assert.Equal(t, gpio.Input, a.Mode())
+	assert.Equal(t, gpio.Input, b.Mode())
+	for i := 0; i < 3; i++ {
+		for _, s := range forward {
+			a.Set(s[0])
+			b.Set(s[1])
+		}
+	}
+	assert.Equal(t, int64(12), e.Position())
+	// reverse
+	b.Set(gpio.High)
+	a.Set(gpio.High)
+	assert.Equal(t, int64(10), e.Position())
+	e.Reset()
+	assert.Equal(t, int64(0), e.Position())
+	e.Close()
+	a.Set(gpio.Low)
+	assert.Equal(t, int64(0), e.Position())
+
+	// busy
+	c := mock.NewPin(3)
+	assert.Nil(t, c.Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+	_, err = encoder.New(a, c)
+	assert.Equal(t, gpio.ErrBusy, err)
+	// a is released
+	_, err = encoder.New(a, b)
+	assert.Nil(t, err)
+}
+
+func TestEncoderInvalid(t *testing.T) {
+	e, err := encoder.New(nil, nil)
+	require.Nil(t, err)
+	now := time.Now()
+	e.Update(gpio.High, gpio.High, now)
+	assert.Equal(t, int64(0), e.Position())
+	e.Update(gpio.Low, gpio.High, now)
+	assert.Equal(t, int64(1), e.Position())
+}
+
+func TestEncoderVelocity(t *testing.T) {
+	e, err := encoder.New(nil, nil, encoder.WithSmoothing(0.5))
+	require.Nil(t, err)
+	assert.Equal(t, 0.0, e.Velocity())
+	var pos int
+	// 1000 counts per second
+	step(e, &pos, 20, time.Millisecond)
+	assert.Equal(t, int64(20), e.Position())
+	assert.InDelta(t, 1000, e.Velocity(), 50)
+	// slowing exponentially approaches the new rate.
+	step(e, &pos, 1, 2*time.Millisecond)
+	// the final step is "now", so lag the start of the next run.
+	time.Sleep(2 * time.Millisecond)
+	step(e, &pos, 10, 2*time.Millisecond)
+	assert.InDelta(t, 500, e.Velocity(), 50)
+	// reverse
+	step(e, &pos, -10, time.Millisecond)
+	assert.Equal(t, int64(21), e.Position())
+	assert.InDelta(t, -1000, e.Velocity(), 50)
+	// decays while stopped, then stalls.
+	time.Sleep(20 * time.Millisecond)
+	v := e.Velocity()
+	assert.True(t, v < 0 && v > -60, v)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0.0, e.Velocity())
+}
+
+func TestEncoderReversed(t *testing.T) {
+	e, err := encoder.New(nil, nil, encoder.WithReversed())
+	require.Nil(t, err)
+	var pos int
+	step(e, &pos, 8, time.Millisecond)
+	assert.Equal(t, int64(-8), e.Position())
+	assert.True(t, e.Velocity() < 0)
+}
+
+func TestOdometry(t *testing.T) {
+	l, err := encoder.New(nil, nil)
+	require.Nil(t, err)
+	r, err := encoder.New(nil, nil)
+	require.Nil(t, err)
+	var lpos, rpos int
+	// 1mm per count, 100mm track
+	o := encoder.NewOdometry(l, r, 0.001, 0.1)
+	x, y, h := o.Pose()
+	assert.Equal(t, []float64{0, 0, 0}, []float64{x, y, h})
+
+	// straight ahead 100mm
+	step(l, &lpos, 100, 0)
+	step(r, &rpos, 100, 0)
+	o.Update()
+	x, y, h = o.Pose()
+	assert.InDelta(t, 0.1, x, 1e-9)
+	assert.InDelta(t, 0, y, 1e-9)
+	assert.InDelta(t, 0, h, 1e-9)
+
+	// spin anticlockwise on the spot, quarter turn in small steps.
+	// each wheel travels π/2 * 50mm, ~79 counts.
+	for i := 0; i < 79; i++ {
+		step(l, &lpos, -1, 0)
+		step(r, &rpos, 1, 0)
+		o.Update()
+	}
+	x, y, h = o.Pose()
+	assert.InDelta(t, 0.1, x, 1e-3)
+	assert.InDelta(t, 0, y, 1e-3)
+	assert.InDelta(t, math.Pi/2, h, 0.02)
+
+	// forward along y
+	step(l, &lpos, 50, 0)
+	step(r, &rpos, 50, 0)
+	o.Update()
+	x, y, _ = o.Pose()
+	assert.InDelta(t, 0.1, x, 1e-3)
+	assert.InDelta(t, 0.05, y, 1e-3)
+
+	o.SetPose(1, 2, 3*math.Pi)
+	x, y, h = o.Pose()
+	assert.Equal(t, 1.0, x)
+	assert.Equal(t, 2.0, y)
+	assert.InDelta(t, math.Pi, math.Abs(h), 1e-9)
+
+	// velocity
+	step(l, &lpos, 10, time.Millisecond)
+	step(r, &rpos, 10, time.Millisecond)
+	lin, ang := o.Velocity()
+	assert.InDelta(t, 1, lin, 0.1)
+	assert.InDelta(t, 0, ang, 1)
+}
@@ -0,0 +1,316 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package fan provides a controller for PWM controlled fans, with optional
+// tachometer feedback, such as Raspberry Pi case fans and 4-pin PC fans.
+package fan
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/pwm"
+)
+
+// Fan is a fan with its speed controlled by a PWM, and optionally reporting
+// its speed via a tachometer output.
+//
+// The speed can either be set directly, or controlled by a curve mapping
+// temperature to duty cycle.
+type Fan struct {
+	pwm     *pwm.PWM
+	tach    gpio.Pinner
+	ppr     int
+	minDuty float64
+	stall   time.Duration
+	clock   clock.Clock
+	wg      sync.WaitGroup
+	// Guards the following
+	mu     sync.Mutex
+	duty   float64
+	synced bool
+	// the times of the most recent tach pulses, spanning one revolution.
+	pulses []time.Time
+	// the control loop, if running.
+	done chan struct{}
+}
+
+// Option defines an option that can be applied when creating a Fan.
+type Option func(*config)
+
+type config struct {
+	freq      float64
+	activeLow bool
+	tach      gpio.Pinner
+	ppr       int
+	minDuty   float64
+	stall     time.Duration
+	clock     clock.Clock
+}
+
+// WithFrequency sets the frequency of the PWM, in Hz.
+//
+// The default is 100Hz, which suits fans switched by a transistor.  4-pin PC
+// fans nominally expect 25kHz, but most will accept much lower frequencies,
+// which are more practical for a software PWM.
+func WithFrequency(freq float64) Option {
+	return func(c *config) {
+		c.freq = freq
+	}
+}
+
+// WithActiveLow inverts the PWM, for drivers that turn the fan on when the pin
+// is driven low.
+func WithActiveLow() Option {
+	return func(c *config) {
+		c.activeLow = true
+	}
+}
+
+// WithTach provides the pin connected to the open collector tachometer output
+// of the fan, which must be pulled up.
+func WithTach(pin gpio.Pinner) Option {
+	return func(c *config) {
+		c.tach = pin
+	}
+}
+
+// WithPulsesPerRev sets the number of tachometer pulses per revolution.
+//
+// The default is 2, as for most PC fans.
+func WithPulsesPerRev(ppr int) Option {
+	return func(c *config) {
+		if ppr > 0 {
+			c.ppr = ppr
+		}
+	}
+}
+
+// WithMinDuty sets the minimum duty cycle that will keep the fan spinning.
+//
+// Non-zero duty cycles below the minimum are raised to the minimum, so the
+// fan is either stopped or spinning.  The default is 0.
+func WithMinDuty(duty float64) Option {
+	return func(c *config) {
+		c.minDuty = duty
+	}
+}
+
+// WithStallTimeout sets the time without tach pulses after which the fan is
+// considered stopped.
+//
+// The default is 1s.
+func WithStallTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.stall = d
+	}
+}
+
+// WithClock sets the clock used to time the PWM, the tach and the control
+// loop, e.g. a clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// New creates a Fan controlled by a PWM on the pin.
+//
+// The fan is initially stopped.
+func New(pin gpio.Pinner, options ...Option) (*Fan, error) {
+	cfg := config{freq: 100, ppr: 2, stall: time.Second, clock: clock.Real}
+	for _, option := range options {
+		option(&cfg)
+	}
+	popts := []pwm.Option{pwm.WithClock(cfg.clock)}
+	if cfg.activeLow {
+		popts = append(popts, pwm.WithActiveLow())
+	}
+	f := &Fan{
+		tach:    cfg.tach,
+		ppr:     cfg.ppr,
+		minDuty: cfg.minDuty,
+		stall:   cfg.stall,
+		clock:   cfg.clock,
+		pulses:  make([]time.Time, 0, cfg.ppr+1),
+	}
+	if f.tach != nil {
+		f.tach.SetMode(gpio.Input)
+		if err := f.tach.Watch(gpio.EdgeFalling, f.pulse); err != nil {
+			return nil, err
+		}
+	}
+	f.pwm = pwm.New(pin, cfg.freq, popts...)
+	return f, nil
+}
+
+// Close stops any control loop and the fan, and releases the pins.
+func (f *Fan) Close() {
+	f.Stop()
+	if f.tach != nil {
+		f.tach.Unwatch()
+	}
+	f.pwm.Close()
+}
+
+// Duty returns the current duty cycle of the fan, in the range 0 to 1.
+func (f *Fan) Duty() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.duty
+}
+
+// SetDuty sets the duty cycle of the fan, in the range 0 to 1, stopping any
+// control loop.
+func (f *Fan) SetDuty(duty float64) {
+	f.Stop()
+	f.setDuty(duty)
+}
+
+func (f *Fan) setDuty(duty float64) {
+	if duty <= 0 {
+		duty = 0
+	} else if duty < f.minDuty {
+		duty = f.minDuty
+	} else if duty > 1 {
+		duty = 1
+	}
+	f.mu.Lock()
+	f.duty = duty
+	f.mu.Unlock()
+	f.pwm.SetDuty(duty)
+}
+
+// RPM returns the speed of the fan, in revolutions per minute, measured over
+// the most recent revolution.
+//
+// Returns 0 if the fan has no tach, or has stalled.
+func (f *Fan) RPM() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.pulses)
+	if n < 2 {
+		return 0
+	}
+	last := f.pulses[n-1]
+	if f.clock.Now().Sub(last) > f.stall {
+		return 0
+	}
+	revs := float64(n-1) / float64(f.ppr)
+	return revs * float64(time.Minute) / float64(last.Sub(f.pulses[0]))
+}
+
+func (f *Fan) pulse(pin gpio.Pinner) {
+	now := f.clock.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// ignore the initial call made by the watch.
+	if !f.synced {
+		f.synced = true
+		return
+	}
+	if len(f.pulses) > 0 && now.Sub(f.pulses[len(f.pulses)-1]) > f.stall {
+		// restarting after a stall.
+		f.pulses = f.pulses[:0]
+	}
+	if len(f.pulses) == cap(f.pulses) {
+		copy(f.pulses, f.pulses[1:])
+		f.pulses = f.pulses[:len(f.pulses)-1]
+	}
+	f.pulses = append(f.pulses, now)
+}
+
+// Point is a point on a Curve.
+type Point struct {
+	// Temp is the temperature, in whatever units the temperature source
+	// returns.
+	Temp float64
+
+	// Duty is the duty cycle at the temperature, in the range 0 to 1.
+	Duty float64
+}
+
+// Curve maps temperature to duty cycle, by linear interpolation between
+// points.
+//
+// Temperatures below the first point map to the duty of the first point, and
+// above the last map to the duty of the last.
+type Curve []Point
+
+// Duty returns the duty cycle for the temperature.
+func (c Curve) Duty(temp float64) float64 {
+	if len(c) == 0 {
+		return 0
+	}
+	pp := make(Curve, len(c))
+	copy(pp, c)
+	sort.Slice(pp, func(i, j int) bool { return pp[i].Temp < pp[j].Temp })
+	if temp <= pp[0].Temp {
+		return pp[0].Duty
+	}
+	for i := 1; i < len(pp); i++ {
+		if temp <= pp[i].Temp {
+			lo, hi := pp[i-1], pp[i]
+			return lo.Duty + (hi.Duty-lo.Duty)*(temp-lo.Temp)/(hi.Temp-lo.Temp)
+		}
+	}
+	return pp[len(pp)-1].Duty
+}
+
+// Run starts a control loop which reads the temperature, and sets the duty
+// cycle from the curve, every interval.
+//
+// If the temperature cannot be read then the fan is run at full speed, so a
+// failed sensor errs on the side of cooling.  Any existing control loop is
+// stopped.
+func (f *Fan) Run(temp func() (float64, error), curve Curve, interval time.Duration) {
+	f.Stop()
+	done := make(chan struct{})
+	f.mu.Lock()
+	f.done = done
+	f.mu.Unlock()
+	update := func() {
+		t, err := temp()
+		if err != nil {
+			f.setDuty(1)
+			return
+		}
+		f.setDuty(curve.Duty(t))
+	}
+	update()
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		t := f.clock.NewTimer(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C():
+				update()
+				t.Reset(interval)
+			}
+		}
+	}()
+}
+
+// Stop stops the control loop, if running, leaving the fan at its current
+// duty cycle.
+func (f *Fan) Stop() {
+	f.mu.Lock()
+	done := f.done
+	f.done = nil
+	f.mu.Unlock()
+	if done != nil {
+		close(done)
+		f.wg.Wait()
+	}
+}
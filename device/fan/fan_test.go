@@ -0,0 +1,172 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package fan_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/fan"
+	"github.com/warthog618/gpio/mock"
+)
+
+func TestDuty(t *testing.T) {
+	pin := mock.NewPin(1)
+	f, err := fan.New(pin, fan.WithMinDuty(0.2))
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.Output, pin.Mode())
+	assert.Equal(t, gpio.Low, pin.Read())
+	assert.Equal(t, 0.0, f.Duty())
+	f.SetDuty(1)
+	assert.Equal(t, gpio.High, pin.Read())
+	assert.Equal(t, 1.0, f.Duty())
+	f.SetDuty(0.1)
+	assert.Equal(t, 0.2, f.Duty())
+	f.SetDuty(0.5)
+	assert.Equal(t, 0.5, f.Duty())
+	f.SetDuty(2)
+	assert.Equal(t, 1.0, f.Duty())
+	f.SetDuty(-1)
+	assert.Equal(t, 0.0, f.Duty())
+	assert.Equal(t, gpio.Low, pin.Read())
+	// no tach
+	assert.Equal(t, 0.0, f.RPM())
+	f.SetDuty(1)
+	f.Close()
+	assert.Equal(t, gpio.Low, pin.Read())
+}
+
+func TestActiveLow(t *testing.T) {
+	pin := mock.NewPin(1)
+	f, err := fan.New(pin, fan.WithActiveLow())
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.High, pin.Read())
+	f.SetDuty(1)
+	assert.Equal(t, gpio.Low, pin.Read())
+	f.Close()
+	assert.Equal(t, gpio.High, pin.Read())
+}
+
+func TestRPM(t *testing.T) {
+	pin := mock.NewPin(1)
+	tach := mock.NewPin(2)
+	tach.Set(gpio.High)
+	clk := clock.NewFake(time.Now())
+	f, err := fan.New(pin,
+		fan.WithTach(tach),
+		fan.WithPulsesPerRev(2),
+		fan.WithStallTimeout(100*time.Millisecond),
+		fan.WithClock(clk))
+	assert.Nil(t, err)
+	defer f.Close()
+	assert.Equal(t, gpio.Input, tach.Mode())
+	assert.Equal(t, 0.0, f.RPM())
+	// 2 pulses per 20ms => 3000 RPM
+	pulse := func() {
+		tach.Set(gpio.Low)
+		tach.Set(gpio.High)
+	}
+	pulse()
+	assert.Equal(t, 0.0, f.RPM())
+	for i := 0; i < 5; i++ {
+		clk.Advance(10 * time.Millisecond)
+		pulse()
+	}
+	assert.Equal(t, 3000.0, f.RPM())
+	// measured over the last revolution
+	clk.Advance(20 * time.Millisecond)
+	pulse()
+	assert.Equal(t, 2000.0, f.RPM())
+	clk.Advance(100 * time.Millisecond)
+	assert.Equal(t, 2000.0, f.RPM())
+	clk.Advance(time.Millisecond)
+	assert.Equal(t, 0.0, f.RPM())
+	// restarting after a stall
+	pulse()
+	assert.Equal(t, 0.0, f.RPM())
+	clk.Advance(15 * time.Millisecond)
+	pulse()
+	assert.Equal(t, 2000.0, f.RPM())
+
+	// tach already watched.
+	_, err = fan.New(mock.NewPin(3), fan.WithTach(tach))
+	assert.Equal(t, gpio.ErrBusy, err)
+}
+
+func TestCurve(t *testing.T) {
+	c := fan.Curve{{Temp: 70, Duty: 1}, {Temp: 40, Duty: 0}, {Temp: 50, Duty: 0.5}}
+	patterns := []struct {
+		temp float64
+		duty float64
+	}{
+		{20, 0},
+		{40, 0},
+		{45, 0.25},
+		{50, 0.5},
+		{60, 0.75},
+		{70, 1},
+		{90, 1},
+	}
+	for _, p := range patterns {
+		assert.InDelta(t, p.duty, c.Duty(p.temp), 0.0001, p.temp)
+	}
+	assert.Equal(t, 0.0, fan.Curve{}.Duty(50))
+}
+
+func TestRun(t *testing.T) {
+	pin := mock.NewPin(1)
+	clk := clock.NewFake(time.Now())
+	f, err := fan.New(pin, fan.WithClock(clk))
+	assert.Nil(t, err)
+	defer f.Close()
+	var temp int64 = 40
+	var fail int32
+	src := func() (float64, error) {
+		if atomic.LoadInt32(&fail) != 0 {
+			return 0, errors.New("sensor failed")
+		}
+		return float64(atomic.LoadInt64(&temp)), nil
+	}
+	// constant duty cycles, so the loop has the only timer.
+	c := fan.Curve{{Temp: 40, Duty: 0}, {Temp: 60, Duty: 1}}
+	interval := 5 * time.Millisecond
+	f.Run(src, c, interval)
+	assert.Equal(t, 0.0, f.Duty())
+	// tick advances the clock by the interval, once the loop is waiting, and
+	// waits for the update.
+	tick := func() {
+		clk.BlockUntil(1)
+		clk.Advance(interval)
+		clk.BlockUntil(1)
+	}
+	atomic.StoreInt64(&temp, 60)
+	clk.BlockUntil(1)
+	clk.Advance(interval - time.Microsecond)
+	assert.Equal(t, 0.0, f.Duty())
+	clk.Advance(time.Microsecond)
+	clk.BlockUntil(1)
+	assert.Equal(t, 1.0, f.Duty())
+	assert.Equal(t, gpio.High, pin.Read())
+	atomic.StoreInt64(&temp, 30)
+	tick()
+	assert.Equal(t, 0.0, f.Duty())
+	assert.Equal(t, gpio.Low, pin.Read())
+	atomic.StoreInt32(&fail, 1)
+	tick()
+	assert.Equal(t, 1.0, f.Duty())
+
+	// SetDuty stops the loop.
+	f.SetDuty(0)
+	atomic.StoreInt32(&fail, 0)
+	assert.Zero(t, clk.Pending())
+	clk.Advance(time.Second)
+	assert.Equal(t, 0.0, f.Duty())
+}
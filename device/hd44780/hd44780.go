@@ -0,0 +1,323 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package hd44780 provides a driver for HD44780 character LCDs in 4-bit
+// parallel mode.
+package hd44780
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Commands
+const (
+	cmdClear       = 0x01
+	cmdHome        = 0x02
+	cmdEntryMode   = 0x04
+	cmdDisplay     = 0x08
+	cmdFunctionSet = 0x20
+	cmdSetCGRAM    = 0x40
+	cmdSetDDRAM    = 0x80
+
+	entryIncrement = 0x02
+	displayOn      = 0x04
+	cursorOn       = 0x02
+	blinkOn        = 0x01
+	function2Line  = 0x08
+	// the 8-bit function set used to synchronise the interface.
+	function8Bit = 0x03
+	// the 4-bit function set, without the line bit.
+	function4Bit = 0x02
+)
+
+// Timings
+const (
+	// the minimum width of the enable pulse is 450ns.
+	tEnable = time.Microsecond
+	// the execution time of most commands.
+	tCommand = 50 * time.Microsecond
+	// the execution time of clear and home.
+	tClear = 2 * time.Millisecond
+	// the power on time before the display can be initialised.
+	tPowerOn = 50 * time.Millisecond
+	// the maximum time to wait on the busy flag.
+	tBusyTimeout = 10 * time.Millisecond
+)
+
+// HD44780 is an HD44780 character LCD driven in 4-bit mode.
+//
+// By default the driver waits the worst case execution time after each
+// command.  If the R/W pin is provided then the busy flag is polled instead.
+type HD44780 struct {
+	rs    gpio.Pinner
+	e     gpio.Pinner
+	rw    gpio.Pinner
+	data  [4]gpio.Pinner
+	cols  int
+	rows  int
+	clock clock.Clock
+	// Guards the following and the sequencing of writes to the display.
+	mu      sync.Mutex
+	display byte
+}
+
+// Option defines an option that can be applied when creating an HD44780.
+type Option func(*HD44780)
+
+// WithRW provides the pin connected to the R/W input, so that the busy flag
+// can be polled rather than waiting the worst case command time.
+//
+// If not provided then R/W must be tied low.
+func WithRW(pin gpio.Pinner) Option {
+	return func(d *HD44780) {
+		d.rw = pin
+	}
+}
+
+// WithClock sets the clock used to time the commands, e.g. a clock.Fake for
+// tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(d *HD44780) {
+		d.clock = c
+	}
+}
+
+// New creates an HD44780 with the given number of columns and rows, e.g. 16x2
+// or 20x4, and initialises the display.
+//
+// The data pins are D4-D7 of the display, in that order.
+// The display is initially clear, with the cursor hidden.
+func New(rs, e gpio.Pinner, data [4]gpio.Pinner, cols, rows int, options ...Option) *HD44780 {
+	d := &HD44780{
+		rs:    rs,
+		e:     e,
+		data:  data,
+		cols:  cols,
+		rows:  rows,
+		clock: clock.Real,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	for _, p := range append([]gpio.Pinner{rs, e}, data[:]...) {
+		p.Write(gpio.Low)
+		p.SetMode(gpio.Output)
+	}
+	if d.rw != nil {
+		d.rw.Write(gpio.Low)
+		d.rw.SetMode(gpio.Output)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock.Sleep(tPowerOn)
+	// synchronise to 8-bit mode, from an unknown state, then switch to 4-bit
+	// mode, as per the datasheet initialisation by instruction.
+	d.writeNibble(function8Bit)
+	d.clock.Sleep(5 * time.Millisecond)
+	d.writeNibble(function8Bit)
+	d.clock.Sleep(200 * time.Microsecond)
+	d.writeNibble(function8Bit)
+	d.clock.Sleep(tCommand)
+	d.writeNibble(function4Bit)
+	d.clock.Sleep(tCommand)
+	function := byte(cmdFunctionSet)
+	if rows > 1 {
+		function |= function2Line
+	}
+	d.command(function)
+	d.command(cmdDisplay)
+	d.command(cmdClear)
+	d.command(cmdEntryMode | entryIncrement)
+	d.display = displayOn
+	d.command(cmdDisplay | d.display)
+	return d
+}
+
+// Close clears and turns off the display, and releases the pins.
+func (d *HD44780) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.command(cmdClear)
+	d.command(cmdDisplay)
+	for _, p := range append([]gpio.Pinner{d.rs, d.e}, d.data[:]...) {
+		p.SetMode(gpio.Input)
+	}
+	if d.rw != nil {
+		d.rw.SetMode(gpio.Input)
+	}
+}
+
+// Cols returns the number of columns of the display.
+func (d *HD44780) Cols() int {
+	return d.cols
+}
+
+// Rows returns the number of rows of the display.
+func (d *HD44780) Rows() int {
+	return d.rows
+}
+
+// Clear clears the display and returns the cursor to the top left.
+func (d *HD44780) Clear() {
+	d.mu.Lock()
+	d.command(cmdClear)
+	d.mu.Unlock()
+}
+
+// Home returns the cursor to the top left.
+func (d *HD44780) Home() {
+	d.mu.Lock()
+	d.command(cmdHome)
+	d.mu.Unlock()
+}
+
+// SetCursor moves the cursor to the column and row, where 0,0 is the top left.
+//
+// Positions outside the display are ignored.
+func (d *HD44780) SetCursor(col, row int) {
+	if col < 0 || col >= d.cols || row < 0 || row >= d.rows {
+		return
+	}
+	// rows 2 and 3 are continuations of rows 0 and 1.
+	addr := byte(col + row/2*d.cols)
+	if row%2 == 1 {
+		addr += 0x40
+	}
+	d.mu.Lock()
+	d.command(cmdSetDDRAM | addr)
+	d.mu.Unlock()
+}
+
+// Print writes the text to the display at the cursor.
+//
+// The text is written as bytes, so characters 0-7 display the custom
+// characters, and other characters map to the display character ROM, which
+// matches ASCII for most printable characters.
+func (d *HD44780) Print(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := 0; i < len(text); i++ {
+		d.write(text[i])
+	}
+}
+
+// ShowCursor sets whether the cursor is displayed as an underline.
+func (d *HD44780) ShowCursor(show bool) {
+	d.setDisplay(cursorOn, show)
+}
+
+// Blink sets whether the character at the cursor blinks.
+func (d *HD44780) Blink(blink bool) {
+	d.setDisplay(blinkOn, blink)
+}
+
+// Display sets whether the display is on.
+//
+// The contents of the display are retained while it is off.
+func (d *HD44780) Display(on bool) {
+	d.setDisplay(displayOn, on)
+}
+
+func (d *HD44780) setDisplay(flag byte, set bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if set {
+		d.display |= flag
+	} else {
+		d.display &^= flag
+	}
+	d.command(cmdDisplay | d.display)
+}
+
+// CreateChar defines the custom character, 0-7, with the pattern of its 8
+// rows, top to bottom, each with the 5 columns in the low bits.
+//
+// The cursor position is reset to the top left.
+func (d *HD44780) CreateChar(ch int, pattern [8]byte) {
+	if ch < 0 || ch > 7 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.command(cmdSetCGRAM | byte(ch<<3))
+	for _, row := range pattern {
+		d.write(row & 0x1f)
+	}
+	d.command(cmdSetDDRAM)
+}
+
+// command sends a command to the display.
+// Assumes caller holds the mu lock.
+func (d *HD44780) command(cmd byte) {
+	d.rs.Write(gpio.Low)
+	d.writeByte(cmd)
+	if cmd == cmdClear || cmd == cmdHome {
+		d.wait(tClear)
+	} else {
+		d.wait(tCommand)
+	}
+}
+
+// write writes data to the display RAM.
+// Assumes caller holds the mu lock.
+func (d *HD44780) write(data byte) {
+	d.rs.Write(gpio.High)
+	d.writeByte(data)
+	d.wait(tCommand)
+}
+
+func (d *HD44780) writeByte(b byte) {
+	d.writeNibble(b >> 4)
+	d.writeNibble(b)
+}
+
+// writeNibble writes the low 4 bits of n to D4-D7, and strobes E.
+func (d *HD44780) writeNibble(n byte) {
+	for i, p := range d.data {
+		p.Write(n>>uint(i)&0x01 == 0x01)
+	}
+	d.e.Write(gpio.High)
+	d.clock.Sleep(tEnable)
+	d.e.Write(gpio.Low)
+}
+
+// wait waits for the display to complete a command, either by polling the busy
+// flag or waiting the worst case execution time.
+func (d *HD44780) wait(max time.Duration) {
+	if d.rw == nil {
+		d.clock.Sleep(max)
+		return
+	}
+	for _, p := range d.data {
+		p.SetMode(gpio.Input)
+	}
+	d.rs.Write(gpio.Low)
+	d.rw.Write(gpio.High)
+	deadline := d.clock.Now().Add(tBusyTimeout)
+	for {
+		// the busy flag is D7 of the upper nibble, and the lower nibble
+		// must also be clocked out.
+		d.e.Write(gpio.High)
+		d.clock.Sleep(tEnable)
+		busy := d.data[3].Read()
+		d.e.Write(gpio.Low)
+		d.e.Write(gpio.High)
+		d.clock.Sleep(tEnable)
+		d.e.Write(gpio.Low)
+		if busy == gpio.Low || d.clock.Now().After(deadline) {
+			break
+		}
+	}
+	d.rw.Write(gpio.Low)
+	for _, p := range d.data {
+		p.SetMode(gpio.Output)
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package hd44780_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/hd44780"
+	"github.com/warthog618/gpio/mock"
+)
+
+type bus struct {
+	rs, e, rw *mock.Pin
+	data      [4]*mock.Pin
+	// nibbles written, with RS in bit 4.
+	nibbles []byte
+	// the number of busy reads.
+	reads int
+}
+
+func newBus(rw bool) *bus {
+	b := &bus{rs: mock.NewPin(0), e: mock.NewPin(1)}
+	for i := range b.data {
+		b.data[i] = mock.NewPin(2 + i)
+	}
+	if rw {
+		b.rw = mock.NewPin(6)
+	}
+	b.e.Watch(gpio.EdgeFalling, func(gpio.Pinner) {
+		if b.e.Mode() != gpio.Output {
+			// the initial call from Watch.
+			return
+		}
+		if b.rw != nil && b.rw.Read() == gpio.High {
+			b.reads++
+			return
+		}
+		var n byte
+		for i, p := range b.data {
+			if p.Read() {
+				n |= 1 << uint(i)
+			}
+		}
+		if b.rs.Read() {
+			n |= 0x10
+		}
+		b.nibbles = append(b.nibbles, n)
+	})
+	return b
+}
+
+func (b *bus) pins() [4]gpio.Pinner {
+	return [4]gpio.Pinner{b.data[0], b.data[1], b.data[2], b.data[3]}
+}
+
+// bytes returns the bytes written, after the 4 initialisation nibbles, with
+// RS in bit 8.
+func (b *bus) bytes(t *testing.T) []int {
+	nn := b.nibbles[4:]
+	require.Equal(t, 0, len(nn)%2)
+	var bb []int
+	for i := 0; i < len(nn); i += 2 {
+		require.Equal(t, nn[i]&0x10, nn[i+1]&0x10)
+		bb = append(bb, int(nn[i]&0x10)<<4|int(nn[i]&0x0f)<<4|int(nn[i+1]&0x0f))
+	}
+	b.nibbles = b.nibbles[:4]
+	return bb
+}
+
+// run calls f, advancing the clock while f sleeps, and returns the time f
+// took according to the clock.
+func run(clk *clock.Fake, f func()) time.Duration {
+	start := clk.Now()
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return clk.Now().Sub(start)
+		default:
+		}
+		if clk.Pending() == 0 {
+			runtime.Gosched()
+			continue
+		}
+		// the resolution of the driver timings.
+		clk.Advance(time.Microsecond)
+	}
+}
+
+func TestNew(t *testing.T) {
+	b := newBus(false)
+	d := hd44780.New(b.rs, b.e, b.pins(), 16, 2)
+	assert.Equal(t, 16, d.Cols())
+	assert.Equal(t, 2, d.Rows())
+	assert.Equal(t, gpio.Output, b.e.Mode())
+	assert.Equal(t, gpio.Output, b.data[3].Mode())
+	require.True(t, len(b.nibbles) >= 4)
+	assert.Equal(t, []byte{0x03, 0x03, 0x03, 0x02}, b.nibbles[:4])
+	assert.Equal(t, []int{0x28, 0x08, 0x01, 0x06, 0x0c}, b.bytes(t))
+	d.Close()
+	assert.Equal(t, []int{0x01, 0x08}, b.bytes(t))
+	assert.Equal(t, gpio.Input, b.e.Mode())
+}
+
+func TestPrint(t *testing.T) {
+	b := newBus(false)
+	d := hd44780.New(b.rs, b.e, b.pins(), 20, 4)
+	b.bytes(t)
+	d.Print("Hi")
+	assert.Equal(t, []int{0x100 | 'H', 0x100 | 'i'}, b.bytes(t))
+	d.SetCursor(3, 1)
+	d.SetCursor(1, 2)
+	d.SetCursor(0, 3)
+	d.SetCursor(20, 0)
+	d.SetCursor(0, 4)
+	assert.Equal(t, []int{0x80 | 0x43, 0x80 | 0x15, 0x80 | 0x54}, b.bytes(t))
+	d.Clear()
+	d.Home()
+	assert.Equal(t, []int{0x01, 0x02}, b.bytes(t))
+}
+
+func TestDisplayControl(t *testing.T) {
+	b := newBus(false)
+	d := hd44780.New(b.rs, b.e, b.pins(), 16, 1)
+	assert.Equal(t, 0x20, b.bytes(t)[0])
+	d.ShowCursor(true)
+	d.Blink(true)
+	d.Display(false)
+	d.ShowCursor(false)
+	d.Display(true)
+	assert.Equal(t, []int{0x0e, 0x0f, 0x0b, 0x09, 0x0d}, b.bytes(t))
+}
+
+func TestCreateChar(t *testing.T) {
+	b := newBus(false)
+	d := hd44780.New(b.rs, b.e, b.pins(), 16, 2)
+	b.bytes(t)
+	d.CreateChar(2, [8]byte{0x1f, 0x11, 0x11, 0x11, 0x11, 0x11, 0x1f, 0xff})
+	d.CreateChar(8, [8]byte{})
+	assert.Equal(t, []int{0x50,
+		0x11f, 0x111, 0x111, 0x111, 0x111, 0x111, 0x11f, 0x11f,
+		0x80}, b.bytes(t))
+}
+
+func TestBusy(t *testing.T) {
+	b := newBus(true)
+	d := hd44780.New(b.rs, b.e, b.pins(), 16, 2, hd44780.WithRW(b.rw))
+	b.bytes(t)
+	assert.Equal(t, gpio.Output, b.rw.Mode())
+	assert.Equal(t, gpio.Low, b.rw.Read())
+	// each busy poll reads two nibbles.
+	b.reads = 0
+	d.Home()
+	assert.Equal(t, 2, b.reads)
+	// busy clears during the third poll, so is seen clear on the fourth.
+	b.reads = 0
+	b.data[3].Set(gpio.High)
+	b.e.Unwatch()
+	b.e.Watch(gpio.EdgeFalling, func(gpio.Pinner) {
+		if b.rw.Read() == gpio.High {
+			b.reads++
+			if b.reads == 5 {
+				b.data[3].Set(gpio.Low)
+			}
+		}
+	})
+	d.Home()
+	assert.Equal(t, 8, b.reads)
+	assert.Equal(t, gpio.Output, b.data[3].Mode())
+}
+
+func TestTiming(t *testing.T) {
+	b := newBus(false)
+	clk := clock.NewFake(time.Now())
+	var d *hd44780.HD44780
+	elapsed := run(clk, func() {
+		d = hd44780.New(b.rs, b.e, b.pins(), 16, 2, hd44780.WithClock(clk))
+	})
+	// the power on and synchronisation delays, then the 5 commands,
+	// including a clear, with 1us enable pulses for each nibble.
+	us := time.Microsecond
+	assert.Equal(t, 55300*us+4*us+2200*us+10*us, elapsed)
+	assert.Equal(t, []int{0x28, 0x08, 0x01, 0x06, 0x0c}, b.bytes(t))
+
+	assert.Equal(t, 2002*us, run(clk, d.Clear))
+	assert.Equal(t, 2002*us, run(clk, d.Home))
+	assert.Equal(t, 104*us, run(clk, func() { d.Print("Hi") }))
+	assert.Equal(t, 52*us, run(clk, func() { d.SetCursor(1, 1) }))
+	assert.Equal(t, []int{0x01, 0x02, 0x100 | 'H', 0x100 | 'i', 0xc1}, b.bytes(t))
+}
+
+func TestBusyTimeout(t *testing.T) {
+	b := newBus(true)
+	clk := clock.NewFake(time.Now())
+	var d *hd44780.HD44780
+	run(clk, func() {
+		d = hd44780.New(b.rs, b.e, b.pins(), 16, 2,
+			hd44780.WithRW(b.rw), hd44780.WithClock(clk))
+	})
+	// a stuck busy flag is polled for 10ms, then ignored.
+	b.data[3].Set(gpio.High)
+	b.reads = 0
+	elapsed := run(clk, d.Home)
+	assert.True(t, elapsed > 10*time.Millisecond && elapsed < 10010*time.Microsecond, elapsed)
+	assert.True(t, b.reads > 9000, b.reads)
+	assert.Equal(t, gpio.Low, b.rw.Read())
+	assert.Equal(t, gpio.Output, b.data[3].Mode())
+}
@@ -0,0 +1,327 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package max7219 provides a driver for daisy chained MAX7219 and MAX7221 LED
+// display drivers, as used in 8x8 LED matrix and 8 digit seven segment display
+// modules.
+package max7219
+
+import (
+	"sync"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/spi"
+)
+
+// Registers
+const (
+	regDigit0      = 0x01
+	regDecodeMode  = 0x09
+	regIntensity   = 0x0a
+	regScanLimit   = 0x0b
+	regShutdown    = 0x0c
+	regDisplayTest = 0x0f
+)
+
+// MaxIntensity is the maximum intensity of the display.
+const MaxIntensity = 15
+
+// Transport writes to a chain of MAX7219s.
+type Transport interface {
+	// Write shifts the data out, MSB first, within a single chip select,
+	// so the data is latched on the rising edge of chip select.
+	Write(data []byte) error
+}
+
+// MAX7219 is a chain of MAX7219s, each driving an 8x8 LED matrix, or 8 seven
+// segment digits, with a framebuffer.
+//
+// Module 0 is the module connected directly to the Raspberry Pi.
+//
+// For matrices, the framebuffer is presented as a single display, with
+// module 0 on the left, and bit 7 of each row as the leftmost column of the
+// module.  Drawing operations update the framebuffer, which is written to the
+// display by Display.
+type MAX7219 struct {
+	t       Transport
+	modules int
+	decode  byte
+	// Guards the following and the sequencing of writes to the chain.
+	mu        sync.Mutex
+	fb        [][8]byte
+	intensity uint8
+}
+
+// Option defines an option that can be applied when creating a MAX7219.
+type Option func(*MAX7219)
+
+// WithIntensity sets the initial intensity, 0-15.
+//
+// The default is 7.
+func WithIntensity(intensity uint8) Option {
+	return func(d *MAX7219) {
+		d.intensity = intensity
+	}
+}
+
+// WithDecode sets the digits that use Code B decoding, for seven segment
+// displays, with bit n corresponding to digit n.
+//
+// The default is no decoding, as required for matrices.
+func WithDecode(mask byte) Option {
+	return func(d *MAX7219) {
+		d.decode = mask
+	}
+}
+
+// New creates a chain of MAX7219s with the given number of modules, and
+// initialises them.
+//
+// The display is initially clear.
+func New(t Transport, modules int, options ...Option) (*MAX7219, error) {
+	d := &MAX7219{
+		t:         t,
+		modules:   modules,
+		fb:        make([][8]byte, modules),
+		intensity: 7,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	if d.intensity > MaxIntensity {
+		d.intensity = MaxIntensity
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, cmd := range [][2]byte{
+		{regDisplayTest, 0},
+		{regScanLimit, 7},
+		{regDecodeMode, d.decode},
+		{regIntensity, d.intensity},
+	} {
+		if err := d.writeAll(cmd[0], cmd[1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.display(); err != nil {
+		return nil, err
+	}
+	if err := d.writeAll(regShutdown, 1); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// NewSPI creates a chain of MAX7219s on the SPI bus.
+func NewSPI(bus *spi.SPI, modules int, options ...Option) (*MAX7219, error) {
+	return New(&SPITransport{bus}, modules, options...)
+}
+
+// Close shuts down the display.
+func (d *MAX7219) Close() error {
+	return d.Shutdown(true)
+}
+
+// Modules returns the number of modules in the chain.
+func (d *MAX7219) Modules() int {
+	return d.modules
+}
+
+// Width returns the width of the matrix, in pixels.
+func (d *MAX7219) Width() int {
+	return d.modules * 8
+}
+
+// Shutdown sets whether the display is shutdown.
+//
+// The display contents are retained while shutdown.
+func (d *MAX7219) Shutdown(shutdown bool) error {
+	var v byte
+	if !shutdown {
+		v = 1
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.writeAll(regShutdown, v)
+}
+
+// SetIntensity sets the intensity of the display, 0-15.
+func (d *MAX7219) SetIntensity(intensity uint8) error {
+	if intensity > MaxIntensity {
+		intensity = MaxIntensity
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.writeAll(regIntensity, intensity); err != nil {
+		return err
+	}
+	d.intensity = intensity
+	return nil
+}
+
+// Intensity returns the intensity of the display.
+func (d *MAX7219) Intensity() uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.intensity
+}
+
+// Display writes the framebuffer to the display.
+func (d *MAX7219) Display() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.display()
+}
+
+// Clear clears the framebuffer.
+func (d *MAX7219) Clear() {
+	d.mu.Lock()
+	for i := range d.fb {
+		d.fb[i] = [8]byte{}
+	}
+	d.mu.Unlock()
+}
+
+// SetRow sets the row, or digit, of the module, with bit 7 as the leftmost
+// column, or the DP segment of a digit.
+//
+// Rows outside the display are ignored.
+func (d *MAX7219) SetRow(module, row int, v byte) {
+	if module < 0 || module >= d.modules || row < 0 || row > 7 {
+		return
+	}
+	d.mu.Lock()
+	d.fb[module][row] = v
+	d.mu.Unlock()
+}
+
+// Row returns the row, or digit, of the module.
+func (d *MAX7219) Row(module, row int) byte {
+	if module < 0 || module >= d.modules || row < 0 || row > 7 {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fb[module][row]
+}
+
+// SetPixel sets the state of the pixel at x,y, where 0,0 is the top left of
+// module 0.
+//
+// Pixels outside the display are ignored.
+func (d *MAX7219) SetPixel(x, y int, on bool) {
+	d.mu.Lock()
+	d.setPixel(x, y, on)
+	d.mu.Unlock()
+}
+
+// Pixel returns the state of the pixel at x,y.
+func (d *MAX7219) Pixel(x, y int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pixel(x, y)
+}
+
+// ScrollLeft shifts the framebuffer left by one column, discarding the
+// leftmost column, and inserting col as the rightmost, with bit n of col
+// setting row n.
+func (d *MAX7219) ScrollLeft(col byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w := d.modules * 8
+	for y := 0; y < 8; y++ {
+		for x := 0; x < w-1; x++ {
+			d.setPixel(x, y, d.pixel(x+1, y))
+		}
+		d.setPixel(w-1, y, col&(1<<uint(y)) != 0)
+	}
+}
+
+// ScrollRight shifts the framebuffer right by one column, discarding the
+// rightmost column, and inserting col as the leftmost, with bit n of col
+// setting row n.
+func (d *MAX7219) ScrollRight(col byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for y := 0; y < 8; y++ {
+		for x := d.modules*8 - 1; x > 0; x-- {
+			d.setPixel(x, y, d.pixel(x-1, y))
+		}
+		d.setPixel(0, y, col&(1<<uint(y)) != 0)
+	}
+}
+
+// Assumes caller holds the mu lock.
+func (d *MAX7219) pixel(x, y int) bool {
+	if x < 0 || x >= d.modules*8 || y < 0 || y > 7 {
+		return false
+	}
+	return d.fb[x/8][y]&(0x80>>uint(x%8)) != 0
+}
+
+// Assumes caller holds the mu lock.
+func (d *MAX7219) setPixel(x, y int, on bool) {
+	if x < 0 || x >= d.modules*8 || y < 0 || y > 7 {
+		return
+	}
+	mask := byte(0x80 >> uint(x%8))
+	if on {
+		d.fb[x/8][y] |= mask
+	} else {
+		d.fb[x/8][y] &^= mask
+	}
+}
+
+// display writes the framebuffer to the chain, one row of all modules at a
+// time.
+// Assumes caller holds the mu lock.
+func (d *MAX7219) display() error {
+	for row := 0; row < 8; row++ {
+		buf := make([]byte, 0, d.modules*2)
+		// the data for the last module is shifted out first.
+		for m := d.modules - 1; m >= 0; m-- {
+			buf = append(buf, byte(regDigit0+row), d.fb[m][row])
+		}
+		if err := d.t.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAll writes the register of all modules in the chain.
+// Assumes caller holds the mu lock.
+func (d *MAX7219) writeAll(reg, v byte) error {
+	buf := make([]byte, 0, d.modules*2)
+	for m := 0; m < d.modules; m++ {
+		buf = append(buf, reg, v)
+	}
+	return d.t.Write(buf)
+}
+
+// SPITransport writes to a chain of MAX7219s via a bit bashed SPI bus.
+//
+// The MAX7219 is write only, so Miso is not used.
+type SPITransport struct {
+	Bus *spi.SPI
+}
+
+// Write shifts the data out to the chain, and latches it.
+func (t *SPITransport) Write(data []byte) error {
+	s := t.Bus
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.Sclk.Low()
+	s.Mosi.Output(gpio.Low)
+	s.Ssz.Low()
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			s.ClockOut(b>>uint(i)&0x01 == 0x01)
+		}
+	}
+	// data is latched on the rising edge of LOAD/CS.
+	s.Ssz.High()
+	return nil
+}
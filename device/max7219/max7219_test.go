@@ -0,0 +1,107 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package max7219_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio/device/max7219"
+)
+
+type transport struct {
+	writes [][]byte
+}
+
+func (t *transport) Write(data []byte) error {
+	t.writes = append(t.writes, append([]byte(nil), data...))
+	return nil
+}
+
+func (t *transport) last() []byte {
+	return t.writes[len(t.writes)-1]
+}
+
+func TestNew(t *testing.T) {
+	tr := &transport{}
+	d, err := max7219.New(tr, 2, max7219.WithIntensity(3), max7219.WithDecode(0x0f))
+	require.Nil(t, err)
+	assert.Equal(t, 2, d.Modules())
+	assert.Equal(t, 16, d.Width())
+	assert.Equal(t, uint8(3), d.Intensity())
+	require.Len(t, tr.writes, 13)
+	assert.Equal(t, []byte{0x0f, 0, 0x0f, 0}, tr.writes[0])
+	assert.Equal(t, []byte{0x0b, 7, 0x0b, 7}, tr.writes[1])
+	assert.Equal(t, []byte{0x09, 0x0f, 0x09, 0x0f}, tr.writes[2])
+	assert.Equal(t, []byte{0x0a, 3, 0x0a, 3}, tr.writes[3])
+	for row := 0; row < 8; row++ {
+		assert.Equal(t, []byte{byte(row + 1), 0, byte(row + 1), 0}, tr.writes[4+row])
+	}
+	assert.Equal(t, []byte{0x0c, 1, 0x0c, 1}, tr.last())
+	assert.Nil(t, d.Close())
+	assert.Equal(t, []byte{0x0c, 0, 0x0c, 0}, tr.last())
+}
+
+func TestIntensity(t *testing.T) {
+	tr := &transport{}
+	d, err := max7219.New(tr, 1, max7219.WithIntensity(20))
+	require.Nil(t, err)
+	assert.Equal(t, uint8(max7219.MaxIntensity), d.Intensity())
+	assert.Nil(t, d.SetIntensity(2))
+	assert.Equal(t, []byte{0x0a, 2}, tr.last())
+	assert.Equal(t, uint8(2), d.Intensity())
+	assert.Nil(t, d.SetIntensity(16))
+	assert.Equal(t, []byte{0x0a, 15}, tr.last())
+}
+
+func TestFramebuffer(t *testing.T) {
+	tr := &transport{}
+	d, err := max7219.New(tr, 2)
+	require.Nil(t, err)
+	d.SetPixel(0, 0, true)
+	d.SetPixel(9, 7, true)
+	d.SetPixel(16, 0, true)
+	d.SetPixel(0, 8, true)
+	assert.True(t, d.Pixel(0, 0))
+	assert.True(t, d.Pixel(9, 7))
+	assert.False(t, d.Pixel(1, 0))
+	assert.Equal(t, byte(0x80), d.Row(0, 0))
+	assert.Equal(t, byte(0x40), d.Row(1, 7))
+	d.SetRow(1, 3, 0x55)
+	d.SetRow(2, 3, 0x55)
+	assert.Equal(t, byte(0x55), d.Row(1, 3))
+	assert.Equal(t, byte(0), d.Row(2, 3))
+	tr.writes = nil
+	assert.Nil(t, d.Display())
+	require.Len(t, tr.writes, 8)
+	// the last module is shifted out first
+	assert.Equal(t, []byte{1, 0, 1, 0x80}, tr.writes[0])
+	assert.Equal(t, []byte{4, 0x55, 4, 0}, tr.writes[3])
+	assert.Equal(t, []byte{8, 0x40, 8, 0}, tr.writes[7])
+	d.Clear()
+	assert.False(t, d.Pixel(0, 0))
+	assert.Equal(t, byte(0), d.Row(1, 3))
+}
+
+func TestScroll(t *testing.T) {
+	tr := &transport{}
+	d, err := max7219.New(tr, 2)
+	require.Nil(t, err)
+	d.SetPixel(8, 0, true)
+	d.ScrollLeft(0x81)
+	assert.True(t, d.Pixel(7, 0))
+	assert.False(t, d.Pixel(8, 0))
+	assert.True(t, d.Pixel(15, 0))
+	assert.True(t, d.Pixel(15, 7))
+	assert.False(t, d.Pixel(15, 1))
+	d.ScrollRight(0x02)
+	assert.True(t, d.Pixel(8, 0))
+	assert.False(t, d.Pixel(7, 0))
+	assert.False(t, d.Pixel(15, 0))
+	assert.True(t, d.Pixel(0, 1))
+	assert.False(t, d.Pixel(0, 0))
+}
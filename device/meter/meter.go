@@ -0,0 +1,280 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package meter provides a pulse meter for utility meters, such as water, gas
+// and electricity meters, and other pulse output sensors such as anemometers
+// and rain gauges.
+package meter
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// PulseMeter counts the pulses from a meter, and converts them to a total and
+// a rate in the units of the meter.
+//
+// The running total can be persisted to a file, so it survives restarts.
+type PulseMeter struct {
+	pin      gpio.Pinner
+	edge     gpio.Edge
+	debounce time.Duration
+	ppu      float64
+	window   time.Duration
+	per      time.Duration
+	path     string
+	interval time.Duration
+	clock    clock.Clock
+	done     chan struct{}
+	wg       sync.WaitGroup
+	// Guards the following
+	mu     sync.Mutex
+	synced bool
+	pulses uint64
+	saved  uint64
+	last   time.Time
+	// the times of the pulses within the rate window.
+	times []time.Time
+}
+
+// Option defines an option that can be applied when creating a PulseMeter.
+type Option func(*PulseMeter)
+
+// WithEdge sets the edge counted as a pulse.
+//
+// The default is EdgeFalling, as for the open collector and reed switch
+// outputs of most meters.
+func WithEdge(edge gpio.Edge) Option {
+	return func(m *PulseMeter) {
+		m.edge = edge
+	}
+}
+
+// WithDebounce sets the minimum time between pulses, with any edges within
+// that time of a counted pulse ignored.
+//
+// The default is 5ms.  Set to 0 to disable debouncing.
+func WithDebounce(d time.Duration) Option {
+	return func(m *PulseMeter) {
+		m.debounce = d
+	}
+}
+
+// WithPulsesPerUnit sets the calibration of the meter, e.g. 450 pulses per
+// litre, or 1000 pulses per kWh.
+//
+// The default is 1.
+func WithPulsesPerUnit(ppu float64) Option {
+	return func(m *PulseMeter) {
+		if ppu > 0 {
+			m.ppu = ppu
+		}
+	}
+}
+
+// WithRate sets the window over which the rate is measured, and the period
+// the rate is expressed in, e.g. a window of 10s and a period of a minute
+// for litres per minute.
+//
+// The default is a window of 1 minute and a period of 1 minute.
+func WithRate(window, per time.Duration) Option {
+	return func(m *PulseMeter) {
+		m.window = window
+		m.per = per
+	}
+}
+
+// WithPersistence saves the total pulse count to the file, every interval
+// and when the meter is closed, and restores it when the meter is created.
+//
+// An interval of 0 only saves the count when the meter is closed.
+func WithPersistence(path string, interval time.Duration) Option {
+	return func(m *PulseMeter) {
+		m.path = path
+		m.interval = interval
+	}
+}
+
+// WithClock sets the clock used to time the pulses and persistence, e.g. a
+// clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(m *PulseMeter) {
+		m.clock = c
+	}
+}
+
+// New creates a PulseMeter on the pin.
+//
+// If persistence is enabled then the total is restored from the file, if it
+// exists.
+func New(pin gpio.Pinner, options ...Option) (*PulseMeter, error) {
+	m := &PulseMeter{
+		pin:      pin,
+		edge:     gpio.EdgeFalling,
+		debounce: 5 * time.Millisecond,
+		ppu:      1,
+		window:   time.Minute,
+		per:      time.Minute,
+		clock:    clock.Real,
+		done:     make(chan struct{}),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	if m.path != "" {
+		pulses, err := load(m.path)
+		if err != nil {
+			return nil, err
+		}
+		m.pulses = pulses
+		m.saved = pulses
+	}
+	pin.SetMode(gpio.Input)
+	if err := pin.Watch(m.edge, m.pulse); err != nil {
+		return nil, err
+	}
+	if m.path != "" && m.interval > 0 {
+		m.wg.Add(1)
+		go m.persist()
+	}
+	return m, nil
+}
+
+// Close stops counting, and saves the total, if persistence is enabled.
+func (m *PulseMeter) Close() error {
+	m.pin.Unwatch()
+	close(m.done)
+	m.wg.Wait()
+	return m.Save()
+}
+
+// Pulses returns the total number of pulses counted.
+func (m *PulseMeter) Pulses() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pulses
+}
+
+// Total returns the total, in the units of the meter.
+func (m *PulseMeter) Total() float64 {
+	return float64(m.Pulses()) / m.ppu
+}
+
+// Rate returns the rate, in units per rate period, averaged over the rate
+// window.
+func (m *PulseMeter) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trim(m.clock.Now())
+	return float64(len(m.times)) / m.ppu * float64(m.per) / float64(m.window)
+}
+
+// Reset sets the total to the given number of pulses, e.g. to match the
+// register of the meter, and clears the rate.
+func (m *PulseMeter) Reset(pulses uint64) {
+	m.mu.Lock()
+	m.pulses = pulses
+	m.times = m.times[:0]
+	m.mu.Unlock()
+}
+
+// Save writes the total to the persistence file, if enabled and if it has
+// changed since last saved.
+func (m *PulseMeter) Save() error {
+	if m.path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	pulses := m.pulses
+	changed := pulses != m.saved
+	m.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	if err := save(m.path, pulses); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.saved = pulses
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *PulseMeter) pulse(gpio.Pinner) {
+	now := m.clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// ignore the initial call made by the watch.
+	if !m.synced {
+		m.synced = true
+		return
+	}
+	if m.debounce > 0 && !m.last.IsZero() && now.Sub(m.last) < m.debounce {
+		return
+	}
+	m.last = now
+	m.pulses++
+	m.trim(now)
+	m.times = append(m.times, now)
+}
+
+// trim discards pulses that have fallen out of the rate window.
+// Assumes caller holds the mu lock.
+func (m *PulseMeter) trim(now time.Time) {
+	start := now.Add(-m.window)
+	i := 0
+	for i < len(m.times) && !m.times[i].After(start) {
+		i++
+	}
+	if i > 0 {
+		m.times = append(m.times[:0], m.times[i:]...)
+	}
+}
+
+func (m *PulseMeter) persist() {
+	defer m.wg.Done()
+	t := m.clock.NewTimer(m.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C():
+			m.Save()
+			t.Reset(m.interval)
+		}
+	}
+}
+
+func load(path string) (uint64, error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64)
+}
+
+// save writes the count to a temporary file, which is then renamed over the
+// file, so a power failure cannot leave a partially written file.
+func save(path string, pulses uint64) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(pulses, 10)+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
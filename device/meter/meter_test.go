@@ -0,0 +1,133 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package meter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/meter"
+	"github.com/warthog618/gpio/mock"
+)
+
+// pulse pulses the pin, advancing the clock by the gap after each pulse.
+func pulse(pin *mock.Pin, n int, clk *clock.Fake, gap time.Duration) {
+	for i := 0; i < n; i++ {
+		pin.Set(gpio.Low)
+		pin.Set(gpio.High)
+		clk.Advance(gap)
+	}
+}
+
+func TestPulseMeter(t *testing.T) {
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	clk := clock.NewFake(time.Now())
+	m, err := meter.New(pin,
+		meter.WithDebounce(0),
+		meter.WithPulsesPerUnit(4),
+		meter.WithRate(100*time.Millisecond, time.Second),
+		meter.WithClock(clk))
+	require.Nil(t, err)
+	assert.Equal(t, gpio.Input, pin.Mode())
+	assert.Equal(t, uint64(0), m.Pulses())
+	pulse(pin, 10, clk, 5*time.Millisecond)
+	assert.Equal(t, uint64(10), m.Pulses())
+	assert.Equal(t, 2.5, m.Total())
+	// 10 pulses in 100ms => 25 units per second
+	assert.Equal(t, 25.0, m.Rate())
+	// pulses fall out of the window as it moves.
+	clk.Advance(50 * time.Millisecond)
+	assert.Equal(t, 22.5, m.Rate())
+	clk.Advance(25 * time.Millisecond)
+	assert.Equal(t, 10.0, m.Rate())
+	clk.Advance(19 * time.Millisecond)
+	assert.Equal(t, 2.5, m.Rate())
+	clk.Advance(time.Millisecond)
+	assert.Equal(t, 0.0, m.Rate())
+	assert.Equal(t, 2.5, m.Total())
+	m.Reset(100)
+	assert.Equal(t, uint64(100), m.Pulses())
+	assert.Equal(t, 25.0, m.Total())
+	assert.Nil(t, m.Close())
+	pulse(pin, 1, clk, 0)
+	assert.Equal(t, uint64(100), m.Pulses())
+}
+
+func TestDebounce(t *testing.T) {
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	clk := clock.NewFake(time.Now())
+	m, err := meter.New(pin, meter.WithDebounce(20*time.Millisecond), meter.WithClock(clk))
+	require.Nil(t, err)
+	defer m.Close()
+	// bounces
+	pulse(pin, 5, clk, time.Millisecond)
+	assert.Equal(t, uint64(1), m.Pulses())
+	clk.Advance(14 * time.Millisecond)
+	pulse(pin, 1, clk, time.Millisecond)
+	assert.Equal(t, uint64(1), m.Pulses())
+	// from the last counted pulse
+	pulse(pin, 5, clk, time.Millisecond)
+	assert.Equal(t, uint64(2), m.Pulses())
+}
+
+func TestEdge(t *testing.T) {
+	pin := mock.NewPin(1)
+	m, err := meter.New(pin, meter.WithDebounce(0), meter.WithEdge(gpio.EdgeRising))
+	require.Nil(t, err)
+	defer m.Close()
+	pin.Set(gpio.High)
+	assert.Equal(t, uint64(1), m.Pulses())
+	pin.Set(gpio.Low)
+	assert.Equal(t, uint64(1), m.Pulses())
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "total")
+
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	clk := clock.NewFake(time.Now())
+	m, err := meter.New(pin,
+		meter.WithDebounce(0),
+		meter.WithPersistence(path, 10*time.Millisecond),
+		meter.WithClock(clk))
+	require.Nil(t, err)
+	// saved every interval
+	clk.BlockUntil(1)
+	pulse(pin, 3, clk, 0)
+	clk.Advance(9 * time.Millisecond)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	clk.Advance(time.Millisecond)
+	clk.BlockUntil(1)
+	buf, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "3\n", string(buf))
+	pulse(pin, 2, clk, 0)
+	assert.Nil(t, m.Close())
+
+	m, err = meter.New(pin, meter.WithPersistence(path, 0))
+	require.Nil(t, err)
+	assert.Equal(t, uint64(5), m.Pulses())
+	assert.Nil(t, m.Close())
+
+	// corrupt
+	require.Nil(t, ioutil.WriteFile(path, []byte("bogus"), 0644))
+	_, err = meter.New(pin, meter.WithPersistence(path, 0))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,247 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package motor provides a driver for DC motors driven by dual input H-bridge
+// drivers, such as the L298N and DRV8833.
+package motor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/pwm"
+)
+
+// Direction is the direction of rotation of the motor.
+type Direction int
+
+const (
+	// Coasting indicates the bridge is off, so the motor coasts freely.
+	Coasting Direction = iota
+
+	// Forward indicates the motor is driven forward.
+	Forward
+
+	// Reverse indicates the motor is driven in reverse.
+	Reverse
+
+	// Braking indicates the motor terminals are shorted, braking the motor.
+	Braking
+)
+
+// Motor is a DC motor driven by an H-bridge.
+//
+// The bridge inputs are sequenced so that the two sides of the bridge are
+// never driven in opposite directions without first passing through the
+// coast state for the dead time, which prevents shoot-through on bridges
+// that do not provide their own protection.
+type Motor struct {
+	in1, in2 *pwm.PWM
+	// the enable input, for bridges that provide one.
+	en       *pwm.PWM
+	deadTime time.Duration
+	clock    clock.Clock
+	// Guards the following and the inputs.
+	mu    sync.Mutex
+	dir   Direction
+	speed float64
+}
+
+// Option defines an option that can be applied when creating a Motor.
+type Option func(*config)
+
+type config struct {
+	freq     float64
+	deadTime time.Duration
+	clock    clock.Clock
+}
+
+// WithFrequency sets the frequency of the PWM used to control the speed of the
+// motor, in Hz.
+//
+// The default is 1000Hz.
+func WithFrequency(freq float64) Option {
+	return func(c *config) {
+		c.freq = freq
+	}
+}
+
+// WithDeadTime sets the time both sides of the bridge are off when changing
+// direction.
+//
+// The default is 10ms, which also allows the motor to slow before being
+// driven in the opposite direction.
+func WithDeadTime(d time.Duration) Option {
+	return func(c *config) {
+		c.deadTime = d
+	}
+}
+
+// WithClock sets the clock used to time the dead time and the PWMs, e.g. a
+// clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+func newConfig(options []Option) config {
+	cfg := config{freq: 1000, deadTime: 10 * time.Millisecond, clock: clock.Real}
+	for _, option := range options {
+		option(&cfg)
+	}
+	return cfg
+}
+
+func (cfg config) pwm(pin gpio.Pinner) *pwm.PWM {
+	return pwm.New(pin, cfg.freq, pwm.WithClock(cfg.clock))
+}
+
+// NewL298N creates a Motor driven by a bridge with direction inputs and an
+// enable input, such as the L298N or L293D.
+//
+// The speed is controlled by a PWM on the enable pin.
+func NewL298N(in1, in2, en gpio.Pinner, options ...Option) *Motor {
+	cfg := newConfig(options)
+	return &Motor{
+		in1:      cfg.pwm(in1),
+		in2:      cfg.pwm(in2),
+		en:       cfg.pwm(en),
+		deadTime: cfg.deadTime,
+		clock:    cfg.clock,
+	}
+}
+
+// NewDRV8833 creates a Motor driven by a bridge with only two inputs, such as
+// the DRV8833 or TB6612 (with its PWM input held high).
+//
+// The speed is controlled by a PWM on the active input, with the bridge
+// coasting (fast decay) during the off period.
+func NewDRV8833(in1, in2 gpio.Pinner, options ...Option) *Motor {
+	cfg := newConfig(options)
+	return &Motor{
+		in1:      cfg.pwm(in1),
+		in2:      cfg.pwm(in2),
+		deadTime: cfg.deadTime,
+		clock:    cfg.clock,
+	}
+}
+
+// Close coasts the motor and releases the pins.
+func (m *Motor) Close() {
+	m.Coast()
+	m.in1.Close()
+	m.in2.Close()
+	if m.en != nil {
+		m.en.Close()
+	}
+}
+
+// Direction returns the current direction of the motor.
+func (m *Motor) Direction() Direction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dir
+}
+
+// Speed returns the current speed of the motor, in the range 0 to 1.
+func (m *Motor) Speed() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.speed
+}
+
+// Forward drives the motor forward at the speed, in the range 0 to 1.
+func (m *Motor) Forward(speed float64) {
+	m.set(Forward, speed)
+}
+
+// Reverse drives the motor in reverse at the speed, in the range 0 to 1.
+func (m *Motor) Reverse(speed float64) {
+	m.set(Reverse, speed)
+}
+
+// SetSpeed drives the motor at the speed, in the range -1 to 1, with negative
+// speeds driving the motor in reverse.
+func (m *Motor) SetSpeed(speed float64) {
+	if speed < 0 {
+		m.set(Reverse, -speed)
+	} else {
+		m.set(Forward, speed)
+	}
+}
+
+// Brake shorts the motor terminals, actively braking the motor.
+func (m *Motor) Brake() {
+	m.set(Braking, 1)
+}
+
+// Coast turns off the bridge, so the motor coasts to a stop.
+func (m *Motor) Coast() {
+	m.set(Coasting, 0)
+}
+
+func (m *Motor) set(dir Direction, speed float64) {
+	if speed < 0 {
+		speed = 0
+	} else if speed > 1 {
+		speed = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if (m.dir == Forward && dir == Reverse) || (m.dir == Reverse && dir == Forward) {
+		m.apply(Coasting, 0)
+		m.clock.Sleep(m.deadTime)
+	}
+	m.apply(dir, speed)
+	m.dir = dir
+	m.speed = speed
+}
+
+// apply sets the bridge inputs for the direction and speed.
+// Assumes the caller holds the mu lock.
+func (m *Motor) apply(dir Direction, speed float64) {
+	if m.en != nil {
+		switch dir {
+		case Coasting:
+			m.en.SetDuty(0)
+			m.in1.SetDuty(0)
+			m.in2.SetDuty(0)
+		case Braking:
+			m.in1.SetDuty(0)
+			m.in2.SetDuty(0)
+			m.en.SetDuty(1)
+		case Forward:
+			m.en.SetDuty(0)
+			m.in2.SetDuty(0)
+			m.in1.SetDuty(1)
+			m.en.SetDuty(speed)
+		case Reverse:
+			m.en.SetDuty(0)
+			m.in1.SetDuty(0)
+			m.in2.SetDuty(1)
+			m.en.SetDuty(speed)
+		}
+		return
+	}
+	switch dir {
+	case Coasting:
+		m.in1.SetDuty(0)
+		m.in2.SetDuty(0)
+	case Braking:
+		m.in1.SetDuty(1)
+		m.in2.SetDuty(1)
+	case Forward:
+		m.in2.SetDuty(0)
+		m.in1.SetDuty(speed)
+	case Reverse:
+		m.in1.SetDuty(0)
+		m.in2.SetDuty(speed)
+	}
+}
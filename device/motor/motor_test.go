@@ -0,0 +1,105 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package motor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/motor"
+	"github.com/warthog618/gpio/mock"
+)
+
+// bridge is the pair of direction inputs of a mock bridge.
+type bridge struct {
+	in1, in2 *mock.Pin
+}
+
+func newBridge() *bridge {
+	return &bridge{in1: mock.NewPin(1), in2: mock.NewPin(2)}
+}
+
+func TestL298N(t *testing.T) {
+	b := newBridge()
+	en := mock.NewPin(3)
+	m := motor.NewL298N(b.in1, b.in2, en, motor.WithDeadTime(time.Millisecond))
+	defer m.Close()
+	assert.Equal(t, motor.Coasting, m.Direction())
+	m.Forward(1)
+	assert.Equal(t, motor.Forward, m.Direction())
+	assert.Equal(t, 1.0, m.Speed())
+	assert.Equal(t, gpio.High, b.in1.Read())
+	assert.Equal(t, gpio.Low, b.in2.Read())
+	assert.Equal(t, gpio.High, en.Read())
+	m.Reverse(2)
+	assert.Equal(t, motor.Reverse, m.Direction())
+	assert.Equal(t, 1.0, m.Speed())
+	assert.Equal(t, gpio.Low, b.in1.Read())
+	assert.Equal(t, gpio.High, b.in2.Read())
+	assert.Equal(t, gpio.High, en.Read())
+	m.Brake()
+	assert.Equal(t, motor.Braking, m.Direction())
+	assert.Equal(t, b.in1.Read(), b.in2.Read())
+	assert.Equal(t, gpio.High, en.Read())
+	m.Coast()
+	assert.Equal(t, motor.Coasting, m.Direction())
+	assert.Equal(t, gpio.Low, en.Read())
+	m.SetSpeed(-0.5)
+	assert.Equal(t, motor.Reverse, m.Direction())
+	assert.Equal(t, 0.5, m.Speed())
+	assert.Equal(t, gpio.High, b.in2.Read())
+}
+
+func TestDRV8833(t *testing.T) {
+	b := newBridge()
+	m := motor.NewDRV8833(b.in1, b.in2)
+	defer m.Close()
+	m.Forward(1)
+	assert.Equal(t, gpio.High, b.in1.Read())
+	assert.Equal(t, gpio.Low, b.in2.Read())
+	m.Brake()
+	assert.Equal(t, gpio.High, b.in1.Read())
+	assert.Equal(t, gpio.High, b.in2.Read())
+	m.Coast()
+	assert.Equal(t, gpio.Low, b.in1.Read())
+	assert.Equal(t, gpio.Low, b.in2.Read())
+}
+
+func TestDeadTime(t *testing.T) {
+	in1 := mock.NewPin(1)
+	in2 := mock.NewPin(2)
+	clk := clock.NewFake(time.Now())
+	deadTime := 5 * time.Millisecond
+	m := motor.NewDRV8833(in1, in2, motor.WithDeadTime(deadTime), motor.WithClock(clk))
+	defer m.Close()
+	m.Forward(1)
+	assert.Equal(t, gpio.High, in1.Read())
+	done := make(chan struct{})
+	go func() {
+		m.Reverse(1)
+		close(done)
+	}()
+	// the bridge coasts for the dead time before reversing.
+	clk.BlockUntil(1)
+	assert.Equal(t, gpio.Low, in1.Read())
+	assert.Equal(t, gpio.Low, in2.Read())
+	clk.Advance(deadTime - time.Microsecond)
+	assert.Equal(t, gpio.Low, in2.Read())
+	clk.Advance(time.Microsecond)
+	<-done
+	assert.Equal(t, motor.Reverse, m.Direction())
+	assert.Equal(t, gpio.Low, in1.Read())
+	assert.Equal(t, gpio.High, in2.Read())
+
+	// no dead time for changes that do not reverse the motor.
+	m.Brake()
+	m.Forward(1)
+	assert.Equal(t, gpio.High, in1.Read())
+	assert.Equal(t, gpio.Low, in2.Read())
+}
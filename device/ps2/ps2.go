@@ -0,0 +1,440 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package ps2 provides a decoder for PS/2 keyboards and mice.
+package ps2
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Commands and responses
+const (
+	cmdSetLEDs         = 0xed
+	cmdEnableReporting = 0xf4
+	respAck            = 0xfa
+	respResend         = 0xfe
+	respError          = 0xfc
+	prefixExtended     = 0xe0
+	prefixRelease      = 0xf0
+)
+
+// Frames
+const (
+	// the bits in a frame - start, 8 data bits, parity and stop.
+	frameBits = 11
+	// the positions of the parity and stop bits in a received frame.
+	parityBit = 9
+	stopBit   = 10
+	// the positions of the parity and stop bits in a sent frame, which are
+	// preceded by the start bit set by the request to send.
+	sendParityBit = 8
+	sendStopBit   = 9
+)
+
+// Timings
+const (
+	// the time the clock is held low to request to send.
+	inhibitTime = 100 * time.Microsecond
+	// the maximum time between the bits of a frame.
+	frameTimeout = 2 * time.Millisecond
+	// the maximum time for the device to clock in a frame from the host.
+	sendTimeout = 20 * time.Millisecond
+	// the maximum time for the device to respond to a command.
+	responseTimeout = 20 * time.Millisecond
+)
+
+// LEDs are the keyboard indicator LEDs, as set by SetLEDs.
+type LEDs byte
+
+const (
+	// ScrollLock is the scroll lock LED.
+	ScrollLock LEDs = 1 << iota
+
+	// NumLock is the num lock LED.
+	NumLock
+
+	// CapsLock is the caps lock LED.
+	CapsLock
+)
+
+// Scancode is a key event from a keyboard using scan code set 2, the default.
+type Scancode struct {
+	// Code is the scan code of the key.
+	Code byte
+
+	// Extended is true if the code was prefixed by 0xe0.
+	Extended bool
+
+	// Release is true if the key was released, i.e. the code was prefixed
+	// by 0xf0.
+	Release bool
+}
+
+// link states
+const (
+	// receiving frames from the device.
+	stateReceive = iota
+	// the host is holding the clock low to request to send.
+	stateInhibit
+	// the device is clocking in a frame from the host.
+	stateSend
+)
+
+// PS2 decodes the frames sent by a PS/2 device, and sends commands to it.
+//
+// The clock is watched for falling edges, on which the data is sampled, so
+// the bit timing is driven by the watcher.  Both lines are open collector, so
+// are driven low by setting the pins to Output, and released by setting the
+// pins to Input, relying on the pull-ups in the device.
+type PS2 struct {
+	clk        gpio.Pinner
+	data       gpio.Pinner
+	onByte     func(byte)
+	onScancode func(Scancode)
+	clock      clock.Clock
+	// Guards the following
+	mu    sync.Mutex
+	state int
+	// the bits of the frame being received or sent, and the number of bits
+	// clocked so far.
+	bits   uint16
+	n      int
+	last   time.Time
+	errors uint64
+	// the prefixes seen for the scancode being assembled.
+	extended bool
+	release  bool
+	// signalled when a send completes, with the result.
+	sent chan error
+	// receives the response to a command, while one is outstanding.
+	resp   chan byte
+	closed bool
+}
+
+// Option defines an option that can be applied when creating a PS2.
+type Option func(*PS2)
+
+// WithByteHandler sets a handler called with each byte received from the
+// device, e.g. mouse movement packets.
+//
+// Responses to commands sent by Send are not passed to the handler.
+//
+// The handler is called from the watcher goroutine, so must be quick, must
+// not block, and must not call Send.
+func WithByteHandler(handler func(byte)) Option {
+	return func(d *PS2) {
+		d.onByte = handler
+	}
+}
+
+// WithScancodeHandler sets a handler called with each scancode assembled
+// from the bytes received from a keyboard.
+//
+// The handler is called from the watcher goroutine, so must be quick, must
+// not block, and must not call Send.
+func WithScancodeHandler(handler func(Scancode)) Option {
+	return func(d *PS2) {
+		d.onScancode = handler
+	}
+}
+
+// WithClock sets the clock used to time sends, and to timestamp edges on pins
+// that do not support WatchEvents, e.g. a clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(d *PS2) {
+		d.clock = c
+	}
+}
+
+// eventWatcher is implemented by pins that can deliver timestamped edge
+// events, such as *gpio.Pin.
+type eventWatcher interface {
+	WatchEvents(edge gpio.Edge, handler func(gpio.Event), options ...gpio.WatchOption) error
+}
+
+// New creates a PS2 for the device connected to the clock and data pins, and
+// starts decoding.
+//
+// If the clock pin supports WatchEvents, as *gpio.Pin does, then the edges
+// are handled, in order, from the watcher goroutine.
+func New(clk, data gpio.Pinner, options ...Option) (*PS2, error) {
+	d := &PS2{clk: clk, data: data, clock: clock.Real}
+	for _, option := range options {
+		option(d)
+	}
+	clk.SetMode(gpio.Input)
+	data.SetMode(gpio.Input)
+	var err error
+	if w, ok := clk.(eventWatcher); ok {
+		err = w.WatchEvents(gpio.EdgeFalling, func(evt gpio.Event) {
+			d.fall(evt.Time)
+		})
+	} else {
+		err = clk.Watch(gpio.EdgeFalling, func(p gpio.Pinner) {
+			// ignore the initial call made by Watch.
+			if p.Read() == gpio.Low {
+				d.fall(d.clock.Now())
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close stops decoding, removes the watch from the clock, and releases the
+// pins.
+func (d *PS2) Close() {
+	d.clk.Unwatch()
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.clk.SetMode(gpio.Input)
+	d.data.SetMode(gpio.Input)
+}
+
+// Errors returns the number of frames discarded due to framing, parity or
+// timing errors.
+func (d *PS2) Errors() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.errors
+}
+
+// SetLEDs sets the keyboard indicator LEDs.
+func (d *PS2) SetLEDs(leds LEDs) error {
+	return d.Send(cmdSetLEDs, byte(leds))
+}
+
+// EnableReporting enables the reporting of movement by a mouse, which is
+// disabled after power on.
+func (d *PS2) EnableReporting() error {
+	return d.Send(cmdEnableReporting)
+}
+
+// Send sends the bytes to the device, waiting for the device to acknowledge
+// each.
+//
+// Returns ErrTimeout if the device does not clock in a byte, or respond to
+// it, within 20ms, ErrNoAck if the device does not acknowledge the frame, and
+// ErrNak if the device requests a resend or reports an error.
+//
+// Send must not be called from the handlers.
+func (d *PS2) Send(bytes ...byte) error {
+	for _, b := range bytes {
+		if err := d.send(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *PS2) send(b byte) error {
+	d.mu.Lock()
+	if d.closed || d.state != stateReceive {
+		d.mu.Unlock()
+		return ErrBusy
+	}
+	d.state = stateInhibit
+	bits := uint16(b) | 1<<sendStopBit
+	if !oddParity(b) {
+		bits |= 1 << sendParityBit
+	}
+	d.bits = bits
+	d.n = 0
+	sent := make(chan error, 1)
+	resp := make(chan byte, 1)
+	d.sent = sent
+	d.resp = resp
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.resp = nil
+		d.mu.Unlock()
+	}()
+
+	// request to send, by inhibiting the clock, then pulling data low and
+	// releasing the clock.
+	d.clk.Write(gpio.Low)
+	d.clk.SetMode(gpio.Output)
+	d.clock.Sleep(inhibitTime)
+	d.data.Write(gpio.Low)
+	d.data.SetMode(gpio.Output)
+	d.mu.Lock()
+	d.state = stateSend
+	d.mu.Unlock()
+	d.clk.SetMode(gpio.Input)
+
+	select {
+	case err := <-sent:
+		if err != nil {
+			return err
+		}
+	case <-d.clock.After(sendTimeout):
+		d.mu.Lock()
+		d.state = stateReceive
+		d.n = 0
+		d.mu.Unlock()
+		d.data.SetMode(gpio.Input)
+		return ErrTimeout
+	}
+	select {
+	case r := <-resp:
+		switch r {
+		case respAck:
+			return nil
+		case respResend, respError:
+			return ErrNak
+		}
+		return ErrNoAck
+	case <-d.clock.After(responseTimeout):
+		return ErrTimeout
+	}
+}
+
+// fall handles a falling edge on the clock.
+func (d *PS2) fall(t time.Time) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	switch d.state {
+	case stateInhibit:
+		// the host driving the clock.
+		d.mu.Unlock()
+		return
+	case stateSend:
+		d.clockOut()
+		d.mu.Unlock()
+		return
+	}
+	if d.n > 0 && t.Sub(d.last) > frameTimeout {
+		// the remainder of the frame was lost.
+		d.errors++
+		d.n = 0
+	}
+	d.last = t
+	if d.data.Read() == gpio.High {
+		d.bits |= 1 << uint(d.n)
+	} else {
+		d.bits &^= 1 << uint(d.n)
+	}
+	d.n++
+	if d.n == 1 && d.bits&1 != 0 {
+		// not a start bit, so wait for one.
+		d.errors++
+		d.n = 0
+	}
+	if d.n < frameBits {
+		d.mu.Unlock()
+		return
+	}
+	d.n = 0
+	b := byte(d.bits >> 1)
+	parity := d.bits>>parityBit&1 != 0
+	stop := d.bits>>stopBit&1 != 0
+	if !stop || oddParity(b) == parity {
+		d.errors++
+		d.mu.Unlock()
+		return
+	}
+	if d.resp != nil {
+		select {
+		case d.resp <- b:
+		default:
+		}
+		d.mu.Unlock()
+		return
+	}
+	var sc Scancode
+	var code bool
+	if d.onScancode != nil {
+		sc, code = d.assemble(b)
+	}
+	d.mu.Unlock()
+	if d.onByte != nil {
+		d.onByte(b)
+	}
+	if code {
+		d.onScancode(sc)
+	}
+}
+
+// clockOut sets the data for the next bit of the frame being sent, or checks
+// the acknowledgement from the device once the frame has been sent.
+//
+// The device samples the data on the rising edge of the clock.
+// Assumes the caller holds the mu lock.
+func (d *PS2) clockOut() {
+	if d.n <= sendStopBit {
+		if d.bits>>uint(d.n)&1 == 0 {
+			d.data.Write(gpio.Low)
+			d.data.SetMode(gpio.Output)
+		} else {
+			d.data.SetMode(gpio.Input)
+		}
+		d.n++
+		return
+	}
+	// the device pulls data low to acknowledge the frame.
+	var err error
+	if d.data.Read() != gpio.Low {
+		err = ErrNoAck
+	}
+	d.state = stateReceive
+	d.n = 0
+	d.sent <- err
+}
+
+// assemble adds the byte to the scancode being assembled, and returns the
+// scancode, and true, if complete.
+//
+// Assumes the caller holds the mu lock.
+func (d *PS2) assemble(b byte) (Scancode, bool) {
+	switch b {
+	case prefixExtended:
+		d.extended = true
+		return Scancode{}, false
+	case prefixRelease:
+		d.release = true
+		return Scancode{}, false
+	}
+	sc := Scancode{Code: b, Extended: d.extended, Release: d.release}
+	d.extended = false
+	d.release = false
+	return sc, true
+}
+
+// oddParity returns true if the byte has an odd number of bits set.
+func oddParity(b byte) bool {
+	b ^= b >> 4
+	b ^= b >> 2
+	b ^= b >> 1
+	return b&1 != 0
+}
+
+var (
+	// ErrBusy indicates a send is already in progress, or the PS2 is closed.
+	ErrBusy = errors.New("busy")
+
+	// ErrTimeout indicates the device did not respond in time.
+	ErrTimeout = errors.New("timeout")
+
+	// ErrNoAck indicates the device did not acknowledge a frame.
+	ErrNoAck = errors.New("no acknowledgement")
+
+	// ErrNak indicates the device requested a resend, or reported an error.
+	ErrNak = errors.New("command rejected")
+)
@@ -0,0 +1,256 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package ps2_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/ps2"
+	"github.com/warthog618/gpio/mock"
+)
+
+// device simulates a PS/2 device on the clock and data pins.
+type device struct {
+	clk  *mock.Pin
+	data *mock.Pin
+}
+
+func newDevice() *device {
+	d := &device{clk: mock.NewPin(1), data: mock.NewPin(2)}
+	// the pull-ups
+	d.clk.Set(gpio.High)
+	d.data.Set(gpio.High)
+	return d
+}
+
+// clock generates a clock pulse with the data bit.
+func (d *device) clock(bit gpio.Level) {
+	d.data.Set(bit)
+	d.clk.Set(gpio.Low)
+	d.clk.Set(gpio.High)
+}
+
+// frame sends a frame with the byte, and the given parity and stop bits.
+func (d *device) frame(b byte, parity, stop gpio.Level) {
+	d.clock(gpio.Low)
+	for i := uint(0); i < 8; i++ {
+		d.clock(b>>i&1 != 0)
+	}
+	d.clock(parity)
+	d.clock(stop)
+	d.data.Set(gpio.High)
+}
+
+// ones returns the number of bits set in the byte.
+func ones(b byte) int {
+	n := 0
+	for i := uint(0); i < 8; i++ {
+		n += int(b >> i & 1)
+	}
+	return n
+}
+
+// send sends the byte with correct parity.
+func (d *device) send(b byte) {
+	d.frame(b, ones(b)%2 == 0, gpio.High)
+}
+
+// line returns the level of a pin driven by the host, or released to the
+// pull-up.
+func line(p *mock.Pin) gpio.Level {
+	if p.Mode() == gpio.Output {
+		return p.Read()
+	}
+	return gpio.High
+}
+
+// receive waits for a request to send from the host, and clocks in the
+// frame, returning the byte and parity.
+func (d *device) receive(t *testing.T, ack bool) (byte, gpio.Level, bool) {
+	deadline := time.Now().Add(time.Second)
+	for line(d.data) != gpio.Low || d.clk.Mode() != gpio.Input {
+		if time.Now().After(deadline) {
+			t.Error("no request to send")
+			return 0, false, false
+		}
+		time.Sleep(10 * time.Microsecond)
+	}
+	var bits [10]gpio.Level
+	for i := range bits {
+		d.clk.Set(gpio.Low)
+		d.clk.Set(gpio.High)
+		bits[i] = line(d.data)
+	}
+	var b byte
+	for i := uint(0); i < 8; i++ {
+		if bits[i] {
+			b |= 1 << i
+		}
+	}
+	if ack {
+		d.data.Set(gpio.Low)
+	}
+	d.clk.Set(gpio.Low)
+	d.clk.Set(gpio.High)
+	d.data.Set(gpio.High)
+	return b, bits[8], bits[9] == gpio.High
+}
+
+func TestReceive(t *testing.T) {
+	dev := newDevice()
+	var mu sync.Mutex
+	var bytes []byte
+	var codes []ps2.Scancode
+	d, err := ps2.New(dev.clk, dev.data,
+		ps2.WithByteHandler(func(b byte) {
+			mu.Lock()
+			bytes = append(bytes, b)
+			mu.Unlock()
+		}),
+		ps2.WithScancodeHandler(func(sc ps2.Scancode) {
+			mu.Lock()
+			codes = append(codes, sc)
+			mu.Unlock()
+		}))
+	require.Nil(t, err)
+	defer d.Close()
+	assert.Equal(t, gpio.Input, dev.clk.Mode())
+	assert.Equal(t, gpio.Input, dev.data.Mode())
+
+	// A pressed, A released, right ctrl pressed and released
+	for _, b := range []byte{0x1c, 0xf0, 0x1c, 0xe0, 0x14, 0xe0, 0xf0, 0x14} {
+		dev.send(b)
+	}
+	mu.Lock()
+	assert.Equal(t, []byte{0x1c, 0xf0, 0x1c, 0xe0, 0x14, 0xe0, 0xf0, 0x14}, bytes)
+	assert.Equal(t, []ps2.Scancode{
+		{Code: 0x1c},
+		{Code: 0x1c, Release: true},
+		{Code: 0x14, Extended: true},
+		{Code: 0x14, Extended: true, Release: true},
+	}, codes)
+	bytes = nil
+	mu.Unlock()
+	assert.Zero(t, d.Errors())
+
+	// bad parity
+	dev.frame(0x1c, gpio.High, gpio.High)
+	// bad stop
+	dev.frame(0x1c, gpio.Low, gpio.Low)
+	// no start bit
+	dev.clock(gpio.High)
+	assert.Equal(t, uint64(3), d.Errors())
+	dev.send(0x55)
+	mu.Lock()
+	assert.Equal(t, []byte{0x55}, bytes)
+	mu.Unlock()
+}
+
+func TestSend(t *testing.T) {
+	dev := newDevice()
+	var mu sync.Mutex
+	var bytes []byte
+	d, err := ps2.New(dev.clk, dev.data, ps2.WithByteHandler(func(b byte) {
+		mu.Lock()
+		bytes = append(bytes, b)
+		mu.Unlock()
+	}))
+	require.Nil(t, err)
+	defer d.Close()
+
+	var got []byte
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			b, parity, stop := dev.receive(t, true)
+			got = append(got, b)
+			assert.True(t, stop)
+			// odd parity
+			n := ones(b)
+			if parity {
+				n++
+			}
+			assert.Equal(t, 1, n%2)
+			dev.send(0xfa)
+		}
+	}()
+	assert.Nil(t, d.SetLEDs(ps2.CapsLock|ps2.NumLock))
+	<-done
+	assert.Equal(t, []byte{0xed, 0x06}, got)
+	assert.Equal(t, gpio.Input, dev.clk.Mode())
+	assert.Equal(t, gpio.Input, dev.data.Mode())
+	// responses are not passed to the handler.
+	mu.Lock()
+	assert.Empty(t, bytes)
+	mu.Unlock()
+
+	// resend
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		dev.receive(t, true)
+		dev.send(0xfe)
+	}()
+	assert.Equal(t, ps2.ErrNak, d.EnableReporting())
+	<-done
+
+	// no ack
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		dev.receive(t, false)
+	}()
+	assert.Equal(t, ps2.ErrNoAck, d.Send(0xf4))
+	<-done
+
+	// no device
+	assert.Equal(t, ps2.ErrTimeout, d.Send(0xf4))
+	assert.Equal(t, gpio.Input, dev.data.Mode())
+}
+
+func TestSendTimeout(t *testing.T) {
+	dev := newDevice()
+	c := clock.NewFake(time.Now())
+	d, err := ps2.New(dev.clk, dev.data, ps2.WithClock(c))
+	require.Nil(t, err)
+	defer d.Close()
+
+	errs := make(chan error)
+	go func() {
+		errs <- d.Send(0xf4)
+	}()
+	// the request to send
+	c.BlockUntil(1)
+	assert.Equal(t, gpio.Output, dev.clk.Mode())
+	assert.Equal(t, gpio.Low, dev.clk.Read())
+	c.Advance(100 * time.Microsecond)
+	// waiting for the device to clock the frame
+	c.BlockUntil(1)
+	assert.Equal(t, gpio.Input, dev.clk.Mode())
+	assert.Equal(t, gpio.Output, dev.data.Mode())
+	c.Advance(20 * time.Millisecond)
+	assert.Equal(t, ps2.ErrTimeout, <-errs)
+	assert.Equal(t, gpio.Input, dev.data.Mode())
+
+	// no response
+	go func() {
+		errs <- d.Send(0xf4)
+	}()
+	c.BlockUntil(1)
+	c.Advance(100 * time.Microsecond)
+	dev.receive(t, true)
+	// the expired send timeout, and the response timeout
+	c.BlockUntil(2)
+	c.Advance(20 * time.Millisecond)
+	assert.Equal(t, ps2.ErrTimeout, <-errs)
+}
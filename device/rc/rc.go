@@ -0,0 +1,404 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package rc provides decoders for the outputs of RC receivers, either as
+// a PWM pulse per channel, or as a CPPM sum signal.
+package rc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// Pulses outside these limits are considered glitches and the containing
+// frame is discarded.
+const (
+	minPulse = 500 * time.Microsecond
+	maxPulse = 2500 * time.Microsecond
+	// the minimum gap between CPPM frames.
+	syncGap = 3 * time.Millisecond
+)
+
+// Calibration maps the pulse widths of a channel to values.
+type Calibration struct {
+	// Min is the pulse width corresponding to a value of -1.
+	Min time.Duration
+
+	// Center is the pulse width corresponding to a value of 0.
+	Center time.Duration
+
+	// Max is the pulse width corresponding to a value of 1.
+	Max time.Duration
+}
+
+// DefaultCalibration is the nominal calibration of RC channels.
+var DefaultCalibration = Calibration{
+	Min:    1000 * time.Microsecond,
+	Center: 1500 * time.Microsecond,
+	Max:    2000 * time.Microsecond,
+}
+
+// Value returns the value, in the range -1 to 1, corresponding to the pulse
+// width.
+func (c Calibration) Value(width time.Duration) float64 {
+	var v float64
+	if width < c.Center {
+		v = float64(width-c.Center) / float64(c.Center-c.Min)
+	} else {
+		v = float64(width-c.Center) / float64(c.Max-c.Center)
+	}
+	if v < -1 {
+		return -1
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// Option defines an option that can be applied when creating a decoder.
+type Option func(*config)
+
+type config struct {
+	cal        map[int]Calibration
+	timeout    time.Duration
+	onFrame    func([]float64)
+	onFailsafe func()
+}
+
+// WithCalibration sets the calibration of the channel.
+//
+// The default is DefaultCalibration.
+func WithCalibration(ch int, cal Calibration) Option {
+	return func(c *config) {
+		c.cal[ch] = cal
+	}
+}
+
+// WithFailsafe sets the time without a valid frame after which the signal is
+// considered lost.
+//
+// The default is 100ms.
+func WithFailsafe(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// WithFrameHandler sets a handler called with the channel values at the end
+// of each valid frame.
+//
+// The handler is called from the watcher goroutine, so must be quick and must
+// not block.  The values are only valid for the duration of the call.
+func WithFrameHandler(handler func(values []float64)) Option {
+	return func(c *config) {
+		c.onFrame = handler
+	}
+}
+
+// WithFailsafeHandler sets a handler called when the signal is lost.
+func WithFailsafeHandler(handler func()) Option {
+	return func(c *config) {
+		c.onFailsafe = handler
+	}
+}
+
+// decoder is the frame handling common to the CPPM and PWM decoders.
+type decoder struct {
+	cal        []Calibration
+	timeout    time.Duration
+	onFrame    func([]float64)
+	onFailsafe func()
+	// Guards the following
+	mu       sync.Mutex
+	widths   []time.Duration
+	values   []float64
+	failsafe bool
+	timer    *time.Timer
+	closed   bool
+}
+
+func (d *decoder) init(channels int, options []Option) {
+	cfg := config{cal: map[int]Calibration{}, timeout: 100 * time.Millisecond}
+	for _, option := range options {
+		option(&cfg)
+	}
+	d.cal = make([]Calibration, channels)
+	d.timeout = cfg.timeout
+	d.onFrame = cfg.onFrame
+	d.onFailsafe = cfg.onFailsafe
+	d.widths = make([]time.Duration, channels)
+	d.values = make([]float64, channels)
+	d.failsafe = true
+	for i := range d.cal {
+		d.cal[i] = DefaultCalibration
+		if c, ok := cfg.cal[i]; ok {
+			d.cal[i] = c
+		}
+	}
+}
+
+// Channels returns the number of channels decoded.
+func (d *decoder) Channels() int {
+	return len(d.cal)
+}
+
+// Values returns the calibrated values, in the range -1 to 1, of the channels
+// from the most recent valid frame.
+func (d *decoder) Values() []float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]float64(nil), d.values...)
+}
+
+// Widths returns the pulse widths of the channels from the most recent valid
+// frame.
+func (d *decoder) Widths() []time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]time.Duration(nil), d.widths...)
+}
+
+// Failsafe returns true if no valid frame has been received within the
+// failsafe timeout.
+//
+// The decoder is in failsafe until the first valid frame is received.
+func (d *decoder) Failsafe() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.failsafe
+}
+
+// frame records a complete frame of pulse widths.
+func (d *decoder) frame(widths []time.Duration) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	copy(d.widths, widths)
+	for i, w := range widths {
+		d.values[i] = d.cal[i].Value(w)
+	}
+	d.failsafe = false
+	if d.timer == nil {
+		d.timer = time.AfterFunc(d.timeout, d.lost)
+	} else {
+		d.timer.Reset(d.timeout)
+	}
+	var values []float64
+	if d.onFrame != nil {
+		values = append(values, d.values...)
+	}
+	d.mu.Unlock()
+	if values != nil {
+		d.onFrame(values)
+	}
+}
+
+// lost enters failsafe when the timer expires.
+func (d *decoder) lost() {
+	d.mu.Lock()
+	if d.closed || d.failsafe {
+		d.mu.Unlock()
+		return
+	}
+	d.failsafe = true
+	d.mu.Unlock()
+	if d.onFailsafe != nil {
+		d.onFailsafe()
+	}
+}
+
+func (d *decoder) close() {
+	d.mu.Lock()
+	d.closed = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.mu.Unlock()
+}
+
+func validPulse(width time.Duration) bool {
+	return width >= minPulse && width <= maxPulse
+}
+
+// CPPM decodes a CPPM sum signal, where the channels are encoded as the
+// periods between consecutive pulses, and frames are separated by a gap
+// longer than any channel.
+type CPPM struct {
+	decoder
+	pin *gpio.Pin
+	// Only accessed by Edge
+	last   time.Time
+	synced bool
+	pulses []time.Duration
+}
+
+// NewCPPM creates a decoder for the CPPM signal on the pin, carrying the given
+// number of channels.
+//
+// The periods are measured between rising edges, so an inverted signal, which
+// is equivalent, requires no special handling.
+//
+// If pin is nil then edges must be passed to the decoder via Edge.
+func NewCPPM(pin *gpio.Pin, channels int, options ...Option) (*CPPM, error) {
+	d := &CPPM{
+		pin:    pin,
+		pulses: make([]time.Duration, 0, channels),
+	}
+	d.init(channels, options)
+	if pin != nil {
+		pin.Input()
+		// only rising edges are watched, though sysfs may report a stale
+		// level, so treat all events as rising.
+		if err := pin.WatchEvents(gpio.EdgeRising, func(evt gpio.Event) {
+			d.Edge(gpio.High, evt.Time)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Close stops decoding, and removes the watch from the pin.
+func (d *CPPM) Close() {
+	if d.pin != nil {
+		d.pin.Unwatch()
+	}
+	d.close()
+}
+
+// Edge passes an edge on the signal to the decoder.
+//
+// Edges must be passed in order, and only rising edges are considered.
+func (d *CPPM) Edge(level gpio.Level, t time.Time) {
+	if level != gpio.High {
+		return
+	}
+	last := d.last
+	d.last = t
+	if last.IsZero() {
+		return
+	}
+	period := t.Sub(last)
+	if period > syncGap {
+		if d.synced && len(d.pulses) == cap(d.pulses) {
+			d.frame(d.pulses)
+		}
+		d.synced = true
+		d.pulses = d.pulses[:0]
+		return
+	}
+	if !d.synced {
+		return
+	}
+	if !validPulse(period) || len(d.pulses) == cap(d.pulses) {
+		// wait for the next sync gap.
+		d.synced = false
+		return
+	}
+	d.pulses = append(d.pulses, period)
+}
+
+// PWM decodes a separate PWM signal for each channel, where the channel is
+// encoded as the width of the high pulse.
+type PWM struct {
+	decoder
+	pins []*gpio.Pin
+	// Only accessed by Edge
+	rise   []time.Time
+	pulses []time.Duration
+	seen   []bool
+	nseen  int
+}
+
+// NewPWM creates a decoder for the PWM signals on the pins, one per channel.
+//
+// A frame is complete once a valid pulse has been received on every channel.
+//
+// Any nil pins are not watched, and edges for those channels must be passed to
+// the decoder via Edge.
+func NewPWM(pins []*gpio.Pin, options ...Option) (*PWM, error) {
+	n := len(pins)
+	d := &PWM{
+		pins:   pins,
+		rise:   make([]time.Time, n),
+		pulses: make([]time.Duration, n),
+		seen:   make([]bool, n),
+	}
+	d.init(n, options)
+	// edges from different pins arrive on the one watcher goroutine, but
+	// serialise anyway as they may also be fed via Edge.
+	var mu sync.Mutex
+	for i, pin := range pins {
+		if pin == nil {
+			continue
+		}
+		ch := i
+		pin.Input()
+		err := pin.WatchEvents(gpio.EdgeBoth, func(evt gpio.Event) {
+			mu.Lock()
+			d.Edge(ch, evt.Level, evt.Time)
+			mu.Unlock()
+		})
+		if err != nil {
+			d.unwatch()
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Close stops decoding, and removes the watches from the pins.
+func (d *PWM) Close() {
+	d.unwatch()
+	d.close()
+}
+
+func (d *PWM) unwatch() {
+	for _, pin := range d.pins {
+		if pin != nil {
+			pin.Unwatch()
+		}
+	}
+}
+
+// Edge passes an edge on the signal of the channel to the decoder.
+//
+// Edges for each channel must be passed in order.
+func (d *PWM) Edge(ch int, level gpio.Level, t time.Time) {
+	if ch < 0 || ch >= len(d.rise) {
+		return
+	}
+	if level == gpio.High {
+		d.rise[ch] = t
+		return
+	}
+	rise := d.rise[ch]
+	d.rise[ch] = time.Time{}
+	if rise.IsZero() {
+		return
+	}
+	width := t.Sub(rise)
+	if !validPulse(width) {
+		return
+	}
+	d.pulses[ch] = width
+	if !d.seen[ch] {
+		d.seen[ch] = true
+		d.nseen++
+	}
+	if d.nseen < len(d.seen) {
+		return
+	}
+	d.frame(d.pulses)
+	for i := range d.seen {
+		d.seen[i] = false
+	}
+	d.nseen = 0
+}
@@ -0,0 +1,168 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package rc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/device/rc"
+)
+
+const us = time.Microsecond
+
+func TestCalibration(t *testing.T) {
+	c := rc.DefaultCalibration
+	assert.Equal(t, 0.0, c.Value(1500*us))
+	assert.Equal(t, -1.0, c.Value(1000*us))
+	assert.Equal(t, 1.0, c.Value(2000*us))
+	assert.Equal(t, 0.5, c.Value(1750*us))
+	assert.Equal(t, -0.5, c.Value(1250*us))
+	// clamped
+	assert.Equal(t, -1.0, c.Value(900*us))
+	assert.Equal(t, 1.0, c.Value(2100*us))
+	// asymmetric
+	c = rc.Calibration{Min: 1100 * us, Center: 1500 * us, Max: 1700 * us}
+	assert.Equal(t, -0.5, c.Value(1300*us))
+	assert.Equal(t, 0.5, c.Value(1600*us))
+}
+
+// cppmFrame feeds a frame of rising edges, starting with a sync gap,
+// and returns the time of the last edge.
+func cppmFrame(d *rc.CPPM, t time.Time, widths ...time.Duration) time.Time {
+	t = t.Add(5 * time.Millisecond)
+	d.Edge(gpio.High, t)
+	for _, w := range widths {
+		t = t.Add(w)
+		d.Edge(gpio.Low, t.Add(-w+300*us))
+		d.Edge(gpio.High, t)
+	}
+	return t
+}
+
+func TestCPPM(t *testing.T) {
+	var frames [][]float64
+	d, err := rc.NewCPPM(nil, 3, rc.WithFrameHandler(func(v []float64) {
+		frames = append(frames, append([]float64(nil), v...))
+	}))
+	require.Nil(t, err)
+	defer d.Close()
+	assert.Equal(t, 3, d.Channels())
+	assert.True(t, d.Failsafe())
+
+	now := time.Now()
+	d.Edge(gpio.High, now)
+	// partial frame before sync is ignored
+	now = now.Add(1500 * us)
+	d.Edge(gpio.High, now)
+	now = cppmFrame(d, now, 1000*us, 1500*us, 2000*us)
+	assert.Empty(t, frames)
+	// the frame is completed by the following sync gap
+	now = cppmFrame(d, now, 1250*us, 1750*us, 1500*us)
+	require.Len(t, frames, 1)
+	assert.Equal(t, []float64{-1, 0, 1}, frames[0])
+	assert.False(t, d.Failsafe())
+	assert.Equal(t, []time.Duration{1000 * us, 1500 * us, 2000 * us}, d.Widths())
+
+	// glitched frame is discarded
+	now = cppmFrame(d, now, 1500*us, 100*us, 1500*us)
+	require.Len(t, frames, 2)
+	assert.Equal(t, []float64{-0.5, 0.5, 0}, frames[1])
+	// short frame is discarded
+	now = cppmFrame(d, now, 1500*us, 1500*us)
+	assert.Len(t, frames, 2)
+	// long frame is discarded
+	now = cppmFrame(d, now, 1500*us, 1500*us, 1500*us, 1500*us)
+	assert.Len(t, frames, 2)
+	cppmFrame(d, now)
+	assert.Len(t, frames, 2)
+	assert.Equal(t, []float64{-0.5, 0.5, 0}, d.Values())
+}
+
+func TestPWM(t *testing.T) {
+	var frames [][]float64
+	d, err := rc.NewPWM([]*gpio.Pin{nil, nil},
+		rc.WithCalibration(1, rc.Calibration{Min: 1100 * us, Center: 1500 * us, Max: 1900 * us}),
+		rc.WithFrameHandler(func(v []float64) {
+			frames = append(frames, append([]float64(nil), v...))
+		}))
+	require.Nil(t, err)
+	defer d.Close()
+	assert.Equal(t, 2, d.Channels())
+
+	now := time.Now()
+	// fall without rise is ignored
+	d.Edge(0, gpio.Low, now)
+	d.Edge(0, gpio.High, now)
+	d.Edge(0, gpio.Low, now.Add(2000*us))
+	assert.Empty(t, frames)
+	// invalid pulse is ignored
+	d.Edge(1, gpio.High, now)
+	d.Edge(1, gpio.Low, now.Add(3000*us))
+	assert.Empty(t, frames)
+	// out of range channels are ignored
+	d.Edge(2, gpio.High, now)
+	d.Edge(-1, gpio.High, now)
+	d.Edge(1, gpio.High, now)
+	d.Edge(1, gpio.Low, now.Add(1300*us))
+	require.Len(t, frames, 1)
+	assert.Equal(t, []float64{1, -0.5}, frames[0])
+	assert.Equal(t, []time.Duration{2000 * us, 1300 * us}, d.Widths())
+	// a frame requires all channels to be updated
+	now = now.Add(20 * time.Millisecond)
+	d.Edge(1, gpio.High, now)
+	d.Edge(1, gpio.Low, now.Add(1500*us))
+	assert.Len(t, frames, 1)
+	d.Edge(0, gpio.High, now)
+	d.Edge(0, gpio.Low, now.Add(1500*us))
+	require.Len(t, frames, 2)
+	assert.Equal(t, []float64{0, 0}, frames[1])
+}
+
+func TestFailsafe(t *testing.T) {
+	lost := make(chan struct{}, 2)
+	d, err := rc.NewPWM([]*gpio.Pin{nil},
+		rc.WithFailsafe(20*time.Millisecond),
+		rc.WithFailsafeHandler(func() {
+			lost <- struct{}{}
+		}))
+	require.Nil(t, err)
+	defer d.Close()
+	assert.True(t, d.Failsafe())
+	pulse := func() {
+		now := time.Now()
+		d.Edge(0, gpio.High, now)
+		d.Edge(0, gpio.Low, now.Add(1500*us))
+	}
+	pulse()
+	assert.False(t, d.Failsafe())
+	for i := 0; i < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+		pulse()
+	}
+	select {
+	case <-lost:
+		t.Error("failsafe with signal")
+	default:
+	}
+	select {
+	case <-lost:
+	case <-time.After(100 * time.Millisecond):
+		t.Error("missed failsafe")
+	}
+	assert.True(t, d.Failsafe())
+	select {
+	case <-lost:
+		t.Error("repeated failsafe")
+	case <-time.After(40 * time.Millisecond):
+	}
+	// recovers with signal
+	pulse()
+	assert.False(t, d.Failsafe())
+}
@@ -0,0 +1,348 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package relay provides a driver for relays, and banks of relays, with
+// safeguards suitable for switching mains loads.
+package relay
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Relay is a relay driven by a pin.
+//
+// The relay is guaranteed to be off when the pin is switched to an Output,
+// and can be restricted to minimum on and off times, to protect loads such as
+// compressors and contactors from rapid cycling.
+type Relay struct {
+	pin       gpio.Pinner
+	activeLow bool
+	minOn     time.Duration
+	minOff    time.Duration
+	clock     clock.Clock
+	// the bank containing the relay, if any.
+	bank *Bank
+	// Guards the following
+	mu      sync.Mutex
+	on      bool
+	changed time.Time
+}
+
+// Option defines an option that can be applied when creating a Relay.
+type Option func(*Relay)
+
+// WithActiveLow indicates the relay is energised by driving the pin Low, as
+// is common for relay modules with optocoupled inputs.
+//
+// The default is active high.
+func WithActiveLow() Option {
+	return func(r *Relay) {
+		r.activeLow = true
+	}
+}
+
+// WithMinOn sets the minimum time the relay must remain on before it can be
+// turned off.
+//
+// The default is 0.
+func WithMinOn(d time.Duration) Option {
+	return func(r *Relay) {
+		r.minOn = d
+	}
+}
+
+// WithMinOff sets the minimum time the relay must remain off before it can be
+// turned on.
+//
+// The minimum off time also applies from the creation of the relay, so a
+// quickly restarted program cannot cycle the load.
+//
+// The default is 0.
+func WithMinOff(d time.Duration) Option {
+	return func(r *Relay) {
+		r.minOff = d
+	}
+}
+
+// WithClock sets the clock used to time the dwell and interlock delays, e.g. a
+// clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(r *Relay) {
+		r.clock = c
+	}
+}
+
+// New creates a Relay on the pin.
+//
+// The inactive level is written to the pin before it is switched to an
+// Output, so the relay is never briefly energised.
+func New(pin gpio.Pinner, options ...Option) *Relay {
+	r := &Relay{pin: pin, clock: clock.Real}
+	for _, option := range options {
+		option(r)
+	}
+	r.changed = r.clock.Now()
+	pin.Write(r.level(false))
+	pin.SetMode(gpio.Output)
+	return r
+}
+
+// Close turns off the relay, irrespective of the minimum on time.
+//
+// The pin is left as an Output, driving the inactive level, as releasing it to
+// an Input could leave the relay input floating.
+func (r *Relay) Close() {
+	r.mu.Lock()
+	r.on = false
+	r.changed = r.clock.Now()
+	r.pin.Write(r.level(false))
+	r.mu.Unlock()
+}
+
+// On turns on the relay.
+func (r *Relay) On() error {
+	return r.Set(true)
+}
+
+// Off turns off the relay.
+func (r *Relay) Off() error {
+	return r.Set(false)
+}
+
+// Set sets the state of the relay.
+//
+// Returns ErrDwell if the relay has not been in its current state for the
+// minimum time, or ErrInterlock if turning on the relay would energise it at
+// the same time as an interlocked relay.  In either case the state of the
+// relay is unchanged.
+func (r *Relay) Set(on bool) error {
+	if r.bank != nil {
+		return r.bank.set(r, on)
+	}
+	return r.set(on, 0)
+}
+
+// IsOn returns true if the relay is on.
+func (r *Relay) IsOn() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.on
+}
+
+// Ready returns the time remaining until the relay can change state, or 0 if
+// it can change state now.
+func (r *Relay) Ready() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining()
+}
+
+// Assumes caller holds the mu lock.
+func (r *Relay) remaining() time.Duration {
+	dwell := r.minOff
+	if r.on {
+		dwell = r.minOn
+	}
+	if left := dwell - r.clock.Now().Sub(r.changed); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// set sets the state of the relay, if permitted by the dwell times, with
+// holdoff being any additional time required since the relay was turned off.
+func (r *Relay) set(on bool, holdoff time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if on == r.on {
+		return nil
+	}
+	if r.remaining() > 0 {
+		return ErrDwell
+	}
+	if on && holdoff > 0 {
+		return ErrDwell
+	}
+	r.on = on
+	r.changed = r.clock.Now()
+	r.pin.Write(r.level(on))
+	return nil
+}
+
+// offSince returns the time the relay was turned off, and false if it is on.
+func (r *Relay) offSince() (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed, !r.on
+}
+
+func (r *Relay) level(on bool) gpio.Level {
+	return gpio.Level(on != r.activeLow)
+}
+
+// Bank is a collection of relays, which may be interlocked so that no two
+// relays in an interlock group are ever on at the same time.
+//
+// e.g. the forward and reverse contactors of a motor.
+type Bank struct {
+	relays []*Relay
+	delay  time.Duration
+	// Guards the following and changes to the states of the relays.
+	mu     sync.Mutex
+	groups [][]*Relay
+}
+
+// BankOption defines an option that can be applied when creating a Bank.
+type BankOption func(*Bank)
+
+// WithInterlockDelay sets the minimum time between an interlocked relay
+// turning off and another in its group turning on, to allow the contacts of
+// the first to open fully.
+//
+// As for the minimum off time, the relays are considered to have turned off
+// when they were created.
+//
+// The default is 0.
+func WithInterlockDelay(d time.Duration) BankOption {
+	return func(b *Bank) {
+		b.delay = d
+	}
+}
+
+// NewBank creates a Bank of the relays.
+//
+// The relays must not belong to any other bank.
+func NewBank(relays []*Relay, options ...BankOption) *Bank {
+	b := &Bank{relays: relays}
+	for _, option := range options {
+		option(b)
+	}
+	for _, r := range relays {
+		r.bank = b
+	}
+	return b
+}
+
+// Close turns off all the relays in the bank.
+func (b *Bank) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.relays {
+		r.Close()
+	}
+}
+
+// Len returns the number of relays in the bank.
+func (b *Bank) Len() int {
+	return len(b.relays)
+}
+
+// Relay returns the relay with the given index, or nil if there is no such
+// relay.
+func (b *Bank) Relay(n int) *Relay {
+	if n < 0 || n >= len(b.relays) {
+		return nil
+	}
+	return b.relays[n]
+}
+
+// Interlock adds an interlock group containing the relays with the given
+// indices.
+//
+// Returns ErrInterlock if more than one of the relays is currently on.
+func (b *Bank) Interlock(relays ...int) error {
+	group := make([]*Relay, 0, len(relays))
+	for _, n := range relays {
+		r := b.Relay(n)
+		if r == nil {
+			return ErrInvalidRelay
+		}
+		group = append(group, r)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	on := 0
+	for _, r := range group {
+		if r.IsOn() {
+			on++
+		}
+	}
+	if on > 1 {
+		return ErrInterlock
+	}
+	b.groups = append(b.groups, group)
+	return nil
+}
+
+// AllOff turns off all relays in the bank that can be turned off, and returns
+// the first error encountered.
+func (b *Bank) AllOff() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var err error
+	for _, r := range b.relays {
+		if rerr := r.set(false, 0); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// set sets the state of a relay in the bank, subject to its interlocks.
+func (b *Bank) set(r *Relay, on bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !on {
+		return r.set(false, 0)
+	}
+	var holdoff time.Duration
+	for _, g := range b.groups {
+		if !contains(g, r) {
+			continue
+		}
+		for _, other := range g {
+			if other == r {
+				continue
+			}
+			since, off := other.offSince()
+			if !off {
+				return ErrInterlock
+			}
+			if left := b.delay - other.clock.Now().Sub(since); left > holdoff {
+				holdoff = left
+			}
+		}
+	}
+	return r.set(true, holdoff)
+}
+
+func contains(rr []*Relay, r *Relay) bool {
+	for _, x := range rr {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrDwell indicates the relay cannot change state as it has not been in
+	// its current state for the minimum time.
+	ErrDwell = errors.New("minimum dwell time not elapsed")
+
+	// ErrInterlock indicates the relay cannot be turned on as an interlocked
+	// relay is on.
+	ErrInterlock = errors.New("interlocked relay is on")
+
+	// ErrInvalidRelay indicates the relay index is not in the bank.
+	ErrInvalidRelay = errors.New("invalid relay")
+)
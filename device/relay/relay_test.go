@@ -0,0 +1,136 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package relay_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/relay"
+	"github.com/warthog618/gpio/mock"
+)
+
+func TestNew(t *testing.T) {
+	pin := mock.NewPin(1)
+	// the pin must never be seen driving the active level.
+	assert.Nil(t, pin.Watch(gpio.EdgeFalling, func(p gpio.Pinner) {
+		if pin.Mode() == gpio.Output {
+			t.Error("relay energised")
+		}
+	}))
+	r := relay.New(pin, relay.WithActiveLow())
+	pin.Unwatch()
+	assert.Equal(t, gpio.Output, pin.Mode())
+	assert.Equal(t, gpio.High, pin.Read())
+	assert.False(t, r.IsOn())
+	assert.Nil(t, r.On())
+	assert.True(t, r.IsOn())
+	assert.Equal(t, gpio.Low, pin.Read())
+	assert.Nil(t, r.On())
+	assert.Nil(t, r.Off())
+	assert.Equal(t, gpio.High, pin.Read())
+
+	pin = mock.NewPin(2)
+	r = relay.New(pin)
+	assert.Equal(t, gpio.Low, pin.Read())
+	assert.Nil(t, r.Set(true))
+	assert.Equal(t, gpio.High, pin.Read())
+	r.Close()
+	assert.False(t, r.IsOn())
+	assert.Equal(t, gpio.Low, pin.Read())
+	assert.Equal(t, gpio.Output, pin.Mode())
+}
+
+func TestDwell(t *testing.T) {
+	pin := mock.NewPin(1)
+	clk := clock.NewFake(time.Now())
+	r := relay.New(pin,
+		relay.WithMinOn(20*time.Millisecond),
+		relay.WithMinOff(10*time.Millisecond),
+		relay.WithClock(clk))
+	// min off applies from creation
+	assert.Equal(t, relay.ErrDwell, r.On())
+	clk.Advance(4 * time.Millisecond)
+	assert.Equal(t, 6*time.Millisecond, r.Ready())
+	clk.Advance(r.Ready() - time.Microsecond)
+	assert.Equal(t, relay.ErrDwell, r.On())
+	clk.Advance(time.Microsecond)
+	assert.Nil(t, r.On())
+	assert.Equal(t, relay.ErrDwell, r.Off())
+	assert.True(t, r.IsOn())
+	assert.Equal(t, gpio.High, pin.Read())
+	clk.Advance(19 * time.Millisecond)
+	assert.Equal(t, time.Millisecond, r.Ready())
+	assert.Equal(t, relay.ErrDwell, r.Off())
+	clk.Advance(time.Millisecond)
+	assert.Equal(t, time.Duration(0), r.Ready())
+	assert.Nil(t, r.Off())
+	assert.Equal(t, relay.ErrDwell, r.On())
+	assert.False(t, r.IsOn())
+	// close ignores the minimum on time
+	clk.Advance(10 * time.Millisecond)
+	assert.Nil(t, r.On())
+	r.Close()
+	assert.False(t, r.IsOn())
+	assert.Equal(t, gpio.Low, pin.Read())
+}
+
+func TestInterlock(t *testing.T) {
+	pins := []*mock.Pin{mock.NewPin(0), mock.NewPin(1), mock.NewPin(2)}
+	rr := make([]*relay.Relay, len(pins))
+	for i, p := range pins {
+		rr[i] = relay.New(p)
+	}
+	b := relay.NewBank(rr)
+	assert.Equal(t, 3, b.Len())
+	assert.Equal(t, rr[1], b.Relay(1))
+	assert.Nil(t, b.Relay(3))
+	assert.Equal(t, relay.ErrInvalidRelay, b.Interlock(0, 3))
+	require.Nil(t, b.Interlock(0, 1))
+	assert.Nil(t, rr[0].On())
+	assert.Equal(t, relay.ErrInterlock, rr[1].On())
+	assert.False(t, rr[1].IsOn())
+	assert.Equal(t, gpio.Low, pins[1].Read())
+	// relays outside the group are unaffected
+	assert.Nil(t, rr[2].On())
+	assert.Nil(t, rr[0].Off())
+	assert.Nil(t, rr[1].On())
+	assert.Equal(t, relay.ErrInterlock, rr[0].On())
+	// a group cannot be added across relays that are on
+	assert.Equal(t, relay.ErrInterlock, b.Interlock(1, 2))
+	assert.Nil(t, b.AllOff())
+	for i, r := range rr {
+		assert.False(t, r.IsOn(), i)
+	}
+	assert.Nil(t, b.Interlock(1, 2))
+	assert.Nil(t, rr[2].On())
+	assert.Equal(t, relay.ErrInterlock, rr[1].On())
+	b.Close()
+	assert.Equal(t, gpio.Low, pins[2].Read())
+}
+
+func TestInterlockDelay(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	rr := []*relay.Relay{
+		relay.New(mock.NewPin(0), relay.WithClock(clk)),
+		relay.New(mock.NewPin(1), relay.WithClock(clk)),
+	}
+	b := relay.NewBank(rr, relay.WithInterlockDelay(10*time.Millisecond))
+	require.Nil(t, b.Interlock(0, 1))
+	// the delay applies from creation
+	assert.Equal(t, relay.ErrDwell, rr[0].On())
+	clk.Advance(10 * time.Millisecond)
+	assert.Nil(t, rr[0].On())
+	assert.Nil(t, rr[0].Off())
+	clk.Advance(9 * time.Millisecond)
+	assert.Equal(t, relay.ErrDwell, rr[1].On())
+	clk.Advance(time.Millisecond)
+	assert.Nil(t, rr[1].On())
+}
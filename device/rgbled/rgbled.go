@@ -0,0 +1,163 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package rgbled provides a driver for RGB LEDs driven by three PWM channels.
+package rgbled
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/pwm"
+)
+
+// RGBLED is an RGB LED with each of its red, green and blue elements driven by
+// a PWM.
+//
+// Colors are gamma corrected, so that equal steps in the color components
+// appear as equal steps in brightness.
+type RGBLED struct {
+	r, g, b *pwm.PWM
+	gamma   float64
+	// Guards the following
+	mu    sync.Mutex
+	color [3]uint8
+	// the generation of the color, so fades can detect newer colors.
+	gen int
+}
+
+// Option defines an option that can be applied when creating an RGBLED.
+type Option func(*config)
+
+type config struct {
+	freq        float64
+	gamma       float64
+	commonAnode bool
+}
+
+// WithCommonAnode indicates the LED has a common anode, so the elements are
+// lit by driving their pins Low.
+//
+// The default is common cathode.
+func WithCommonAnode() Option {
+	return func(c *config) {
+		c.commonAnode = true
+	}
+}
+
+// WithGamma sets the gamma used to correct the color components.
+//
+// The default is 2.2.  A gamma of 1 disables correction.
+func WithGamma(gamma float64) Option {
+	return func(c *config) {
+		c.gamma = gamma
+	}
+}
+
+// WithFrequency sets the PWM frequency, in Hz.
+//
+// The default is 200Hz.
+func WithFrequency(freq float64) Option {
+	return func(c *config) {
+		c.freq = freq
+	}
+}
+
+// New creates an RGBLED on the pins driving its red, green and blue elements.
+//
+// The LED is initially off.
+func New(r, g, b gpio.Pinner, options ...Option) *RGBLED {
+	cfg := config{freq: 200, gamma: 2.2}
+	for _, option := range options {
+		option(&cfg)
+	}
+	var po []pwm.Option
+	if cfg.commonAnode {
+		po = append(po, pwm.WithActiveLow())
+	}
+	return &RGBLED{
+		r:     pwm.New(r, cfg.freq, po...),
+		g:     pwm.New(g, cfg.freq, po...),
+		b:     pwm.New(b, cfg.freq, po...),
+		gamma: cfg.gamma,
+	}
+}
+
+// Close turns off the LED and releases the pins.
+func (l *RGBLED) Close() {
+	l.mu.Lock()
+	l.gen++
+	l.mu.Unlock()
+	l.r.Close()
+	l.g.Close()
+	l.b.Close()
+}
+
+// Color returns the current color.
+func (l *RGBLED) Color() (r, g, b uint8) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.color[0], l.color[1], l.color[2]
+}
+
+// SetColor sets the color, cancelling any fade in progress.
+func (l *RGBLED) SetColor(r, g, b uint8) {
+	l.mu.Lock()
+	l.gen++
+	l.apply([3]float64{float64(r), float64(g), float64(b)})
+	l.mu.Unlock()
+}
+
+// Off turns off the LED.
+func (l *RGBLED) Off() {
+	l.SetColor(0, 0, 0)
+}
+
+// Fade crossfades from the current color to the given color over the
+// duration, and blocks until the fade is complete.
+//
+// The fade is cancelled if the color is set, or another fade is started,
+// before it completes.
+func (l *RGBLED) Fade(r, g, b uint8, d time.Duration) {
+	const step = 20 * time.Millisecond
+	l.mu.Lock()
+	l.gen++
+	gen := l.gen
+	from := [3]float64{float64(l.color[0]), float64(l.color[1]), float64(l.color[2])}
+	l.mu.Unlock()
+	to := [3]float64{float64(r), float64(g), float64(b)}
+	steps := int(d / step)
+	for i := 1; i <= steps; i++ {
+		time.Sleep(step)
+		f := float64(i) / float64(steps)
+		var c [3]float64
+		for n := range c {
+			c[n] = from[n] + (to[n]-from[n])*f
+		}
+		l.mu.Lock()
+		if l.gen != gen {
+			l.mu.Unlock()
+			return
+		}
+		l.apply(c)
+		l.mu.Unlock()
+	}
+	l.mu.Lock()
+	if l.gen == gen {
+		l.apply(to)
+	}
+	l.mu.Unlock()
+}
+
+// apply sets the PWMs to the color.
+// Assumes the caller holds the mu lock.
+func (l *RGBLED) apply(c [3]float64) {
+	for n, p := range []*pwm.PWM{l.r, l.g, l.b} {
+		l.color[n] = uint8(math.Round(c[n]))
+		p.SetDuty(math.Pow(c[n]/255, l.gamma))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package rgbled_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/device/rgbled"
+	"github.com/warthog618/gpio/mock"
+)
+
+func TestRGBLED(t *testing.T) {
+	r, g, b := mock.NewPin(1), mock.NewPin(2), mock.NewPin(3)
+	l := rgbled.New(r, g, b)
+	defer l.Close()
+	assert.Equal(t, gpio.Low, r.Read())
+	l.SetColor(255, 0, 255)
+	assert.Equal(t, gpio.High, r.Read())
+	assert.Equal(t, gpio.Low, g.Read())
+	assert.Equal(t, gpio.High, b.Read())
+	cr, cg, cb := l.Color()
+	assert.Equal(t, []uint8{255, 0, 255}, []uint8{cr, cg, cb})
+	l.Off()
+	assert.Equal(t, gpio.Low, r.Read())
+	assert.Equal(t, gpio.Low, b.Read())
+}
+
+func TestRGBLEDCommonAnode(t *testing.T) {
+	r, g, b := mock.NewPin(1), mock.NewPin(2), mock.NewPin(3)
+	l := rgbled.New(r, g, b, rgbled.WithCommonAnode())
+	assert.Equal(t, gpio.High, r.Read())
+	l.SetColor(0, 255, 0)
+	assert.Equal(t, gpio.High, r.Read())
+	assert.Equal(t, gpio.Low, g.Read())
+	l.Close()
+	assert.Equal(t, gpio.High, g.Read())
+}
+
+func TestRGBLEDFade(t *testing.T) {
+	r, g, b := mock.NewPin(1), mock.NewPin(2), mock.NewPin(3)
+	l := rgbled.New(r, g, b, rgbled.WithGamma(1))
+	defer l.Close()
+	l.SetColor(0, 0, 0)
+	l.Fade(255, 100, 0, 100*time.Millisecond)
+	cr, cg, cb := l.Color()
+	assert.Equal(t, []uint8{255, 100, 0}, []uint8{cr, cg, cb})
+	// cancelled by SetColor
+	done := make(chan struct{})
+	go func() {
+		l.Fade(0, 0, 0, time.Second)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	l.SetColor(1, 2, 3)
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Error("fade not cancelled")
+	}
+	cr, cg, cb = l.Color()
+	assert.Equal(t, []uint8{1, 2, 3}, []uint8{cr, cg, cb})
+}
@@ -0,0 +1,306 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package sevenseg provides a driver for multiplexed seven segment displays.
+package sevenseg
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Segment bits, as used in segment patterns.
+const (
+	SegA  = 0x01
+	SegB  = 0x02
+	SegC  = 0x04
+	SegD  = 0x08
+	SegE  = 0x10
+	SegF  = 0x20
+	SegG  = 0x40
+	SegDP = 0x80
+)
+
+// font maps characters to segment patterns.
+var font = map[rune]byte{
+	'0': 0x3f, '1': 0x06, '2': 0x5b, '3': 0x4f, '4': 0x66,
+	'5': 0x6d, '6': 0x7d, '7': 0x07, '8': 0x7f, '9': 0x6f,
+	'A': 0x77, 'B': 0x7c, 'C': 0x39, 'D': 0x5e, 'E': 0x79, 'F': 0x71,
+	'G': 0x3d, 'H': 0x76, 'I': 0x30, 'J': 0x1e, 'L': 0x38, 'N': 0x54,
+	'O': 0x5c, 'P': 0x73, 'R': 0x50, 'S': 0x6d, 'T': 0x78, 'U': 0x3e,
+	'Y': 0x6e, '-': 0x40, '_': 0x08, ' ': 0x00,
+}
+
+// Segments drives the segment lines shared by the digits of a display.
+type Segments interface {
+	// Write sets the segment lines to the pattern, where a set bit drives
+	// the segment active.
+	Write(pattern byte)
+}
+
+// Direct drives the segments directly from pins, in the order a to g, and
+// optionally dp.
+type Direct struct {
+	pins   []gpio.Pinner
+	active gpio.Level
+}
+
+// NewDirect creates a Direct for the segment pins, which are set to Outputs.
+//
+// The activeLow flag indicates that segments are lit by driving the pins
+// Low, as for common anode displays.
+func NewDirect(pins []gpio.Pinner, activeLow bool) *Direct {
+	d := &Direct{pins: pins, active: gpio.Level(!activeLow)}
+	for _, p := range pins {
+		p.Write(!d.active)
+		p.SetMode(gpio.Output)
+	}
+	return d
+}
+
+// Write sets the segment pins to the pattern.
+func (d *Direct) Write(pattern byte) {
+	for i, p := range d.pins {
+		lit := pattern&(1<<uint(i)) != 0
+		p.Write(gpio.Level(lit == bool(d.active)))
+	}
+}
+
+// ShiftRegister drives the segments via a serial in, parallel out, shift
+// register such as the 74HC595.
+//
+// The pattern is shifted out MSB first, so dp is connected to output 7 and
+// segment a to output 0.
+type ShiftRegister struct {
+	data, clock, latch gpio.Pinner
+	invert             bool
+}
+
+// NewShiftRegister creates a ShiftRegister driven by the data, clock and
+// latch pins, which are set to Outputs.
+//
+// The activeLow flag indicates that segments are lit by driving the outputs
+// Low, as for common anode displays.
+func NewShiftRegister(data, clock, latch gpio.Pinner, activeLow bool) *ShiftRegister {
+	for _, p := range []gpio.Pinner{data, clock, latch} {
+		p.Write(gpio.Low)
+		p.SetMode(gpio.Output)
+	}
+	return &ShiftRegister{data: data, clock: clock, latch: latch, invert: activeLow}
+}
+
+// Write shifts out the pattern and latches it onto the outputs.
+func (s *ShiftRegister) Write(pattern byte) {
+	if s.invert {
+		pattern = ^pattern
+	}
+	for i := 7; i >= 0; i-- {
+		s.data.Write(pattern&(1<<uint(i)) != 0)
+		s.clock.Write(gpio.High)
+		s.clock.Write(gpio.Low)
+	}
+	s.latch.Write(gpio.High)
+	s.latch.Write(gpio.Low)
+}
+
+// Display is a multiplexed seven segment display.
+//
+// The digits share the segment lines, and are lit in turn by a background
+// goroutine, fast enough to appear continuously lit.
+type Display struct {
+	seg         Segments
+	digits      []gpio.Pinner
+	digitActive gpio.Level
+	slot        time.Duration
+	clock       clock.Clock
+	done        chan struct{}
+	wg          sync.WaitGroup
+	// Guards the following
+	mu         sync.Mutex
+	patterns   []byte
+	brightness float64
+}
+
+// Option defines an option that can be applied when creating a Display.
+type Option func(*Display)
+
+// WithDigitActiveHigh indicates the digits are selected by driving their pins
+// High, as for common anode displays without driver transistors.
+//
+// The default is active Low, as for common cathode displays.
+func WithDigitActiveHigh() Option {
+	return func(d *Display) {
+		d.digitActive = gpio.High
+	}
+}
+
+// WithRefreshRate sets the rate, in Hz, at which the whole display is
+// refreshed.
+//
+// The default is 100Hz.  Rates much below 50Hz will be seen to flicker.
+func WithRefreshRate(rate float64) Option {
+	return func(d *Display) {
+		d.slot = time.Duration(float64(time.Second) / rate / float64(len(d.digits)))
+	}
+}
+
+// WithClock sets the clock used to time the refresh, e.g. a clock.Fake for
+// tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(d *Display) {
+		d.clock = c
+	}
+}
+
+// New creates a Display with the segments and digit select pins, and starts
+// refreshing it.
+//
+// The digits are ordered left to right.  The display is initially blank.
+func New(seg Segments, digits []gpio.Pinner, options ...Option) *Display {
+	d := &Display{
+		seg:         seg,
+		digits:      digits,
+		digitActive: gpio.Low,
+		clock:       clock.Real,
+		done:        make(chan struct{}),
+		patterns:    make([]byte, len(digits)),
+		brightness:  1,
+	}
+	WithRefreshRate(100)(d)
+	for _, option := range options {
+		option(d)
+	}
+	for _, p := range digits {
+		p.Write(!d.digitActive)
+		p.SetMode(gpio.Output)
+	}
+	d.wg.Add(1)
+	go d.refresh()
+	return d
+}
+
+// Close stops refreshing the display and blanks it.
+func (d *Display) Close() {
+	close(d.done)
+	d.wg.Wait()
+	for _, p := range d.digits {
+		p.Write(!d.digitActive)
+	}
+	d.seg.Write(0)
+}
+
+// Digits returns the number of digits in the display.
+func (d *Display) Digits() int {
+	return len(d.digits)
+}
+
+// SetBrightness sets the brightness, in the range 0 to 1, by controlling the
+// proportion of its time slot that each digit is lit.
+func (d *Display) SetBrightness(brightness float64) {
+	if brightness < 0 {
+		brightness = 0
+	} else if brightness > 1 {
+		brightness = 1
+	}
+	d.mu.Lock()
+	d.brightness = brightness
+	d.mu.Unlock()
+}
+
+// SetPattern sets the segment pattern for a digit.
+func (d *Display) SetPattern(digit int, pattern byte) {
+	if digit < 0 || digit >= len(d.digits) {
+		return
+	}
+	d.mu.Lock()
+	d.patterns[digit] = pattern
+	d.mu.Unlock()
+}
+
+// Pattern returns the segment pattern for a digit.
+func (d *Display) Pattern(digit int) byte {
+	if digit < 0 || digit >= len(d.digits) {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.patterns[digit]
+}
+
+// Print displays the string, right aligned.
+//
+// A '.' lights the decimal point of the preceding character, and characters
+// that cannot be displayed are shown as blanks.  Characters beyond the width
+// of the display are truncated from the left.
+func (d *Display) Print(s string) {
+	var pp []byte
+	for _, c := range strings.ToUpper(s) {
+		if c == '.' {
+			if len(pp) == 0 || pp[len(pp)-1]&SegDP != 0 {
+				pp = append(pp, 0)
+			}
+			pp[len(pp)-1] |= SegDP
+			continue
+		}
+		pp = append(pp, font[c])
+	}
+	if len(pp) > len(d.digits) {
+		pp = pp[len(pp)-len(d.digits):]
+	}
+	d.mu.Lock()
+	for i := range d.patterns {
+		d.patterns[i] = 0
+	}
+	copy(d.patterns[len(d.patterns)-len(pp):], pp)
+	d.mu.Unlock()
+}
+
+func (d *Display) refresh() {
+	defer d.wg.Done()
+	t := d.clock.NewTimer(0)
+	<-t.C()
+	sleep := func(dur time.Duration) bool {
+		if dur <= 0 {
+			return true
+		}
+		t.Reset(dur)
+		select {
+		case <-d.done:
+			t.Stop()
+			return false
+		case <-t.C():
+			return true
+		}
+	}
+	for {
+		for i, p := range d.digits {
+			d.mu.Lock()
+			pattern := d.patterns[i]
+			on := time.Duration(float64(d.slot) * d.brightness)
+			d.mu.Unlock()
+			// the digit is only selected while its segments are set to
+			// prevent ghosting on adjacent digits.
+			d.seg.Write(pattern)
+			if on > 0 {
+				p.Write(d.digitActive)
+			}
+			if !sleep(on) {
+				return
+			}
+			if len(d.digits) > 1 || on < d.slot {
+				p.Write(!d.digitActive)
+			}
+			if !sleep(d.slot - on) {
+				return
+			}
+		}
+	}
+}
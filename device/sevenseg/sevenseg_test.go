@@ -0,0 +1,171 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package sevenseg_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/sevenseg"
+	"github.com/warthog618/gpio/mock"
+)
+
+func mockPins(n int) ([]*mock.Pin, []gpio.Pinner) {
+	mm := make([]*mock.Pin, n)
+	pp := make([]gpio.Pinner, n)
+	for i := range mm {
+		mm[i] = mock.NewPin(i)
+		pp[i] = mm[i]
+	}
+	return mm, pp
+}
+
+func readPattern(pins []*mock.Pin) byte {
+	var b byte
+	for i, p := range pins {
+		if p.Read() {
+			b |= 1 << uint(i)
+		}
+	}
+	return b
+}
+
+func TestPrint(t *testing.T) {
+	_, sp := mockPins(8)
+	_, dp := mockPins(4)
+	d := sevenseg.New(sevenseg.NewDirect(sp, false), dp)
+	defer d.Close()
+	assert.Equal(t, 4, d.Digits())
+	patterns := []struct {
+		in  string
+		out [4]byte
+	}{
+		{"1", [4]byte{0, 0, 0, 0x06}},
+		{"12.5", [4]byte{0, 0x06, 0x5b | sevenseg.SegDP, 0x6d}},
+		{"..", [4]byte{0, 0, sevenseg.SegDP, sevenseg.SegDP}},
+		{"-abc", [4]byte{0x40, 0x77, 0x7c, 0x39}},
+		{"12345", [4]byte{0x5b, 0x4f, 0x66, 0x6d}},
+		{"?", [4]byte{}},
+	}
+	for _, p := range patterns {
+		d.Print(p.in)
+		var out [4]byte
+		for i := range out {
+			out[i] = d.Pattern(i)
+		}
+		assert.Equal(t, p.out, out, p.in)
+	}
+	d.SetPattern(0, 0xff)
+	assert.Equal(t, byte(0xff), d.Pattern(0))
+	d.SetPattern(4, 0xff)
+	assert.Equal(t, byte(0), d.Pattern(4))
+}
+
+func TestDirect(t *testing.T) {
+	sm, sp := mockPins(8)
+	dm, dp := mockPins(1)
+	clk := clock.NewFake(time.Now())
+	d := sevenseg.New(sevenseg.NewDirect(sp, false), dp, sevenseg.WithClock(clk))
+	d.Print("7")
+	// applied from the next refresh.
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Millisecond)
+	clk.BlockUntil(1)
+	assert.Equal(t, byte(0x07), readPattern(sm))
+	assert.Equal(t, gpio.Low, dm[0].Read())
+	d.Close()
+	assert.Equal(t, byte(0), readPattern(sm))
+	assert.Equal(t, gpio.High, dm[0].Read())
+
+	// active low
+	sm, sp = mockPins(8)
+	dm, dp = mockPins(1)
+	d = sevenseg.New(sevenseg.NewDirect(sp, true), dp,
+		sevenseg.WithDigitActiveHigh(), sevenseg.WithClock(clk))
+	d.Print("7")
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Millisecond)
+	clk.BlockUntil(1)
+	assert.Equal(t, byte(^byte(0x07)), readPattern(sm))
+	assert.Equal(t, gpio.High, dm[0].Read())
+	d.Close()
+	assert.Equal(t, gpio.Low, dm[0].Read())
+}
+
+func TestMultiplex(t *testing.T) {
+	sm, sp := mockPins(8)
+	dm, dp := mockPins(2)
+	clk := clock.NewFake(time.Now())
+	d := sevenseg.New(sevenseg.NewDirect(sp, false), dp,
+		sevenseg.WithRefreshRate(50), sevenseg.WithClock(clk))
+	defer d.Close()
+	d.Print("12")
+	// a 10ms slot per digit, so applied from the next refresh.
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(10 * time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		clk.BlockUntil(1)
+		assert.Equal(t, byte(0x06), readPattern(sm))
+		assert.Equal(t, gpio.Low, dm[0].Read())
+		assert.Equal(t, gpio.High, dm[1].Read())
+		clk.Advance(10 * time.Millisecond)
+		clk.BlockUntil(1)
+		assert.Equal(t, byte(0x5b), readPattern(sm))
+		assert.Equal(t, gpio.High, dm[0].Read())
+		assert.Equal(t, gpio.Low, dm[1].Read())
+		clk.Advance(10 * time.Millisecond)
+	}
+
+	// lit for a quarter of each slot, from the next slot.
+	clk.BlockUntil(1)
+	d.SetBrightness(0.25)
+	clk.Advance(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		assert.Equal(t, gpio.Low, dm[1].Read())
+		clk.Advance(2500 * time.Microsecond)
+		clk.BlockUntil(1)
+		assert.Equal(t, gpio.High, dm[0].Read())
+		assert.Equal(t, gpio.High, dm[1].Read())
+		clk.Advance(7500 * time.Microsecond)
+		clk.BlockUntil(1)
+		assert.Equal(t, byte(0x06), readPattern(sm))
+		assert.Equal(t, gpio.Low, dm[0].Read())
+		clk.Advance(2500 * time.Microsecond)
+		clk.BlockUntil(1)
+		assert.Equal(t, gpio.High, dm[0].Read())
+		assert.Equal(t, gpio.High, dm[1].Read())
+		clk.Advance(7500 * time.Microsecond)
+	}
+}
+
+func TestShiftRegister(t *testing.T) {
+	data := mock.NewPin(1)
+	clock := mock.NewPin(2)
+	latch := mock.NewPin(3)
+	sr := sevenseg.NewShiftRegister(data, clock, latch, false)
+	var shifted byte
+	assert.Nil(t, clock.Watch(gpio.EdgeRising, func(gpio.Pinner) {
+		shifted <<= 1
+		if data.Read() {
+			shifted |= 1
+		}
+	}))
+	var latched []byte
+	assert.Nil(t, latch.Watch(gpio.EdgeRising, func(gpio.Pinner) {
+		latched = append(latched, shifted)
+	}))
+	sr.Write(0x5b)
+	assert.Equal(t, []byte{0x00, 0x5b}, latched)
+	sr = sevenseg.NewShiftRegister(data, clock, latch, true)
+	sr.Write(0x5b)
+	assert.Equal(t, []byte{0x00, 0x5b, 0xa4}, latched)
+}
@@ -0,0 +1,269 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package shutdown provides a listener for a power or shutdown button, which
+// cleans up and powers off the system, or performs some other action, when the
+// button is held or pressed in a pattern.
+package shutdown
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Button is a shutdown button.
+//
+// The button is debounced, and triggers once, when held for the hold time or
+// pressed the given number of times within the window.  When triggered the
+// button stops watching the pin, calls the cleanup, then performs the action.
+type Button struct {
+	pin      gpio.Pinner
+	active   gpio.Level
+	debounce time.Duration
+	hold     time.Duration
+	presses  int
+	window   time.Duration
+	cleanup  func()
+	action   func() error
+	errh     func(error)
+	clock    clock.Clock
+	// Guards the following
+	mu        sync.Mutex
+	pressed   bool
+	debouncer clock.Timer
+	holder    clock.Timer
+	times     []time.Time
+	done      bool
+}
+
+// Option defines an option that can be applied when creating a Button.
+type Option func(*Button)
+
+// WithActiveHigh indicates the button drives the pin high when pressed.
+//
+// The default is active low, with the button shorting the pin to ground, and
+// the pin pulled up, if the pin supports setting the pull.
+func WithActiveHigh() Option {
+	return func(b *Button) {
+		b.active = gpio.High
+	}
+}
+
+// WithDebounce sets the time the pin must be stable before a change in level
+// is accepted.
+//
+// The default is 50ms.
+func WithDebounce(d time.Duration) Option {
+	return func(b *Button) {
+		b.debounce = d
+	}
+}
+
+// WithHold sets the time the button must be held to trigger.
+//
+// The default is 3s.
+func WithHold(d time.Duration) Option {
+	return func(b *Button) {
+		b.hold = d
+		b.presses = 0
+	}
+}
+
+// WithPresses triggers the button when it is pressed n times within the
+// window, rather than when held.
+func WithPresses(n int, window time.Duration) Option {
+	return func(b *Button) {
+		b.presses = n
+		b.window = window
+	}
+}
+
+// WithCommand sets the command run when the button triggers.
+//
+// The default is "systemctl poweroff".
+func WithCommand(name string, args ...string) Option {
+	return func(b *Button) {
+		b.action = func() error {
+			return exec.Command(name, args...).Run()
+		}
+	}
+}
+
+// WithHandler sets a handler called when the button triggers, in place of
+// running a command.
+func WithHandler(handler func()) Option {
+	return func(b *Button) {
+		b.action = func() error {
+			handler()
+			return nil
+		}
+	}
+}
+
+// WithCleanup sets the function called to tidy up before the action is
+// performed.
+//
+// The default is gpio.Close, which restores the GPIO pins to their initial
+// state before the system shuts down.
+func WithCleanup(cleanup func()) Option {
+	return func(b *Button) {
+		b.cleanup = cleanup
+	}
+}
+
+// WithErrorHandler sets a handler called with any error returned by the
+// command.
+func WithErrorHandler(handler func(error)) Option {
+	return func(b *Button) {
+		b.errh = handler
+	}
+}
+
+// WithClock sets the clock used to time the debounce, hold and presses, e.g.
+// a clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(b *Button) {
+		b.clock = c
+	}
+}
+
+// New creates a Button on the pin.
+//
+// The pin is set to an Input, and watched for presses.
+func New(pin gpio.Pinner, options ...Option) (*Button, error) {
+	b := &Button{
+		pin:      pin,
+		active:   gpio.Low,
+		debounce: 50 * time.Millisecond,
+		hold:     3 * time.Second,
+		cleanup:  func() { gpio.Close() },
+		clock:    clock.Real,
+	}
+	WithCommand("systemctl", "poweroff")(b)
+	for _, option := range options {
+		option(b)
+	}
+	pin.SetMode(gpio.Input)
+	if p, ok := pin.(puller); ok {
+		if b.active == gpio.Low {
+			p.SetPull(gpio.PullUp)
+		} else {
+			p.SetPull(gpio.PullDown)
+		}
+	}
+	if err := pin.Watch(gpio.EdgeBoth, b.edge); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// puller is implemented by pins, such as gpio.Pin, that support pull up and
+// pull down.
+type puller interface {
+	SetPull(gpio.Pull)
+}
+
+// Close stops watching the button, without triggering.
+func (b *Button) Close() {
+	b.mu.Lock()
+	done := b.stop()
+	b.mu.Unlock()
+	if !done {
+		b.pin.Unwatch()
+	}
+}
+
+// stop stops the button, returning true if it was already stopped.
+// Assumes caller holds the mu lock.
+func (b *Button) stop() bool {
+	done := b.done
+	b.done = true
+	if b.debouncer != nil {
+		b.debouncer.Stop()
+	}
+	if b.holder != nil {
+		b.holder.Stop()
+	}
+	return done
+}
+
+// edge restarts the debounce timer on each edge.
+func (b *Button) edge(gpio.Pinner) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		return
+	}
+	if b.debouncer != nil {
+		b.debouncer.Stop()
+	}
+	b.debouncer = b.clock.AfterFunc(b.debounce, b.settled)
+}
+
+// settled handles the pin level once it has been stable for the debounce
+// period.
+func (b *Button) settled() {
+	pressed := b.pin.Read() == b.active
+	b.mu.Lock()
+	if b.done || pressed == b.pressed {
+		b.mu.Unlock()
+		return
+	}
+	b.pressed = pressed
+	if b.presses == 0 {
+		if pressed {
+			b.holder = b.clock.AfterFunc(b.hold, b.held)
+		} else if b.holder != nil {
+			b.holder.Stop()
+		}
+		b.mu.Unlock()
+		return
+	}
+	if !pressed {
+		b.mu.Unlock()
+		return
+	}
+	now := b.clock.Now()
+	b.times = append(b.times, now)
+	if len(b.times) > b.presses {
+		b.times = b.times[1:]
+	}
+	if len(b.times) < b.presses || now.Sub(b.times[0]) > b.window {
+		b.mu.Unlock()
+		return
+	}
+	b.stop()
+	b.mu.Unlock()
+	b.trigger()
+}
+
+func (b *Button) held() {
+	b.mu.Lock()
+	if b.done || !b.pressed {
+		b.mu.Unlock()
+		return
+	}
+	b.stop()
+	b.mu.Unlock()
+	b.trigger()
+}
+
+// trigger performs the cleanup and action.
+// Called from a timer goroutine, so not from within the watch handler.
+func (b *Button) trigger() {
+	b.pin.Unwatch()
+	if b.cleanup != nil {
+		b.cleanup()
+	}
+	if err := b.action(); err != nil && b.errh != nil {
+		b.errh(err)
+	}
+}
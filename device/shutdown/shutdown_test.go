@@ -0,0 +1,182 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package shutdown_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/shutdown"
+	"github.com/warthog618/gpio/mock"
+)
+
+// recorder records the sequence of calls made by the Button.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func (r *recorder) options() []shutdown.Option {
+	return []shutdown.Option{
+		shutdown.WithDebounce(5 * time.Millisecond),
+		shutdown.WithCleanup(func() { r.add("cleanup") }),
+		shutdown.WithHandler(func() { r.add("action") }),
+	}
+}
+
+func TestHold(t *testing.T) {
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	var r recorder
+	b, err := shutdown.New(pin, append(r.options(), shutdown.WithHold(50*time.Millisecond))...)
+	assert.Nil(t, err)
+	defer b.Close()
+	assert.Equal(t, gpio.Input, pin.Mode())
+	assert.Equal(t, gpio.PullUp, pin.Pull())
+
+	// short press
+	pin.Set(gpio.Low)
+	time.Sleep(20 * time.Millisecond)
+	pin.Set(gpio.High)
+	time.Sleep(60 * time.Millisecond)
+	assert.Empty(t, r.get())
+
+	// bouncing is ignored
+	for i := 0; i < 10; i++ {
+		pin.Set(gpio.Low)
+		time.Sleep(time.Millisecond)
+		pin.Set(gpio.High)
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(60 * time.Millisecond)
+	assert.Empty(t, r.get())
+
+	// hold
+	pin.Set(gpio.Low)
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, []string{"cleanup", "action"}, r.get())
+
+	// unwatched once triggered
+	assert.Nil(t, pin.Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+	pin.Unwatch()
+}
+
+func TestPresses(t *testing.T) {
+	pin := mock.NewPin(1)
+	var r recorder
+	b, err := shutdown.New(pin, append(r.options(),
+		shutdown.WithActiveHigh(),
+		shutdown.WithPresses(3, 200*time.Millisecond))...)
+	assert.Nil(t, err)
+	defer b.Close()
+	assert.Equal(t, gpio.PullDown, pin.Pull())
+	press := func() {
+		pin.Set(gpio.High)
+		time.Sleep(15 * time.Millisecond)
+		pin.Set(gpio.Low)
+		time.Sleep(15 * time.Millisecond)
+	}
+	press()
+	press()
+	time.Sleep(250 * time.Millisecond)
+	// too slow
+	press()
+	assert.Empty(t, r.get())
+	press()
+	press()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, []string{"cleanup", "action"}, r.get())
+}
+
+func TestCommand(t *testing.T) {
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	errs := make(chan error, 1)
+	b, err := shutdown.New(pin,
+		shutdown.WithDebounce(time.Millisecond),
+		shutdown.WithHold(10*time.Millisecond),
+		shutdown.WithCleanup(nil),
+		shutdown.WithCommand("false"),
+		shutdown.WithErrorHandler(func(err error) { errs <- err }))
+	assert.Nil(t, err)
+	defer b.Close()
+	pin.Set(gpio.Low)
+	select {
+	case err := <-errs:
+		assert.NotNil(t, err)
+	case <-time.After(time.Second):
+		t.Error("command not run")
+	}
+}
+
+func TestClose(t *testing.T) {
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	var r recorder
+	b, err := shutdown.New(pin, append(r.options(), shutdown.WithHold(20*time.Millisecond))...)
+	assert.Nil(t, err)
+	pin.Set(gpio.Low)
+	time.Sleep(10 * time.Millisecond)
+	b.Close()
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, r.get())
+
+	pin.Set(gpio.High)
+	_, err = shutdown.New(pin, r.options()...)
+	assert.Nil(t, err)
+	_, err = shutdown.New(pin, r.options()...)
+	assert.Equal(t, gpio.ErrBusy, err)
+}
+
+func TestFakeClock(t *testing.T) {
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	c := clock.NewFake(time.Now())
+	var r recorder
+	b, err := shutdown.New(pin, append(r.options(),
+		shutdown.WithHold(time.Second),
+		shutdown.WithClock(c))...)
+	assert.Nil(t, err)
+	defer b.Close()
+
+	// bouncing is ignored
+	for i := 0; i < 10; i++ {
+		pin.Set(gpio.Low)
+		c.Advance(time.Millisecond)
+		pin.Set(gpio.High)
+		c.Advance(time.Millisecond)
+	}
+	c.Advance(time.Minute)
+	assert.Empty(t, r.get())
+
+	// released just short of the hold time, as the release is also debounced
+	pin.Set(gpio.Low)
+	c.Advance(time.Second - time.Nanosecond)
+	pin.Set(gpio.High)
+	c.Advance(time.Minute)
+	assert.Empty(t, r.get())
+
+	// hold
+	pin.Set(gpio.Low)
+	c.Advance(5*time.Millisecond + time.Second)
+	assert.Equal(t, []string{"cleanup", "action"}, r.get())
+}
@@ -0,0 +1,326 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package ssd1306 provides a driver for SSD1306 monochrome OLED displays,
+// connected via a bit bashed I2C or SPI bus.
+package ssd1306
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/i2c"
+	"github.com/warthog618/gpio/spi"
+)
+
+// Commands
+const (
+	cmdSetContrast      = 0x81
+	cmdResumeRAM        = 0xa4
+	cmdNormal           = 0xa6
+	cmdInvert           = 0xa7
+	cmdMultiplex        = 0xa8
+	cmdDisplayOff       = 0xae
+	cmdDisplayOn        = 0xaf
+	cmdSetOffset        = 0xd3
+	cmdSetClock         = 0xd5
+	cmdSetPrecharge     = 0xd9
+	cmdSetComPins       = 0xda
+	cmdSetVcomDetect    = 0xdb
+	cmdChargePump       = 0x8d
+	cmdMemoryMode       = 0x20
+	cmdColumnAddr       = 0x21
+	cmdPageAddr         = 0x22
+	cmdStartLine        = 0x40
+	cmdSegRemap         = 0xa1
+	cmdComScanDec       = 0xc8
+	cmdDeactivateScroll = 0x2e
+)
+
+// I2C control bytes
+const (
+	ctrlCommand = 0x00
+	ctrlData    = 0x40
+)
+
+// Addr is the default I2C address of the display.
+const Addr = 0x3c
+
+// Transport writes commands and data to the display.
+type Transport interface {
+	// Command writes a sequence of command bytes.
+	Command(cmds ...byte) error
+
+	// Data writes data to the display RAM.
+	Data(data []byte) error
+}
+
+// SSD1306 is an SSD1306 display, with a framebuffer.
+//
+// Drawing operations update the framebuffer, which is written to the display
+// by Display.
+type SSD1306 struct {
+	t      Transport
+	width  int
+	height int
+	reset  gpio.Pinner
+	// Guards the following and the sequencing of display writes.
+	mu sync.Mutex
+	fb []byte
+}
+
+// Option defines an option that can be applied when creating an SSD1306.
+type Option func(*SSD1306)
+
+// WithReset provides the pin connected to the display RES input, which is
+// pulsed low to reset the display before it is initialised.
+func WithReset(pin gpio.Pinner) Option {
+	return func(d *SSD1306) {
+		d.reset = pin
+	}
+}
+
+// New creates an SSD1306 with the given dimensions, in pixels, e.g. 128x64 or
+// 128x32, and initialises the display.
+//
+// The display is initially clear.
+func New(t Transport, width, height int, options ...Option) (*SSD1306, error) {
+	d := &SSD1306{
+		t:      t,
+		width:  width,
+		height: height,
+		fb:     make([]byte, width*height/8),
+	}
+	for _, option := range options {
+		option(d)
+	}
+	if d.reset != nil {
+		d.reset.Write(gpio.High)
+		d.reset.SetMode(gpio.Output)
+		time.Sleep(time.Millisecond)
+		d.reset.Write(gpio.Low)
+		time.Sleep(10 * time.Millisecond)
+		d.reset.Write(gpio.High)
+	}
+	comPins := byte(0x12)
+	if height == 32 {
+		comPins = 0x02
+	}
+	err := t.Command(
+		cmdDisplayOff,
+		cmdSetClock, 0x80,
+		cmdMultiplex, byte(height-1),
+		cmdSetOffset, 0x00,
+		cmdStartLine,
+		cmdChargePump, 0x14,
+		cmdMemoryMode, 0x00,
+		cmdSegRemap,
+		cmdComScanDec,
+		cmdSetComPins, comPins,
+		cmdSetContrast, 0xcf,
+		cmdSetPrecharge, 0xf1,
+		cmdSetVcomDetect, 0x40,
+		cmdResumeRAM,
+		cmdNormal,
+		cmdDeactivateScroll,
+		cmdDisplayOn)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.Display(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// NewI2C creates an SSD1306 at the 7-bit addr, usually Addr, on the I2C bus.
+func NewI2C(bus *i2c.I2C, addr uint8, width, height int, options ...Option) (*SSD1306, error) {
+	return New(&I2CTransport{bus, addr}, width, height, options...)
+}
+
+// NewSPI creates an SSD1306 on the SPI bus, with the D/C input driven by the
+// dc pin.
+func NewSPI(bus *spi.SPI, dc gpio.Pinner, width, height int, options ...Option) (*SSD1306, error) {
+	return New(NewSPITransport(bus, dc), width, height, options...)
+}
+
+// Close turns off the display.
+func (d *SSD1306) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.t.Command(cmdDisplayOff)
+}
+
+// Width returns the width of the display, in pixels.
+func (d *SSD1306) Width() int {
+	return d.width
+}
+
+// Height returns the height of the display, in pixels.
+func (d *SSD1306) Height() int {
+	return d.height
+}
+
+// Display writes the framebuffer to the display.
+func (d *SSD1306) Display() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.t.Command(
+		cmdColumnAddr, 0, byte(d.width-1),
+		cmdPageAddr, 0, byte(d.height/8-1))
+	if err != nil {
+		return err
+	}
+	return d.t.Data(d.fb)
+}
+
+// Clear clears the framebuffer.
+func (d *SSD1306) Clear() {
+	d.mu.Lock()
+	for i := range d.fb {
+		d.fb[i] = 0
+	}
+	d.mu.Unlock()
+}
+
+// SetPixel sets the state of the pixel at x,y, where 0,0 is the top left.
+//
+// Pixels outside the display are ignored.
+func (d *SSD1306) SetPixel(x, y int, on bool) {
+	d.mu.Lock()
+	d.setPixel(x, y, on)
+	d.mu.Unlock()
+}
+
+// Pixel returns the state of the pixel at x,y.
+func (d *SSD1306) Pixel(x, y int) bool {
+	if x < 0 || x >= d.width || y < 0 || y >= d.height {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fb[y/8*d.width+x]&(1<<uint(y%8)) != 0
+}
+
+// Assumes caller holds the mu lock.
+func (d *SSD1306) setPixel(x, y int, on bool) {
+	if x < 0 || x >= d.width || y < 0 || y >= d.height {
+		return
+	}
+	mask := byte(1 << uint(y%8))
+	if on {
+		d.fb[y/8*d.width+x] |= mask
+	} else {
+		d.fb[y/8*d.width+x] &^= mask
+	}
+}
+
+// DrawText draws the text into the framebuffer with its top left corner at
+// x,y, using the built-in 5x7 font.
+//
+// Each character occupies a 6x8 cell.  Characters outside printable ASCII
+// are drawn as '?', and text beyond the edge of the display is clipped.
+// The cells are cleared before drawing, so text may be overwritten.
+func (d *SSD1306) DrawText(x, y int, text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range text {
+		g := glyph(r)
+		for c := 0; c < CharWidth; c++ {
+			var col byte
+			if c < len(g) {
+				col = g[c]
+			}
+			for row := 0; row < CharHeight; row++ {
+				d.setPixel(x+c, y+row, col&(1<<uint(row)) != 0)
+			}
+		}
+		x += CharWidth
+	}
+}
+
+// The dimensions of the character cell used by DrawText.
+const (
+	CharWidth  = 6
+	CharHeight = 8
+)
+
+// SetContrast sets the contrast of the display, 0-255.
+func (d *SSD1306) SetContrast(contrast uint8) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.t.Command(cmdSetContrast, contrast)
+}
+
+// Invert sets whether the display is inverted, i.e. lit pixels are shown as
+// dark and vice versa.
+func (d *SSD1306) Invert(invert bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if invert {
+		return d.t.Command(cmdInvert)
+	}
+	return d.t.Command(cmdNormal)
+}
+
+// I2CTransport writes to an SSD1306 via a bit bashed I2C bus.
+type I2CTransport struct {
+	Bus  *i2c.I2C
+	Addr uint8
+}
+
+// Command writes the commands to the display.
+func (t *I2CTransport) Command(cmds ...byte) error {
+	return t.Bus.Write(t.Addr, append([]byte{ctrlCommand}, cmds...))
+}
+
+// Data writes the data to the display RAM.
+func (t *I2CTransport) Data(data []byte) error {
+	return t.Bus.Write(t.Addr, append([]byte{ctrlData}, data...))
+}
+
+// SPITransport writes to an SSD1306 via a bit bashed 4-wire SPI bus.
+type SPITransport struct {
+	bus *spi.SPI
+	dc  gpio.Pinner
+}
+
+// NewSPITransport creates a transport on the SPI bus, with the D/C input
+// driven by the dc pin.
+func NewSPITransport(bus *spi.SPI, dc gpio.Pinner) *SPITransport {
+	dc.Write(gpio.Low)
+	dc.SetMode(gpio.Output)
+	return &SPITransport{bus, dc}
+}
+
+// Command writes the commands to the display.
+func (t *SPITransport) Command(cmds ...byte) error {
+	t.write(gpio.Low, cmds)
+	return nil
+}
+
+// Data writes the data to the display RAM.
+func (t *SPITransport) Data(data []byte) error {
+	t.write(gpio.High, data)
+	return nil
+}
+
+func (t *SPITransport) write(dc gpio.Level, data []byte) {
+	s := t.bus
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	s.Ssz.High()
+	s.Sclk.Low()
+	s.Mosi.Output(gpio.Low)
+	t.dc.Write(dc)
+	s.Ssz.Low()
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			s.ClockOut(b>>uint(i)&0x01 == 0x01)
+		}
+	}
+	s.Ssz.High()
+}
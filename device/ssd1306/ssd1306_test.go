@@ -0,0 +1,119 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package ssd1306_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/device/ssd1306"
+	"github.com/warthog618/gpio/mock"
+)
+
+type transport struct {
+	cmds [][]byte
+	data [][]byte
+}
+
+func (t *transport) Command(cmds ...byte) error {
+	t.cmds = append(t.cmds, append([]byte(nil), cmds...))
+	return nil
+}
+
+func (t *transport) Data(data []byte) error {
+	t.data = append(t.data, append([]byte(nil), data...))
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	tr := &transport{}
+	rst := mock.NewPin(0)
+	d, err := ssd1306.New(tr, 128, 32, ssd1306.WithReset(rst))
+	require.Nil(t, err)
+	assert.Equal(t, gpio.Output, rst.Mode())
+	assert.Equal(t, gpio.High, rst.Read())
+	assert.Equal(t, 128, d.Width())
+	assert.Equal(t, 32, d.Height())
+	require.Len(t, tr.cmds, 2)
+	init := tr.cmds[0]
+	assert.Equal(t, byte(0xae), init[0])
+	assert.Equal(t, byte(0xaf), init[len(init)-1])
+	assert.Contains(t, string(init), string([]byte{0xa8, 31}))
+	assert.Contains(t, string(init), string([]byte{0xda, 0x02}))
+	assert.Equal(t, []byte{0x21, 0, 127, 0x22, 0, 3}, tr.cmds[1])
+	require.Len(t, tr.data, 1)
+	assert.Equal(t, make([]byte, 512), tr.data[0])
+	assert.Nil(t, d.Close())
+	assert.Equal(t, []byte{0xae}, tr.cmds[len(tr.cmds)-1])
+}
+
+func TestPixels(t *testing.T) {
+	tr := &transport{}
+	d, err := ssd1306.New(tr, 128, 64)
+	require.Nil(t, err)
+	d.SetPixel(0, 0, true)
+	d.SetPixel(127, 63, true)
+	d.SetPixel(5, 10, true)
+	d.SetPixel(128, 0, true)
+	d.SetPixel(0, -1, true)
+	assert.True(t, d.Pixel(0, 0))
+	assert.True(t, d.Pixel(5, 10))
+	assert.False(t, d.Pixel(5, 11))
+	assert.False(t, d.Pixel(128, 0))
+	assert.Nil(t, d.Display())
+	fb := tr.data[len(tr.data)-1]
+	require.Len(t, fb, 1024)
+	assert.Equal(t, byte(0x01), fb[0])
+	assert.Equal(t, byte(0x04), fb[128+5])
+	assert.Equal(t, byte(0x80), fb[1023])
+	d.SetPixel(5, 10, false)
+	assert.False(t, d.Pixel(5, 10))
+	d.Clear()
+	assert.False(t, d.Pixel(0, 0))
+	assert.Nil(t, d.Display())
+	assert.Equal(t, make([]byte, 1024), tr.data[len(tr.data)-1])
+}
+
+func TestDrawText(t *testing.T) {
+	tr := &transport{}
+	d, err := ssd1306.New(tr, 128, 64)
+	require.Nil(t, err)
+	d.DrawText(0, 8, "I!")
+	assert.Nil(t, d.Display())
+	fb := tr.data[len(tr.data)-1]
+	// page aligned text maps directly to the font columns.
+	assert.Equal(t, []byte{0x00, 0x41, 0x7f, 0x41, 0x00, 0x00}, fb[128:134])
+	assert.Equal(t, []byte{0x00, 0x00, 0x5f, 0x00, 0x00, 0x00}, fb[134:140])
+	// unaligned text spans pages
+	d.Clear()
+	d.DrawText(0, 4, "|")
+	assert.True(t, d.Pixel(2, 4))
+	assert.True(t, d.Pixel(2, 10))
+	assert.False(t, d.Pixel(2, 11))
+	assert.False(t, d.Pixel(1, 4))
+	// unknown characters are drawn as '?', and clipped at the edge
+	d.Clear()
+	d.DrawText(124, 0, "\x01")
+	q := d.Pixel(125, 0)
+	d.Clear()
+	d.DrawText(124, 0, "?")
+	assert.Equal(t, q, d.Pixel(125, 0))
+	assert.True(t, q)
+}
+
+func TestContrast(t *testing.T) {
+	tr := &transport{}
+	d, err := ssd1306.New(tr, 128, 64)
+	require.Nil(t, err)
+	assert.Nil(t, d.SetContrast(0x40))
+	assert.Equal(t, []byte{0x81, 0x40}, tr.cmds[len(tr.cmds)-1])
+	assert.Nil(t, d.Invert(true))
+	assert.Equal(t, []byte{0xa7}, tr.cmds[len(tr.cmds)-1])
+	assert.Nil(t, d.Invert(false))
+	assert.Equal(t, []byte{0xa6}, tr.cmds[len(tr.cmds)-1])
+}
@@ -0,0 +1,237 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package tof provides time of flight measurement between edges on two pins,
+// such as for speed traps, start/stop timing gates, and ultrasonic rangers.
+package tof
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// Gate measures the interval between an edge on the start pin and the
+// subsequent edge on the stop pin.
+//
+// The start and stop pins may be the same pin, e.g. the echo pin of an
+// ultrasonic ranger, for which the width of the echo pulse is measured
+// between the rising and falling edges.
+type Gate struct {
+	start     gpio.Pinner
+	stop      gpio.Pinner
+	startEdge gpio.Edge
+	stopEdge  gpio.Edge
+	timeout   time.Duration
+	trigger   func()
+	// Guards the following
+	mu      sync.Mutex
+	armed   bool
+	started time.Time
+	result  chan time.Duration
+}
+
+// Option defines an option that can be applied when creating a Gate.
+type Option func(*Gate)
+
+// WithStartEdge sets the edge on the start pin that starts the measurement.
+//
+// The default is EdgeRising.
+func WithStartEdge(edge gpio.Edge) Option {
+	return func(g *Gate) {
+		g.startEdge = edge
+	}
+}
+
+// WithStopEdge sets the edge on the stop pin that ends the measurement.
+//
+// The default is EdgeRising, or EdgeFalling if the start and stop pins are
+// the same pin.
+func WithStopEdge(edge gpio.Edge) Option {
+	return func(g *Gate) {
+		g.stopEdge = edge
+	}
+}
+
+// WithTimeout sets the maximum time to wait for a measurement to complete.
+//
+// The default is 1s.
+func WithTimeout(d time.Duration) Option {
+	return func(g *Gate) {
+		g.timeout = d
+	}
+}
+
+// WithTrigger sets a function called to start each measurement, once the gate
+// is armed, e.g. to pulse the trigger pin of an ultrasonic ranger.
+func WithTrigger(trigger func()) Option {
+	return func(g *Gate) {
+		g.trigger = trigger
+	}
+}
+
+// eventWatcher is implemented by pins that can deliver timestamped edge
+// events, such as *gpio.Pin.
+type eventWatcher interface {
+	WatchEvents(edge gpio.Edge, handler func(gpio.Event), options ...gpio.WatchOption) error
+}
+
+// New creates a Gate measuring from an edge on the start pin to an edge on the
+// stop pin.
+//
+// The pins are set to Input, and watched for the duration of the Gate.  If the
+// pins support WatchEvents, as *gpio.Pin does, then the edges are timestamped
+// by the watcher, using the kernel event timestamps when available.
+func New(start, stop gpio.Pinner, options ...Option) (*Gate, error) {
+	g := &Gate{
+		start:     start,
+		stop:      stop,
+		startEdge: gpio.EdgeRising,
+		stopEdge:  gpio.EdgeRising,
+		timeout:   time.Second,
+	}
+	if start == stop {
+		g.stopEdge = gpio.EdgeFalling
+	}
+	for _, option := range options {
+		option(g)
+	}
+	start.SetMode(gpio.Input)
+	if start == stop {
+		return g, watch(start, gpio.EdgeBoth, g.edge)
+	}
+	stop.SetMode(gpio.Input)
+	if err := watch(start, g.startEdge, g.startEvent); err != nil {
+		return nil, err
+	}
+	if err := watch(stop, g.stopEdge, g.stopEvent); err != nil {
+		start.Unwatch()
+		return nil, err
+	}
+	return g, nil
+}
+
+// watch calls the handler with the level and time of the edges on the pin.
+func watch(pin gpio.Pinner, edge gpio.Edge, handler func(gpio.Level, time.Time)) error {
+	if w, ok := pin.(eventWatcher); ok {
+		return w.WatchEvents(edge, func(evt gpio.Event) {
+			handler(evt.Level, evt.Time)
+		})
+	}
+	return pin.Watch(edge, func(p gpio.Pinner) {
+		handler(p.Read(), time.Now())
+	})
+}
+
+// Close removes the watches from the pins.
+func (g *Gate) Close() {
+	g.start.Unwatch()
+	if g.stop != g.start {
+		g.stop.Unwatch()
+	}
+}
+
+// Measure arms the gate, calls the trigger, if any, and returns the interval
+// between the subsequent start and stop edges.
+//
+// Returns ErrTimeout if the measurement does not complete within the timeout.
+// Measure must not be called concurrently.
+func (g *Gate) Measure() (time.Duration, error) {
+	result := make(chan time.Duration, 1)
+	g.mu.Lock()
+	g.armed = true
+	g.started = time.Time{}
+	g.result = result
+	g.mu.Unlock()
+	if g.trigger != nil {
+		g.trigger()
+	}
+	t := time.NewTimer(g.timeout)
+	defer t.Stop()
+	select {
+	case d := <-result:
+		return d, nil
+	case <-t.C:
+		g.mu.Lock()
+		g.armed = false
+		g.mu.Unlock()
+		return 0, ErrTimeout
+	}
+}
+
+// MeasureN performs n measurements and returns the mean interval.
+//
+// Returns the first error encountered, if any.
+func (g *Gate) MeasureN(n int) (time.Duration, error) {
+	if n < 1 {
+		n = 1
+	}
+	var total time.Duration
+	for i := 0; i < n; i++ {
+		d, err := g.Measure()
+		if err != nil {
+			return 0, err
+		}
+		total += d
+	}
+	return total / time.Duration(n), nil
+}
+
+// edge handles the edges when the start and stop pins are the same pin.
+func (g *Gate) edge(level gpio.Level, t time.Time) {
+	g.mu.Lock()
+	started := !g.started.IsZero()
+	g.mu.Unlock()
+	if started {
+		g.stopEvent(level, t)
+	} else {
+		g.startEvent(level, t)
+	}
+}
+
+func (g *Gate) startEvent(level gpio.Level, t time.Time) {
+	if !matches(g.startEdge, level) {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.armed && g.started.IsZero() {
+		g.started = t
+	}
+}
+
+func (g *Gate) stopEvent(level gpio.Level, t time.Time) {
+	if !matches(g.stopEdge, level) {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.armed || g.started.IsZero() || t.Before(g.started) {
+		return
+	}
+	g.armed = false
+	g.result <- t.Sub(g.started)
+}
+
+// matches returns true if an event reporting the level matches the edge.
+func matches(edge gpio.Edge, level gpio.Level) bool {
+	switch edge {
+	case gpio.EdgeBoth:
+		return true
+	case gpio.EdgeRising:
+		return level == gpio.High
+	case gpio.EdgeFalling:
+		return level == gpio.Low
+	}
+	return false
+}
+
+var (
+	// ErrTimeout indicates the measurement did not complete within the
+	// timeout.
+	ErrTimeout = errors.New("timeout")
+)
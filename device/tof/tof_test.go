@@ -0,0 +1,96 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package tof_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/device/tof"
+	"github.com/warthog618/gpio/mock"
+)
+
+func TestGate(t *testing.T) {
+	start := mock.NewPin(1)
+	stop := mock.NewPin(2)
+	g, err := tof.New(start, stop, tof.WithTrigger(func() {
+		start.Set(gpio.High)
+		time.Sleep(5 * time.Millisecond)
+		stop.Set(gpio.High)
+		start.Set(gpio.Low)
+		stop.Set(gpio.Low)
+	}))
+	require.Nil(t, err)
+	defer g.Close()
+	assert.Equal(t, gpio.Input, start.Mode())
+	assert.Equal(t, gpio.Input, stop.Mode())
+
+	d, err := g.Measure()
+	assert.Nil(t, err)
+	assert.True(t, d >= 5*time.Millisecond && d < 10*time.Millisecond, d)
+
+	d, err = g.MeasureN(3)
+	assert.Nil(t, err)
+	assert.True(t, d >= 5*time.Millisecond && d < 10*time.Millisecond, d)
+}
+
+func TestGateEdges(t *testing.T) {
+	start := mock.NewPin(1)
+	stop := mock.NewPin(2)
+	start.Set(gpio.High)
+	stop.Set(gpio.High)
+	g, err := tof.New(start, stop,
+		tof.WithStartEdge(gpio.EdgeFalling),
+		tof.WithStopEdge(gpio.EdgeFalling),
+		tof.WithTrigger(func() {
+			// a stop before the start is ignored.
+			stop.Set(gpio.Low)
+			stop.Set(gpio.High)
+			start.Set(gpio.Low)
+			time.Sleep(2 * time.Millisecond)
+			stop.Set(gpio.Low)
+			start.Set(gpio.High)
+			stop.Set(gpio.High)
+		}))
+	require.Nil(t, err)
+	defer g.Close()
+	d, err := g.Measure()
+	assert.Nil(t, err)
+	assert.True(t, d >= 2*time.Millisecond && d < 7*time.Millisecond, d)
+}
+
+func TestGateSamePin(t *testing.T) {
+	echo := mock.NewPin(1)
+	g, err := tof.New(echo, echo, tof.WithTrigger(func() {
+		echo.Set(gpio.High)
+		time.Sleep(3 * time.Millisecond)
+		echo.Set(gpio.Low)
+	}))
+	require.Nil(t, err)
+	defer g.Close()
+	d, err := g.Measure()
+	assert.Nil(t, err)
+	assert.True(t, d >= 3*time.Millisecond && d < 8*time.Millisecond, d)
+}
+
+func TestGateTimeout(t *testing.T) {
+	start := mock.NewPin(1)
+	stop := mock.NewPin(2)
+	g, err := tof.New(start, stop, tof.WithTimeout(10*time.Millisecond))
+	require.Nil(t, err)
+	defer g.Close()
+	_, err = g.Measure()
+	assert.Equal(t, tof.ErrTimeout, err)
+	_, err = g.MeasureN(2)
+	assert.Equal(t, tof.ErrTimeout, err)
+
+	// already watched
+	_, err = tof.New(mock.NewPin(3), stop)
+	assert.Equal(t, gpio.ErrBusy, err)
+}
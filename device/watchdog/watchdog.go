@@ -0,0 +1,167 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package watchdog provides a keepalive for external hardware watchdog
+// circuits, which reset the system if a heartbeat output stops toggling.
+package watchdog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Keepalive toggles a heartbeat output while the application is healthy.
+//
+// The application indicates it is healthy by periodically calling Feed.  If
+// Feed is not called within the feed timeout then toggling stops, and the
+// watchdog circuit will reset the system.  Starve stops toggling permanently,
+// such as after a fatal error, so the heartbeat cannot be resumed by a part of
+// the application that is still running.
+type Keepalive struct {
+	pin      gpio.Pinner
+	interval time.Duration
+	timeout  time.Duration
+	clock    clock.Clock
+	done     chan struct{}
+	wg       sync.WaitGroup
+	// Guards the following
+	mu       sync.Mutex
+	level    gpio.Level
+	deadline time.Time
+	starved  bool
+	closed   bool
+}
+
+// Option defines an option that can be applied when creating a Keepalive.
+type Option func(*Keepalive)
+
+// WithInterval sets the interval between toggles of the heartbeat.
+//
+// The default is 500ms.
+func WithInterval(d time.Duration) Option {
+	return func(k *Keepalive) {
+		if d > 0 {
+			k.interval = d
+		}
+	}
+}
+
+// WithFeedTimeout sets the time after the last Feed at which toggling stops.
+//
+// The default is 5s.
+func WithFeedTimeout(d time.Duration) Option {
+	return func(k *Keepalive) {
+		if d > 0 {
+			k.timeout = d
+		}
+	}
+}
+
+// WithClock sets the clock used to time the heartbeat and the feed timeout,
+// e.g. a clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(k *Keepalive) {
+		k.clock = c
+	}
+}
+
+// New creates a Keepalive toggling the pin.
+//
+// The pin is set to an output, driven low.  Toggling starts on the first call
+// to Feed, so a program that hangs during startup does not keep the heartbeat
+// alive.
+func New(pin gpio.Pinner, options ...Option) *Keepalive {
+	k := &Keepalive{
+		pin:      pin,
+		interval: 500 * time.Millisecond,
+		timeout:  5 * time.Second,
+		clock:    clock.Real,
+		done:     make(chan struct{}),
+	}
+	for _, option := range options {
+		option(k)
+	}
+	pin.Write(gpio.Low)
+	pin.SetMode(gpio.Output)
+	k.wg.Add(1)
+	go k.run()
+	return k
+}
+
+// Feed indicates the application is healthy, so the heartbeat continues for
+// at least the feed timeout.
+//
+// Feed has no effect once the Keepalive has been starved.
+func (k *Keepalive) Feed() {
+	k.mu.Lock()
+	if !k.starved {
+		k.deadline = k.clock.Now().Add(k.timeout)
+	}
+	k.mu.Unlock()
+}
+
+// Starve permanently stops the heartbeat, so the watchdog circuit will reset
+// the system.
+//
+// The heartbeat is stopped before Starve returns.
+func (k *Keepalive) Starve() {
+	k.mu.Lock()
+	k.starved = true
+	k.mu.Unlock()
+}
+
+// Alive returns true if the heartbeat is toggling, i.e. the Keepalive has been
+// fed within the feed timeout and has not been starved.
+func (k *Keepalive) Alive() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.alive(k.clock.Now())
+}
+
+// Assumes caller holds the mu lock.
+func (k *Keepalive) alive(now time.Time) bool {
+	return !k.starved && now.Before(k.deadline)
+}
+
+// Close stops the heartbeat, leaving the pin at its current level.
+func (k *Keepalive) Close() {
+	k.mu.Lock()
+	k.starved = true
+	if k.closed {
+		k.mu.Unlock()
+		return
+	}
+	k.closed = true
+	k.mu.Unlock()
+	close(k.done)
+	k.wg.Wait()
+}
+
+func (k *Keepalive) run() {
+	defer k.wg.Done()
+	t := k.clock.NewTimer(k.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-t.C():
+			k.mu.Lock()
+			// the toggle is performed under the lock so it cannot follow a
+			// Starve.
+			if k.alive(k.clock.Now()) {
+				k.level = !k.level
+				k.pin.Write(k.level)
+			}
+			k.mu.Unlock()
+			t.Reset(k.interval)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package watchdog_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/device/watchdog"
+	"github.com/warthog618/gpio/mock"
+)
+
+// toggleCounter counts the writes to a pin.
+type toggleCounter struct {
+	*mock.Pin
+	mu     sync.Mutex
+	writes int
+}
+
+func (p *toggleCounter) Write(level gpio.Level) {
+	p.mu.Lock()
+	p.writes++
+	p.mu.Unlock()
+	p.Pin.Write(level)
+}
+
+func (p *toggleCounter) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writes
+}
+
+// tick advances the clock by the intervals, waiting for each to be handled.
+func tick(clk *clock.Fake, interval time.Duration, n int) {
+	for i := 0; i < n; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(interval)
+	}
+	clk.BlockUntil(1)
+}
+
+func TestKeepalive(t *testing.T) {
+	pin := &toggleCounter{Pin: mock.NewPin(1)}
+	clk := clock.NewFake(time.Now())
+	interval := 2 * time.Millisecond
+	k := watchdog.New(pin,
+		watchdog.WithInterval(interval),
+		watchdog.WithFeedTimeout(20*time.Millisecond),
+		watchdog.WithClock(clk))
+	defer k.Close()
+	assert.Equal(t, gpio.Output, pin.Mode())
+	assert.Equal(t, gpio.Low, pin.Read())
+	// not toggled until fed.
+	start := pin.count()
+	tick(clk, interval, 5)
+	assert.False(t, k.Alive())
+	assert.Equal(t, start, pin.count())
+
+	// toggled every interval.
+	k.Feed()
+	assert.True(t, k.Alive())
+	tick(clk, interval, 1)
+	assert.Equal(t, start+1, pin.count())
+	assert.Equal(t, gpio.High, pin.Read())
+	tick(clk, interval, 1)
+	assert.Equal(t, start+2, pin.count())
+	assert.Equal(t, gpio.Low, pin.Read())
+
+	// stops once the feed times out.
+	tick(clk, interval, 7)
+	assert.True(t, k.Alive())
+	assert.Equal(t, start+9, pin.count())
+	tick(clk, interval, 1)
+	assert.False(t, k.Alive())
+	n := pin.count()
+	assert.Equal(t, start+9, n)
+	tick(clk, interval, 5)
+	assert.Equal(t, n, pin.count())
+
+	// and resumes when fed again.
+	k.Feed()
+	tick(clk, interval, 1)
+	assert.Equal(t, n+1, pin.count())
+}
+
+func TestStarve(t *testing.T) {
+	pin := &toggleCounter{Pin: mock.NewPin(1)}
+	clk := clock.NewFake(time.Now())
+	k := watchdog.New(pin, watchdog.WithInterval(time.Millisecond), watchdog.WithClock(clk))
+	k.Feed()
+	start := pin.count()
+	tick(clk, time.Millisecond, 3)
+	k.Starve()
+	assert.False(t, k.Alive())
+	n := pin.count()
+	assert.Equal(t, start+3, n)
+	// cannot be revived.
+	k.Feed()
+	assert.False(t, k.Alive())
+	tick(clk, time.Millisecond, 3)
+	assert.Equal(t, n, pin.count())
+	k.Close()
+	k.Close()
+}
@@ -0,0 +1,81 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Peripheral base detection from the device tree.
+
+package gpio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+)
+
+var (
+	// The sources of the peripheral address mapping.
+	dtRangesPath      = "/proc/device-tree/soc/ranges"
+	dtSocCellsPath    = "/proc/device-tree/soc/#address-cells"
+	dtSocSizeCellPath = "/proc/device-tree/soc/#size-cells"
+	dtRootCellsPath   = "/proc/device-tree/#address-cells"
+)
+
+// gpioOffset is the offset of the GPIO registers from the peripheral base on
+// the BCM2835 family.
+const gpioOffset = 0x200000
+
+// DetectPeripheralBase returns the physical address of the peripherals, as
+// mapped by the soc node of the device tree.
+//
+// The ranges of the soc node map the bus addresses of the peripherals to
+// physical addresses, so the parent address of the first range is the
+// peripheral base, e.g. 0x3f000000 on a Pi 3.  The cell sizes of the node are
+// honoured, so the 64-bit physical addresses of the BCM2711 are supported.
+//
+// This does not require the package to be opened.
+func DetectPeripheralBase() (int64, error) {
+	ranges, err := ioutil.ReadFile(dtRangesPath)
+	if err != nil {
+		return 0, err
+	}
+	return parseRanges(ranges,
+		readCells(dtSocCellsPath, 1),
+		readCells(dtRootCellsPath, 1),
+		readCells(dtSocSizeCellPath, 1))
+}
+
+// readCells reads a cell count property, returning def if the property is not
+// available.
+func readCells(path string, def int) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil || len(b) != 4 {
+		return def
+	}
+	return int(binary.BigEndian.Uint32(b))
+}
+
+// parseRanges returns the parent address of the first entry of a ranges
+// property with the given cell sizes.
+func parseRanges(ranges []byte, childCells, parentCells, sizeCells int) (int64, error) {
+	if parentCells < 1 || parentCells > 2 || childCells < 0 || sizeCells < 0 {
+		return 0, ErrInvalidRanges
+	}
+	start := childCells * 4
+	if len(ranges) < (childCells+parentCells+sizeCells)*4 {
+		return 0, ErrInvalidRanges
+	}
+	var base uint64
+	for i := 0; i < parentCells; i++ {
+		base = base<<32 | uint64(binary.BigEndian.Uint32(ranges[start+i*4:]))
+	}
+	if int64(base) <= 0 {
+		return 0, ErrInvalidRanges
+	}
+	return int64(base), nil
+}
+
+var (
+	// ErrInvalidRanges indicates the device tree ranges could not be parsed.
+	ErrInvalidRanges = errors.New("invalid device tree ranges")
+)
@@ -0,0 +1,79 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRanges(t *testing.T) {
+	patterns := []struct {
+		name   string
+		ranges []byte
+		cells  [3]int
+		base   int64
+		err    error
+	}{
+		{"bcm2835",
+			[]byte{0x7e, 0, 0, 0, 0x20, 0, 0, 0, 0x01, 0, 0, 0},
+			[3]int{1, 1, 1}, 0x20000000, nil},
+		{"bcm2837",
+			[]byte{0x7e, 0, 0, 0, 0x3f, 0, 0, 0, 0x01, 0, 0, 0,
+				0x40, 0, 0, 0, 0x40, 0, 0, 0, 0, 0x04, 0, 0},
+			[3]int{1, 1, 1}, 0x3f000000, nil},
+		{"bcm2711",
+			[]byte{0x7e, 0, 0, 0, 0, 0, 0, 0, 0xfe, 0, 0, 0, 0x01, 0x80, 0, 0},
+			[3]int{1, 2, 1}, 0xfe000000, nil},
+		{"high",
+			[]byte{0, 0, 0, 0, 0x7c, 0, 0, 0, 0, 0, 0, 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0x04, 0, 0, 0},
+			[3]int{2, 2, 2}, 0x1000000000, nil},
+		{"short",
+			[]byte{0x7e, 0, 0, 0, 0x3f, 0, 0, 0},
+			[3]int{1, 1, 1}, 0, ErrInvalidRanges},
+		{"zero",
+			[]byte{0x7e, 0, 0, 0, 0, 0, 0, 0, 0x01, 0, 0, 0},
+			[3]int{1, 1, 1}, 0, ErrInvalidRanges},
+		{"cells",
+			[]byte{0x7e, 0, 0, 0, 0x3f, 0, 0, 0, 0x01, 0, 0, 0, 0, 0, 0, 0},
+			[3]int{1, 3, 0}, 0, ErrInvalidRanges},
+	}
+	for _, p := range patterns {
+		base, err := parseRanges(p.ranges, p.cells[0], p.cells[1], p.cells[2])
+		assert.Equal(t, p.err, err, p.name)
+		assert.Equal(t, p.base, base, p.name)
+	}
+}
+
+func TestDetectPeripheralBase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dt")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	oldRanges, oldSoc, oldRoot := dtRangesPath, dtSocCellsPath, dtRootCellsPath
+	defer func() {
+		dtRangesPath, dtSocCellsPath, dtRootCellsPath = oldRanges, oldSoc, oldRoot
+	}()
+	dtRangesPath = filepath.Join(dir, "ranges")
+	dtSocCellsPath = filepath.Join(dir, "soc-cells")
+	dtRootCellsPath = filepath.Join(dir, "root-cells")
+
+	_, err = DetectPeripheralBase()
+	assert.True(t, os.IsNotExist(err))
+
+	// BCM2711, with 64-bit parent addresses.
+	require.Nil(t, ioutil.WriteFile(dtRangesPath,
+		[]byte{0x7e, 0, 0, 0, 0, 0, 0, 0, 0xfe, 0, 0, 0, 0x01, 0x80, 0, 0}, 0644))
+	require.Nil(t, ioutil.WriteFile(dtSocCellsPath, []byte{0, 0, 0, 1}, 0644))
+	require.Nil(t, ioutil.WriteFile(dtRootCellsPath, []byte{0, 0, 0, 2}, 0644))
+	base, err := DetectPeripheralBase()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0xfe000000), base)
+}
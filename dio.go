@@ -22,9 +22,7 @@
 // 	gpio.Open()
 // 	defer gpio.Close()
 //
-// 	pin := gpio.NewPin(gpio.J8p7)
-// 	pin.Low()
-// 	pin.Output()
+// 	pin, _ := gpio.NewPin(gpio.J8p7, gpio.WithInitialLevel(gpio.Low), gpio.WithMode(gpio.Output))
 //
 // 	for {
 // 		pin.Toggle()
@@ -41,6 +39,8 @@
 package gpio
 
 import (
+	"errors"
+	"sync/atomic"
 	"time"
 )
 
@@ -55,8 +55,43 @@ type Pin struct {
 	pullReg2711 int
 	bank        int
 	mask        uint32
+	// Pointers to the level, set and clear registers, so the fast path
+	// avoids indexing, and the associated bounds checks, on mem.
+	levelPtr *uint32
+	setPtr   *uint32
+	clearPtr *uint32
 	// Mutable fields
 	shadow Level
+	drive  Drive
+	// true if the pin is an emulated open drain or open source output.
+	emulated bool
+	// true once the level has been set by the Pin, so the pin can be
+	// made an Output without driving a stale level.
+	written bool
+	// The line requested from the character device, if in use.
+	line *line
+}
+
+// Pinner is the interface common to all pins, whether native GPIO pins or pins
+// provided by an expander.
+//
+// This allows applications and device drivers to treat pins uniformly,
+// irrespective of how they are provided.
+type Pinner interface {
+	// Read returns the level of the pin.
+	Read() Level
+
+	// Write sets the level of the pin.
+	Write(Level)
+
+	// SetMode sets the mode of the pin.
+	SetMode(Mode)
+
+	// Watch calls the handler when the pin level changes on the given edge.
+	Watch(Edge, func(Pinner)) error
+
+	// Unwatch removes any watch from the pin.
+	Unwatch()
 }
 
 // Level represents the high (true) or low (false) level of a Pin.
@@ -68,6 +103,9 @@ type Mode int
 // Pull defines the pull up/down state of a Pin.
 type Pull int
 
+// Drive defines the drive mode of an output Pin.
+type Drive int
+
 const (
 	memLength = 4096
 
@@ -103,6 +141,20 @@ const (
 	PullUp
 )
 
+// Drive modes for output pins.
+const (
+	// DrivePushPull actively drives the pin both high and low.
+	DrivePushPull Drive = iota
+
+	// DriveOpenDrain actively drives the pin low, but switches the pin to
+	// an input (Hi-Z) when set high.
+	DriveOpenDrain
+
+	// DriveOpenSource actively drives the pin high, but switches the pin to
+	// an input (Hi-Z) when set low.
+	DriveOpenSource
+)
+
 // Convenience mapping from J8 pinouts to BCM pinouts.
 const (
 	J8p27 = iota
@@ -136,8 +188,33 @@ const (
 	MaxGPIOPin
 )
 
+// Convenience mapping from the pins of the P1 header of the original Model B
+// (rev 1) that differ from the J8 header to BCM pinouts.
+const (
+	P1p3Rev1  = 0
+	P1p5Rev1  = 1
+	P1p13Rev1 = 21
+)
+
+// Convenience mapping from the P5 header of the Model A and B (rev 2) to BCM
+// pinouts.
+const (
+	P5p3 = 28
+	P5p4 = 29
+	P5p5 = 30
+	P5p6 = 31
+)
+
+// MaxCMGPIOPin is the number of pins available on the Compute Module edge
+// connector.
+//
+// Pins above MaxGPIOPin can only be used on boards that provide them.
+const MaxCMGPIOPin = 46
+
 // GPIO aliases to J8 pins
 const (
+	GPIO0  = J8p27
+	GPIO1  = J8p28
 	GPIO2  = J8p3
 	GPIO3  = J8p5
 	GPIO4  = J8p7
@@ -168,12 +245,27 @@ const (
 
 // NewPin creates a new pin object.
 // The pin number provided is the BCM GPIO number.
-func NewPin(pin int) *Pin {
+//
+// Repeated requests for the same pin return independent Pins, unless a
+// different Sharing policy is set using the WithSharing option.
+//
+// The pin may be configured by providing options, e.g.
+//
+//	pin, err := gpio.NewPin(gpio.J8p7,
+//		gpio.WithMode(gpio.Input),
+//		gpio.WithPull(gpio.PullUp),
+//		gpio.WithEdge(gpio.EdgeFalling, handler))
+//
+// If any option cannot be applied then an error is returned.
+func NewPin(pin int, options ...PinOption) (*Pin, error) {
+	if cdev != nil {
+		return newLinePin(cdev, pin, options)
+	}
 	if len(mem) == 0 {
 		panic("GPIO not initialised.")
 	}
-	if pin < 0 || pin >= MaxGPIOPin {
-		return nil
+	if pin < 0 || pin >= maxPin() {
+		return nil, ErrInvalidPin
 	}
 
 	// Pre-calculate commonly used register addresses and bit masks.
@@ -202,7 +294,7 @@ func NewPin(pin int) *Pin {
 		shadow = High
 	}
 
-	return &Pin{
+	p := &Pin{
 		pin:         pin,
 		fsel:        fsel,
 		bank:        bank,
@@ -211,8 +303,46 @@ func NewPin(pin int) *Pin {
 		clearReg:    clearReg,
 		pullReg2711: pullReg,
 		setReg:      setReg,
+		levelPtr:    &mem[levelReg],
+		setPtr:      &mem[setReg],
+		clearPtr:    &mem[clearReg],
 		shadow:      shadow,
 	}
+	return p.claim(options)
+}
+
+// newLinePin creates a pin for a line on a character device.
+func newLinePin(c *charDev, pin int, options []PinOption) (*Pin, error) {
+	if pin < 0 || pin >= c.lines {
+		return nil, ErrInvalidPin
+	}
+	l, err := c.requestLine(pin)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pin{
+		pin:    pin,
+		line:   l,
+		shadow: l.read(),
+		drive:  l.driveMode(),
+	}
+	return p.claim(options)
+}
+
+// claim registers the newly created pin and applies the options to the pin
+// returned by the registry.
+func (pin *Pin) claim(options []PinOption) (*Pin, error) {
+	p, err := pinRegistry.claim(pin)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.apply(options); err != nil {
+		if p == pin {
+			pinRegistry.remove(pin)
+		}
+		return nil, err
+	}
+	return p, nil
 }
 
 // Input sets pin as Input.
@@ -220,8 +350,10 @@ func (pin *Pin) Input() {
 	pin.SetMode(Input)
 }
 
-// Output sets pin as Output.
-func (pin *Pin) Output() {
+// Output sets the pin to the initial level, then sets it as Output, so the
+// pin never drives a stale level.
+func (pin *Pin) Output(initial Level) {
+	pin.Write(initial)
 	pin.SetMode(Output)
 }
 
@@ -237,6 +369,12 @@ func (pin *Pin) Low() {
 
 // Mode returns the mode of the pin in the Function Select register.
 func (pin *Pin) Mode() Mode {
+	if pin.line != nil {
+		return pin.line.mode()
+	}
+	if pin.emulated {
+		return Output
+	}
 	// read Mode and current value
 	modeShift := uint(pin.pin%10) * 3
 	return Mode(mem[pin.fsel] >> modeShift & modeMask)
@@ -252,6 +390,20 @@ func (pin *Pin) Pin() int {
 	return pin.pin
 }
 
+// pinID uniquely identifies a pin, as pins on different character devices may
+// share the same pin number.
+type pinID struct {
+	chip *charDev
+	pin  int
+}
+
+func (pin *Pin) id() pinID {
+	if pin.line != nil {
+		return pinID{pin.line.chip, pin.pin}
+	}
+	return pinID{pin: pin.pin}
+}
+
 // Toggle pin state
 func (pin *Pin) Toggle() {
 	if pin.shadow {
@@ -262,7 +414,84 @@ func (pin *Pin) Toggle() {
 }
 
 // SetMode sets the pin Mode.
+//
+// When using the character device only Input and Output are supported,
+// and other modes are ignored.
+//
+// If the package was opened with WithStrictOutput, then setting a pin to
+// Output before its level has been set is refused, and logged, as per
+// TrySetMode.
 func (pin *Pin) SetMode(mode Mode) {
+	if err := pin.TrySetMode(mode); err != nil {
+		logError("mode not set", "pin", pin.pin, "mode", mode, "err", err)
+	}
+}
+
+// TrySetMode sets the pin Mode, as per SetMode, and returns an error if the
+// mode cannot be set.
+//
+// If the package was opened with WithStrictOutput, then setting a pin to
+// Output before its level has been set, by Write, High, Low,
+// WithInitialLevel, or a PinGroup, returns ErrNoInitialLevel.  Pins that are
+// already Outputs are unaffected.
+func (pin *Pin) TrySetMode(mode Mode) error {
+	if err := pin.checkOutput(mode); err != nil {
+		return err
+	}
+	pin.changeMode(mode)
+	return nil
+}
+
+// strictOutput, if non-zero, refuses to set pins to Output before their level
+// has been set.
+var strictOutput int32
+
+// checkOutput returns an error if the pin cannot be set to the mode under
+// the strict output policy.
+func (pin *Pin) checkOutput(mode Mode) error {
+	if mode != Output || pin.written || atomic.LoadInt32(&strictOutput) == 0 {
+		return nil
+	}
+	if pin.Mode() == Output {
+		return nil
+	}
+	return ErrNoInitialLevel
+}
+
+// changeMode sets the pin Mode, without checking the strict output policy.
+func (pin *Pin) changeMode(mode Mode) {
+	pinRegistry.setMode(pin, mode)
+	if pin.line != nil {
+		pin.line.setMode(mode, pin.shadow)
+		return
+	}
+	if mode == Output && pin.drive != DrivePushPull {
+		pin.emulated = true
+		pin.writeEmulated(pin.shadow)
+		return
+	}
+	pin.endEmulation()
+	pin.setMode(mode)
+}
+
+// endEmulation ends any emulated open drain or open source drive.
+//
+// The latch only holds the active level of the emulated drive, so it is
+// synced to the shadow, before the pin can be switched to driving both levels.
+func (pin *Pin) endEmulation() {
+	if !pin.emulated {
+		return
+	}
+	if pin.shadow == Low {
+		mem[pin.clearReg] = pin.mask
+	} else {
+		mem[pin.setReg] = pin.mask
+	}
+	pin.emulated = false
+}
+
+// setMode sets the mode in the function select register.
+func (pin *Pin) setMode(mode Mode) {
 	// shift for pin mode field within fsel register.
 	modeShift := uint(pin.pin%10) * 3
 
@@ -272,10 +501,65 @@ func (pin *Pin) SetMode(mode Mode) {
 	mem[pin.fsel] = mem[pin.fsel]&^(modeMask<<modeShift) | uint32(mode)<<modeShift
 }
 
+// SetDrive sets the drive mode used when the pin is an output.
+//
+// For open drain and open source the pin is only driven at the active level,
+// low and high respectively, and is switched to an input (Hi-Z) to release it
+// to the inactive level.  When using the character device the native open
+// drain and open source flags are used instead.
+//
+// The drive mode is applied immediately if the pin is already an output.
+func (pin *Pin) SetDrive(drive Drive) {
+	if pin.line != nil {
+		pin.line.setDrive(drive, pin.shadow)
+		pin.drive = drive
+		return
+	}
+	output := pin.emulated || pin.Mode() == Output
+	pin.drive = drive
+	if output {
+		pin.SetMode(Output)
+	}
+}
+
+// Drive returns the drive mode of the pin.
+func (pin *Pin) Drive() Drive {
+	return pin.drive
+}
+
+// writeEmulated sets the level of an emulated open drain or open source pin.
+func (pin *Pin) writeEmulated(level Level) {
+	active := Low
+	if pin.drive == DriveOpenSource {
+		active = High
+	}
+	if level == active {
+		if level == Low {
+			mem[pin.clearReg] = pin.mask
+		} else {
+			mem[pin.setReg] = pin.mask
+		}
+		pin.setMode(Output)
+	} else {
+		pin.setMode(Input)
+	}
+	pin.shadow = level
+}
+
+// level returns the level of the pin without updating the shadow.
+func (pin *Pin) level() Level {
+	if pin.line != nil {
+		return pin.line.read()
+	}
+	return *pin.levelPtr&pin.mask != 0
+}
+
 // Read pin state (high/low)
 func (pin *Pin) Read() (level Level) {
-	if (mem[pin.levelReg] & pin.mask) != 0 {
-		level = High
+	if pin.line != nil {
+		level = pin.line.read()
+	} else {
+		level = *pin.levelPtr&pin.mask != 0
 	}
 	pin.shadow = level
 	return
@@ -283,18 +567,33 @@ func (pin *Pin) Read() (level Level) {
 
 // Set pin state (high/low)
 func (pin *Pin) Write(level Level) {
-	if level == Low {
-		mem[pin.clearReg] = pin.mask
+	if pin.line != nil {
+		pin.line.write(level)
+	} else if pin.emulated {
+		pin.writeEmulated(level)
+		pin.written = true
+		return
+	} else if level == Low {
+		*pin.clearPtr = pin.mask
 	} else {
-		mem[pin.setReg] = pin.mask
+		*pin.setPtr = pin.mask
 	}
 	pin.shadow = level
+	pin.written = true
 }
 
 // SetPull sets the pull up/down mode for a Pin.
 // Unlike the mode, the pull value cannot be read back from hardware and
 // so must be remembered by the caller.
+//
+// When using the character device the pull is applied as a bias flag on the
+// line request, and so is owned by the request rather than set directly in
+// hardware.  This requires Linux v5.5 or later.
 func (pin *Pin) SetPull(pull Pull) {
+	if pin.line != nil {
+		pin.line.setPull(pull, pin.shadow)
+		return
+	}
 	switch chipset {
 	case BCM2711:
 		pin.setPull2711(pull)
@@ -348,3 +647,15 @@ func (pin *Pin) PullDown() {
 func (pin *Pin) PullNone() {
 	pin.SetPull(PullNone)
 }
+
+var (
+	// ErrInvalidPin indicates the pin number is not a valid GPIO pin.
+	ErrInvalidPin = errors.New("invalid pin")
+
+	// ErrUnsupported indicates GPIO access is not supported on the platform.
+	ErrUnsupported = errors.New("not supported on this platform")
+
+	// ErrNoInitialLevel indicates a pin cannot be set to Output as its level
+	// has not been set.
+	ErrNoInitialLevel = errors.New("output level not set")
+)
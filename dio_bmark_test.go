@@ -3,6 +3,8 @@
 // Use of this source code is governed by an MIT-style
 // license that can be found in the LICENSE file.
 
+// +build linux
+
 //
 //  Test suite for dio module.
 //
@@ -19,9 +21,10 @@ import (
 func BenchmarkSysfsRead(b *testing.B) {
 	assert.Nil(b, Open())
 	defer Close()
-	pin := NewPin(J8p7)
+	pin, err := NewPin(J8p7)
+	assert.Nil(b, err)
 	// setup sysfs
-	err := export(pin)
+	err = export(pin)
 	assert.Nil(b, err)
 	defer unexport(pin)
 	f, err := openValue(pin)
@@ -37,9 +40,10 @@ func BenchmarkSysfsRead(b *testing.B) {
 func BenchmarkSysfsWrite(b *testing.B) {
 	assert.Nil(b, Open())
 	defer Close()
-	pin := NewPin(J8p7)
+	pin, err := NewPin(J8p7)
+	assert.Nil(b, err)
 	// setup sysfs
-	err := export(pin)
+	err = export(pin)
 	assert.Nil(b, err)
 	defer unexport(pin)
 	f, err := openValue(pin)
@@ -54,9 +58,10 @@ func BenchmarkSysfsWrite(b *testing.B) {
 func BenchmarkSysfsToggle(b *testing.B) {
 	assert.Nil(b, Open())
 	defer Close()
-	pin := NewPin(J8p7)
+	pin, err := NewPin(J8p7)
+	assert.Nil(b, err)
 	// setup sysfs
-	err := export(pin)
+	err = export(pin)
 	assert.Nil(b, err)
 	defer unexport(pin)
 	f, err := openValue(pin)
@@ -43,14 +43,19 @@ func TestClosedPanic(t *testing.T) {
 func TestNew(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pin := gpio.NewPin(gpio.MaxGPIOPin)
+	pin, err := gpio.NewPin(gpio.MaxGPIOPin)
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+	assert.Nil(t, pin)
+	pin, err = gpio.NewPin(-1)
+	assert.Equal(t, gpio.ErrInvalidPin, err)
 	assert.Nil(t, pin)
 }
 
 func TestRead(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
 	// A basic read test - assuming the pin is input and pulled high
 	// which is the default state for this pin on a Pi.
 	assert.Equal(t, gpio.Input, pin.Mode())
@@ -61,7 +66,8 @@ func TestRead(t *testing.T) {
 func TestMode(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
 	assert.Equal(t, gpio.Input, pin.Mode())
 
 	pin.SetMode(gpio.Output)
@@ -70,7 +76,7 @@ func TestMode(t *testing.T) {
 	pin.SetMode(gpio.Input)
 	assert.Equal(t, gpio.Input, pin.Mode())
 
-	pin.Output()
+	pin.Output(gpio.Low)
 	assert.Equal(t, gpio.Output, pin.Mode())
 
 	pin.Input()
@@ -80,7 +86,8 @@ func TestMode(t *testing.T) {
 func TestPull(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
 	defer pin.PullUp()
 	// A basic read test - using the pull up/down to drive the pin.
 	assert.Equal(t, gpio.Input, pin.Mode())
@@ -98,19 +105,27 @@ func TestPull(t *testing.T) {
 	pin.PullNone()
 }
 
+func TestPinner(t *testing.T) {
+	var p gpio.Pinner = &gpio.Pin{}
+	assert.NotNil(t, p)
+}
+
 func TestPin(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
 	assert.Equal(t, gpio.J8p7, pin.Pin())
-	pin = gpio.NewPin(gpio.J8p16)
+	pin, err = gpio.NewPin(gpio.J8p16)
+	assert.Nil(t, err)
 	assert.Equal(t, gpio.J8p16, pin.Pin())
 }
 
 func TestWrite(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
 	mode := pin.Mode()
 	assert.Equal(t, gpio.Input, mode)
 	defer pin.SetMode(gpio.Input)
@@ -141,8 +156,10 @@ func TestWrite(t *testing.T) {
 func TestWriteLooped(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pinIn := gpio.NewPin(gpio.J8p15)
-	pinOut := gpio.NewPin(gpio.J8p16)
+	pinIn, err := gpio.NewPin(gpio.J8p15)
+	assert.Nil(t, err)
+	pinOut, err := gpio.NewPin(gpio.J8p16)
+	assert.Nil(t, err)
 	pinIn.SetMode(gpio.Input)
 	defer pinOut.SetMode(gpio.Input)
 	pinOut.Write(gpio.Low)
@@ -156,10 +173,71 @@ func TestWriteLooped(t *testing.T) {
 	assert.Equal(t, gpio.Low, pinIn.Read())
 }
 
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestDriveLooped(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinIn, err := gpio.NewPin(gpio.J8p15, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	defer pinIn.PullDown()
+	pinOut, err := gpio.NewPin(gpio.J8p16)
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	assert.Equal(t, gpio.DrivePushPull, pinOut.Drive())
+
+	// open drain - pulled high when released
+	pinIn.PullUp()
+	pinOut.SetDrive(gpio.DriveOpenDrain)
+	assert.Equal(t, gpio.DriveOpenDrain, pinOut.Drive())
+	pinOut.Write(gpio.High)
+	pinOut.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Output, pinOut.Mode())
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.High, pinIn.Read())
+	pinOut.Low()
+	assert.Equal(t, gpio.Low, pinIn.Read())
+	pinOut.High()
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.High, pinIn.Read())
+	assert.Equal(t, gpio.Output, pinOut.Mode())
+
+	// open source - pulled low when released
+	pinIn.PullDown()
+	pinOut.SetDrive(gpio.DriveOpenSource)
+	pinOut.Low()
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.Low, pinIn.Read())
+	pinOut.High()
+	assert.Equal(t, gpio.High, pinIn.Read())
+	pinOut.Toggle()
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.Low, pinIn.Read())
+
+	// push pull
+	pinOut.SetDrive(gpio.DrivePushPull)
+	pinIn.PullUp()
+	assert.Equal(t, gpio.Output, pinOut.Mode())
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.Low, pinIn.Read())
+	pinOut.High()
+	assert.Equal(t, gpio.High, pinIn.Read())
+
+	// open drain released high, then push pull, retains the level.
+	pinOut.Low()
+	pinOut.SetDrive(gpio.DriveOpenDrain)
+	pinOut.Write(gpio.High)
+	pinIn.PullDown()
+	pinOut.SetDrive(gpio.DrivePushPull)
+	assert.Equal(t, gpio.Output, pinOut.Mode())
+	time.Sleep(time.Microsecond)
+	assert.Equal(t, gpio.High, pinIn.Read())
+}
+
 func TestToggle(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
 	defer pin.SetMode(gpio.Input)
 	pin.Write(gpio.Low)
 	pin.SetMode(gpio.Output)
@@ -179,8 +257,10 @@ func TestToggle(t *testing.T) {
 func TestToggleLooped(t *testing.T) {
 	setupDIO(t)
 	defer teardownDIO()
-	pinIn := gpio.NewPin(gpio.J8p15)
-	pinOut := gpio.NewPin(gpio.J8p16)
+	pinIn, err := gpio.NewPin(gpio.J8p15)
+	assert.Nil(t, err)
+	pinOut, err := gpio.NewPin(gpio.J8p16)
+	assert.Nil(t, err)
 	pinIn.SetMode(gpio.Input)
 	defer pinOut.SetMode(gpio.Input)
 	pinOut.Write(gpio.Low)
@@ -198,7 +278,8 @@ func TestToggleLooped(t *testing.T) {
 func BenchmarkRead(b *testing.B) {
 	assert.Nil(b, gpio.Open())
 	defer gpio.Close()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(b, err)
 	for i := 0; i < b.N; i++ {
 		_ = pin.Read()
 	}
@@ -208,7 +289,8 @@ func BenchmarkWrite(b *testing.B) {
 	err := gpio.Open()
 	assert.Nil(b, err)
 	defer gpio.Close()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(b, err)
 	for i := 0; i < b.N; i++ {
 		pin.Write(gpio.High)
 	}
@@ -217,7 +299,8 @@ func BenchmarkWrite(b *testing.B) {
 func BenchmarkToggle(b *testing.B) {
 	assert.Nil(b, gpio.Open())
 	defer gpio.Close()
-	pin := gpio.NewPin(gpio.J8p7)
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(b, err)
 	defer pin.SetMode(gpio.Input)
 	pin.Write(gpio.Low)
 	pin.SetMode(gpio.Output)
@@ -24,9 +24,11 @@ func main() {
 		panic(err)
 	}
 	defer gpio.Close()
-	pin := gpio.NewPin(gpio.GPIO4)
+	pin, err := gpio.NewPin(gpio.GPIO4, gpio.WithMode(gpio.Output))
+	if err != nil {
+		panic(err)
+	}
 	defer pin.Input()
-	pin.Output()
 	// capture exit signals to ensure pin is reverted to input on exit.
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,44 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/i2c"
+	"github.com/warthog618/gpio/i2c/bme280"
+)
+
+// This example reads a BME280 at address 0x76 every second.  The BME280 is
+// connected to the RPI by SCL (J8 5) and SDA (J8 3).
+// Do not run this example on a board where those pins serve other purposes.
+func main() {
+	err := gpio.Open()
+	if err != nil {
+		panic(err)
+	}
+	defer gpio.Close()
+	bus, err := i2c.New(5*time.Microsecond, gpio.GPIO3, gpio.GPIO2)
+	if err != nil {
+		panic(err)
+	}
+	defer bus.Close()
+	dev, err := bme280.New(bus, bme280.Addr)
+	if err != nil {
+		panic(err)
+	}
+	for {
+		r, err := dev.Read()
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("%.2fC %.2fhPa %.1f%%\n", r.Temperature, r.Pressure/100, r.Humidity)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/i2c"
+	"github.com/warthog618/gpio/i2c/mcp23017"
+)
+
+// This example watches GPA0 of an MCP23017 at address 0x20, and mirrors its
+// level to GPB0.  The MCP23017 is connected to the RPI by SCL (J8 5), SDA
+// (J8 3) and INTA (J8 7).
+// Do not run this example on a board where those pins serve other purposes.
+func main() {
+	err := gpio.Open()
+	if err != nil {
+		panic(err)
+	}
+	defer gpio.Close()
+	bus, err := i2c.New(5*time.Microsecond, gpio.GPIO3, gpio.GPIO2)
+	if err != nil {
+		panic(err)
+	}
+	defer bus.Close()
+	dev, err := mcp23017.New(bus, 0x20)
+	if err != nil {
+		panic(err)
+	}
+	defer dev.Close()
+	intr, err := gpio.NewPin(gpio.GPIO4)
+	if err != nil {
+		panic(err)
+	}
+	if err = dev.WatchInterrupt(intr); err != nil {
+		panic(err)
+	}
+	out := dev.Pin(8)
+	out.Write(gpio.Low)
+	out.SetMode(gpio.Output)
+	defer out.SetMode(gpio.Input)
+	in := dev.Pin(0)
+	in.SetMode(gpio.Input)
+	in.SetPull(gpio.PullUp)
+	err = in.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		level := pin.Read()
+		fmt.Println("GPA0 is", level)
+		out.Write(level)
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer in.Unwatch()
+
+	// capture exit signals to ensure resources are released on exit.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	fmt.Println("Watching GPA0...")
+	select {
+	case <-time.After(time.Minute):
+	case <-quit:
+	}
+}
@@ -37,13 +37,16 @@ func main() {
 	if tset < tclk {
 		tset = tclk
 	}
-	a := adc0832.New(
+	a, err := adc0832.New(
 		tclk,
 		tset,
 		cfg.MustGet("clk").Int(),
 		cfg.MustGet("csz").Int(),
 		cfg.MustGet("di").Int(),
 		cfg.MustGet("do").Int())
+	if err != nil {
+		panic(err)
+	}
 	defer a.Close()
 	ch0 := a.Read(0)
 	ch1 := a.Read(1)
@@ -33,12 +33,15 @@ func main() {
 	}
 	defer gpio.Close()
 	tclk := cfg.MustGet("tclk").Duration()
-	adc := mcp3w0c.NewMCP3008(
+	adc, err := mcp3w0c.NewMCP3008(
 		tclk,
 		cfg.MustGet("clk").Int(),
 		cfg.MustGet("csz").Int(),
 		cfg.MustGet("di").Int(),
 		cfg.MustGet("do").Int())
+	if err != nil {
+		panic(err)
+	}
 	defer adc.Close()
 	for ch := 0; ch < 8; ch++ {
 		d := adc.Read(ch)
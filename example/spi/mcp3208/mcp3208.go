@@ -33,12 +33,15 @@ func main() {
 	}
 	defer gpio.Close()
 	tclk := cfg.MustGet("tclk").Duration()
-	adc := mcp3w0c.NewMCP3208(
+	adc, err := mcp3w0c.NewMCP3208(
 		tclk,
 		cfg.MustGet("sclk").Int(),
 		cfg.MustGet("ssz").Int(),
 		cfg.MustGet("mosi").Int(),
 		cfg.MustGet("miso").Int())
+	if err != nil {
+		panic(err)
+	}
 	defer adc.Close()
 	for ch := 0; ch < 8; ch++ {
 		d := adc.Read(ch)
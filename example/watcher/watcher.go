@@ -22,16 +22,17 @@ func main() {
 		panic(err)
 	}
 	defer gpio.Close()
-	pin := gpio.NewPin(gpio.J8p7)
-	pin.Input()
-	pin.PullUp()
+	pin, err := gpio.NewPin(gpio.J8p7, gpio.WithMode(gpio.Input), gpio.WithPull(gpio.PullUp))
+	if err != nil {
+		panic(err)
+	}
 
 	// capture exit signals to ensure resources are released on exit.
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	defer signal.Stop(quit)
 
-	err = pin.Watch(gpio.EdgeBoth, func(pin *gpio.Pin) {
+	err = pin.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
 		fmt.Printf("Pin 4 is %v", pin.Read())
 	})
 	if err != nil {
@@ -0,0 +1,27 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gpio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackClock(t *testing.T) {
+	periphUnavailable = true
+	defer func() {
+		periphUnavailable = false
+	}()
+	c, err := NewClock(GPIO4)
+	assert.Equal(t, ErrUnsupported, err)
+	assert.Nil(t, c)
+	// the pin is checked first.
+	_, err = NewClock(GPIO7)
+	assert.Equal(t, ErrInvalidPin, err)
+}
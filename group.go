@@ -0,0 +1,177 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+// PinGroup is a set of pins that are accessed together.
+//
+// Where possible, operations on the group are performed with a single register
+// access per bank and direction, so the pins in a bank being set High change
+// together, as do those being set Low.  Pins provided by the character device,
+// or emulating open drain or open source outputs, are accessed individually.
+type PinGroup struct {
+	pins []*Pin
+}
+
+// NewPinGroup creates a PinGroup containing the pins.
+//
+// The order of the pins determines the bit corresponding to each pin in
+// the group levels, with the first pin being bit 0.
+// At most 64 pins can be grouped.
+func NewPinGroup(pins ...*Pin) (*PinGroup, error) {
+	if len(pins) > 64 {
+		return nil, ErrInvalidPin
+	}
+	for _, p := range pins {
+		if p == nil {
+			return nil, ErrInvalidPin
+		}
+	}
+	return &PinGroup{pins: append([]*Pin(nil), pins...)}, nil
+}
+
+// Pins returns the pins in the group.
+func (g *PinGroup) Pins() []*Pin {
+	return g.pins
+}
+
+// Read returns the levels of the pins in the group.
+//
+// Bit n of the result is the level of the nth pin in the group.
+// The level registers are each read once, so the levels of pins in a bank
+// are a coherent snapshot.
+func (g *PinGroup) Read() uint64 {
+	var bank [2]uint32
+	var read [2]bool
+	var levels uint64
+	for i, p := range g.pins {
+		var level Level
+		if p.line != nil {
+			level = p.line.read()
+		} else {
+			b := p.bank & 1
+			if !read[b] {
+				bank[b] = mem[13+b]
+				read[b] = true
+			}
+			level = bank[b]&p.mask != 0
+		}
+		p.shadow = level
+		if level {
+			levels |= 1 << uint(i)
+		}
+	}
+	return levels
+}
+
+// ReadAll returns the levels of all the GPIOs, with bit n of the result
+// being the level of GPIO n.
+//
+// The levels are read from the two level registers in immediate succession,
+// so the levels of the header GPIOs, which are all in the first bank, are a
+// coherent snapshot.
+//
+// When using the character device, only the lines requested as pins can be
+// read, and these are read individually.
+func ReadAll() uint64 {
+	if cdev != nil {
+		return cdev.readRequested()
+	}
+	if len(mem) == 0 {
+		panic("GPIO not initialised.")
+	}
+	l0 := mem[13]
+	l1 := mem[14]
+	return uint64(l1)<<32 | uint64(l0)
+}
+
+// Write sets the levels of the pins in the group.
+//
+// Bit n of levels is the level of the nth pin in the group.
+//
+// The set and clear registers are separate, so for each bank the pins being
+// set High are written first, with a single write to GPSET, followed by the
+// pins being set Low, with a single write to GPCLR.  The two writes are
+// consecutive, but are not simultaneous, so the rising pins briefly lead the
+// falling pins.
+func (g *PinGroup) Write(levels uint64) {
+	var set, clear [2]uint32
+	for i, p := range g.pins {
+		level := Level(levels&(1<<uint(i)) != 0)
+		if p.line != nil || p.emulated {
+			p.Write(level)
+			continue
+		}
+		if level {
+			set[p.bank&1] |= p.mask
+		} else {
+			clear[p.bank&1] |= p.mask
+		}
+		p.shadow = level
+		p.written = true
+	}
+	for bank := 0; bank < 2; bank++ {
+		if set[bank] != 0 {
+			mem[7+bank] = set[bank]
+		}
+		if clear[bank] != 0 {
+			mem[10+bank] = clear[bank]
+		}
+	}
+}
+
+// SetMode sets the mode of all the pins in the group.
+//
+// The function select registers are each updated with a single
+// read-modify-write, so pins sharing a register change mode together.
+func (g *PinGroup) SetMode(mode Mode) {
+	modes := make(map[*Pin]Mode, len(g.pins))
+	for _, p := range g.pins {
+		modes[p] = mode
+	}
+	SetModes(modes)
+}
+
+// SetModes sets the modes of multiple pins.
+//
+// The function select registers are each updated with a single
+// read-modify-write, so pins sharing a register change mode together, and
+// the minimum number of register accesses is performed.
+// Pins provided by the character device, or emulating open drain or open
+// source outputs, are set individually.
+//
+// If the package was opened with WithStrictOutput, then pins that cannot be
+// set to Output as their level has not been set are left unchanged, and
+// logged, as per SetMode.
+func SetModes(modes map[*Pin]Mode) {
+	var masks, values [6]uint32
+	var touched bool
+	for p, mode := range modes {
+		if p.line != nil || (mode == Output && p.drive != DrivePushPull) {
+			p.SetMode(mode)
+			continue
+		}
+		if err := p.checkOutput(mode); err != nil {
+			logError("mode not set", "pin", p.pin, "mode", mode, "err", err)
+			continue
+		}
+		pinRegistry.setMode(p, mode)
+		p.endEmulation()
+		modeShift := uint(p.pin%10) * 3
+		masks[p.fsel] |= modeMask << modeShift
+		values[p.fsel] |= uint32(mode) << modeShift
+		touched = true
+	}
+	if !touched {
+		return
+	}
+	memlock.Lock()
+	defer memlock.Unlock()
+	for fsel, mask := range masks {
+		if mask != 0 {
+			mem[fsel] = mem[fsel]&^mask | values[fsel]
+		}
+	}
+}
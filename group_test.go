@@ -0,0 +1,109 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//
+//  Test suite for group module.
+//
+//	Tests use J8 pins 7 and 15 and 16 (for looped tests)
+//
+package gpio_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+func TestNewPinGroupInvalid(t *testing.T) {
+	g, err := gpio.NewPinGroup(make([]*gpio.Pin, 65)...)
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+	assert.Nil(t, g)
+	g, err = gpio.NewPinGroup(nil)
+	assert.Equal(t, gpio.ErrInvalidPin, err)
+	assert.Nil(t, g)
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestPinGroupWriteLooped(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinIn, err := gpio.NewPin(gpio.J8p15, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	g, err := gpio.NewPinGroup(pinOut)
+	assert.Nil(t, err)
+	assert.Equal(t, []*gpio.Pin{pinOut}, g.Pins())
+	g.Write(1)
+	assert.Equal(t, gpio.High, pinIn.Read())
+	assert.Equal(t, gpio.High, pinOut.Shadow())
+	g.Write(0)
+	assert.Equal(t, gpio.Low, pinIn.Read())
+	assert.Equal(t, gpio.Low, pinOut.Shadow())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestPinGroupReadLooped(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinIn, err := gpio.NewPin(gpio.J8p15, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	// J8p7 is pulled up.
+	pinUp, err := gpio.NewPin(gpio.J8p7, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	g, err := gpio.NewPinGroup(pinIn, pinUp)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x02), g.Read())
+	assert.Equal(t, uint64(1)<<gpio.J8p7, gpio.ReadAll()&(1<<gpio.J8p7|1<<gpio.J8p15))
+	pinOut.High()
+	assert.Equal(t, uint64(0x03), g.Read())
+	assert.Equal(t, gpio.High, pinIn.Shadow())
+	levels := gpio.ReadAll()
+	assert.NotZero(t, levels&(1<<gpio.J8p15))
+	assert.NotZero(t, levels&(1<<gpio.J8p16))
+}
+
+func TestSetModes(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinA, err := gpio.NewPin(gpio.J8p15)
+	assert.Nil(t, err)
+	pinB, err := gpio.NewPin(gpio.J8p16)
+	assert.Nil(t, err)
+	defer gpio.SetModes(map[*gpio.Pin]gpio.Mode{pinA: gpio.Input, pinB: gpio.Input})
+	gpio.SetModes(map[*gpio.Pin]gpio.Mode{pinA: gpio.Output, pinB: gpio.Alt0})
+	assert.Equal(t, gpio.Output, pinA.Mode())
+	assert.Equal(t, gpio.Alt0, pinB.Mode())
+	g, err := gpio.NewPinGroup(pinA, pinB)
+	assert.Nil(t, err)
+	g.SetMode(gpio.Input)
+	assert.Equal(t, gpio.Input, pinA.Mode())
+	assert.Equal(t, gpio.Input, pinB.Mode())
+}
+
+func BenchmarkGroupWrite(b *testing.B) {
+	assert.Nil(b, gpio.Open())
+	defer gpio.Close()
+	var pins []*gpio.Pin
+	for _, p := range []int{gpio.J8p7, gpio.J8p15, gpio.J8p16} {
+		pin, err := gpio.NewPin(p)
+		assert.Nil(b, err)
+		pins = append(pins, pin)
+	}
+	g, err := gpio.NewPinGroup(pins...)
+	assert.Nil(b, err)
+	for i := 0; i < b.N; i++ {
+		g.Write(uint64(i))
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package bme280 provides a device driver for the Bosch BME280 and BMP280
+// environmental sensors.
+package bme280
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio/i2c"
+)
+
+// Registers
+const (
+	regCalib00   = 0x88
+	regCalibH1   = 0xa1
+	regID        = 0xd0
+	regReset     = 0xe0
+	regCalib26   = 0xe1
+	regCtrlHum   = 0xf2
+	regStatus    = 0xf3
+	regCtrlMeas  = 0xf4
+	regConfig    = 0xf5
+	regPressMSB  = 0xf7
+	statusMeas   = 0x08
+	modeForced   = 0x01
+	resetCommand = 0xb6
+)
+
+// Chip IDs
+const (
+	idBMP280 = 0x58
+	idBME280 = 0x60
+)
+
+// Addresses of the device, depending on the level of the SDO pin.
+const (
+	// Addr is the address with SDO tied low.
+	Addr = 0x76
+
+	// AltAddr is the address with SDO tied high.
+	AltAddr = 0x77
+)
+
+// Oversampling defines the oversampling applied to a measurement.
+type Oversampling uint8
+
+const (
+	// Skip disables the measurement.
+	Skip Oversampling = iota
+	// X1 takes a single sample.
+	X1
+	// X2 averages 2 samples.
+	X2
+	// X4 averages 4 samples.
+	X4
+	// X8 averages 8 samples.
+	X8
+	// X16 averages 16 samples.
+	X16
+)
+
+// Reading is a compensated measurement from the sensor.
+type Reading struct {
+	// Temperature is the temperature in degrees Celsius.
+	Temperature float64
+
+	// Pressure is the pressure in Pascals.
+	Pressure float64
+
+	// Humidity is the relative humidity in percent.
+	//
+	// This is always 0 for the BMP280.
+	Humidity float64
+}
+
+// calibration holds the compensation parameters read from the device.
+type calibration struct {
+	t1 uint16
+	t2 int16
+	t3 int16
+	p1 uint16
+	p2 int16
+	p3 int16
+	p4 int16
+	p5 int16
+	p6 int16
+	p7 int16
+	p8 int16
+	p9 int16
+	h1 uint8
+	h2 int16
+	h3 uint8
+	h4 int16
+	h5 int16
+	h6 int8
+}
+
+// BME280 is a BME280, or BMP280, connected to a bit bashed I2C bus.
+//
+// Measurements are made in forced mode, so the device sleeps between
+// readings.
+type BME280 struct {
+	// Guards the sequencing of device accesses.
+	mu       sync.Mutex
+	bus      *i2c.I2C
+	addr     uint8
+	humidity bool
+	cal      calibration
+	osrsT    Oversampling
+	osrsP    Oversampling
+	osrsH    Oversampling
+}
+
+// Option defines an option that can be applied when creating a BME280.
+type Option func(*BME280)
+
+// WithOversampling sets the oversampling of the temperature, pressure and
+// humidity measurements.
+//
+// The default is X1 for all three.  Humidity is ignored by the BMP280.
+func WithOversampling(t, p, h Oversampling) Option {
+	return func(d *BME280) {
+		d.osrsT = t
+		d.osrsP = p
+		d.osrsH = h
+	}
+}
+
+// New creates a BME280 at the 7-bit addr, Addr or AltAddr, on the bus.
+//
+// The device is reset, and its calibration parameters read.
+func New(bus *i2c.I2C, addr uint8, options ...Option) (*BME280, error) {
+	d := &BME280{bus: bus, addr: addr, osrsT: X1, osrsP: X1, osrsH: X1}
+	for _, option := range options {
+		option(d)
+	}
+	var id [1]byte
+	if err := bus.ReadRegister(addr, regID, id[:]); err != nil {
+		return nil, err
+	}
+	switch id[0] {
+	case idBME280:
+		d.humidity = true
+	case idBMP280:
+	default:
+		return nil, ErrUnknownDevice
+	}
+	if err := bus.WriteRegister(addr, regReset, []byte{resetCommand}); err != nil {
+		return nil, err
+	}
+	// allow the device to load its calibration.
+	time.Sleep(2 * time.Millisecond)
+	if err := d.readCalibration(); err != nil {
+		return nil, err
+	}
+	if err := bus.WriteRegister(addr, regConfig, []byte{0}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// HasHumidity returns true if the device measures humidity, i.e. it is a
+// BME280 rather than a BMP280.
+func (d *BME280) HasHumidity() bool {
+	return d.humidity
+}
+
+// Read triggers a measurement and returns the compensated result.
+func (d *BME280) Read() (Reading, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.humidity {
+		if err := d.bus.WriteRegister(d.addr, regCtrlHum, []byte{byte(d.osrsH)}); err != nil {
+			return Reading{}, err
+		}
+	}
+	meas := byte(d.osrsT)<<5 | byte(d.osrsP)<<2 | modeForced
+	if err := d.bus.WriteRegister(d.addr, regCtrlMeas, []byte{meas}); err != nil {
+		return Reading{}, err
+	}
+	if err := d.waitMeasurement(); err != nil {
+		return Reading{}, err
+	}
+	n := 6
+	if d.humidity {
+		n = 8
+	}
+	var b [8]byte
+	if err := d.bus.ReadRegister(d.addr, regPressMSB, b[:n]); err != nil {
+		return Reading{}, err
+	}
+	adcP := int32(b[0])<<12 | int32(b[1])<<4 | int32(b[2])>>4
+	adcT := int32(b[3])<<12 | int32(b[4])<<4 | int32(b[5])>>4
+	adcH := int32(b[6])<<8 | int32(b[7])
+	t, tFine := d.cal.temperature(adcT)
+	r := Reading{
+		Temperature: float64(t) / 100,
+		Pressure:    float64(d.cal.pressure(adcP, tFine)) / 256,
+	}
+	if d.humidity {
+		r.Humidity = float64(d.cal.humidity(adcH, tFine)) / 1024
+	}
+	return r, nil
+}
+
+// waitMeasurement waits for the device to complete a forced measurement.
+// Assumes caller already holds the mu lock.
+func (d *BME280) waitMeasurement() error {
+	// the maximum measurement time, with X16 oversampling, is ~113ms.
+	for i := 0; i < 150; i++ {
+		time.Sleep(time.Millisecond)
+		var status [1]byte
+		if err := d.bus.ReadRegister(d.addr, regStatus, status[:]); err != nil {
+			return err
+		}
+		if status[0]&statusMeas == 0 {
+			return nil
+		}
+	}
+	return ErrTimeout
+}
+
+func (d *BME280) readCalibration() error {
+	var b [26]byte
+	if err := d.bus.ReadRegister(d.addr, regCalib00, b[:24]); err != nil {
+		return err
+	}
+	u16 := func(i int) uint16 {
+		return uint16(b[i]) | uint16(b[i+1])<<8
+	}
+	c := &d.cal
+	c.t1 = u16(0)
+	c.t2 = int16(u16(2))
+	c.t3 = int16(u16(4))
+	c.p1 = u16(6)
+	c.p2 = int16(u16(8))
+	c.p3 = int16(u16(10))
+	c.p4 = int16(u16(12))
+	c.p5 = int16(u16(14))
+	c.p6 = int16(u16(16))
+	c.p7 = int16(u16(18))
+	c.p8 = int16(u16(20))
+	c.p9 = int16(u16(22))
+	if !d.humidity {
+		return nil
+	}
+	if err := d.bus.ReadRegister(d.addr, regCalibH1, b[:1]); err != nil {
+		return err
+	}
+	c.h1 = b[0]
+	if err := d.bus.ReadRegister(d.addr, regCalib26, b[:7]); err != nil {
+		return err
+	}
+	c.h2 = int16(u16(0))
+	c.h3 = b[2]
+	// h4 and h5 are 12-bit signed values sharing a nibble.
+	c.h4 = int16(int8(b[3]))<<4 | int16(b[4]&0x0f)
+	c.h5 = int16(int8(b[5]))<<4 | int16(b[4]>>4)
+	c.h6 = int8(b[6])
+	return nil
+}
+
+// The compensation functions follow the integer implementations in the
+// Bosch datasheet.
+
+// temperature returns the temperature, in hundredths of a degree Celsius,
+// and the fine temperature used to compensate the other measurements.
+func (c *calibration) temperature(adcT int32) (int32, int32) {
+	var1 := (((adcT >> 3) - (int32(c.t1) << 1)) * int32(c.t2)) >> 11
+	var2 := (((((adcT >> 4) - int32(c.t1)) * ((adcT >> 4) - int32(c.t1))) >> 12) *
+		int32(c.t3)) >> 14
+	tFine := var1 + var2
+	return (tFine*5 + 128) >> 8, tFine
+}
+
+// pressure returns the pressure, in Pascals, as a Q24.8 fixed point value.
+func (c *calibration) pressure(adcP, tFine int32) uint32 {
+	var1 := int64(tFine) - 128000
+	var2 := var1 * var1 * int64(c.p6)
+	var2 = var2 + ((var1 * int64(c.p5)) << 17)
+	var2 = var2 + (int64(c.p4) << 35)
+	var1 = ((var1 * var1 * int64(c.p3)) >> 8) + ((var1 * int64(c.p2)) << 12)
+	var1 = (((int64(1) << 47) + var1) * int64(c.p1)) >> 33
+	if var1 == 0 {
+		// avoid division by zero
+		return 0
+	}
+	p := 1048576 - int64(adcP)
+	p = (((p << 31) - var2) * 3125) / var1
+	var1 = (int64(c.p9) * (p >> 13) * (p >> 13)) >> 25
+	var2 = (int64(c.p8) * p) >> 19
+	p = ((p + var1 + var2) >> 8) + (int64(c.p7) << 4)
+	return uint32(p)
+}
+
+// humidity returns the relative humidity, in percent, as a Q22.10 fixed
+// point value.
+func (c *calibration) humidity(adcH, tFine int32) uint32 {
+	v := tFine - 76800
+	v = ((((adcH << 14) - (int32(c.h4) << 20) - (int32(c.h5) * v)) + 16384) >> 15) *
+		(((((((v*int32(c.h6))>>10)*(((v*int32(c.h3))>>11)+32768))>>10)+2097152)*
+			int32(c.h2) + 8192) >> 14)
+	v = v - (((((v >> 15) * (v >> 15)) >> 7) * int32(c.h1)) >> 4)
+	if v < 0 {
+		v = 0
+	}
+	if v > 419430400 {
+		v = 419430400
+	}
+	return uint32(v >> 12)
+}
+
+var (
+	// ErrUnknownDevice indicates the device at the address is not a BME280
+	// or BMP280.
+	ErrUnknownDevice = errors.New("unknown device")
+
+	// ErrTimeout indicates the device did not complete a measurement.
+	ErrTimeout = errors.New("timeout")
+)
@@ -0,0 +1,58 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package bme280
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// calibration and readings from the worked example in the BMP280 datasheet.
+var example = calibration{
+	t1: 27504, t2: 26435, t3: -1000,
+	p1: 36477, p2: -10685, p3: 3024, p4: 2855, p5: 140, p6: -7, p7: 15500,
+	p8: -14600, p9: 6000,
+	h1: 75, h2: 362, h3: 0, h4: 313, h5: 50, h6: 30,
+}
+
+func TestTemperature(t *testing.T) {
+	temp, tFine := example.temperature(519888)
+	assert.Equal(t, int32(2508), temp)
+	assert.Equal(t, int32(128422), tFine)
+}
+
+func TestPressure(t *testing.T) {
+	_, tFine := example.temperature(519888)
+	p := float64(example.pressure(415148, tFine)) / 256
+	assert.InDelta(t, 100653.27, p, 0.1)
+	var c calibration
+	assert.Equal(t, uint32(0), c.pressure(415148, tFine))
+}
+
+// humidityFloat is the floating point compensation from the BME280 datasheet.
+func humidityFloat(c calibration, adcH, tFine int32) float64 {
+	v := float64(tFine) - 76800
+	v = (float64(adcH) - (float64(c.h4)*64 + float64(c.h5)/16384*v)) *
+		(float64(c.h2) / 65536 * (1 + float64(c.h6)/67108864*v*
+			(1+float64(c.h3)/67108864*v)))
+	v = v * (1 - float64(c.h1)*v/524288)
+	if v > 100 {
+		return 100
+	}
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+func TestHumidity(t *testing.T) {
+	_, tFine := example.temperature(519888)
+	for _, adcH := range []int32{0, 20000, 26000, 30000, 36000, 65535} {
+		h := float64(example.humidity(adcH, tFine)) / 1024
+		assert.InDelta(t, humidityFloat(example, adcH, tFine), h, 0.1, adcH)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package i2c provides a bit bashed I2C master using GPIO pins.
+package i2c
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// I2C represents an I2C bus connected to the Raspberry Pi via two GPIO lines.
+//
+// Both lines are driven open drain, by switching between driving the line low
+// as an Output and releasing it as an Input, so the bus requires pull-ups.
+// The internal pull-ups are enabled, but these are weak, so external pull-ups
+// are recommended for anything other than short buses at low speeds.
+//
+// This is the basis for bit bashed I2C interfaces using GPIO pins. It is not
+// related to the I2C device drivers provided by Linux.
+type I2C struct {
+	Mu sync.Mutex
+	// time between clock edges (i.e. half the cycle time)
+	Tclk time.Duration
+	Scl  gpio.Pinner
+	Sda  gpio.Pinner
+}
+
+// New creates an I2C.
+func New(tclk time.Duration, scl, sda int) (*I2C, error) {
+	// release the bus until needed...
+	sclPin, err := gpio.NewPin(scl,
+		gpio.WithPull(gpio.PullUp),
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Input))
+	if err != nil {
+		return nil, err
+	}
+	sdaPin, err := gpio.NewPin(sda,
+		gpio.WithPull(gpio.PullUp),
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Input))
+	if err != nil {
+		return nil, err
+	}
+	return &I2C{Tclk: tclk, Scl: sclPin, Sda: sdaPin}, nil
+}
+
+// NewFromPins creates an I2C using the provided pins, such as pins on an
+// expander or mock pins.
+//
+// The output latches of the pins are set Low, and the pins are released as
+// Inputs until needed.  Any pull-ups must be provided by the caller.
+func NewFromPins(tclk time.Duration, scl, sda gpio.Pinner) *I2C {
+	for _, p := range []gpio.Pinner{scl, sda} {
+		p.Write(gpio.Low)
+		p.SetMode(gpio.Input)
+	}
+	return &I2C{Tclk: tclk, Scl: scl, Sda: sda}
+}
+
+// Close releases the pins used to drive the I2C bus.
+func (i2c *I2C) Close() {
+	i2c.Mu.Lock()
+	release(i2c.Scl)
+	release(i2c.Sda)
+	i2c.Mu.Unlock()
+}
+
+// Start issues a start, or repeated start, condition on the bus.
+// Assumes caller already holds the Mu lock.
+func (i2c *I2C) Start() {
+	release(i2c.Sda)
+	i2c.sclHigh()
+	time.Sleep(i2c.Tclk)
+	drive(i2c.Sda)
+	time.Sleep(i2c.Tclk)
+	drive(i2c.Scl)
+}
+
+// Stop issues a stop condition on the bus.
+// Assumes caller already holds the Mu lock.
+func (i2c *I2C) Stop() {
+	drive(i2c.Sda)
+	time.Sleep(i2c.Tclk)
+	i2c.sclHigh()
+	time.Sleep(i2c.Tclk)
+	release(i2c.Sda)
+	time.Sleep(i2c.Tclk)
+}
+
+// ClockOutByte clocks out a byte, MSB first, and returns true if the byte
+// was acknowledged by the device.
+// Assumes clock starts low and ends low.
+// Assumes caller already holds the Mu lock.
+func (i2c *I2C) ClockOutByte(b byte) bool {
+	for i := 7; i >= 0; i-- {
+		i2c.clockOut(b>>uint(i)&0x01 == 0x01)
+	}
+	return i2c.clockIn() == gpio.Low
+}
+
+// ClockInByte clocks in a byte, MSB first, and then acknowledges it if ack is
+// true.
+// Assumes clock starts low and ends low.
+// Assumes caller already holds the Mu lock.
+func (i2c *I2C) ClockInByte(ack bool) byte {
+	var b byte
+	for i := 0; i < 8; i++ {
+		b = b << 1
+		if i2c.clockIn() {
+			b = b | 0x01
+		}
+	}
+	i2c.clockOut(gpio.Level(!ack))
+	return b
+}
+
+// Write writes the data to the device at the 7-bit address.
+func (i2c *I2C) Write(addr uint8, data []byte) error {
+	i2c.Mu.Lock()
+	defer i2c.Mu.Unlock()
+	i2c.Start()
+	err := i2c.write(addr<<1, data)
+	i2c.Stop()
+	return err
+}
+
+// Read reads data from the device at the 7-bit address.
+func (i2c *I2C) Read(addr uint8, data []byte) error {
+	i2c.Mu.Lock()
+	defer i2c.Mu.Unlock()
+	i2c.Start()
+	err := i2c.read(addr, data)
+	i2c.Stop()
+	return err
+}
+
+// WriteRegister writes the data to sequential registers, starting from reg, on
+// the device at the 7-bit address.
+func (i2c *I2C) WriteRegister(addr, reg uint8, data []byte) error {
+	i2c.Mu.Lock()
+	defer i2c.Mu.Unlock()
+	i2c.Start()
+	err := i2c.write(addr<<1, append([]byte{reg}, data...))
+	i2c.Stop()
+	return err
+}
+
+// ReadRegister reads data from sequential registers, starting from reg, on the
+// device at the 7-bit address.
+func (i2c *I2C) ReadRegister(addr, reg uint8, data []byte) error {
+	i2c.Mu.Lock()
+	defer i2c.Mu.Unlock()
+	i2c.Start()
+	err := i2c.write(addr<<1, []byte{reg})
+	if err == nil {
+		i2c.Start()
+		err = i2c.read(addr, data)
+	}
+	i2c.Stop()
+	return err
+}
+
+func (i2c *I2C) write(addrByte byte, data []byte) error {
+	if !i2c.ClockOutByte(addrByte) {
+		return ErrNack
+	}
+	for _, b := range data {
+		if !i2c.ClockOutByte(b) {
+			return ErrNack
+		}
+	}
+	return nil
+}
+
+func (i2c *I2C) read(addr uint8, data []byte) error {
+	if !i2c.ClockOutByte(addr<<1 | 0x01) {
+		return ErrNack
+	}
+	for i := range data {
+		data[i] = i2c.ClockInByte(i < len(data)-1)
+	}
+	return nil
+}
+
+// clockIn clocks in a bit from the device on Sda.
+// Assumes clock starts low and ends low.
+func (i2c *I2C) clockIn() gpio.Level {
+	release(i2c.Sda) // to allow device to drive
+	time.Sleep(i2c.Tclk)
+	i2c.sclHigh()
+	time.Sleep(i2c.Tclk)
+	b := i2c.Sda.Read()
+	drive(i2c.Scl)
+	return b
+}
+
+// clockOut clocks out a bit to the device on Sda.
+// Assumes clock starts low and ends low.
+func (i2c *I2C) clockOut(l gpio.Level) {
+	if l {
+		release(i2c.Sda)
+	} else {
+		drive(i2c.Sda)
+	}
+	time.Sleep(i2c.Tclk)
+	i2c.sclHigh() // device reads while the clock is high
+	time.Sleep(i2c.Tclk)
+	drive(i2c.Scl)
+}
+
+// sclHigh releases the clock and waits for any clock stretching by the device.
+func (i2c *I2C) sclHigh() {
+	release(i2c.Scl)
+	for i := 0; i < maxStretch && i2c.Scl.Read() == gpio.Low; i++ {
+		time.Sleep(i2c.Tclk)
+	}
+}
+
+// release releases the line to be pulled high by the pull-ups.
+func release(line gpio.Pinner) {
+	line.SetMode(gpio.Input)
+}
+
+// drive drives the line low from the Low output latch.
+func drive(line gpio.Pinner) {
+	line.SetMode(gpio.Output)
+}
+
+// the maximum number of clock periods a device may stretch the clock.
+const maxStretch = 1000
+
+var (
+	// ErrNack indicates the device did not acknowledge a transfer.
+	ErrNack = errors.New("nack")
+)
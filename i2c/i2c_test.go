@@ -0,0 +1,218 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package i2c_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/i2c"
+	"github.com/warthog618/gpio/mock"
+)
+
+type state int
+
+const (
+	idle state = iota
+	addressed
+	writing
+	reading
+)
+
+// device is a register based I2C device simulated on mock lines.
+//
+// The device watches the lines driven by the master and drives Sda,
+// via the external level of the mock pin, when acknowledging or transmitting.
+type device struct {
+	addr  uint8
+	regs  [256]byte
+	ptr   uint8
+	scl   *mock.Pin
+	sda   *mock.Pin
+	state state
+	// the number of clock pulses in the current byte, including the ack.
+	bits  int
+	shift byte
+	// the state following the ack of the received byte.
+	next  state
+	acked bool
+	// true until the register pointer has been written.
+	first bool
+	// records the conditions seen on the bus.
+	starts int
+	stops  int
+}
+
+func newDevice(t *testing.T, addr uint8) *device {
+	d := &device{
+		addr: addr,
+		scl:  mock.NewPin(3),
+		sda:  mock.NewPin(2),
+	}
+	// pull-ups
+	d.scl.Set(gpio.High)
+	d.sda.Set(gpio.High)
+	require.Nil(t, d.scl.Watch(gpio.EdgeBoth, d.clock))
+	require.Nil(t, d.sda.Watch(gpio.EdgeBoth, d.data))
+	// ignore the initial call of the watch
+	d.stops = 0
+	return d
+}
+
+func (d *device) data(gpio.Pinner) {
+	if d.scl.Read() == gpio.Low {
+		return
+	}
+	if d.sda.Read() == gpio.Low {
+		d.starts++
+		d.state = addressed
+		d.bits = 0
+		d.shift = 0
+		return
+	}
+	d.stops++
+	d.state = idle
+}
+
+func (d *device) clock(gpio.Pinner) {
+	if d.state == idle {
+		return
+	}
+	if d.scl.Read() == gpio.High {
+		d.bits++
+		switch {
+		case d.state == reading && d.bits == 9:
+			d.acked = d.sda.Read() == gpio.Low
+		case d.state != reading && d.bits <= 8:
+			d.shift = d.shift << 1
+			if d.sda.Read() {
+				d.shift |= 0x01
+			}
+		}
+		return
+	}
+	switch {
+	case d.state == reading && d.bits < 8:
+		d.sda.Set(d.regs[d.ptr-1]>>uint(7-d.bits)&0x01 == 0x01)
+	case d.state == reading && d.bits == 8:
+		d.sda.Set(gpio.High)
+	case d.state == reading:
+		d.bits = 0
+		if !d.acked {
+			d.state = idle
+			return
+		}
+		d.transmit()
+	case d.bits == 8:
+		d.receive()
+	case d.bits == 9:
+		d.sda.Set(gpio.High)
+		d.bits = 0
+		d.state = d.next
+		if d.state == reading {
+			d.transmit()
+		}
+	}
+}
+
+// receive handles a received byte, and acks it if addressed.
+func (d *device) receive() {
+	b := d.shift
+	d.shift = 0
+	switch d.state {
+	case addressed:
+		if b>>1 != d.addr {
+			d.state = idle
+			return
+		}
+		d.next = writing
+		if b&0x01 == 0x01 {
+			d.next = reading
+		}
+		d.first = true
+	case writing:
+		if d.first {
+			d.ptr = b
+			d.first = false
+		} else {
+			d.regs[d.ptr] = b
+			d.ptr++
+		}
+	}
+	d.sda.Set(gpio.Low)
+}
+
+// transmit drives the first bit of the register at the pointer.
+func (d *device) transmit() {
+	d.ptr++
+	d.sda.Set(d.regs[d.ptr-1]&0x80 == 0x80)
+}
+
+func TestWriteRegister(t *testing.T) {
+	d := newDevice(t, 0x20)
+	bus := i2c.NewFromPins(0, d.scl, d.sda)
+	assert.Equal(t, gpio.Input, d.scl.Mode())
+	assert.Equal(t, gpio.Input, d.sda.Mode())
+
+	err := bus.WriteRegister(0x20, 0x12, []byte{0xa5, 0x3c})
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0xa5), d.regs[0x12])
+	assert.Equal(t, byte(0x3c), d.regs[0x13])
+	assert.Equal(t, 1, d.starts)
+	assert.Equal(t, 1, d.stops)
+	assert.Equal(t, idle, d.state)
+	// bus released
+	assert.Equal(t, gpio.High, d.scl.Read())
+	assert.Equal(t, gpio.High, d.sda.Read())
+}
+
+func TestReadRegister(t *testing.T) {
+	d := newDevice(t, 0x20)
+	d.regs[0x0e] = 0x81
+	d.regs[0x0f] = 0x5a
+	d.regs[0x10] = 0xff
+	bus := i2c.NewFromPins(0, d.scl, d.sda)
+
+	var data [3]byte
+	err := bus.ReadRegister(0x20, 0x0e, data[:])
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x81, 0x5a, 0xff}, data[:])
+	// repeated start for the read
+	assert.Equal(t, 2, d.starts)
+	assert.Equal(t, 1, d.stops)
+	assert.Equal(t, gpio.High, d.sda.Read())
+}
+
+func TestNack(t *testing.T) {
+	d := newDevice(t, 0x20)
+	bus := i2c.NewFromPins(0, d.scl, d.sda)
+
+	err := bus.WriteRegister(0x21, 0x00, []byte{0x01})
+	assert.Equal(t, i2c.ErrNack, err)
+	assert.Equal(t, byte(0), d.regs[0])
+	var data [1]byte
+	err = bus.Read(0x21, data[:])
+	assert.Equal(t, i2c.ErrNack, err)
+	// the bus is stopped after the nack
+	assert.Equal(t, 2, d.stops)
+	assert.Equal(t, gpio.High, d.scl.Read())
+	assert.Equal(t, gpio.High, d.sda.Read())
+}
+
+func TestClose(t *testing.T) {
+	d := newDevice(t, 0x20)
+	bus := i2c.NewFromPins(0, d.scl, d.sda)
+	bus.Mu.Lock()
+	bus.Start()
+	bus.Mu.Unlock()
+	assert.Equal(t, gpio.Output, d.scl.Mode())
+	assert.Equal(t, gpio.Output, d.sda.Mode())
+	bus.Close()
+	assert.Equal(t, gpio.Input, d.scl.Mode())
+	assert.Equal(t, gpio.Input, d.sda.Mode())
+}
@@ -0,0 +1,350 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package mcp23017 provides a device driver for the MCP23017 16-bit I2C I/O
+// expander.
+package mcp23017
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/warthog618/gpio"
+)
+
+// Registers, with IOCON.BANK = 0, so A and B registers are paired.
+const (
+	regIODIR   = 0x00
+	regGPINTEN = 0x04
+	regIOCON   = 0x0a
+	regGPPU    = 0x0c
+	regINTF    = 0x0e
+	regINTCAP  = 0x10
+	regGPIO    = 0x12
+	regOLAT    = 0x14
+)
+
+// IOCON bits
+const (
+	ioconMirror = 0x40
+	ioconODR    = 0x04
+)
+
+// Bus provides access to the registers of devices on an I2C bus.
+//
+// Bus is implemented by i2c.I2C.
+type Bus interface {
+	// ReadRegister reads data from sequential registers, starting from reg,
+	// on the device at the 7-bit address.
+	ReadRegister(addr, reg uint8, data []byte) error
+
+	// WriteRegister writes the data to sequential registers, starting from
+	// reg, on the device at the 7-bit address.
+	WriteRegister(addr, reg uint8, data []byte) error
+}
+
+// NumPins is the number of pins provided by the MCP23017.
+const NumPins = 16
+
+// MCP23017 is an MCP23017 connected to a bit bashed I2C bus.
+//
+// Pins 0-7 correspond to GPA0-7, and pins 8-15 to GPB0-7.
+//
+// The device INTA and INTB outputs are mirrored and configured as open drain,
+// so either, or both, may be connected to the GPIO pin used to watch for
+// interrupts.  That pin is pulled up, so the interrupt line may be shared with
+// other open drain sources.
+type MCP23017 struct {
+	// Guards the following and the sequencing of device accesses.
+	mu   sync.Mutex
+	bus  Bus
+	addr uint8
+	// shadows of the device registers.
+	iodir   uint16
+	gppu    uint16
+	gpinten uint16
+	olat    uint16
+	// the interrupt pin, if any.
+	intr     gpio.Pinner
+	pins     [NumPins]*Pin
+	edges    [NumPins]gpio.Edge
+	handlers [NumPins]func(gpio.Pinner)
+}
+
+// New creates an MCP23017 at the 7-bit addr, 0x20-0x27, on the bus.
+func New(bus Bus, addr uint8) (*MCP23017, error) {
+	d := &MCP23017{bus: bus, addr: addr}
+	if err := d.writeReg8(regIOCON, ioconMirror|ioconODR); err != nil {
+		return nil, err
+	}
+	var err error
+	if d.iodir, err = d.readReg(regIODIR); err != nil {
+		return nil, err
+	}
+	if d.gppu, err = d.readReg(regGPPU); err != nil {
+		return nil, err
+	}
+	if d.olat, err = d.readReg(regOLAT); err != nil {
+		return nil, err
+	}
+	if err = d.writeReg(regGPINTEN, 0); err != nil {
+		return nil, err
+	}
+	for i := range d.pins {
+		d.pins[i] = &Pin{dev: d, pin: uint(i), mask: 1 << uint(i)}
+	}
+	return d, nil
+}
+
+// Close removes any watches and releases the interrupt pin.
+func (d *MCP23017) Close() {
+	d.mu.Lock()
+	intr := d.intr
+	d.intr = nil
+	d.gpinten = 0
+	d.writeReg(regGPINTEN, 0)
+	for i := range d.handlers {
+		d.handlers[i] = nil
+	}
+	d.mu.Unlock()
+	if intr != nil {
+		intr.Unwatch()
+	}
+}
+
+// Pin returns the pin with the given number, 0-15, or nil if there is no such
+// pin.
+func (d *MCP23017) Pin(pin int) *Pin {
+	if pin < 0 || pin >= NumPins {
+		return nil
+	}
+	return d.pins[pin]
+}
+
+// WatchInterrupt watches the GPIO pin connected to the device INTA or INTB
+// output, and dispatches the resulting edge events to the handlers of the
+// expander pins.
+//
+// The pin is pulled up, if it supports pulls.
+// This must be called before watching any expander pins.
+func (d *MCP23017) WatchInterrupt(intr gpio.Pinner) error {
+	d.mu.Lock()
+	if d.intr != nil {
+		d.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	d.intr = intr
+	d.mu.Unlock()
+	intr.SetMode(gpio.Input)
+	if p, ok := intr.(puller); ok {
+		p.SetPull(gpio.PullUp)
+	}
+	err := intr.Watch(gpio.EdgeFalling, func(gpio.Pinner) {
+		d.service()
+	})
+	if err != nil {
+		d.mu.Lock()
+		d.intr = nil
+		d.mu.Unlock()
+	}
+	return err
+}
+
+// puller is implemented by pins, such as gpio.Pin, that support pull up and
+// pull down.
+type puller interface {
+	SetPull(gpio.Pull)
+}
+
+// service reads the interrupt flags and captured levels from the device and
+// calls the handlers of the pins that triggered the interrupt.
+func (d *MCP23017) service() {
+	d.mu.Lock()
+	intf, err := d.readReg(regINTF)
+	if err != nil || intf == 0 {
+		d.mu.Unlock()
+		return
+	}
+	// reading INTCAP clears the interrupt.
+	intcap, err := d.readReg(regINTCAP)
+	if err != nil {
+		d.mu.Unlock()
+		return
+	}
+	var hh []func(gpio.Pinner)
+	var pp []*Pin
+	for i, p := range d.pins {
+		if intf&p.mask == 0 || d.handlers[i] == nil {
+			continue
+		}
+		high := intcap&p.mask != 0
+		switch d.edges[i] {
+		case gpio.EdgeRising:
+			if !high {
+				continue
+			}
+		case gpio.EdgeFalling:
+			if high {
+				continue
+			}
+		case gpio.EdgeNone:
+			continue
+		}
+		hh = append(hh, d.handlers[i])
+		pp = append(pp, p)
+	}
+	d.mu.Unlock()
+	for i, h := range hh {
+		h(pp[i])
+	}
+}
+
+func (d *MCP23017) readReg(reg uint8) (uint16, error) {
+	var b [2]byte
+	if err := d.bus.ReadRegister(d.addr, reg, b[:]); err != nil {
+		return 0, err
+	}
+	return uint16(b[0]) | uint16(b[1])<<8, nil
+}
+
+func (d *MCP23017) writeReg(reg uint8, v uint16) error {
+	return d.bus.WriteRegister(d.addr, reg, []byte{byte(v), byte(v >> 8)})
+}
+
+func (d *MCP23017) writeReg8(reg uint8, v uint8) error {
+	return d.bus.WriteRegister(d.addr, reg, []byte{v})
+}
+
+// updateReg sets the masked bits of the shadowed register.
+// Assumes the caller holds the mu lock.
+func (d *MCP23017) updateReg(reg uint8, shadow *uint16, mask uint16, set bool) error {
+	v := *shadow &^ mask
+	if set {
+		v |= mask
+	}
+	if v == *shadow {
+		return nil
+	}
+	if err := d.writeReg(reg, v); err != nil {
+		return err
+	}
+	*shadow = v
+	return nil
+}
+
+// Pin is a single pin of an MCP23017.
+//
+// Pin implements gpio.Pinner.
+type Pin struct {
+	dev  *MCP23017
+	pin  uint
+	mask uint16
+}
+
+// Pin returns the number of the pin on the expander, 0-15.
+func (p *Pin) Pin() int {
+	return int(p.pin)
+}
+
+// Read returns the level of the pin.
+//
+// Bus errors are reported as Low.
+func (p *Pin) Read() gpio.Level {
+	d := p.dev
+	d.mu.Lock()
+	v, err := d.readReg(regGPIO)
+	d.mu.Unlock()
+	if err != nil {
+		return gpio.Low
+	}
+	return v&p.mask != 0
+}
+
+// Write sets the level of the pin.
+//
+// The level is written to the output latch, so it may be set before the pin is
+// set to an Output.
+func (p *Pin) Write(level gpio.Level) {
+	d := p.dev
+	d.mu.Lock()
+	d.updateReg(regOLAT, &d.olat, p.mask, bool(level))
+	d.mu.Unlock()
+}
+
+// SetMode sets the mode of the pin.
+//
+// Only Input and Output are supported.  Other modes are ignored.
+func (p *Pin) SetMode(mode gpio.Mode) {
+	if mode != gpio.Input && mode != gpio.Output {
+		return
+	}
+	d := p.dev
+	d.mu.Lock()
+	d.updateReg(regIODIR, &d.iodir, p.mask, mode == gpio.Input)
+	d.mu.Unlock()
+}
+
+// Mode returns the mode of the pin.
+func (p *Pin) Mode() gpio.Mode {
+	d := p.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.iodir&p.mask != 0 {
+		return gpio.Input
+	}
+	return gpio.Output
+}
+
+// SetPull sets the pull of the pin.
+//
+// The MCP23017 only supports pull up, so PullDown is treated as PullNone.
+func (p *Pin) SetPull(pull gpio.Pull) {
+	d := p.dev
+	d.mu.Lock()
+	d.updateReg(regGPPU, &d.gppu, p.mask, pull == gpio.PullUp)
+	d.mu.Unlock()
+}
+
+// Watch calls the handler when the pin level changes on the given edge.
+//
+// As per gpio.Pin.Watch, the handler is called immediately with the current
+// level.  The interrupt pin must be set using WatchInterrupt before pins can
+// be watched.
+func (p *Pin) Watch(edge gpio.Edge, handler func(gpio.Pinner)) error {
+	d := p.dev
+	d.mu.Lock()
+	if d.intr == nil {
+		d.mu.Unlock()
+		return ErrNoInterrupt
+	}
+	if d.handlers[p.pin] != nil {
+		d.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	if err := d.updateReg(regGPINTEN, &d.gpinten, p.mask, true); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	d.edges[p.pin] = edge
+	d.handlers[p.pin] = handler
+	d.mu.Unlock()
+	go handler(p)
+	return nil
+}
+
+// Unwatch removes any watch from the pin.
+func (p *Pin) Unwatch() {
+	d := p.dev
+	d.mu.Lock()
+	d.updateReg(regGPINTEN, &d.gpinten, p.mask, false)
+	d.handlers[p.pin] = nil
+	d.mu.Unlock()
+}
+
+var (
+	// ErrNoInterrupt indicates the interrupt pin has not been set, so pins
+	// cannot be watched.
+	ErrNoInterrupt = errors.New("no interrupt pin")
+)
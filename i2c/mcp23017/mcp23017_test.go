@@ -0,0 +1,245 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package mcp23017_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/i2c"
+	"github.com/warthog618/gpio/i2c/mcp23017"
+	"github.com/warthog618/gpio/mock"
+)
+
+// Registers, as 16-bit A/B pairs.
+const (
+	regIODIR   = 0x00
+	regGPINTEN = 0x04
+	regIOCON   = 0x0a
+	regGPPU    = 0x0c
+	regINTF    = 0x0e
+	regINTCAP  = 0x10
+	regGPIO    = 0x12
+	regOLAT    = 0x14
+)
+
+const addr = 0x20
+
+// fakeBus is a bus with an MCP23017 at addr.
+type fakeBus struct {
+	mu   sync.Mutex
+	regs [0x16]byte
+	err  error
+	// the INT line, which is released when INTCAP is read.
+	intr *mock.Pin
+}
+
+func newFakeBus() *fakeBus {
+	b := &fakeBus{intr: mock.NewPin(4)}
+	// power on reset state
+	b.regs[regIODIR] = 0xff
+	b.regs[regIODIR+1] = 0xff
+	b.intr.Set(gpio.High)
+	return b
+}
+
+func (b *fakeBus) ReadRegister(a, reg uint8, data []byte) error {
+	b.mu.Lock()
+	if b.err != nil || a != addr {
+		b.mu.Unlock()
+		return i2c.ErrNack
+	}
+	copy(data, b.regs[reg:])
+	release := reg == regINTCAP
+	b.mu.Unlock()
+	if release {
+		b.intr.Set(gpio.High)
+	}
+	return nil
+}
+
+func (b *fakeBus) WriteRegister(a, reg uint8, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil || a != addr {
+		return i2c.ErrNack
+	}
+	copy(b.regs[reg:], data)
+	return nil
+}
+
+func (b *fakeBus) reg(reg uint8) uint16 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return uint16(b.regs[reg]) | uint16(b.regs[reg+1])<<8
+}
+
+func (b *fakeBus) setReg(reg uint8, v uint16) {
+	b.mu.Lock()
+	b.regs[reg] = byte(v)
+	b.regs[reg+1] = byte(v >> 8)
+	b.mu.Unlock()
+}
+
+// interrupt latches the pin levels as the captured interrupt and asserts INT.
+func (b *fakeBus) interrupt(intf, levels uint16) {
+	b.setReg(regINTF, intf)
+	b.setReg(regINTCAP, levels)
+	b.setReg(regGPIO, levels)
+	b.intr.Set(gpio.Low)
+}
+
+func TestNew(t *testing.T) {
+	b := newFakeBus()
+	b.setReg(regGPINTEN, 0xffff)
+	d, err := mcp23017.New(b, addr)
+	require.Nil(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, byte(0x44), b.regs[regIOCON])
+	assert.Equal(t, uint16(0), b.reg(regGPINTEN))
+	assert.Nil(t, d.Pin(-1))
+	assert.Nil(t, d.Pin(mcp23017.NumPins))
+	for i := 0; i < mcp23017.NumPins; i++ {
+		p := d.Pin(i)
+		require.NotNil(t, p)
+		assert.Equal(t, i, p.Pin())
+		assert.Equal(t, gpio.Input, p.Mode())
+	}
+
+	b = newFakeBus()
+	b.err = errors.New("bus error")
+	d, err = mcp23017.New(b, addr)
+	assert.Equal(t, i2c.ErrNack, err)
+	assert.Nil(t, d)
+
+	d, err = mcp23017.New(newFakeBus(), addr+1)
+	assert.Equal(t, i2c.ErrNack, err)
+	assert.Nil(t, d)
+}
+
+func TestPin(t *testing.T) {
+	b := newFakeBus()
+	d, err := mcp23017.New(b, addr)
+	require.Nil(t, err)
+	var p gpio.Pinner = d.Pin(9)
+	require.NotNil(t, p)
+
+	// latched before becoming an output
+	p.Write(gpio.High)
+	assert.Equal(t, uint16(0x0200), b.reg(regOLAT))
+	assert.Equal(t, uint16(0xffff), b.reg(regIODIR))
+	p.SetMode(gpio.Output)
+	assert.Equal(t, uint16(0xfdff), b.reg(regIODIR))
+	assert.Equal(t, gpio.Output, d.Pin(9).Mode())
+	assert.Equal(t, gpio.Input, d.Pin(1).Mode())
+	p.Write(gpio.Low)
+	assert.Equal(t, uint16(0), b.reg(regOLAT))
+
+	// unsupported modes are ignored
+	p.SetMode(gpio.Alt0)
+	assert.Equal(t, gpio.Output, d.Pin(9).Mode())
+	p.SetMode(gpio.Input)
+	assert.Equal(t, uint16(0xffff), b.reg(regIODIR))
+
+	d.Pin(1).SetPull(gpio.PullUp)
+	assert.Equal(t, uint16(0x0002), b.reg(regGPPU))
+	d.Pin(1).SetPull(gpio.PullDown)
+	assert.Equal(t, uint16(0), b.reg(regGPPU))
+
+	b.setReg(regGPIO, 0x0202)
+	assert.Equal(t, gpio.High, p.Read())
+	assert.Equal(t, gpio.High, d.Pin(1).Read())
+	assert.Equal(t, gpio.Low, d.Pin(0).Read())
+
+	// bus errors read Low
+	b.err = errors.New("bus error")
+	assert.Equal(t, gpio.Low, p.Read())
+}
+
+func TestWatchInterrupt(t *testing.T) {
+	b := newFakeBus()
+	d, err := mcp23017.New(b, addr)
+	require.Nil(t, err)
+	defer d.Close()
+
+	err = d.Pin(0).Watch(gpio.EdgeBoth, func(gpio.Pinner) {})
+	assert.Equal(t, mcp23017.ErrNoInterrupt, err)
+
+	b.intr.SetMode(gpio.Output)
+	err = d.WatchInterrupt(b.intr)
+	require.Nil(t, err)
+	assert.Equal(t, gpio.Input, b.intr.Mode())
+	assert.Equal(t, gpio.PullUp, b.intr.Pull())
+	err = d.WatchInterrupt(b.intr)
+	assert.Equal(t, gpio.ErrBusy, err)
+
+	ch := make(chan event, 10)
+	handler := func(p gpio.Pinner) {
+		ch <- event{p.(*mcp23017.Pin).Pin(), p.Read()}
+	}
+	err = d.Pin(0).Watch(gpio.EdgeFalling, handler)
+	require.Nil(t, err)
+	assert.Equal(t, event{0, gpio.Low}, waitEvent(t, ch))
+	err = d.Pin(9).Watch(gpio.EdgeBoth, handler)
+	require.Nil(t, err)
+	assert.Equal(t, event{9, gpio.Low}, waitEvent(t, ch))
+	err = d.Pin(9).Watch(gpio.EdgeBoth, handler)
+	assert.Equal(t, gpio.ErrBusy, err)
+	assert.Equal(t, uint16(0x0201), b.reg(regGPINTEN))
+
+	// dispatched to the pins flagged in INTF, on their edges.
+	b.interrupt(0x0201, 0x0201)
+	assert.Equal(t, event{9, gpio.High}, waitEvent(t, ch))
+	assert.Equal(t, gpio.High, b.intr.Read())
+	b.interrupt(0x0201, 0x0000)
+	assert.Equal(t, event{0, gpio.Low}, waitEvent(t, ch))
+	assert.Equal(t, event{9, gpio.Low}, waitEvent(t, ch))
+
+	// unflagged pins are ignored.
+	b.interrupt(0x0200, 0x0001)
+	assert.Equal(t, event{9, gpio.Low}, waitEvent(t, ch))
+	// as does an interrupt from another source on a shared line.
+	b.interrupt(0x0000, 0x0201)
+	assert.Equal(t, 0, len(ch))
+	b.intr.Set(gpio.High)
+
+	d.Pin(9).Unwatch()
+	assert.Equal(t, uint16(0x0001), b.reg(regGPINTEN))
+	b.interrupt(0x0201, 0x0000)
+	assert.Equal(t, event{0, gpio.Low}, waitEvent(t, ch))
+	assert.Equal(t, 0, len(ch))
+
+	d.Close()
+	assert.Equal(t, uint16(0), b.reg(regGPINTEN))
+	b.interrupt(0x0001, 0x0000)
+	assert.Equal(t, 0, len(ch))
+	assert.Equal(t, gpio.Low, b.intr.Read())
+	// the interrupt pin is released for reuse.
+	err = b.intr.Watch(gpio.EdgeFalling, func(gpio.Pinner) {})
+	assert.Nil(t, err)
+}
+
+// event records the pin and level passed to a handler.
+type event struct {
+	pin   int
+	level gpio.Level
+}
+
+func waitEvent(t *testing.T, ch <-chan event) event {
+	t.Helper()
+	select {
+	case evt := <-ch:
+		return evt
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return event{}
+}
@@ -0,0 +1,313 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package pcf8574 provides a device driver for the PCF8574 and PCF8574A 8-bit
+// I2C I/O expanders.
+package pcf8574
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/warthog618/gpio"
+)
+
+// Bus provides access to devices on an I2C bus.
+//
+// Bus is implemented by i2c.I2C.
+type Bus interface {
+	// Read reads data from the device at the 7-bit address.
+	Read(addr uint8, data []byte) error
+
+	// Write writes the data to the device at the 7-bit address.
+	Write(addr uint8, data []byte) error
+}
+
+// NumPins is the number of pins provided by the PCF8574.
+const NumPins = 8
+
+// PCF8574 is a PCF8574, or PCF8574A, connected to a bit bashed I2C bus.
+//
+// The PCF8574 has quasi-bidirectional I/O.  Each pin is either driven low, or
+// is weakly pulled high, in which case it can be read as an input.  The driver
+// hides this, so pins can be used as Inputs and Outputs as per a gpio.Pin.
+// An Output driven High is indistinguishable from an Input, except that it
+// has been explicitly set High.
+//
+// The device INT output is open drain and active low, and is asserted on any
+// change to the level of an input pin.
+type PCF8574 struct {
+	// Guards the following and the sequencing of device accesses.
+	mu   sync.Mutex
+	bus  Bus
+	addr uint8
+	// the pins that are outputs.
+	outputs uint8
+	// the level of the output latches.
+	latch uint8
+	// the port levels when last read.
+	levels uint8
+	// the interrupt pin, if any.
+	intr     gpio.Pinner
+	pins     [NumPins]*Pin
+	edges    [NumPins]gpio.Edge
+	handlers [NumPins]func(gpio.Pinner)
+}
+
+// New creates a PCF8574 at the 7-bit addr on the bus.
+//
+// The address is 0x20-0x27 for the PCF8574, and 0x38-0x3f for the PCF8574A.
+//
+// All pins are initially Inputs.
+func New(bus Bus, addr uint8) (*PCF8574, error) {
+	d := &PCF8574{bus: bus, addr: addr}
+	if err := d.write(); err != nil {
+		return nil, err
+	}
+	var err error
+	if d.levels, err = d.read(); err != nil {
+		return nil, err
+	}
+	for i := range d.pins {
+		d.pins[i] = &Pin{dev: d, pin: uint(i), mask: 1 << uint(i)}
+	}
+	return d, nil
+}
+
+// Close removes any watches and releases the interrupt pin.
+func (d *PCF8574) Close() {
+	d.mu.Lock()
+	intr := d.intr
+	d.intr = nil
+	for i := range d.handlers {
+		d.handlers[i] = nil
+	}
+	d.mu.Unlock()
+	if intr != nil {
+		intr.Unwatch()
+	}
+}
+
+// Pin returns the pin with the given number, 0-7, or nil if there is no such
+// pin.
+func (d *PCF8574) Pin(pin int) *Pin {
+	if pin < 0 || pin >= NumPins {
+		return nil
+	}
+	return d.pins[pin]
+}
+
+// WatchInterrupt watches the GPIO pin connected to the device INT output, and
+// dispatches the resulting edge events to the handlers of the expander pins.
+//
+// The pin is pulled up, if it supports pulls.
+// This must be called before watching any expander pins.
+func (d *PCF8574) WatchInterrupt(intr gpio.Pinner) error {
+	d.mu.Lock()
+	if d.intr != nil {
+		d.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	d.intr = intr
+	d.mu.Unlock()
+	intr.SetMode(gpio.Input)
+	if p, ok := intr.(puller); ok {
+		p.SetPull(gpio.PullUp)
+	}
+	err := intr.Watch(gpio.EdgeFalling, func(gpio.Pinner) {
+		d.service()
+	})
+	if err != nil {
+		d.mu.Lock()
+		d.intr = nil
+		d.mu.Unlock()
+	}
+	return err
+}
+
+// puller is implemented by pins, such as gpio.Pin, that support pull up and
+// pull down.
+type puller interface {
+	SetPull(gpio.Pull)
+}
+
+// service reads the port, which clears the interrupt, and calls the handlers
+// of the pins that have changed.
+func (d *PCF8574) service() {
+	d.mu.Lock()
+	v, err := d.read()
+	if err != nil {
+		d.mu.Unlock()
+		return
+	}
+	changed := v ^ d.levels
+	d.levels = v
+	var hh []func(gpio.Pinner)
+	var pp []*Pin
+	for i, p := range d.pins {
+		if changed&p.mask == 0 || d.handlers[i] == nil {
+			continue
+		}
+		high := v&p.mask != 0
+		switch d.edges[i] {
+		case gpio.EdgeRising:
+			if !high {
+				continue
+			}
+		case gpio.EdgeFalling:
+			if high {
+				continue
+			}
+		case gpio.EdgeNone:
+			continue
+		}
+		hh = append(hh, d.handlers[i])
+		pp = append(pp, p)
+	}
+	d.mu.Unlock()
+	for i, h := range hh {
+		h(pp[i])
+	}
+}
+
+// read returns the levels of the port.
+// Assumes the caller holds the mu lock.
+func (d *PCF8574) read() (uint8, error) {
+	var b [1]byte
+	if err := d.bus.Read(d.addr, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// write writes the port, driving low only the outputs with a low latch.
+// Assumes the caller holds the mu lock.
+func (d *PCF8574) write() error {
+	return d.bus.Write(d.addr, []byte{^d.outputs | d.latch})
+}
+
+// update sets the masked bits of the shadowed value and writes the port.
+// Assumes the caller holds the mu lock.
+func (d *PCF8574) update(shadow *uint8, mask uint8, set bool) error {
+	old := *shadow
+	v := old &^ mask
+	if set {
+		v |= mask
+	}
+	if v == old {
+		return nil
+	}
+	*shadow = v
+	if err := d.write(); err != nil {
+		*shadow = old
+		return err
+	}
+	return nil
+}
+
+// Pin is a single pin of a PCF8574.
+//
+// Pin implements gpio.Pinner.
+type Pin struct {
+	dev  *PCF8574
+	pin  uint
+	mask uint8
+}
+
+// Pin returns the number of the pin on the expander, 0-7.
+func (p *Pin) Pin() int {
+	return int(p.pin)
+}
+
+// Read returns the level of the pin.
+//
+// Bus errors are reported as Low.
+func (p *Pin) Read() gpio.Level {
+	d := p.dev
+	d.mu.Lock()
+	v, err := d.read()
+	d.mu.Unlock()
+	if err != nil {
+		return gpio.Low
+	}
+	return v&p.mask != 0
+}
+
+// Write sets the level of the pin.
+//
+// The level is latched, so it may be set before the pin is set to an Output.
+func (p *Pin) Write(level gpio.Level) {
+	d := p.dev
+	d.mu.Lock()
+	d.update(&d.latch, p.mask, bool(level))
+	d.mu.Unlock()
+}
+
+// SetMode sets the mode of the pin.
+//
+// Only Input and Output are supported.  Other modes are ignored.
+func (p *Pin) SetMode(mode gpio.Mode) {
+	if mode != gpio.Input && mode != gpio.Output {
+		return
+	}
+	d := p.dev
+	d.mu.Lock()
+	d.update(&d.outputs, p.mask, mode == gpio.Output)
+	d.mu.Unlock()
+}
+
+// Mode returns the mode of the pin.
+func (p *Pin) Mode() gpio.Mode {
+	d := p.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.outputs&p.mask != 0 {
+		return gpio.Output
+	}
+	return gpio.Input
+}
+
+// SetPull is provided for compatibility with other pins.
+//
+// The PCF8574 inputs are always weakly pulled up, so this has no effect.
+func (p *Pin) SetPull(pull gpio.Pull) {
+}
+
+// Watch calls the handler when the pin level changes on the given edge.
+//
+// As per gpio.Pin.Watch, the handler is called immediately with the current
+// level.  The interrupt pin must be set using WatchInterrupt before pins can
+// be watched.
+func (p *Pin) Watch(edge gpio.Edge, handler func(gpio.Pinner)) error {
+	d := p.dev
+	d.mu.Lock()
+	if d.intr == nil {
+		d.mu.Unlock()
+		return ErrNoInterrupt
+	}
+	if d.handlers[p.pin] != nil {
+		d.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	d.edges[p.pin] = edge
+	d.handlers[p.pin] = handler
+	d.mu.Unlock()
+	go handler(p)
+	return nil
+}
+
+// Unwatch removes any watch from the pin.
+func (p *Pin) Unwatch() {
+	d := p.dev
+	d.mu.Lock()
+	d.handlers[p.pin] = nil
+	d.mu.Unlock()
+}
+
+var (
+	// ErrNoInterrupt indicates the interrupt pin has not been set, so pins
+	// cannot be watched.
+	ErrNoInterrupt = errors.New("no interrupt pin")
+)
@@ -0,0 +1,246 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package pcf8574_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/i2c"
+	"github.com/warthog618/gpio/i2c/pcf8574"
+	"github.com/warthog618/gpio/mock"
+)
+
+const addr = 0x20
+
+// fakeBus is a bus with a PCF8574 at addr.
+//
+// The port is quasi-bidirectional, so each line is Low if either the port
+// drives it low, or an external device pulls it low.
+type fakeBus struct {
+	mu sync.Mutex
+	// the last byte written to the port, with 1 releasing the line.
+	port byte
+	// the lines pulled low externally.
+	pulled byte
+	// the levels when the port was last read, to detect input changes.
+	levels byte
+	err    error
+	writes int
+	// the INT line, which is asserted by input changes and released by a
+	// read of the port.
+	intr *mock.Pin
+}
+
+func newFakeBus() *fakeBus {
+	b := &fakeBus{port: 0xff, levels: 0xff, intr: mock.NewPin(4)}
+	b.intr.Set(gpio.High)
+	return b
+}
+
+func (b *fakeBus) Read(a uint8, data []byte) error {
+	b.mu.Lock()
+	if b.err != nil || a != addr {
+		b.mu.Unlock()
+		return i2c.ErrNack
+	}
+	b.levels = b.port &^ b.pulled
+	data[0] = b.levels
+	b.mu.Unlock()
+	b.intr.Set(gpio.High)
+	return nil
+}
+
+func (b *fakeBus) Write(a uint8, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil || a != addr {
+		return i2c.ErrNack
+	}
+	b.port = data[len(data)-1]
+	b.writes++
+	return nil
+}
+
+func (b *fakeBus) written() byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.port
+}
+
+// pull sets the lines externally pulled low, and asserts INT if that changes
+// the level of any line.
+func (b *fakeBus) pull(mask byte) {
+	b.mu.Lock()
+	b.pulled = mask
+	changed := b.port&^b.pulled != b.levels
+	b.mu.Unlock()
+	if changed {
+		b.intr.Set(gpio.Low)
+	}
+}
+
+func TestNew(t *testing.T) {
+	b := newFakeBus()
+	b.port = 0
+	d, err := pcf8574.New(b, addr)
+	require.Nil(t, err)
+	require.NotNil(t, d)
+	// all lines released as inputs
+	assert.Equal(t, byte(0xff), b.written())
+	assert.Nil(t, d.Pin(-1))
+	assert.Nil(t, d.Pin(pcf8574.NumPins))
+	for i := 0; i < pcf8574.NumPins; i++ {
+		p := d.Pin(i)
+		require.NotNil(t, p)
+		assert.Equal(t, i, p.Pin())
+		assert.Equal(t, gpio.Input, p.Mode())
+	}
+
+	b = newFakeBus()
+	b.err = errors.New("bus error")
+	d, err = pcf8574.New(b, addr)
+	assert.Equal(t, i2c.ErrNack, err)
+	assert.Nil(t, d)
+}
+
+func TestQuasiBidirectional(t *testing.T) {
+	b := newFakeBus()
+	d, err := pcf8574.New(b, addr)
+	require.Nil(t, err)
+	var p gpio.Pinner = d.Pin(3)
+
+	// released input reads the external level
+	assert.Equal(t, gpio.High, p.Read())
+	b.pull(0x08)
+	assert.Equal(t, gpio.Low, p.Read())
+	b.pull(0)
+
+	// latching Low on an input leaves the line released
+	p.Write(gpio.Low)
+	assert.Equal(t, byte(0xff), b.written())
+	assert.Equal(t, gpio.High, p.Read())
+
+	// and it is driven once the pin is an output
+	p.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Output, d.Pin(3).Mode())
+	assert.Equal(t, byte(0xf7), b.written())
+	assert.Equal(t, gpio.Low, p.Read())
+	assert.Equal(t, gpio.High, d.Pin(2).Read())
+
+	// an output written High releases the line, so it reads back as an input
+	p.Write(gpio.High)
+	assert.Equal(t, byte(0xff), b.written())
+	assert.Equal(t, gpio.Output, d.Pin(3).Mode())
+	assert.Equal(t, gpio.High, p.Read())
+	b.pull(0x08)
+	assert.Equal(t, gpio.Low, p.Read())
+	b.pull(0)
+
+	// returning a Low output to an input releases the line
+	p.Write(gpio.Low)
+	assert.Equal(t, byte(0xf7), b.written())
+	p.SetMode(gpio.Input)
+	assert.Equal(t, byte(0xff), b.written())
+	assert.Equal(t, gpio.Input, d.Pin(3).Mode())
+
+	// unchanged levels and unsupported modes are not written
+	writes := b.writes
+	p.SetMode(gpio.Input)
+	p.SetMode(gpio.Alt0)
+	d.Pin(3).SetPull(gpio.PullDown)
+	assert.Equal(t, writes, b.writes)
+	assert.Equal(t, gpio.Input, d.Pin(3).Mode())
+
+	// bus errors read Low, and leave the shadows unchanged
+	b.err = errors.New("bus error")
+	assert.Equal(t, gpio.Low, p.Read())
+	p.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Input, d.Pin(3).Mode())
+}
+
+func TestWatchInterrupt(t *testing.T) {
+	b := newFakeBus()
+	d, err := pcf8574.New(b, addr)
+	require.Nil(t, err)
+	defer d.Close()
+
+	err = d.Pin(0).Watch(gpio.EdgeBoth, func(gpio.Pinner) {})
+	assert.Equal(t, pcf8574.ErrNoInterrupt, err)
+
+	err = d.WatchInterrupt(b.intr)
+	require.Nil(t, err)
+	assert.Equal(t, gpio.Input, b.intr.Mode())
+	assert.Equal(t, gpio.PullUp, b.intr.Pull())
+	err = d.WatchInterrupt(b.intr)
+	assert.Equal(t, gpio.ErrBusy, err)
+
+	ch := make(chan event, 10)
+	handler := func(p gpio.Pinner) {
+		ch <- event{p.(*pcf8574.Pin).Pin(), p.Read()}
+	}
+	err = d.Pin(0).Watch(gpio.EdgeFalling, handler)
+	require.Nil(t, err)
+	assert.Equal(t, event{0, gpio.High}, waitEvent(t, ch))
+	err = d.Pin(5).Watch(gpio.EdgeBoth, handler)
+	require.Nil(t, err)
+	assert.Equal(t, event{5, gpio.High}, waitEvent(t, ch))
+	err = d.Pin(5).Watch(gpio.EdgeBoth, handler)
+	assert.Equal(t, gpio.ErrBusy, err)
+
+	// dispatched to the pins that changed, on their edges.
+	b.pull(0x20)
+	assert.Equal(t, event{5, gpio.Low}, waitEvent(t, ch))
+	assert.Equal(t, gpio.High, b.intr.Read())
+	b.pull(0x21)
+	assert.Equal(t, event{0, gpio.Low}, waitEvent(t, ch))
+	b.pull(0)
+	assert.Equal(t, event{5, gpio.High}, waitEvent(t, ch))
+	assert.Equal(t, 0, len(ch))
+
+	// including an output written High, as that reads as an input.
+	p := d.Pin(5)
+	p.Write(gpio.High)
+	p.SetMode(gpio.Output)
+	b.pull(0x20)
+	assert.Equal(t, event{5, gpio.Low}, waitEvent(t, ch))
+	b.pull(0)
+	assert.Equal(t, event{5, gpio.High}, waitEvent(t, ch))
+
+	d.Pin(5).Unwatch()
+	b.pull(0x21)
+	assert.Equal(t, event{0, gpio.Low}, waitEvent(t, ch))
+	assert.Equal(t, 0, len(ch))
+
+	d.Close()
+	b.pull(0)
+	assert.Equal(t, 0, len(ch))
+	// the interrupt pin is released for reuse.
+	err = b.intr.Watch(gpio.EdgeFalling, func(gpio.Pinner) {})
+	assert.Nil(t, err)
+}
+
+// event records the pin and level passed to a handler.
+type event struct {
+	pin   int
+	level gpio.Level
+}
+
+func waitEvent(t *testing.T, ch <-chan event) event {
+	t.Helper()
+	select {
+	case evt := <-ch:
+		return evt
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return event{}
+}
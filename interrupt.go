@@ -13,10 +13,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/warthog618/gpio/clock"
 	"golang.org/x/sys/unix"
 )
 
@@ -43,9 +46,161 @@ const (
 )
 
 type interrupt struct {
-	pin       *Pin
-	handler   func(*Pin)
+	pin     *Pin
+	handler func(*Pin)
+	// the sysfs value file, or nil if the pin is watched via the character
+	// device.
 	valueFile *os.File
+	// if set, events are only dispatched if the filter returns true.
+	filter func(Event) bool
+	// if set, events are only dispatched if they pass the pipeline.
+	pipeline *Filter
+	// the maximum number of events dispatched per second, or 0 if unlimited.
+	maxRate int
+	// the counter of edges, if any.
+	counter *EdgeCounter
+	// the latch set by edges, if any.
+	latch *Latch
+	// called from the watcher goroutine for each edge, if set.
+	onEdge func(Event)
+	// true once the initial sysfs event has been seen.
+	synced bool
+	// if set, events reporting the same level as the previous event are
+	// suppressed.
+	dedup bool
+	// the level of the previous event, for dedup.
+	lastLevel Level
+	// if set, an existing sysfs export is used as configured, rather than
+	// failing with ErrBusy.
+	adopt bool
+	// true if an existing sysfs export was adopted, so is left exported
+	// when the watch is removed.
+	adopted bool
+	// the edge of the adopted export, restored when the watch is removed.
+	adoptedEdge Edge
+	// the source of event times, and of the timing of the rate limit and
+	// instrumentation.
+	clock clock.Clock
+	// Guards the following
+	mu    sync.Mutex
+	stats WatchStats
+	// the start of the current rate window, and the events within it.
+	window      time.Time
+	windowCount uint64
+	// the start of the current rate limit window, and the events dispatched
+	// within it.
+	limitWindow time.Time
+	limitCount  int
+	// true if a coalesced event is scheduled for the next limit window.
+	pending bool
+	// true once the watch has been released.
+	released bool
+}
+
+// Event describes an edge event on a watched pin.
+type Event struct {
+	// Pin is the pin that triggered the event.
+	Pin *Pin
+
+	// Level is the level of the pin when the event was read.
+	Level Level
+
+	// Time is the time of the event.
+	//
+	// For pins watched via the character device this is derived from the
+	// kernel event timestamp.  For sysfs this is the time the watcher woke.
+	Time time.Time
+}
+
+// WatchOption defines an option that can be applied to a watch.
+type WatchOption func(*interrupt)
+
+// WithFilter discards events for which the filter returns false, before
+// the handler is dispatched.
+//
+// The filter is called from the watcher goroutine, so it must be quick and
+// must not block, but events are discarded without waking a handler
+// goroutine.
+func WithFilter(filter func(Event) bool) WatchOption {
+	return func(intr *interrupt) {
+		intr.filter = filter
+	}
+}
+
+// WithPipeline discards events that do not pass the stages of the pipeline,
+// before the handler is dispatched.
+//
+// The pipeline is applied after any filter set by WithFilter, and before any
+// rate limit set by WithMaxRate.  Each watch has its own instance of the
+// stage state, so a Pipeline may be shared by several watches.  The events
+// passed and discarded by each stage are reported in the Stages field of the
+// WatchStats.
+//
+// The stages are called from the watcher goroutine, so must be quick and must
+// not block.
+func WithPipeline(p Pipeline) WatchOption {
+	return func(intr *interrupt) {
+		intr.pipeline = p.Filter()
+	}
+}
+
+// WithDedup suppresses events that report the same level as the previous
+// event, so the handler sees a strictly alternating sequence of levels.
+//
+// Consecutive events with the same level occur when a pulse is shorter than
+// the time taken to read the level after the edge, or when events race with
+// Read.  This only applies to watches on EdgeBoth, and is ignored for other
+// edges.
+func WithDedup() WatchOption {
+	return func(intr *interrupt) {
+		intr.dedup = true
+	}
+}
+
+// WithMaxRate limits the events dispatched to the handler to at most n per
+// second.
+//
+// Events beyond the limit are suppressed, and a single coalesced event is
+// dispatched at the start of the next second, so the handler still sees the
+// final level of the pin.  The number of suppressed events is reported in
+// the Suppressed field of the WatchStats.
+func WithMaxRate(n int) WatchOption {
+	return func(intr *interrupt) {
+		intr.maxRate = n
+	}
+}
+
+// WithAdopt attaches the watch to an existing sysfs export of the pin, such
+// as one created by a udev rule or init script, rather than failing with
+// ErrBusy.
+//
+// The export is used as configured, so its direction is unchanged, and its
+// edge takes precedence over the edge requested, unless the export has no
+// edge set, in which case the requested edge is set for the life of the
+// watch.  The export is left in place when the watch is removed.  Pins that
+// are not already exported are exported as usual.
+//
+// This only applies to pins watched via sysfs.
+func WithAdopt() WatchOption {
+	return func(intr *interrupt) {
+		intr.adopt = true
+	}
+}
+
+// WithClock sets the clock used to time the events on the watch, e.g. a
+// clock.Fake for tests.
+//
+// The clock provides the Time of events, and so the timing of Debounce and
+// other pipeline stages, as well as the windows of WithMaxRate and the
+// handler durations recorded by Instrument.  The default is clock.Real.
+//
+// With any other clock, the Time of events is the time of the clock when the
+// event is read, as the kernel timestamps are unrelated to that clock.
+// Latencies are always measured from the kernel timestamps.
+func WithClock(c clock.Clock) WatchOption {
+	return func(intr *interrupt) {
+		intr.clock = c
+	}
 }
 
 // Watcher monitors the pins for level transitions that trigger interrupts.
@@ -56,7 +211,7 @@ type Watcher struct {
 	epfd int
 
 	// Map from pin to value Fd.
-	interruptFds map[int]int
+	interruptFds map[pinID]int
 
 	// Map from pin Fd to interrupt
 	interrupts map[int]*interrupt
@@ -69,6 +224,12 @@ type Watcher struct {
 
 	// true once the Watcher has been closed.
 	closed bool
+
+	// true if handler invocations are instrumented.
+	instrumented bool
+
+	// called after each instrumented handler invocation, if set.
+	onEvent func(WatchEvent)
 }
 
 var defaultWatcher *Watcher
@@ -98,7 +259,7 @@ func NewWatcher() *Watcher {
 	unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, int(p[0]), &epv)
 	w := &Watcher{
 		epfd:         epfd,
-		interruptFds: make(map[int]int),
+		interruptFds: make(map[pinID]int),
 		interrupts:   make(map[int]*interrupt),
 		doneCh:       make(chan struct{}),
 		donefds:      p,
@@ -121,6 +282,7 @@ func (w *Watcher) watch() {
 			if err == unix.EINTR {
 				continue
 			}
+			logError("watcher failed", "err", err)
 			panic(fmt.Sprintf("EpollWait error: %v", err))
 		}
 		for i := 0; i < n; i++ {
@@ -132,14 +294,164 @@ func (w *Watcher) watch() {
 			}
 			w.Lock()
 			irq, ok := w.interrupts[int(event.Fd)]
+			instrumented := w.instrumented
+			onEvent := w.onEvent
 			w.Unlock()
 			if ok {
-				go irq.handler(irq.pin)
+				w.dispatch(irq, instrumented, onEvent)
 			}
 		}
 	}
 }
 
+// dispatch calls the handler for an interrupt, unless the event is filtered.
+func (w *Watcher) dispatch(irq *interrupt, instrumented bool, onEvent func(WatchEvent)) {
+	// sysfs provides no timestamps, so the wakeup is the best estimate of
+	// the edge time.
+	edge := monotonicNow()
+	n := 1
+	initial := false
+	if irq.pin.line != nil {
+		var each func(eventData)
+		if irq.onEdge != nil {
+			each = func(ed eventData) {
+				irq.edgeEvent(Event{
+					Pin:   irq.pin,
+					Level: ed.ID == eventRisingEdge,
+					Time:  irq.eventTime(ed.Timestamp),
+				})
+			}
+		}
+		var ts uint64
+		ts, n = irq.pin.line.readEvents(each)
+		if ts != 0 {
+			edge = ts
+		}
+		if n > 1 && irq.handler != nil {
+			// events are coalesced into a single handler call.
+			logDebug("dropped events", "pin", irq.pin.pin, "count", n-1)
+		}
+	} else if !irq.synced {
+		// the first sysfs event is the initial sync rather than an edge.
+		irq.synced = true
+		initial = true
+		n = 0
+	} else if irq.onEdge != nil {
+		irq.edgeEvent(Event{
+			Pin:   irq.pin,
+			Level: irq.pin.level(),
+			Time:  irq.clock.Now(),
+		})
+	}
+	if irq.counter != nil {
+		atomic.AddUint64(&irq.counter.count, uint64(n))
+	}
+	if irq.latch != nil && n > 0 {
+		atomic.StoreUint32(&irq.latch.occurred, 1)
+	}
+	if irq.handler == nil {
+		return
+	}
+	if irq.dedup {
+		level := irq.pin.level()
+		if level == irq.lastLevel && !initial {
+			return
+		}
+		irq.lastLevel = level
+	}
+	if irq.filter != nil || irq.pipeline != nil {
+		evt := Event{
+			Pin:   irq.pin,
+			Level: irq.pin.level(),
+			Time:  irq.eventTime(edge),
+		}
+		if irq.filter != nil && !irq.filter(evt) {
+			return
+		}
+		if irq.pipeline != nil && !irq.pipeline.Pass(evt) {
+			return
+		}
+	}
+	if irq.maxRate > 0 && !irq.allow() {
+		return
+	}
+	irq.call(edge, instrumented, onEvent)
+}
+
+// eventTime returns the time of the edge with the timestamp, in nanoseconds on
+// the monotonic clock.
+func (irq *interrupt) eventTime(edge uint64) time.Time {
+	if irq.clock != clock.Real {
+		return irq.clock.Now()
+	}
+	return time.Now().Add(-sinceEdge(edge))
+}
+
+// edgeEvent passes the event to the edge handler, subject to any filter.
+func (irq *interrupt) edgeEvent(evt Event) {
+	if irq.dedup {
+		if evt.Level == irq.lastLevel {
+			return
+		}
+		irq.lastLevel = evt.Level
+	}
+	if irq.filter != nil && !irq.filter(evt) {
+		return
+	}
+	if irq.pipeline != nil && !irq.pipeline.Pass(evt) {
+		return
+	}
+	irq.onEdge(evt)
+}
+
+// call calls the handler in a new goroutine.
+func (irq *interrupt) call(edge uint64, instrumented bool, onEvent func(WatchEvent)) {
+	if instrumented {
+		go irq.instrumentedHandler(edge, onEvent)
+	} else {
+		go irq.handler(irq.pin)
+	}
+}
+
+// allow returns true if an event may be dispatched within the rate limit.
+//
+// If not, the event is suppressed, and a coalesced event is scheduled for the
+// start of the next window.
+func (irq *interrupt) allow() bool {
+	now := irq.clock.Now()
+	irq.mu.Lock()
+	defer irq.mu.Unlock()
+	if now.Sub(irq.limitWindow) >= time.Second {
+		irq.limitWindow = now
+		irq.limitCount = 0
+	}
+	if irq.limitCount < irq.maxRate {
+		irq.limitCount++
+		return true
+	}
+	irq.stats.Suppressed++
+	if !irq.pending {
+		irq.pending = true
+		irq.clock.AfterFunc(irq.limitWindow.Add(time.Second).Sub(now), irq.coalesced)
+	}
+	return false
+}
+
+// coalesced dispatches the event coalesced from those suppressed by the rate
+// limit.
+func (irq *interrupt) coalesced() {
+	irq.mu.Lock()
+	irq.pending = false
+	if irq.released {
+		irq.mu.Unlock()
+		return
+	}
+	irq.limitWindow = irq.clock.Now()
+	irq.limitCount = 1
+	irq.mu.Unlock()
+	go irq.handler(irq.pin)
+}
+
 func closeInterrupts() {
 	watcher := defaultWatcher
 	if watcher == nil {
@@ -160,8 +472,8 @@ func (w *Watcher) Close() {
 	unix.Write(w.donefds[1], []byte("bye"))
 	for fd := range w.interrupts {
 		intr := w.interrupts[fd]
-		intr.valueFile.Close()
-		unexport(intr.pin)
+		logDebug("releasing watch", "pin", intr.pin.pin)
+		intr.release()
 	}
 	w.interrupts = nil
 	w.interruptFds = nil
@@ -174,24 +486,51 @@ func (w *Watcher) Close() {
 //
 // The pin can only be registered once.  Subsequent registers,
 // without an Unregister, will return an error.
-func (w *Watcher) RegisterPin(pin *Pin, edge Edge, handler func(*Pin)) (err error) {
+//
+// The watch may be customised by providing options, e.g. WithFilter.
+func (w *Watcher) RegisterPin(pin *Pin, edge Edge, handler func(*Pin), options ...WatchOption) (err error) {
 	w.Lock()
 	defer w.Unlock()
 
-	_, ok := w.interruptFds[pin.pin]
+	_, ok := w.interruptFds[pin.id()]
 	if ok {
 		return ErrBusy
 	}
-	if err = export(pin); err != nil {
-		return err
+	intr := &interrupt{pin: pin, handler: handler, clock: clock.Real}
+	for _, option := range options {
+		option(intr)
+	}
+	if pin.line == nil && intr.adopt && isExported(pin) {
+		if edge, err = adoptExport(intr, edge); err != nil {
+			return err
+		}
+	}
+	if edge != EdgeBoth {
+		intr.dedup = false
+	}
+	intr.lastLevel = pin.level()
+	if pin.line != nil {
+		return w.registerLine(intr, edge)
+	}
+	if !intr.adopted {
+		if err = export(pin); err != nil {
+			return err
+		}
 	}
 	defer func() {
-		if err != nil {
+		if err == nil {
+			return
+		}
+		if intr.adopted {
+			intr.releaseAdopted()
+		} else {
 			unexport(pin)
 		}
 	}()
-	if err = setEdge(pin, edge); err != nil {
-		return err
+	if edge != intr.adoptedEdge {
+		if err = setEdge(pin, edge); err != nil {
+			return err
+		}
 	}
 	valueFile, err := openValue(pin)
 	if err != nil {
@@ -207,29 +546,397 @@ func (w *Watcher) RegisterPin(pin *Pin, edge Edge, handler func(*Pin)) (err erro
 	if err := unix.EpollCtl(w.epfd, unix.EPOLL_CTL_ADD, pinFd, &event); err != nil {
 		return err
 	}
-	w.interruptFds[pin.pin] = pinFd
-	w.interrupts[pinFd] = &interrupt{pin: pin, handler: handler, valueFile: valueFile}
+	intr.valueFile = valueFile
+	w.interruptFds[pin.id()] = pinFd
+	w.interrupts[pinFd] = intr
 	return nil
 }
 
+// registerLine creates a watch on a pin using the character device.
+//
+// Assumes the caller holds the lock.
+func (w *Watcher) registerLine(intr *interrupt, edge Edge) error {
+	pin := intr.pin
+	handler := intr.handler
+	if edge == EdgeNone {
+		// No events are requested, so the line handle is retained and
+		// is not added to the epoll.
+		pinFd := pin.line.fd
+		w.interruptFds[pin.id()] = pinFd
+		w.interrupts[pinFd] = intr
+		if handler != nil {
+			go handler(pin)
+		}
+		return nil
+	}
+	pinFd, err := pin.line.watch(edge, pin.shadow)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			pin.line.unwatch(pin.shadow)
+		}
+	}()
+	if err = unix.SetNonblock(pinFd, true); err != nil {
+		return err
+	}
+	event := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(pinFd)}
+	if err = unix.EpollCtl(w.epfd, unix.EPOLL_CTL_ADD, pinFd, &event); err != nil {
+		return err
+	}
+	w.interruptFds[pin.id()] = pinFd
+	w.interrupts[pinFd] = intr
+	// Unlike sysfs, the character device does not provide an initial event,
+	// so call the handler to sync to the current state.
+	if handler != nil {
+		go handler(pin)
+	}
+	return nil
+}
+
+// release returns the pin to its unwatched state.
+func (intr *interrupt) release() {
+	intr.mu.Lock()
+	intr.released = true
+	intr.mu.Unlock()
+	if intr.pin.line != nil {
+		intr.pin.line.unwatch(intr.pin.shadow)
+		return
+	}
+	intr.valueFile.Close()
+	if intr.adopted {
+		intr.releaseAdopted()
+		return
+	}
+	unexport(intr.pin)
+}
+
+// adoptExport adopts the existing sysfs export of the pin, returning the
+// edge to watch.
+func adoptExport(intr *interrupt, edge Edge) (Edge, error) {
+	pin := intr.pin
+	logDebug("adopting sysfs export", "pin", pin.pin)
+	if err := waitExported(pin); err != nil {
+		return edge, err
+	}
+	current, err := readSysfs(pin, "edge")
+	if err != nil {
+		return edge, err
+	}
+	intr.adopted = true
+	intr.adoptedEdge = Edge(current)
+	if intr.adoptedEdge == EdgeNone {
+		return edge, nil
+	}
+	return intr.adoptedEdge, nil
+}
+
+// releaseAdopted restores the edge of an adopted export, if it was changed by
+// the watch.
+func (intr *interrupt) releaseAdopted() {
+	if intr.adoptedEdge != EdgeNone {
+		return
+	}
+	if err := setEdge(intr.pin, EdgeNone); err != nil {
+		logWarn("restoring adopted edge failed", "pin", intr.pin.pin, "err", err)
+	}
+}
+
 // UnregisterPin removes any watch on the Pin.
 func (w *Watcher) UnregisterPin(pin *Pin) {
 	w.Lock()
 	defer w.Unlock()
 
-	pinFd, ok := w.interruptFds[pin.pin]
+	pinFd, ok := w.interruptFds[pin.id()]
 	if !ok {
 		return
 	}
-	delete(w.interruptFds, pin.pin)
+	delete(w.interruptFds, pin.id())
 	unix.EpollCtl(w.epfd, unix.EPOLL_CTL_DEL, pinFd, nil)
 	unix.SetNonblock(pinFd, false)
 	intr, ok := w.interrupts[pinFd]
+	if !ok {
+		return
+	}
+	delete(w.interrupts, pinFd)
+	intr.release()
+}
+
+// WatchStats contains the statistics for the handler invocations on a pin.
+//
+// Statistics, other than Suppressed, are only collected while the watcher
+// is instrumented.
+type WatchStats struct {
+	// Events is the number of handler invocations.
+	Events uint64
+
+	// Rate is the number of events in the most recently completed one second
+	// interval.
+	Rate uint64
+
+	// Latency is the time from the edge to the handler being invoked, for
+	// the most recent event.
+	//
+	// For pins watched via the character device the edge time is the kernel
+	// event timestamp.  For sysfs the edge time is not available, so the
+	// latency is measured from the watcher waking.
+	Latency time.Duration
+
+	// MaxLatency is the maximum Latency seen.
+	MaxLatency time.Duration
+
+	// TotalLatency is the sum of the Latency of all events.
+	TotalLatency time.Duration
+
+	// Duration is the time spent in the handler for the most recent event.
+	Duration time.Duration
+
+	// MaxDuration is the maximum Duration seen.
+	MaxDuration time.Duration
+
+	// TotalDuration is the sum of the Duration of all events.
+	TotalDuration time.Duration
+
+	// Suppressed is the number of events suppressed by WithMaxRate.
+	//
+	// This is counted whether or not the watcher is instrumented.
+	Suppressed uint64
+
+	// Stages contains the statistics for each stage of the pipeline set by
+	// WithPipeline, if any.
+	//
+	// These are counted whether or not the watcher is instrumented.
+	Stages []StageStats
+}
+
+// WatchEvent describes a single instrumented handler invocation.
+type WatchEvent struct {
+	// Pin is the pin that triggered the handler.
+	Pin *Pin
+
+	// Latency is the time from the edge to the handler being invoked.
+	Latency time.Duration
+
+	// Duration is the time spent in the handler.
+	Duration time.Duration
+}
+
+// Instrument enables the collection of statistics on handler invocations.
+//
+// If callback is not nil then it is called after each handler invocation,
+// from the goroutine that called the handler.
+// Instrumentation adds a small overhead, so is disabled by default.
+func (w *Watcher) Instrument(callback func(WatchEvent)) {
+	w.Lock()
+	w.instrumented = true
+	w.onEvent = callback
+	w.Unlock()
+}
+
+// Stats returns the statistics for the watch on the pin.
+//
+// Returns false if the pin is not watched.
+func (w *Watcher) Stats(pin *Pin) (WatchStats, bool) {
+	w.Lock()
+	var intr *interrupt
+	pinFd, ok := w.interruptFds[pin.id()]
 	if ok {
-		delete(w.interrupts, pinFd)
-		intr.valueFile.Close()
+		intr, ok = w.interrupts[pinFd]
+	}
+	w.Unlock()
+	if !ok {
+		return WatchStats{}, false
+	}
+	intr.mu.Lock()
+	stats := intr.stats
+	intr.mu.Unlock()
+	if intr.pipeline != nil {
+		stats.Stages = intr.pipeline.Stats()
+	}
+	return stats, true
+}
+
+// Instrument enables the collection of statistics on handler invocations by
+// the default watcher, as per Watcher.Instrument.
+func Instrument(callback func(WatchEvent)) {
+	getDefaultWatcher().Instrument(callback)
+}
+
+// WatchStats returns the statistics for the watch on the pin.
+//
+// Returns false if the pin is not watched.
+func (p *Pin) WatchStats() (WatchStats, bool) {
+	return getDefaultWatcher().Stats(p)
+}
+
+// instrumentedHandler calls the handler and records the statistics for the
+// invocation.
+//
+// The edge is the time of the edge in nanoseconds on the monotonic clock.
+func (intr *interrupt) instrumentedHandler(edge uint64, onEvent func(WatchEvent)) {
+	start := intr.clock.Now()
+	latency := sinceEdge(edge)
+	intr.handler(intr.pin)
+	duration := intr.clock.Now().Sub(start)
+	intr.mu.Lock()
+	st := &intr.stats
+	st.Events++
+	st.Latency = latency
+	st.TotalLatency += latency
+	if latency > st.MaxLatency {
+		st.MaxLatency = latency
+	}
+	st.Duration = duration
+	st.TotalDuration += duration
+	if duration > st.MaxDuration {
+		st.MaxDuration = duration
+	}
+	if d := start.Sub(intr.window); d >= time.Second {
+		if d < 2*time.Second {
+			st.Rate = intr.windowCount
+		} else {
+			st.Rate = 0
+		}
+		intr.window = start
+		intr.windowCount = 0
+	}
+	intr.windowCount++
+	intr.mu.Unlock()
+	if onEvent != nil {
+		onEvent(WatchEvent{intr.pin, latency, duration})
+	}
+}
+
+// sinceEdge returns the time elapsed since the edge.
+func sinceEdge(edge uint64) time.Duration {
+	now := monotonicNow()
+	if edge > now {
+		// kernels prior to v5.7 timestamp events with the realtime clock.
+		now = uint64(time.Now().UnixNano())
+	}
+	return time.Duration(int64(now - edge))
+}
+
+// monotonicNow returns the current time in nanoseconds on the monotonic clock,
+// as used for character device event timestamps.
+func monotonicNow() uint64 {
+	var ts unix.Timespec
+	unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts)
+	return uint64(ts.Nano())
+}
+
+// EdgeCounter counts the edges on a pin.
+//
+// The edges are counted by the watcher, without calling a handler, so
+// counting is cheap.  Edges on pins watched via the character device are
+// counted exactly, as the kernel queues the events.  Sysfs only indicates
+// that at least one edge has occurred, so edges may be missed at high rates.
+type EdgeCounter struct {
+	// first to ensure 64-bit alignment for atomic access.
+	count uint64
+	pin   *Pin
+}
+
+// EdgeCounter creates an EdgeCounter for the edge on the pin.
+//
+// The counter holds the watch on the pin, so the pin cannot be otherwise
+// watched until the counter is closed.
+func (p *Pin) EdgeCounter(edge Edge) (*EdgeCounter, error) {
+	c := &EdgeCounter{pin: p}
+	watcher := getDefaultWatcher()
+	err := watcher.RegisterPin(p, edge, nil, func(intr *interrupt) {
+		intr.counter = c
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Count returns the number of edges counted.
+func (c *EdgeCounter) Count() uint64 {
+	return atomic.LoadUint64(&c.count)
+}
+
+// Reset zeroes the count, and returns the count prior to the reset.
+func (c *EdgeCounter) Reset() uint64 {
+	return atomic.SwapUint64(&c.count, 0)
+}
+
+// Close stops counting and removes the watch from the pin.
+func (c *EdgeCounter) Close() {
+	c.pin.Unwatch()
+}
+
+// Latch records whether an edge has occurred on a pin.
+//
+// The latch is set by the watcher, so pulses shorter than the interval
+// between checks are caught, unlike polling the pin level with Read.
+type Latch struct {
+	occurred uint32
+	pin      *Pin
+}
+
+// Latch creates a Latch for the edge on the pin.
+//
+// The latch holds the watch on the pin, so the pin cannot be otherwise
+// watched until the latch is closed.
+func (p *Pin) Latch(edge Edge) (*Latch, error) {
+	l := &Latch{pin: p}
+	watcher := getDefaultWatcher()
+	err := watcher.RegisterPin(p, edge, nil, func(intr *interrupt) {
+		intr.latch = l
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Occurred returns true if an edge has occurred since the latch was created
+// or last cleared.
+func (l *Latch) Occurred() bool {
+	return atomic.LoadUint32(&l.occurred) != 0
+}
+
+// Clear clears the latch, and returns true if an edge had occurred prior to
+// the clear.
+//
+// An edge occurring concurrently with the clear is reported either by the
+// clear or by the next check, so is never missed.
+func (l *Latch) Clear() bool {
+	return atomic.SwapUint32(&l.occurred, 0) != 0
+}
+
+// Close stops latching and removes the watch from the pin.
+func (l *Latch) Close() {
+	l.pin.Unwatch()
+}
+
+// WatchEvents calls the handler with each edge event on the pin.
+//
+// Unlike Watch, the handler is passed the level and time of each edge, and
+// is called from the watcher goroutine, in order, so it must be quick and must
+// not block.  No initial call is made to sync to the current level.
+//
+// For pins watched via the character device each edge is reported, with its
+// kernel timestamp.  Sysfs only indicates that at least one edge has
+// occurred, so edges may be missed, and the level and time are read when the
+// watcher wakes.
+//
+// The edge handler may be combined with options, e.g. WithFilter.
+func (p *Pin) WatchEvents(edge Edge, handler func(Event), options ...WatchOption) error {
+	watcher := getDefaultWatcher()
+	return watcher.RegisterPin(p, edge, nil, append(options, withEdgeHandler(handler))...)
+}
+
+// withEdgeHandler sets the handler called from the watcher goroutine for each
+// edge event.
+func withEdgeHandler(handler func(Event)) WatchOption {
+	return func(intr *interrupt) {
+		intr.onEdge = handler
 	}
-	unexport(pin)
 }
 
 // Watch the pin for changes to level.
@@ -238,9 +945,19 @@ func (w *Watcher) UnregisterPin(pin *Pin) {
 // with the current level, and then on the specified edges.
 // The edge determines which edge to watch.
 // There can only be one watcher on the pin at a time.
-func (p *Pin) Watch(edge Edge, handler func(*Pin)) error {
+//
+// The handler is passed the triggering pin, which may be asserted to a *Pin.
+func (p *Pin) Watch(edge Edge, handler func(Pinner)) error {
+	return p.WatchWith(edge, handler)
+}
+
+// WatchWith watches the pin for changes to level, as per Watch, with the watch
+// customised by the options, e.g. WithFilter.
+func (p *Pin) WatchWith(edge Edge, handler func(Pinner), options ...WatchOption) error {
 	watcher := getDefaultWatcher()
-	return watcher.RegisterPin(p, edge, handler)
+	return watcher.RegisterPin(p, edge, func(pin *Pin) {
+		handler(pin)
+	}, options...)
 }
 
 // Unwatch removes any watch from the pin.
@@ -249,43 +966,83 @@ func (p *Pin) Unwatch() {
 	watcher.UnregisterPin(p)
 }
 
-func waitWriteable(path string) error {
-	try := 0
-	for unix.Access(path, unix.W_OK) != nil {
-		try++
-		if try > 10 {
+// exportTimeout is the maximum time to wait for the sysfs files of a pin to
+// become accessible after it is exported.
+var exportTimeout = int64(time.Second)
+
+// retryAccess calls fn until it succeeds, fails with an error that is not
+// retryable, or the export timeout expires, with an exponential backoff
+// between attempts.
+//
+// This absorbs the window after export where the sysfs files exist but udev
+// has not yet applied the rules that make them accessible.
+func retryAccess(path string, retryable func(error) bool, fn func() error) error {
+	deadline := time.Now().Add(time.Duration(atomic.LoadInt64(&exportTimeout)))
+	delay := time.Millisecond
+	for try := 1; ; try++ {
+		err := fn()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			logWarn("sysfs access timed out", "path", path, "err", err)
 			return ErrTimeout
 		}
-		time.Sleep(50 * time.Millisecond)
+		logDebug("waiting for sysfs access", "path", path, "try", try, "err", err)
+		time.Sleep(delay)
+		if delay *= 2; delay > 100*time.Millisecond {
+			delay = 100 * time.Millisecond
+		}
 	}
-	return nil
+}
+
+func waitWriteable(path string) error {
+	return retryAccess(path, func(error) bool { return true }, func() error {
+		return unix.Access(path, unix.W_OK)
+	})
 }
 
 func export(p *Pin) error {
-	file, err := os.OpenFile("/sys/class/gpio/export", os.O_WRONLY, os.ModeExclusive)
+	file, err := os.OpenFile(filepath.Join(sysfsRoot, "export"), os.O_WRONLY, os.ModeExclusive)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 	_, err = file.WriteString(strconv.Itoa(int(p.pin)))
 	if e, ok := err.(*os.PathError); ok && e.Err == unix.EBUSY {
-		return ErrBusy
+		if adopting() && isExported(p) && isStale(p.pin) {
+			// left exported by a previous run, so adopt it.
+			logDebug("adopting sysfs export", "pin", p.pin)
+			err = waitExported(p)
+		} else {
+			return ErrBusy
+		}
+	} else if err == nil {
+		// wait for pin to be exported on sysfs - can take > 100ms on older Pis
+		err = waitExported(p)
 	}
-	if err != nil {
-		return err
+	if err == nil {
+		recordExport(p.pin, true)
 	}
-	// wait for pin to be exported on sysfs - can take > 100ms on older Pis
-	return waitExported(p)
+	return err
 }
 
-func openValue(p *Pin) (*os.File, error) {
-	path := fmt.Sprintf("/sys/class/gpio/gpio%v/value", p.pin)
-	return os.OpenFile(path, os.O_RDWR, os.ModeExclusive)
+func openValue(p *Pin) (f *os.File, err error) {
+	path := filepath.Join(sysfsPath(p), "value")
+	err = retryAccess(path, os.IsPermission, func() error {
+		f, err = os.OpenFile(path, os.O_RDWR, os.ModeExclusive)
+		return err
+	})
+	return f, err
 }
 
 func setEdge(p *Pin, edge Edge) error {
-	path := fmt.Sprintf("/sys/class/gpio/gpio%v/edge", p.pin)
-	file, err := os.OpenFile(path, os.O_RDWR, os.ModeExclusive)
+	path := filepath.Join(sysfsPath(p), "edge")
+	var file *os.File
+	err := retryAccess(path, os.IsPermission, func() (err error) {
+		file, err = os.OpenFile(path, os.O_RDWR, os.ModeExclusive)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -295,23 +1052,24 @@ func setEdge(p *Pin, edge Edge) error {
 }
 
 func unexport(p *Pin) error {
-	file, err := os.OpenFile("/sys/class/gpio/unexport", os.O_WRONLY, os.ModeExclusive)
+	file, err := os.OpenFile(filepath.Join(sysfsRoot, "unexport"), os.O_WRONLY, os.ModeExclusive)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 	_, err = file.WriteString(strconv.Itoa(int(p.pin)))
+	if err == nil {
+		recordExport(p.pin, false)
+	}
 	return err
 }
 
 // Wait for the sysfs GPIO files to become writable.
 func waitExported(p *Pin) error {
-	path := fmt.Sprintf("/sys/class/gpio/gpio%v/value", p.pin)
-	if err := waitWriteable(path); err != nil {
+	if err := waitWriteable(filepath.Join(sysfsPath(p), "value")); err != nil {
 		return err
 	}
-	path = fmt.Sprintf("/sys/class/gpio/gpio%v/edge", p.pin)
-	return waitWriteable(path)
+	return waitWriteable(filepath.Join(sysfsPath(p), "edge"))
 }
 
 var (
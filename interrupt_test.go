@@ -3,6 +3,8 @@
 // Use of this source code is governed by an MIT-style
 // license that can be found in the LICENSE file.
 
+// +build linux
+
 //
 // Test suite for interrupt module.
 //
@@ -12,10 +14,15 @@ package gpio
 
 import (
 	"errors"
+	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio/clock"
+	"golang.org/x/sys/unix"
 )
 
 func waitInterrupt(ch chan int, timeout time.Duration) (int, error) {
@@ -29,8 +36,11 @@ func waitInterrupt(ch chan int, timeout time.Duration) (int, error) {
 
 func setupIntr(t *testing.T) (pinIn *Pin, pinOut *Pin, watcher *Watcher) {
 	assert.Nil(t, Open())
-	pinIn = NewPin(J8p15)
-	pinOut = NewPin(J8p16)
+	var err error
+	pinIn, err = NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err = NewPin(J8p16)
+	assert.Nil(t, err)
 	watcher = getDefaultWatcher()
 	pinIn.SetMode(Input)
 	pinOut.Write(Low)
@@ -254,13 +264,14 @@ func TestCloseInterrupts(t *testing.T) {
 func TestWatchExists(t *testing.T) {
 	assert.Nil(t, Open())
 	defer Close()
-	pinIn := NewPin(J8p15)
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
 	pinIn.SetMode(Input)
 	count := 0
-	assert.Nil(t, pinIn.Watch(EdgeFalling, func(pin *Pin) {
+	assert.Nil(t, pinIn.Watch(EdgeFalling, func(pin Pinner) {
 		count++
 	}))
-	assert.NotNil(t, pinIn.Watch(EdgeFalling, func(pin *Pin) {
+	assert.NotNil(t, pinIn.Watch(EdgeFalling, func(pin Pinner) {
 		count++
 	}))
 	time.Sleep(2 * time.Millisecond)
@@ -274,8 +285,10 @@ func TestWatchExists(t *testing.T) {
 func TestWatchLooped(t *testing.T) {
 	assert.Nil(t, Open())
 	defer Close()
-	pinIn := NewPin(J8p15)
-	pinOut := NewPin(J8p16)
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(t, err)
 	pinIn.SetMode(Input)
 	defer pinOut.SetMode(Input)
 	pinOut.Write(Low)
@@ -283,7 +296,7 @@ func TestWatchLooped(t *testing.T) {
 	mode := pinOut.Mode()
 	assert.Equal(t, Output, mode)
 	called := false
-	assert.Nil(t, pinIn.Watch(EdgeFalling, func(pin *Pin) {
+	assert.Nil(t, pinIn.Watch(EdgeFalling, func(pin Pinner) {
 		called = true
 	}))
 	time.Sleep(2 * time.Millisecond)
@@ -303,6 +316,236 @@ func TestWatchLooped(t *testing.T) {
 	assert.False(t, called)
 }
 
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestWatchFilterLooped(t *testing.T) {
+	assert.Nil(t, Open())
+	defer Close()
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(t, err)
+	pinIn.SetMode(Input)
+	defer pinOut.SetMode(Input)
+	pinOut.Write(Low)
+	pinOut.SetMode(Output)
+	var armed int32
+	ich := make(chan Level, 3)
+	assert.Nil(t, pinIn.WatchWith(EdgeBoth, func(pin Pinner) {
+		ich <- pin.Read()
+	}, WithFilter(func(evt Event) bool {
+		assert.Equal(t, pinIn, evt.Pin)
+		assert.False(t, evt.Time.IsZero())
+		return atomic.LoadInt32(&armed) != 0
+	})))
+	defer pinIn.Unwatch()
+	// initial sync is not filtered
+	select {
+	case <-ich:
+	case <-time.After(10 * time.Millisecond):
+		t.Error("missed sync")
+	}
+	time.Sleep(5 * time.Millisecond)
+	pinOut.High()
+	select {
+	case <-ich:
+		t.Error("filtered event dispatched")
+	case <-time.After(10 * time.Millisecond):
+	}
+	atomic.StoreInt32(&armed, 1)
+	pinOut.Low()
+	select {
+	case v := <-ich:
+		assert.Equal(t, Low, v)
+	case <-time.After(10 * time.Millisecond):
+		t.Error("missed event")
+	}
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestWatchMaxRateLooped(t *testing.T) {
+	assert.Nil(t, Open())
+	defer Close()
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(t, err)
+	pinIn.SetMode(Input)
+	defer pinOut.SetMode(Input)
+	pinOut.Write(Low)
+	pinOut.SetMode(Output)
+	ich := make(chan Level, 10)
+	assert.Nil(t, pinIn.WatchWith(EdgeBoth, func(pin Pinner) {
+		ich <- pin.Read()
+	}, WithMaxRate(2)))
+	defer pinIn.Unwatch()
+	<-ich // initial sync
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		pinOut.Toggle()
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 2 events, the remainder suppressed.
+	assert.Equal(t, 2, len(ich))
+	st, ok := pinIn.WatchStats()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), st.Suppressed)
+	<-ich
+	<-ich
+	// and coalesced into one event in the next second.
+	select {
+	case v := <-ich:
+		assert.Equal(t, High, v)
+	case <-time.After(1100 * time.Millisecond):
+		t.Error("missed coalesced event")
+	}
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestEdgeCounterLooped(t *testing.T) {
+	assert.Nil(t, Open())
+	defer Close()
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(t, err)
+	pinIn.SetMode(Input)
+	defer pinOut.SetMode(Input)
+	pinOut.Write(Low)
+	pinOut.SetMode(Output)
+	c, err := pinIn.EdgeCounter(EdgeRising)
+	assert.Nil(t, err)
+	defer c.Close()
+	_, err = pinIn.EdgeCounter(EdgeRising)
+	assert.Equal(t, ErrBusy, err)
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, uint64(0), c.Count())
+	for i := 0; i < 3; i++ {
+		pinOut.High()
+		time.Sleep(2 * time.Millisecond)
+		pinOut.Low()
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(3), c.Count())
+	assert.Equal(t, uint64(3), c.Reset())
+	assert.Equal(t, uint64(0), c.Count())
+	c.Close()
+	pinOut.High()
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, uint64(0), c.Count())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestLatchLooped(t *testing.T) {
+	assert.Nil(t, Open())
+	defer Close()
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(t, err)
+	pinIn.SetMode(Input)
+	defer pinOut.SetMode(Input)
+	pinOut.Write(Low)
+	pinOut.SetMode(Output)
+	l, err := pinIn.Latch(EdgeRising)
+	assert.Nil(t, err)
+	defer l.Close()
+	_, err = pinIn.Latch(EdgeRising)
+	assert.Equal(t, ErrBusy, err)
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, l.Occurred())
+	// a pulse between checks is caught.
+	pinOut.High()
+	pinOut.Low()
+	time.Sleep(2 * time.Millisecond)
+	assert.True(t, l.Occurred())
+	assert.True(t, l.Occurred())
+	assert.True(t, l.Clear())
+	assert.False(t, l.Occurred())
+	assert.False(t, l.Clear())
+	l.Close()
+	pinOut.High()
+	time.Sleep(2 * time.Millisecond)
+	assert.False(t, l.Occurred())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestWatchEventsLooped(t *testing.T) {
+	assert.Nil(t, Open())
+	defer Close()
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(t, err)
+	pinIn.SetMode(Input)
+	defer pinOut.SetMode(Input)
+	pinOut.Write(Low)
+	pinOut.SetMode(Output)
+	ech := make(chan Event, 10)
+	err = pinIn.WatchEvents(EdgeBoth, func(evt Event) {
+		ech <- evt
+	})
+	assert.Nil(t, err)
+	defer pinIn.Unwatch()
+	// no initial event
+	select {
+	case <-ech:
+		t.Error("unexpected initial event")
+	case <-time.After(5 * time.Millisecond):
+	}
+	start := time.Now()
+	for i, expected := range []Level{High, Low, High} {
+		pinOut.Toggle()
+		select {
+		case evt := <-ech:
+			assert.Equal(t, pinIn, evt.Pin, i)
+			assert.Equal(t, expected, evt.Level, i)
+			assert.True(t, !evt.Time.Before(start), i)
+			start = evt.Time
+		case <-time.After(10 * time.Millisecond):
+			t.Error("missed event", i)
+		}
+	}
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestInstrumentLooped(t *testing.T) {
+	assert.Nil(t, Open())
+	defer Close()
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(t, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(t, err)
+	pinIn.SetMode(Input)
+	defer pinOut.SetMode(Input)
+	pinOut.Write(Low)
+	pinOut.SetMode(Output)
+	_, ok := pinIn.WatchStats()
+	assert.False(t, ok)
+	ech := make(chan WatchEvent, 3)
+	Instrument(func(e WatchEvent) {
+		ech <- e
+	})
+	assert.Nil(t, pinIn.Watch(EdgeBoth, func(pin Pinner) {
+		time.Sleep(time.Millisecond)
+	}))
+	defer pinIn.Unwatch()
+	time.Sleep(5 * time.Millisecond)
+	pinOut.High()
+	select {
+	case e := <-ech:
+		assert.Equal(t, pinIn, e.Pin)
+		assert.True(t, e.Duration >= time.Millisecond)
+		assert.True(t, e.Latency > 0)
+	case <-time.After(10 * time.Millisecond):
+		t.Error("missed event")
+	}
+	st, ok := pinIn.WatchStats()
+	assert.True(t, ok)
+	assert.NotZero(t, st.Events)
+	assert.True(t, st.MaxDuration >= time.Millisecond)
+	assert.True(t, st.TotalLatency >= st.Latency)
+}
+
 // This provides a coarse estimate of the interrupt latency,
 // i.e. the time between an interrupt being triggered and handled.
 // There is some overhead in there due to the handshaking via a channel etc...
@@ -310,8 +553,10 @@ func TestWatchLooped(t *testing.T) {
 func BenchmarkInterruptLatency(b *testing.B) {
 	assert.Nil(b, Open())
 	defer Close()
-	pinIn := NewPin(J8p15)
-	pinOut := NewPin(J8p16)
+	pinIn, err := NewPin(J8p15)
+	assert.Nil(b, err)
+	pinOut, err := NewPin(J8p16)
+	assert.Nil(b, err)
 	pinIn.SetMode(Input)
 	defer pinOut.SetMode(Input)
 	pinOut.Write(Low)
@@ -319,7 +564,7 @@ func BenchmarkInterruptLatency(b *testing.B) {
 	mode := pinOut.Mode()
 	assert.Equal(b, Output, mode)
 	ich := make(chan int)
-	assert.Nil(b, pinIn.Watch(EdgeBoth, func(pin *Pin) {
+	assert.Nil(b, pinIn.Watch(EdgeBoth, func(pin Pinner) {
 		ich <- 1
 	}))
 	defer pinIn.Unwatch()
@@ -328,3 +573,158 @@ func BenchmarkInterruptLatency(b *testing.B) {
 		<-ich
 	}
 }
+
+func TestRetryAccess(t *testing.T) {
+	old := atomic.SwapInt64(&exportTimeout, int64(100*time.Millisecond))
+	defer atomic.StoreInt64(&exportTimeout, old)
+
+	// succeeds once permissions are granted.
+	tries := 0
+	err := retryAccess("value", os.IsPermission, func() error {
+		tries++
+		if tries < 3 {
+			return &os.PathError{Op: "open", Path: "value", Err: unix.EACCES}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, tries)
+
+	// other errors are returned immediately.
+	tries = 0
+	err = retryAccess("value", os.IsPermission, func() error {
+		tries++
+		return os.ErrNotExist
+	})
+	assert.Equal(t, os.ErrNotExist, err)
+	assert.Equal(t, 1, tries)
+
+	// times out if permissions are never granted.
+	start := time.Now()
+	err = retryAccess("value", os.IsPermission, func() error {
+		return &os.PathError{Op: "open", Path: "value", Err: unix.EACCES}
+	})
+	assert.Equal(t, ErrTimeout, err)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestDedupEdgeEvent(t *testing.T) {
+	var levels []Level
+	intr := &interrupt{
+		dedup:     true,
+		lastLevel: Low,
+		onEdge: func(evt Event) {
+			levels = append(levels, evt.Level)
+		},
+	}
+	for _, l := range []Level{Low, High, High, Low, Low, Low, High} {
+		intr.edgeEvent(Event{Level: l})
+	}
+	assert.Equal(t, []Level{High, Low, High}, levels)
+
+	// without dedup all events are passed through.
+	levels = nil
+	intr.dedup = false
+	for _, l := range []Level{High, High} {
+		intr.edgeEvent(Event{Level: l})
+	}
+	assert.Equal(t, []Level{High, High}, levels)
+}
+
+func TestWatchClockMaxRate(t *testing.T) {
+	c := clock.NewFake(time.Unix(1000, 0))
+	calls := make(chan struct{}, 10)
+	intr := &interrupt{
+		pin:     &Pin{pin: 4},
+		maxRate: 2,
+		clock:   c,
+		handler: func(*Pin) {
+			calls <- struct{}{}
+		},
+	}
+	assert.True(t, intr.allow())
+	c.Advance(100 * time.Millisecond)
+	assert.True(t, intr.allow())
+	assert.False(t, intr.allow())
+	assert.False(t, intr.allow())
+	assert.Equal(t, uint64(2), intr.stats.Suppressed)
+	// a single coalesced event at the start of the next window.
+	assert.Equal(t, 1, c.Pending())
+	c.Advance(899 * time.Millisecond)
+	assert.Equal(t, 0, len(calls))
+	c.Advance(time.Millisecond)
+	select {
+	case <-calls:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for coalesced event")
+	}
+	// which counts towards the new window.
+	assert.True(t, intr.allow())
+	assert.False(t, intr.allow())
+	intr.mu.Lock()
+	intr.released = true
+	intr.mu.Unlock()
+	c.Advance(time.Second)
+	assert.Equal(t, 0, len(calls))
+}
+
+func TestWatchClockDebounce(t *testing.T) {
+	c := clock.NewFake(time.Unix(1000, 0))
+	var levels []Level
+	intr := &interrupt{
+		clock:    c,
+		pipeline: NewPipeline(Debounce(10 * time.Millisecond)).Filter(),
+		onEdge: func(evt Event) {
+			levels = append(levels, evt.Level)
+		},
+	}
+	edges := []struct {
+		after time.Duration
+		level Level
+	}{
+		{0, High},
+		{2 * time.Millisecond, Low},
+		{7 * time.Millisecond, High},
+		{time.Millisecond, Low},
+		{20 * time.Millisecond, High},
+	}
+	for _, e := range edges {
+		c.Advance(e.after)
+		// the kernel timestamp is ignored with a fake clock.
+		evt := Event{Level: e.level, Time: intr.eventTime(monotonicNow())}
+		assert.Equal(t, c.Now(), evt.Time)
+		intr.edgeEvent(evt)
+	}
+	assert.Equal(t, []Level{High, Low, High}, levels)
+
+	// but is used with the real clock.
+	intr.clock = clock.Real
+	edge := monotonicNow() - uint64(time.Second)
+	d := time.Since(intr.eventTime(edge))
+	assert.True(t, d >= time.Second, d)
+	assert.True(t, d < 2*time.Second, d)
+}
+
+func TestWatchClockInstrument(t *testing.T) {
+	c := clock.NewFake(time.Unix(1000, 0))
+	intr := &interrupt{
+		pin:   &Pin{pin: 4},
+		clock: c,
+		handler: func(*Pin) {
+			c.Advance(3 * time.Millisecond)
+		},
+	}
+	var evts []WatchEvent
+	onEvent := func(evt WatchEvent) {
+		evts = append(evts, evt)
+	}
+	intr.instrumentedHandler(monotonicNow(), onEvent)
+	intr.instrumentedHandler(monotonicNow(), onEvent)
+	st := intr.stats
+	assert.Equal(t, uint64(2), st.Events)
+	assert.Equal(t, 3*time.Millisecond, st.Duration)
+	assert.Equal(t, 3*time.Millisecond, st.MaxDuration)
+	assert.Equal(t, 6*time.Millisecond, st.TotalDuration)
+	require.Equal(t, 2, len(evts))
+	assert.Equal(t, 3*time.Millisecond, evts[1].Duration)
+}
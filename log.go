@@ -0,0 +1,45 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+// leveledLogger is the subset of the slog.Logger API used by the package.
+//
+// This allows the package to log without depending on log/slog, which
+// requires Go 1.21.
+type leveledLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// logger is the logger for notable internal events, or nil if logging is
+// disabled, which is the default.
+var logger leveledLogger
+
+func logDebug(msg string, args ...interface{}) {
+	if l := logger; l != nil {
+		l.Debug(msg, args...)
+	}
+}
+
+func logInfo(msg string, args ...interface{}) {
+	if l := logger; l != nil {
+		l.Info(msg, args...)
+	}
+}
+
+func logWarn(msg string, args ...interface{}) {
+	if l := logger; l != nil {
+		l.Warn(msg, args...)
+	}
+}
+
+func logError(msg string, args ...interface{}) {
+	if l := logger; l != nil {
+		l.Error(msg, args...)
+	}
+}
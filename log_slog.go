@@ -0,0 +1,24 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build go1.21
+
+package gpio
+
+import "log/slog"
+
+// SetLogger sets the logger used for notable internal events, such as
+// falling back from /dev/mem to /dev/gpiomem, sysfs export retries, watcher
+// errors, dropped events, and cleanup actions.
+//
+// Logging is disabled by default, and can be disabled again by passing nil.
+// The logger should be set before calling Open.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		logger = nil
+		return
+	}
+	logger = l
+}
@@ -10,8 +10,9 @@ package gpio
 import (
 	"errors"
 	"os"
-	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -41,19 +42,101 @@ var (
 	memlock sync.Mutex
 	mem     []uint32
 	mem8    []uint8
+
+	// The character device, if used instead of mem.
+	cdev *charDev
+
+	// Additional character devices, opened on demand, keyed by name.
+	chips = map[string]*charDev{}
+
+	// The physical address of the peripherals, if provided to Open.
+	periphBase int64
+
+	// True if Open fell back from /dev/mem to /dev/gpiomem, so the other
+	// peripherals are not accessible.
+	periphUnavailable bool
 )
 
 // Open and memory map GPIO memory range from /dev/gpiomem .
-// Some reflection magic is used to convert it to a unsafe []uint32 pointer
-func Open() (err error) {
-	if len(mem) != 0 {
+// Some unsafe magic is used to convert it to a []uint32.
+//
+// The device and the location of the GPIO registers within it can be
+// overridden using the WithDevice, WithBase and WithGPIOOffset options, e.g. to
+// map the registers from /dev/mem.  If /dev/mem is mapped without a base or
+// offset then the registers are located using the peripheral base from the
+// device tree.
+//
+// Alternatively, if the WithCharDev option is provided, the GPIO character
+// device is opened and used for all pin access instead.
+func Open(options ...OpenOption) error {
+	if len(mem) != 0 || cdev != nil {
 		return ErrAlreadyOpen
 	}
+	cfg := openConfig{device: "/dev/gpiomem", timeout: time.Second}
+	for _, option := range options {
+		option(&cfg)
+	}
+	var err error
+	if cfg.chip != "" {
+		err = openCharDevBackend(cfg.chip)
+	} else {
+		err = openMem(cfg)
+	}
+	if err != nil {
+		return err
+	}
+	// only configure the package once open, so a failed Open has no effect.
+	cfg.apply()
+	return nil
+}
+
+// apply applies the options that configure the package, rather than the
+// backend.
+func (cfg *openConfig) apply() {
+	atomic.StoreInt64(&exportTimeout, int64(cfg.timeout))
+	pinRegistry.configure(cfg.sharing, cfg.conflict)
+	if cfg.strict {
+		atomic.StoreInt32(&strictOutput, 1)
+	}
+	if cfg.reclaim {
+		atomic.StoreInt32(&adoptExports, 1)
+		if pins, err := Reclaim(); err != nil {
+			logWarn("reclaim failed", "err", err)
+		} else if len(pins) > 0 {
+			logWarn("reclaimed stale sysfs exports", "pins", pins)
+		}
+	}
+}
+
+// openMem memory maps the GPIO registers from the device.
+func openMem(cfg openConfig) (err error) {
+	base := cfg.base
+	fallback := false
+	if cfg.device == "/dev/mem" && cfg.base == 0 && cfg.offset == 0 {
+		// locate the GPIO registers from the device tree, or the model.
+		cfg.base = peripheralBase()
+		cfg.offset = gpioOffset
+		logDebug("detected peripheral base", "base", cfg.base)
+	}
+	offset := cfg.base + cfg.offset
+	if offset < 0 || offset%int64(os.Getpagesize()) != 0 {
+		return ErrInvalidAddress
+	}
 	file, err := os.OpenFile(
-		"/dev/gpiomem",
+		cfg.device,
 		os.O_RDWR|os.O_SYNC,
 		0)
 
+	if os.IsPermission(err) && cfg.device == "/dev/mem" {
+		// /dev/mem requires root, so fallback to gpiomem, which only maps
+		// the GPIO registers.
+		logWarn("falling back to /dev/gpiomem", "device", cfg.device, "err", err)
+		offset = 0
+		// the base provided for /dev/mem does not apply to gpiomem.
+		base = 0
+		fallback = true
+		file, err = os.OpenFile("/dev/gpiomem", os.O_RDWR|os.O_SYNC, 0)
+	}
 	if err != nil {
 		return
 	}
@@ -65,7 +148,7 @@ func Open() (err error) {
 	// Memory map GPIO registers to byte array
 	mem8, err = unix.Mmap(
 		int(file.Fd()),
-		0,
+		offset,
 		memLength,
 		unix.PROT_READ|unix.PROT_WRITE,
 		unix.MAP_SHARED)
@@ -74,22 +157,58 @@ func Open() (err error) {
 		return
 	}
 
-	// Convert mapped byte memory to unsafe []uint32 pointer, adjust length as needed
-	header := *(*reflect.SliceHeader)(unsafe.Pointer(&mem8))
-	header.Len /= 4 // (32 bit = 4 bytes)
-	header.Cap /= 4
-
-	mem = *(*[]uint32)(unsafe.Pointer(&header))
+	// Convert mapped byte memory to []uint32 (32 bit = 4 bytes)
+	mem = (*[memLength / 4]uint32)(unsafe.Pointer(&mem8[0]))[:]
 
-	if mem[60] == 0x6770696f {
+	if m, err := DetectModel(); err == nil && m.Chipset != 0 {
+		chipset = m.Chipset
+	} else if mem[60] == 0x6770696f {
 		chipset = BCM2835
 	} else {
 		chipset = BCM2711
 	}
+	periphBase = base
+	periphUnavailable = fallback
+
+	return nil
+}
 
+func openCharDevBackend(chip string) error {
+	c, err := openCharDev(chip)
+	if err != nil {
+		return err
+	}
+	memlock.Lock()
+	cdev = c
+	chipset = c.chipset()
+	memlock.Unlock()
 	return nil
 }
 
+// getCharDev returns the character device identified by name or label,
+// opening it if it is not already open.
+func getCharDev(id string) (*charDev, error) {
+	memlock.Lock()
+	defer memlock.Unlock()
+	if len(mem) == 0 && cdev == nil {
+		panic("GPIO not initialised.")
+	}
+	if cdev != nil && cdev.matches(id) {
+		return cdev, nil
+	}
+	for _, c := range chips {
+		if c.matches(id) {
+			return c, nil
+		}
+	}
+	c, err := findCharDev(id)
+	if err != nil {
+		return nil, err
+	}
+	chips[c.name] = c
+	return c, nil
+}
+
 // Chip identifies the chipset on the system.
 //
 // This is not valid until Open has been called.
@@ -101,7 +220,24 @@ func Chip() Chipset {
 func Close() error {
 	memlock.Lock()
 	defer memlock.Unlock()
+	atomic.StoreInt32(&adoptExports, 0)
+	atomic.StoreInt32(&strictOutput, 0)
+	pinRegistry.configure(ShareIndependent, nil)
+	periphBase = 0
+	periphUnavailable = false
+	closeSubscriptions()
 	closeInterrupts()
+	closeClockMem()
+	for name, c := range chips {
+		logDebug("closing chip", "chip", name)
+		c.close()
+		delete(chips, name)
+	}
+	if cdev != nil {
+		c := cdev
+		cdev = nil
+		return c.close()
+	}
 	mem = make([]uint32, 0)
 	return unix.Munmap(mem8)
 }
@@ -109,4 +245,8 @@ func Close() error {
 var (
 	// ErrAlreadyOpen indicates the mem is already open.
 	ErrAlreadyOpen = errors.New("already open")
+
+	// ErrInvalidAddress indicates the GPIO register address is not page
+	// aligned.
+	ErrInvalidAddress = errors.New("invalid address")
 )
@@ -30,3 +30,16 @@ func TestReOpen(t *testing.T) {
 	assert.Nil(t, gpio.Open())
 	defer gpio.Close()
 }
+
+func TestOpenWithDevice(t *testing.T) {
+	assert.Nil(t, gpio.Open(gpio.WithDevice("/dev/gpiomem")))
+	gpio.Close()
+	assert.NotNil(t, gpio.Open(gpio.WithDevice("/dev/nonexistent")))
+}
+
+func TestOpenInvalidAddress(t *testing.T) {
+	assert.Equal(t, gpio.ErrInvalidAddress, gpio.Open(gpio.WithBase(-4096)))
+	assert.Equal(t, gpio.ErrInvalidAddress, gpio.Open(gpio.WithGPIOOffset(4)))
+	assert.Equal(t, gpio.ErrInvalidAddress,
+		gpio.Open(gpio.WithBase(0x3F000000), gpio.WithGPIOOffset(0x200004)))
+}
@@ -0,0 +1,200 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package mock provides pins that are not backed by hardware.
+//
+// The pins implement gpio.Pinner, so they can be used in place of real pins
+// to test application logic and device drivers, with the level of input pins
+// driven from the test side using Set.
+package mock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// Pin is a pin without any backing hardware.
+//
+// The level of the pin is the latched output level when the pin is an
+// Output, and otherwise the level driven externally using Set.
+//
+// Pin implements gpio.Pinner.
+type Pin struct {
+	pin int
+	// Guards the following
+	mu      sync.Mutex
+	mode    gpio.Mode
+	pull    gpio.Pull
+	latch   gpio.Level
+	ext     gpio.Level
+	edge    gpio.Edge
+	handler func(gpio.Pinner)
+	// the other pin of a loopback pair, if any.
+	peer  *Pin
+	delay time.Duration
+}
+
+// NewPin creates a mock pin with the given number.
+//
+// The pin is initially an Input, externally driven Low.
+func NewPin(pin int) *Pin {
+	return &Pin{pin: pin}
+}
+
+// Loopback creates a pair of mock pins connected to each other, as if by a
+// jumper.
+//
+// When either pin is an Output, the level written to it is driven onto the
+// other, after the delay, triggering any watch on the other pin.
+// A delay of 0 drives the other pin synchronously.
+func Loopback(a, b int, delay time.Duration) (*Pin, *Pin) {
+	pa := &Pin{pin: a, delay: delay}
+	pb := &Pin{pin: b, delay: delay, peer: pa}
+	pa.peer = pb
+	return pa, pb
+}
+
+// Pin returns the pin number that this Pin represents.
+func (p *Pin) Pin() int {
+	return p.pin
+}
+
+// Read returns the level of the pin.
+func (p *Pin) Read() gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.level()
+}
+
+// Write sets the output latch of the pin.
+//
+// The level is only visible on the pin when the pin is an Output.
+func (p *Pin) Write(level gpio.Level) {
+	p.update(func() {
+		p.latch = level
+	})
+}
+
+// SetMode sets the mode of the pin.
+//
+// Any mode other than Output is treated as an Input.
+func (p *Pin) SetMode(mode gpio.Mode) {
+	p.update(func() {
+		p.mode = mode
+	})
+}
+
+// Mode returns the mode of the pin.
+func (p *Pin) Mode() gpio.Mode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mode
+}
+
+// SetPull sets the pull of the pin.
+//
+// The pull is recorded, but has no effect on the level of the pin.
+func (p *Pin) SetPull(pull gpio.Pull) {
+	p.mu.Lock()
+	p.pull = pull
+	p.mu.Unlock()
+}
+
+// Pull returns the pull of the pin.
+func (p *Pin) Pull() gpio.Pull {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pull
+}
+
+// Set sets the level externally driven onto the pin, as if by another device.
+//
+// The level is only visible on the pin when the pin is not an Output.
+// Any watch on the pin is triggered by the change in level.
+func (p *Pin) Set(level gpio.Level) {
+	p.update(func() {
+		p.ext = level
+	})
+}
+
+// Watch calls the handler when the pin level changes on the given edge.
+//
+// As per gpio.Pin.Watch, the handler is called immediately with the current
+// level.  Handlers are called synchronously from the call causing the level
+// change, so tests can be deterministic.
+func (p *Pin) Watch(edge gpio.Edge, handler func(gpio.Pinner)) error {
+	p.mu.Lock()
+	if p.handler != nil {
+		p.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	p.edge = edge
+	p.handler = handler
+	p.mu.Unlock()
+	handler(p)
+	return nil
+}
+
+// Unwatch removes any watch from the pin.
+func (p *Pin) Unwatch() {
+	p.mu.Lock()
+	p.handler = nil
+	p.mu.Unlock()
+}
+
+// level returns the level of the pin.
+// Assumes the caller holds the mu lock.
+func (p *Pin) level() gpio.Level {
+	if p.mode == gpio.Output {
+		return p.latch
+	}
+	return p.ext
+}
+
+// update applies the change to the pin, drives the peer if the pin is an
+// Output, and calls the handler if the change results in a watched edge.
+func (p *Pin) update(change func()) {
+	p.mu.Lock()
+	old := p.level()
+	oldMode := p.mode
+	change()
+	level := p.level()
+	drive := p.peer != nil && p.mode == gpio.Output &&
+		(level != old || oldMode != gpio.Output)
+	handler := p.handler
+	p.mu.Unlock()
+	if drive {
+		p.drivePeer(level)
+	}
+	if level != old && handler != nil && fired(p.edge, level) {
+		handler(p)
+	}
+}
+
+// drivePeer sets the level on the peer pin, after the loopback delay.
+func (p *Pin) drivePeer(level gpio.Level) {
+	if p.delay == 0 {
+		p.peer.Set(level)
+		return
+	}
+	time.AfterFunc(p.delay, func() {
+		p.peer.Set(level)
+	})
+}
+
+// fired returns true if a transition to the level matches the edge.
+func fired(edge gpio.Edge, level gpio.Level) bool {
+	switch edge {
+	case gpio.EdgeBoth:
+		return true
+	case gpio.EdgeRising:
+		return level == gpio.High
+	case gpio.EdgeFalling:
+		return level == gpio.Low
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package mock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/mock"
+)
+
+func TestPin(t *testing.T) {
+	p := mock.NewPin(4)
+	var _ gpio.Pinner = p
+	assert.Equal(t, 4, p.Pin())
+	assert.Equal(t, gpio.Input, p.Mode())
+	assert.Equal(t, gpio.Low, p.Read())
+	p.Set(gpio.High)
+	assert.Equal(t, gpio.High, p.Read())
+	// latched until output
+	p.Write(gpio.Low)
+	assert.Equal(t, gpio.High, p.Read())
+	p.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Output, p.Mode())
+	assert.Equal(t, gpio.Low, p.Read())
+	p.Set(gpio.Low)
+	p.Write(gpio.High)
+	assert.Equal(t, gpio.High, p.Read())
+	p.SetMode(gpio.Input)
+	assert.Equal(t, gpio.Low, p.Read())
+	p.SetPull(gpio.PullUp)
+	assert.Equal(t, gpio.PullUp, p.Pull())
+}
+
+func TestWatch(t *testing.T) {
+	p := mock.NewPin(4)
+	var levels []gpio.Level
+	assert.Nil(t, p.Watch(gpio.EdgeRising, func(pin gpio.Pinner) {
+		levels = append(levels, pin.Read())
+	}))
+	assert.Equal(t, gpio.ErrBusy, p.Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+	p.Set(gpio.High)
+	p.Set(gpio.High)
+	p.Set(gpio.Low)
+	p.Set(gpio.High)
+	assert.Equal(t, []gpio.Level{gpio.Low, gpio.High, gpio.High}, levels)
+	p.Unwatch()
+	p.Set(gpio.Low)
+	p.Set(gpio.High)
+	assert.Equal(t, 3, len(levels))
+}
+
+func TestLoopback(t *testing.T) {
+	in, out := mock.Loopback(22, 23, 0)
+	assert.Equal(t, 22, in.Pin())
+	assert.Equal(t, 23, out.Pin())
+	out.Write(gpio.High)
+	assert.Equal(t, gpio.Low, in.Read())
+	out.SetMode(gpio.Output)
+	assert.Equal(t, gpio.High, in.Read())
+	var levels []gpio.Level
+	assert.Nil(t, in.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		levels = append(levels, pin.Read())
+	}))
+	out.Write(gpio.Low)
+	out.Write(gpio.High)
+	assert.Equal(t, []gpio.Level{gpio.High, gpio.Low, gpio.High}, levels)
+	// and in reverse
+	out.SetMode(gpio.Input)
+	in.Write(gpio.Low)
+	in.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Low, out.Read())
+}
+
+func TestLoopbackDelay(t *testing.T) {
+	in, out := mock.Loopback(22, 23, time.Millisecond)
+	ch := make(chan gpio.Level, 2)
+	assert.Nil(t, in.Watch(gpio.EdgeRising, func(pin gpio.Pinner) {
+		ch <- pin.Read()
+	}))
+	assert.Equal(t, gpio.Low, <-ch)
+	out.Write(gpio.High)
+	out.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Low, in.Read())
+	select {
+	case v := <-ch:
+		assert.Equal(t, gpio.High, v)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("missed edge")
+	}
+}
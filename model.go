@@ -0,0 +1,308 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Raspberry Pi model detection.
+
+package gpio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Model describes the model of Raspberry Pi running the package.
+type Model struct {
+	// Name is the name of the model, e.g. "Raspberry Pi 4 Model B Rev 1.4".
+	Name string
+
+	// Revision is the revision code of the board.
+	Revision uint32
+
+	// Type is the short name of the model type, e.g. "4B" or "Zero W".
+	Type string
+
+	// SoC is the name of the processor, e.g. "BCM2711".
+	SoC string
+
+	// Chipset is the GPIO chipset of the processor, or 0 if the GPIO is not
+	// supported by this package.
+	Chipset Chipset
+
+	// Memory is the size of the RAM, in MB.
+	Memory int
+
+	// Manufacturer is the name of the board manufacturer.
+	Manufacturer string
+
+	// Header is the layout of the GPIO header, or nil if the board has no
+	// standard header.
+	Header *Board
+
+	// base is the physical address of the peripherals.
+	base int64
+}
+
+// Revision code fields, for new style codes.
+const (
+	revNewStyle  = 1 << 23
+	revTypeShift = 4
+	revTypeMask  = 0xff
+	revProcShift = 12
+	revProcMask  = 0xf
+	revMfrShift  = 16
+	revMfrMask   = 0xf
+	revMemShift  = 20
+	revMemMask   = 0x7
+	// old style codes may be prefixed with the warranty void bit.
+	revOldMask = 0xffff
+)
+
+type socInfo struct {
+	name    string
+	chipset Chipset
+	base    int64
+}
+
+var socs = []socInfo{
+	{"BCM2835", BCM2835, 0x20000000},
+	{"BCM2836", BCM2835, 0x3f000000},
+	{"BCM2837", BCM2835, 0x3f000000},
+	{"BCM2711", BCM2711, 0xfe000000},
+	{"BCM2712", 0, 0},
+}
+
+var manufacturers = []string{
+	"Sony UK",
+	"Egoman",
+	"Embest",
+	"Sony Japan",
+	"Embest",
+	"Stadium",
+}
+
+var modelTypes = map[uint32]string{
+	0x00: "A",
+	0x01: "B",
+	0x02: "A+",
+	0x03: "B+",
+	0x04: "2B",
+	0x05: "Alpha",
+	0x06: "CM1",
+	0x08: "3B",
+	0x09: "Zero",
+	0x0a: "CM3",
+	0x0c: "Zero W",
+	0x0d: "3B+",
+	0x0e: "3A+",
+	0x10: "CM3+",
+	0x11: "4B",
+	0x12: "Zero 2 W",
+	0x13: "400",
+	0x14: "CM4",
+	0x15: "CM4S",
+	0x17: "5",
+	0x18: "CM5",
+}
+
+// oldModel describes the boards with old style revision codes, all of which
+// use the BCM2835.
+type oldModel struct {
+	typ    string
+	memory int
+	mfr    string
+}
+
+var oldModels = map[uint32]oldModel{
+	0x02: {"B", 256, "Egoman"},
+	0x03: {"B", 256, "Egoman"},
+	0x04: {"B", 256, "Sony UK"},
+	0x05: {"B", 256, "Qisda"},
+	0x06: {"B", 256, "Egoman"},
+	0x07: {"A", 256, "Egoman"},
+	0x08: {"A", 256, "Sony UK"},
+	0x09: {"A", 256, "Qisda"},
+	0x0d: {"B", 512, "Egoman"},
+	0x0e: {"B", 512, "Sony UK"},
+	0x0f: {"B", 512, "Egoman"},
+	0x10: {"B+", 512, "Sony UK"},
+	0x11: {"CM1", 512, "Sony UK"},
+	0x12: {"A+", 256, "Sony UK"},
+	0x13: {"B+", 512, "Embest"},
+	0x14: {"CM1", 512, "Embest"},
+	0x15: {"A+", 256, "Embest"},
+}
+
+// DecodeRevision returns the model corresponding to the board revision code,
+// as found in /proc/cpuinfo.
+//
+// The Name is derived from the Type, as the full name is only available from
+// the device tree.
+func DecodeRevision(rev uint32) (*Model, error) {
+	if rev&revNewStyle == 0 {
+		om, ok := oldModels[rev&revOldMask]
+		if !ok {
+			return nil, ErrUnknownModel
+		}
+		m := &Model{
+			Revision:     rev,
+			Type:         om.typ,
+			Memory:       om.memory,
+			Manufacturer: om.mfr,
+		}
+		m.setSoC(socs[0])
+		m.Name = "Raspberry Pi Model " + m.Type
+		m.Header = headerForModel(m)
+		return m, nil
+	}
+	typ, ok := modelTypes[rev>>revTypeShift&revTypeMask]
+	proc := rev >> revProcShift & revProcMask
+	if !ok || int(proc) >= len(socs) {
+		return nil, ErrUnknownModel
+	}
+	m := &Model{
+		Revision: rev,
+		Type:     typ,
+		Memory:   256 << (rev >> revMemShift & revMemMask),
+	}
+	m.setSoC(socs[proc])
+	if mfr := int(rev >> revMfrShift & revMfrMask); mfr < len(manufacturers) {
+		m.Manufacturer = manufacturers[mfr]
+	}
+	m.Name = "Raspberry Pi " + m.Type
+	m.Header = headerForModel(m)
+	return m, nil
+}
+
+func (m *Model) setSoC(soc socInfo) {
+	m.SoC = soc.name
+	m.Chipset = soc.chipset
+	m.base = soc.base
+}
+
+// headerForModel returns the layout of the GPIO header of the model.
+func headerForModel(m *Model) *Board {
+	switch m.Type {
+	case "A", "B":
+		if m.Revision&revNewStyle == 0 && m.Revision&revOldMask <= 3 {
+			return RaspberryPiRev1
+		}
+		return RaspberryPiRev2
+	case "Zero", "Zero W", "Zero 2 W":
+		return RaspberryPiZero
+	case "CM1", "CM3", "CM3+", "CM4S":
+		return ComputeModule
+	case "Alpha", "CM4", "CM5":
+		return nil
+	}
+	return RaspberryPi
+}
+
+// DetectBoard returns the layout of the GPIO header of the detected model.
+//
+// If the model cannot be detected, or has no standard header, then the J8
+// header of the RaspberryPi is assumed.
+func DetectBoard() *Board {
+	if m, err := DetectModel(); err == nil && m.Header != nil {
+		return m.Header
+	}
+	return RaspberryPi
+}
+
+// maxPin returns the number of pins that may be used on the detected model.
+func maxPin() int {
+	if m, err := DetectModel(); err == nil && m.Header != nil {
+		max := MaxGPIOPin
+		for _, l := range m.Header.Header {
+			if l.Offset >= max {
+				max = l.Offset + 1
+			}
+		}
+		return max
+	}
+	return MaxGPIOPin
+}
+
+var (
+	detectOnce  sync.Once
+	detected    *Model
+	detectedErr error
+
+	// The sources of the model information.
+	dtModelPath    = "/proc/device-tree/model"
+	dtRevisionPath = "/proc/device-tree/system/linux,revision"
+	cpuinfoPath    = "/proc/cpuinfo"
+)
+
+// DetectModel returns the model of Raspberry Pi running the package.
+//
+// The revision code is read from the device tree, if available, else from
+// /proc/cpuinfo.  The result is cached, so subsequent calls are cheap.
+//
+// This does not require the package to be opened.
+func DetectModel() (*Model, error) {
+	detectOnce.Do(func() {
+		detected, detectedErr = detectModel()
+	})
+	return detected, detectedErr
+}
+
+func detectModel() (*Model, error) {
+	rev, err := readRevision()
+	if err != nil {
+		return nil, err
+	}
+	m, err := DecodeRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	if name, err := ioutil.ReadFile(dtModelPath); err == nil {
+		m.Name = strings.TrimRight(string(name), "\x00\n")
+	}
+	return m, nil
+}
+
+// readRevision reads the board revision code.
+func readRevision() (uint32, error) {
+	if b, err := ioutil.ReadFile(dtRevisionPath); err == nil && len(b) == 4 {
+		return binary.BigEndian.Uint32(b), nil
+	}
+	f, err := os.Open(cpuinfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseRevision(f)
+}
+
+// parseRevision extracts the revision code from the contents of
+// /proc/cpuinfo.
+func parseRevision(r io.Reader) (uint32, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), ":", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[0]) != "Revision" {
+			continue
+		}
+		rev, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 16, 32)
+		if err != nil {
+			return 0, err
+		}
+		return uint32(rev), nil
+	}
+	return 0, ErrUnknownModel
+}
+
+var (
+	// ErrUnknownModel indicates the model of the board could not be
+	// determined.
+	ErrUnknownModel = errors.New("unknown model")
+)
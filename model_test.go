@@ -0,0 +1,69 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRevision(t *testing.T) {
+	patterns := []struct {
+		rev    uint32
+		typ    string
+		soc    string
+		cs     Chipset
+		memory int
+		mfr    string
+		header *Board
+		base   int64
+	}{
+		{0x0002, "B", "BCM2835", BCM2835, 256, "Egoman", RaspberryPiRev1, 0x20000000},
+		{0x000e, "B", "BCM2835", BCM2835, 512, "Sony UK", RaspberryPiRev2, 0x20000000},
+		{0x1000010, "B+", "BCM2835", BCM2835, 512, "Sony UK", RaspberryPi, 0x20000000},
+		{0x900093, "Zero", "BCM2835", BCM2835, 512, "Sony UK", RaspberryPiZero, 0x20000000},
+		{0xa01041, "2B", "BCM2836", BCM2835, 1024, "Sony UK", RaspberryPi, 0x3f000000},
+		{0xa02082, "3B", "BCM2837", BCM2835, 1024, "Sony UK", RaspberryPi, 0x3f000000},
+		{0xa020a0, "CM3", "BCM2837", BCM2835, 1024, "Sony UK", ComputeModule, 0x3f000000},
+		{0xb03140, "CM4", "BCM2711", BCM2711, 2048, "Sony UK", nil, 0xfe000000},
+		{0xc03114, "4B", "BCM2711", BCM2711, 4096, "Sony UK", RaspberryPi, 0xfe000000},
+		{0xd03114, "4B", "BCM2711", BCM2711, 8192, "Sony UK", RaspberryPi, 0xfe000000},
+		{0xc03130, "400", "BCM2711", BCM2711, 4096, "Sony UK", RaspberryPi, 0xfe000000},
+		{0xd04170, "5", "BCM2712", 0, 8192, "Sony UK", RaspberryPi, 0},
+	}
+	for _, p := range patterns {
+		m, err := DecodeRevision(p.rev)
+		require.Nil(t, err, p.rev)
+		assert.Equal(t, p.rev, m.Revision)
+		assert.Equal(t, p.typ, m.Type, p.rev)
+		assert.Equal(t, p.soc, m.SoC, p.rev)
+		assert.Equal(t, p.cs, m.Chipset, p.rev)
+		assert.Equal(t, p.memory, m.Memory, p.rev)
+		assert.Equal(t, p.mfr, m.Manufacturer, p.rev)
+		assert.Equal(t, p.header, m.Header, p.rev)
+		assert.Equal(t, p.base, m.base, p.rev)
+		assert.NotEmpty(t, m.Name)
+	}
+	for _, rev := range []uint32{0, 0x0001, 0x0016, 0x8000f0, 0x80f000} {
+		_, err := DecodeRevision(rev)
+		assert.Equal(t, ErrUnknownModel, err, rev)
+	}
+}
+
+func TestParseRevision(t *testing.T) {
+	cpuinfo := "processor\t: 0\nmodel name\t: ARMv7 Processor rev 3 (v7l)\n\n" +
+		"Hardware\t: BCM2835\nRevision\t: c03114\nSerial\t\t: 100000003b5d1c4e\n"
+	rev, err := parseRevision(strings.NewReader(cpuinfo))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0xc03114), rev)
+	_, err = parseRevision(strings.NewReader("Hardware\t: BCM2835\n"))
+	assert.Equal(t, ErrUnknownModel, err)
+	_, err = parseRevision(strings.NewReader("Revision\t: xyz\n"))
+	assert.NotNil(t, err)
+}
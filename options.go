@@ -0,0 +1,231 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import "time"
+
+// PinOption defines an option that can be applied when creating a Pin.
+//
+// Options are collected and then applied in a safe order, regardless of the
+// order they are passed to NewPin: pull, then initial level, then drive, then
+// mode, and finally edge watch.  So an output pin will never briefly drive a stale
+// level, and a watch will never see the transition into the requested
+// configuration.
+type PinOption func(*pinConfig)
+
+type pinConfig struct {
+	mode     *Mode
+	pull     *Pull
+	drive    *Drive
+	level    *Level
+	edge     Edge
+	handler  func(Pinner)
+	watch    []WatchOption
+	hasWatch bool
+}
+
+// WithMode sets the mode of the pin.
+func WithMode(mode Mode) PinOption {
+	return func(c *pinConfig) {
+		c.mode = &mode
+	}
+}
+
+// WithPull sets the pull up/down of the pin.
+func WithPull(pull Pull) PinOption {
+	return func(c *pinConfig) {
+		c.pull = &pull
+	}
+}
+
+// WithDrive sets the drive mode of the pin.
+func WithDrive(drive Drive) PinOption {
+	return func(c *pinConfig) {
+		c.drive = &drive
+	}
+}
+
+// WithInitialLevel sets the level of the pin before the mode is set.
+//
+// This prevents output glitches when the pin is also set to Output.
+func WithInitialLevel(level Level) PinOption {
+	return func(c *pinConfig) {
+		c.level = &level
+	}
+}
+
+// WithEdge adds a watch on the pin for the given edge.
+//
+// The handler is called as per Watch, and the watch may be customised by
+// the options, as per WatchWith.
+func WithEdge(edge Edge, handler func(Pinner), options ...WatchOption) PinOption {
+	return func(c *pinConfig) {
+		c.edge = edge
+		c.handler = handler
+		c.watch = options
+		c.hasWatch = true
+	}
+}
+
+func (pin *Pin) apply(options []PinOption) error {
+	cfg := pinConfig{}
+	for _, option := range options {
+		option(&cfg)
+	}
+	if cfg.pull != nil {
+		pin.SetPull(*cfg.pull)
+	}
+	if cfg.level != nil {
+		pin.Write(*cfg.level)
+	}
+	if cfg.drive != nil {
+		pin.SetDrive(*cfg.drive)
+	}
+	if cfg.mode != nil {
+		if err := pin.TrySetMode(*cfg.mode); err != nil {
+			return err
+		}
+	}
+	if cfg.hasWatch {
+		return pin.WatchWith(cfg.edge, cfg.handler, cfg.watch...)
+	}
+	return nil
+}
+
+// OpenOption defines an option that can be applied when opening the package.
+type OpenOption func(*openConfig)
+
+type openConfig struct {
+	chip     string
+	device   string
+	base     int64
+	offset   int64
+	reclaim  bool
+	timeout  time.Duration
+	sharing  Sharing
+	conflict func(*ConflictError)
+	strict   bool
+}
+
+// WithDevice sets the path of the device to be memory mapped.
+//
+// The default is /dev/gpiomem, which maps only the GPIO registers.
+// Other devices may also require the WithBase and WithGPIOOffset options to
+// locate the GPIO registers.  For /dev/mem, if neither is provided, the
+// registers are located using the peripheral base from the device tree, as per
+// DetectPeripheralBase.
+func WithDevice(path string) OpenOption {
+	return func(c *openConfig) {
+		c.device = path
+	}
+}
+
+// WithBase sets the base address of the peripherals within the device.
+//
+// e.g. 0x20000000 for the BCM2835, 0x3F000000 for the BCM2836/7, and
+// 0xFE000000 for the BCM2711, when mapping /dev/mem.
+//
+// The default is 0.
+func WithBase(base int64) OpenOption {
+	return func(c *openConfig) {
+		c.base = base
+	}
+}
+
+// WithGPIOOffset sets the offset of the GPIO registers from the base address.
+//
+// e.g. 0x200000 for the BCM2835 family, when mapping /dev/mem.
+//
+// The default is 0.
+// The sum of the base and offset must be page aligned.
+func WithGPIOOffset(offset int64) OpenOption {
+	return func(c *openConfig) {
+		c.offset = offset
+	}
+}
+
+// WithReclaim reclaims any pins left exported on sysfs by a previous run of
+// the program, as per Reclaim, and allows subsequent watches to adopt pins
+// that are found to be still exported by a previous run, rather than failing
+// with ErrBusy.
+//
+// Exports by other programs, udev rules or init scripts are not affected.
+// Use WithAdopt to watch those.
+//
+// The pins exported by the program are recorded, in /run/gpio for root, so
+// they can be reclaimed by later runs.  Exports are only recorded if this
+// option, or Reclaim, is used.
+//
+// This is intended for programs that may be restarted after crashing without
+// removing their watches.
+func WithReclaim() OpenOption {
+	return func(c *openConfig) {
+		c.reclaim = true
+	}
+}
+
+// WithExportTimeout sets the maximum time to wait for the sysfs files of a pin
+// to become accessible after the pin is exported for a watch.
+//
+// After export, the files are briefly owned by root until udev applies the
+// rules that grant access, so access is retried, with backoff, until the
+// timeout, after which the watch fails with ErrTimeout.
+//
+// The default is 1s.
+func WithExportTimeout(d time.Duration) OpenOption {
+	return func(c *openConfig) {
+		c.timeout = d
+	}
+}
+
+// WithSharing sets the policy for repeated requests for the same pin, so
+// separate parts of a program cannot unknowingly create the same pin.
+//
+// The default is ShareIndependent.
+func WithSharing(sharing Sharing) OpenOption {
+	return func(c *openConfig) {
+		c.sharing = sharing
+	}
+}
+
+// WithConflictHandler sets a handler called when the mode of a pin is changed
+// via a Pin other than the one that last set it, e.g. when one driver sets a
+// pin to Input while another is driving it as an Output.
+//
+// Conflicts are always logged, whether a handler is set or not.
+func WithConflictHandler(handler func(*ConflictError)) OpenOption {
+	return func(c *openConfig) {
+		c.conflict = handler
+	}
+}
+
+// WithStrictOutput refuses to set a pin to Output before its level has been
+// set, so a pin never drives a stale level, e.g. briefly asserting a relay or
+// chip select, when made an Output.
+//
+// The level may be set using Output, Write, High, Low, or WithInitialLevel.
+// Refused mode changes are logged by SetMode, and reported as
+// ErrNoInitialLevel by TrySetMode, and by NewPin for WithMode.
+func WithStrictOutput() OpenOption {
+	return func(c *openConfig) {
+		c.strict = true
+	}
+}
+
+// WithCharDev selects the GPIO character device backend, using the named chip,
+// e.g. "gpiochip0" or "/dev/gpiochip0", rather than /dev/gpiomem.
+//
+// All pin access is then performed via the kernel rather than directly on
+// hardware registers, and so the pin numbers refer to the line offsets on that
+// chip.  Only the Input and Output modes are supported.
+//
+// Pulls are applied as bias flags on the line requests, which requires Linux
+// v5.5 or later.
+func WithCharDev(chip string) OpenOption {
+	return func(c *openConfig) {
+		c.chip = chip
+	}
+}
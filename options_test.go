@@ -0,0 +1,117 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//
+//  Test suite for pin options.
+//
+//	Tests use J8 pins 7 (mostly) and 15 and 16 (for looped tests)
+//
+package gpio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+func TestWithMode(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pin, err := gpio.NewPin(gpio.J8p7, gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pin.SetMode(gpio.Input)
+	assert.Equal(t, gpio.Output, pin.Mode())
+	pin, err = gpio.NewPin(gpio.J8p7, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.Input, pin.Mode())
+}
+
+func TestWithModeStrict(t *testing.T) {
+	assert.Nil(t, gpio.Open(gpio.WithStrictOutput()))
+	defer teardownDIO()
+	pin, err := gpio.NewPin(gpio.J8p7, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	_, err = gpio.NewPin(gpio.J8p7, gpio.WithMode(gpio.Output))
+	assert.Equal(t, gpio.ErrNoInitialLevel, err)
+	assert.Equal(t, gpio.Input, pin.Mode())
+	pin, err = gpio.NewPin(gpio.J8p7,
+		gpio.WithMode(gpio.Output),
+		gpio.WithInitialLevel(gpio.Low))
+	assert.Nil(t, err)
+	defer pin.SetMode(gpio.Input)
+	assert.Equal(t, gpio.Output, pin.Mode())
+}
+
+func TestWithPull(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pullSettle := time.Microsecond
+	pin, err := gpio.NewPin(gpio.J8p7, gpio.WithPull(gpio.PullDown))
+	assert.Nil(t, err)
+	defer pin.PullUp()
+	time.Sleep(pullSettle)
+	assert.Equal(t, gpio.Low, pin.Read())
+	pin, err = gpio.NewPin(gpio.J8p7, gpio.WithPull(gpio.PullUp))
+	assert.Nil(t, err)
+	time.Sleep(pullSettle)
+	assert.Equal(t, gpio.High, pin.Read())
+}
+
+func TestWithInitialLevel(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	// order of options should not matter - level is always applied first.
+	pin, err := gpio.NewPin(gpio.J8p7,
+		gpio.WithMode(gpio.Output),
+		gpio.WithInitialLevel(gpio.Low))
+	assert.Nil(t, err)
+	defer pin.SetMode(gpio.Input)
+	assert.Equal(t, gpio.Output, pin.Mode())
+	assert.Equal(t, gpio.Low, pin.Shadow())
+	assert.Equal(t, gpio.Low, pin.Read())
+	pin, err = gpio.NewPin(gpio.J8p7, gpio.WithInitialLevel(gpio.High))
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.High, pin.Shadow())
+	assert.Equal(t, gpio.High, pin.Read())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestWithEdgeLooped(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	ich := make(chan gpio.Level, 3)
+	pinIn, err := gpio.NewPin(gpio.J8p15,
+		gpio.WithMode(gpio.Input),
+		gpio.WithEdge(gpio.EdgeRising, func(pin gpio.Pinner) {
+			ich <- pin.Read()
+		}))
+	assert.Nil(t, err)
+	defer pinIn.Unwatch()
+	select {
+	case v := <-ich:
+		assert.Equal(t, gpio.Low, v)
+	case <-time.After(10 * time.Millisecond):
+		t.Error("missing sync interrupt")
+	}
+	pinOut.High()
+	select {
+	case v := <-ich:
+		assert.Equal(t, gpio.High, v)
+	case <-time.After(10 * time.Millisecond):
+		t.Error("missed rising edge")
+	}
+	// a second watch on the same pin is an error
+	pin, err := gpio.NewPin(gpio.J8p15,
+		gpio.WithEdge(gpio.EdgeRising, func(pin gpio.Pinner) {}))
+	assert.Equal(t, gpio.ErrBusy, err)
+	assert.Nil(t, pin)
+}
@@ -0,0 +1,124 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictOutput(t *testing.T) {
+	old := mem
+	mem = make([]uint32, memLength/4)
+	atomic.StoreInt32(&strictOutput, 1)
+	defer func() {
+		mem = old
+		atomic.StoreInt32(&strictOutput, 0)
+	}()
+
+	pin, err := NewPin(4)
+	require.Nil(t, err)
+	assert.Equal(t, ErrNoInitialLevel, pin.TrySetMode(Output))
+	assert.Equal(t, Input, pin.Mode())
+	pin.SetMode(Output)
+	assert.Equal(t, Input, pin.Mode())
+	assert.Nil(t, pin.TrySetMode(Alt0))
+	assert.Equal(t, Alt0, pin.Mode())
+
+	pin.Output(High)
+	assert.Equal(t, Output, pin.Mode())
+	assert.Equal(t, uint32(1<<4), mem[7])
+
+	// already an output.
+	p2, err := NewPin(4)
+	require.Nil(t, err)
+	assert.Nil(t, p2.TrySetMode(Output))
+
+	// groups
+	p5, err := NewPin(5)
+	require.Nil(t, err)
+	p6, err := NewPin(6)
+	require.Nil(t, err)
+	p6.Low()
+	SetModes(map[*Pin]Mode{p5: Output, p6: Output})
+	assert.Equal(t, Input, p5.Mode())
+	assert.Equal(t, Output, p6.Mode())
+	g, err := NewPinGroup(p5)
+	require.Nil(t, err)
+	g.Write(1)
+	g.SetMode(Output)
+	assert.Equal(t, Output, p5.Mode())
+
+	// options
+	_, err = NewPin(8, WithMode(Output))
+	assert.Equal(t, ErrNoInitialLevel, err)
+	p8, err := NewPin(8, WithMode(Output), WithInitialLevel(High))
+	require.Nil(t, err)
+	assert.Equal(t, Output, p8.Mode())
+
+	// not strict
+	atomic.StoreInt32(&strictOutput, 0)
+	p7, err := NewPin(7)
+	require.Nil(t, err)
+	assert.Nil(t, p7.TrySetMode(Output))
+	assert.Equal(t, Output, p7.Mode())
+}
+
+func TestDriveResync(t *testing.T) {
+	old := mem
+	mem = make([]uint32, memLength/4)
+	defer func() {
+		mem = old
+	}()
+
+	pin, err := NewPin(4)
+	require.Nil(t, err)
+	pin.SetDrive(DriveOpenDrain)
+	pin.Output(Low)
+	assert.Equal(t, uint32(1<<4), mem[10])
+	pin.Write(High)
+	// released, so tri-stated.
+	assert.Equal(t, uint32(0), mem[0]>>12&7)
+
+	// the latch is set to the released level before driving.
+	mem[7] = 0
+	pin.SetDrive(DrivePushPull)
+	assert.Equal(t, Output, pin.Mode())
+	assert.Equal(t, uint32(1<<4), mem[7])
+	assert.Equal(t, High, pin.shadow)
+}
+
+func TestSetModesResync(t *testing.T) {
+	old := mem
+	mem = make([]uint32, memLength/4)
+	defer func() {
+		mem = old
+	}()
+
+	pin, err := NewPin(4)
+	require.Nil(t, err)
+	pin.SetDrive(DriveOpenDrain)
+	pin.Output(Low)
+	pin.Write(High)
+
+	// the latch is set to the released level when leaving the emulation...
+	mem[7] = 0
+	SetModes(map[*Pin]Mode{pin: Input})
+	assert.Equal(t, Input, pin.Mode())
+	assert.Equal(t, uint32(1<<4), mem[7])
+	assert.False(t, pin.emulated)
+
+	// ...so it is driven once the pin is a push pull output.
+	pin.SetDrive(DrivePushPull)
+	mem[10] = 0
+	SetModes(map[*Pin]Mode{pin: Output})
+	assert.Equal(t, Output, pin.Mode())
+	assert.Equal(t, uint32(0), mem[10])
+	assert.Equal(t, High, pin.shadow)
+}
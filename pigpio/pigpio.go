@@ -0,0 +1,417 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package pigpio provides a client for the pigpiod socket interface, so the
+// GPIO pins of a remote Raspberry Pi running pigpiod can be controlled via
+// the gpio.Pinner interface.
+//
+// The client uses two connections to the daemon, one for commands, and one
+// for edge notifications, which is only opened when a pin is first watched.
+package pigpio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// DefaultAddr is the default address of pigpiod.
+const DefaultAddr = "localhost:8888"
+
+// Commands
+const (
+	cmdModes = 0
+	cmdModeg = 1
+	cmdPud   = 2
+	cmdRead  = 3
+	cmdWrite = 4
+	cmdPWM   = 5
+	cmdPrs   = 6
+	cmdPfs   = 7
+	cmdBr1   = 10
+	cmdNb    = 19
+	cmdNc    = 21
+	cmdNoib  = 99
+)
+
+// Notification flags
+const (
+	flagWatchdog = 1 << 5
+	flagAlive    = 1 << 6
+	flagEvent    = 1 << 7
+)
+
+// MaxPin is the highest pin number in bank 1, which is the limit of the pins
+// that can be watched.
+const MaxPin = 31
+
+// Client is a connection to pigpiod.
+type Client struct {
+	addr    string
+	timeout time.Duration
+	wg      sync.WaitGroup
+	// Guards the command connection, so each command and its response are
+	// not interleaved with others.
+	cmdMu sync.Mutex
+	conn  net.Conn
+	// Guards the following
+	mu      sync.Mutex
+	err     error
+	notify  net.Conn
+	handle  uint32
+	levels  uint32
+	watches map[int]*watch
+}
+
+type watch struct {
+	edge    gpio.Edge
+	handler func(gpio.Pinner)
+}
+
+// Option defines an option that can be applied when creating a Client.
+type Option func(*Client)
+
+// WithTimeout sets the timeout for connecting to the daemon.
+//
+// The default is 5s.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// Dial connects to pigpiod at the address, e.g. DefaultAddr or
+// "raspberrypi.local:8888".
+func Dial(addr string, options ...Option) (*Client, error) {
+	c := &Client{
+		addr:    addr,
+		timeout: 5 * time.Second,
+		watches: make(map[int]*watch),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	conn, err := net.DialTimeout("tcp", addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return c, nil
+}
+
+// Close closes the connections to the daemon.
+//
+// The remote pins are left in their current state.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	notify := c.notify
+	c.notify = nil
+	c.watches = make(map[int]*watch)
+	c.mu.Unlock()
+	if notify != nil {
+		c.Command(cmdNc, c.handle, 0)
+		notify.Close()
+		c.wg.Wait()
+	}
+	return c.conn.Close()
+}
+
+// Err returns the first error encountered by a Pin, if any.
+//
+// As the gpio.Pinner methods cannot return errors, errors from those methods
+// are recorded by the Client.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) setErr(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+// Command sends a raw command to the daemon and returns the result.
+//
+// Negative results are returned as an Error.
+func (c *Client) Command(cmd, p1, p2 uint32) (uint32, error) {
+	c.cmdMu.Lock()
+	defer c.cmdMu.Unlock()
+	return command(c.conn, cmd, p1, p2)
+}
+
+func command(conn io.ReadWriter, cmd, p1, p2 uint32) (uint32, error) {
+	var buf [16]byte
+	binary.LittleEndian.PutUint32(buf[0:], cmd)
+	binary.LittleEndian.PutUint32(buf[4:], p1)
+	binary.LittleEndian.PutUint32(buf[8:], p2)
+	if _, err := conn.Write(buf[:]); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(conn, buf[:]); err != nil {
+		return 0, err
+	}
+	res := int32(binary.LittleEndian.Uint32(buf[12:]))
+	if res < 0 {
+		return 0, Error(res)
+	}
+	return uint32(res), nil
+}
+
+// Pin returns the remote pin.
+func (c *Client) Pin(pin int) *Pin {
+	return &Pin{c: c, pin: pin}
+}
+
+// watch adds a watch on the pin, opening the notification connection if
+// necessary.
+func (c *Client) watch(pin int, edge gpio.Edge, handler func(gpio.Pinner)) error {
+	if pin < 0 || pin > MaxPin {
+		return ErrInvalidPin
+	}
+	c.mu.Lock()
+	if _, ok := c.watches[pin]; ok {
+		c.mu.Unlock()
+		return gpio.ErrBusy
+	}
+	if c.notify == nil {
+		if err := c.openNotify(); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	c.watches[pin] = &watch{edge: edge, handler: handler}
+	if _, err := c.Command(cmdNb, c.handle, c.bits()); err != nil {
+		delete(c.watches, pin)
+		c.mu.Unlock()
+		return err
+	}
+	c.mu.Unlock()
+	handler(c.Pin(pin))
+	return nil
+}
+
+func (c *Client) unwatch(pin int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.watches[pin]; !ok {
+		return
+	}
+	delete(c.watches, pin)
+	if _, err := c.Command(cmdNb, c.handle, c.bits()); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// Assumes caller holds the mu lock.
+func (c *Client) bits() uint32 {
+	var bits uint32
+	for pin := range c.watches {
+		bits |= 1 << uint(pin)
+	}
+	return bits
+}
+
+// Assumes caller holds the mu lock.
+func (c *Client) openNotify() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return err
+	}
+	handle, err := command(conn, cmdNoib, 0, 0)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	levels, err := c.Command(cmdBr1, 0, 0)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	c.notify = conn
+	c.handle = handle
+	c.levels = levels
+	c.wg.Add(1)
+	go c.readNotify(conn)
+	return nil
+}
+
+// readNotify reads the notification reports, and calls the handlers of the
+// watched pins that have changed level.
+func (c *Client) readNotify(conn net.Conn) {
+	defer c.wg.Done()
+	var buf [12]byte
+	for {
+		if _, err := io.ReadFull(conn, buf[:]); err != nil {
+			c.mu.Lock()
+			closed := c.notify != conn
+			c.mu.Unlock()
+			if !closed {
+				c.setErr(err)
+			}
+			return
+		}
+		flags := binary.LittleEndian.Uint16(buf[2:])
+		if flags&(flagWatchdog|flagAlive|flagEvent) != 0 {
+			continue
+		}
+		levels := binary.LittleEndian.Uint32(buf[8:])
+		c.mu.Lock()
+		changed := levels ^ c.levels
+		c.levels = levels
+		var handlers []func(gpio.Pinner)
+		var pins []int
+		for pin, w := range c.watches {
+			mask := uint32(1) << uint(pin)
+			if changed&mask == 0 {
+				continue
+			}
+			high := levels&mask != 0
+			if w.edge == gpio.EdgeBoth ||
+				(w.edge == gpio.EdgeRising && high) ||
+				(w.edge == gpio.EdgeFalling && !high) {
+				handlers = append(handlers, w.handler)
+				pins = append(pins, pin)
+			}
+		}
+		c.mu.Unlock()
+		for i, h := range handlers {
+			h(c.Pin(pins[i]))
+		}
+	}
+}
+
+// Pin is a pin on the remote Raspberry Pi.
+//
+// Pin implements gpio.Pinner, with any errors recorded by the Client.
+type Pin struct {
+	c   *Client
+	pin int
+}
+
+// Pin returns the number of the pin, as per gpio.Pin.
+func (p *Pin) Pin() int {
+	return p.pin
+}
+
+// Read returns the level of the pin.
+func (p *Pin) Read() gpio.Level {
+	v, err := p.c.Command(cmdRead, uint32(p.pin), 0)
+	if err != nil {
+		p.c.setErr(err)
+	}
+	return v != 0
+}
+
+// Write sets the level of the pin.
+func (p *Pin) Write(level gpio.Level) {
+	var v uint32
+	if level {
+		v = 1
+	}
+	p.do(cmdWrite, v)
+}
+
+// High sets the pin high.
+func (p *Pin) High() {
+	p.Write(gpio.High)
+}
+
+// Low sets the pin low.
+func (p *Pin) Low() {
+	p.Write(gpio.Low)
+}
+
+// SetMode sets the mode of the pin.
+func (p *Pin) SetMode(mode gpio.Mode) {
+	// pigpio modes match the gpio.Mode values, as both are the BCM2835
+	// function select codes.
+	p.do(cmdModes, uint32(mode))
+}
+
+// Mode returns the mode of the pin.
+func (p *Pin) Mode() gpio.Mode {
+	v, err := p.c.Command(cmdModeg, uint32(p.pin), 0)
+	if err != nil {
+		p.c.setErr(err)
+	}
+	return gpio.Mode(v)
+}
+
+// SetPull sets the pull up/down mode of the pin.
+func (p *Pin) SetPull(pull gpio.Pull) {
+	p.do(cmdPud, uint32(pull))
+}
+
+// SetPWM starts a hardware timed PWM on the pin, with the duty cycle in the
+// range 0 to 1.
+//
+// A duty cycle of 0 stops the PWM.
+func (p *Pin) SetPWM(duty float64) error {
+	if duty < 0 {
+		duty = 0
+	} else if duty > 1 {
+		duty = 1
+	}
+	if _, err := p.c.Command(cmdPrs, uint32(p.pin), pwmRange); err != nil {
+		return err
+	}
+	_, err := p.c.Command(cmdPWM, uint32(p.pin), uint32(duty*pwmRange+0.5))
+	return err
+}
+
+// pwmRange is the range, i.e. the resolution, of the PWM duty cycle.
+const pwmRange = 1000
+
+// SetPWMFrequency sets the frequency of the PWM on the pin, in Hz.
+//
+// pigpiod selects the nearest available frequency, which is returned.
+func (p *Pin) SetPWMFrequency(freq uint32) (uint32, error) {
+	return p.c.Command(cmdPfs, uint32(p.pin), freq)
+}
+
+// Watch calls the handler when the pin level changes on the given edge.
+//
+// As per gpio.Pin.Watch, the handler is called immediately with the current
+// level.  Handlers are called from the notification goroutine, so must not
+// block.
+func (p *Pin) Watch(edge gpio.Edge, handler func(gpio.Pinner)) error {
+	return p.c.watch(p.pin, edge, handler)
+}
+
+// Unwatch removes any watch from the pin.
+func (p *Pin) Unwatch() {
+	p.c.unwatch(p.pin)
+}
+
+func (p *Pin) do(cmd, p2 uint32) {
+	if _, err := p.c.Command(cmd, uint32(p.pin), p2); err != nil {
+		p.c.setErr(err)
+	}
+}
+
+// Error is an error returned by pigpiod.
+//
+// The values are the negative error codes defined by pigpio, e.g. -3 for an
+// invalid GPIO.
+type Error int
+
+func (e Error) Error() string {
+	return fmt.Sprintf("pigpio error %d", int(e))
+}
+
+var (
+	// ErrInvalidPin indicates the pin cannot be watched.
+	ErrInvalidPin = errors.New("invalid pin")
+)
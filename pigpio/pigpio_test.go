@@ -0,0 +1,273 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package pigpio_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/pigpio"
+)
+
+// daemon is a minimal fake pigpiod.
+type daemon struct {
+	l  net.Listener
+	mu sync.Mutex
+	// state of the pins
+	levels uint32
+	modes  map[uint32]uint32
+	pulls  map[uint32]uint32
+	pwm    map[uint32]uint32
+	rng    map[uint32]uint32
+	// notification connections and watched bits, by handle
+	notify map[uint32]net.Conn
+	bits   map[uint32]uint32
+	seq    uint16
+	freed  []uint32
+}
+
+func newDaemon(t *testing.T) *daemon {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	d := &daemon{
+		l:      l,
+		modes:  make(map[uint32]uint32),
+		pulls:  make(map[uint32]uint32),
+		pwm:    make(map[uint32]uint32),
+		rng:    make(map[uint32]uint32),
+		notify: make(map[uint32]net.Conn),
+		bits:   make(map[uint32]uint32),
+	}
+	go d.serve()
+	return d
+}
+
+func (d *daemon) addr() string {
+	return d.l.Addr().String()
+}
+
+func (d *daemon) close() {
+	d.l.Close()
+}
+
+func (d *daemon) serve() {
+	for {
+		conn, err := d.l.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *daemon) handle(conn net.Conn) {
+	defer conn.Close()
+	var buf [16]byte
+	for {
+		if _, err := io.ReadFull(conn, buf[:]); err != nil {
+			return
+		}
+		cmd := binary.LittleEndian.Uint32(buf[0:])
+		p1 := binary.LittleEndian.Uint32(buf[4:])
+		p2 := binary.LittleEndian.Uint32(buf[8:])
+		res := d.exec(conn, cmd, p1, p2)
+		binary.LittleEndian.PutUint32(buf[12:], uint32(res))
+		if _, err := conn.Write(buf[:]); err != nil {
+			return
+		}
+	}
+}
+
+func (d *daemon) exec(conn net.Conn, cmd, p1, p2 uint32) int32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch cmd {
+	case 10: // BR1
+		return int32(d.levels)
+	case 19: // NB
+		d.bits[p1] = p2
+		return 0
+	case 21: // NC
+		delete(d.bits, p1)
+		d.freed = append(d.freed, p1)
+		return 0
+	case 99: // NOIB
+		h := uint32(len(d.notify))
+		d.notify[h] = conn
+		return int32(h)
+	}
+	if p1 > 53 {
+		return -3 // PI_BAD_GPIO
+	}
+	switch cmd {
+	case 0: // MODES
+		d.modes[p1] = p2
+	case 1: // MODEG
+		return int32(d.modes[p1])
+	case 2: // PUD
+		d.pulls[p1] = p2
+	case 3: // READ
+		return int32(d.levels >> p1 & 1)
+	case 4: // WRITE
+		d.setLevel(p1, p2 != 0)
+	case 5: // PWM
+		d.pwm[p1] = p2
+	case 6: // PRS
+		d.rng[p1] = p2
+	case 7: // PFS
+		return int32(p2 / 100 * 100)
+	default:
+		return -41 // PI_UNKNOWN_COMMAND
+	}
+	return 0
+}
+
+// set drives the level of the pin, as if by an external device.
+func (d *daemon) set(pin uint32, level bool) {
+	d.mu.Lock()
+	d.setLevel(pin, level)
+	d.mu.Unlock()
+}
+
+func (d *daemon) setLevel(pin uint32, level bool) {
+	mask := uint32(1) << pin
+	old := d.levels
+	if level {
+		d.levels |= mask
+	} else {
+		d.levels &^= mask
+	}
+	if old == d.levels {
+		return
+	}
+	for h, bits := range d.bits {
+		if bits&mask == 0 {
+			continue
+		}
+		var buf [12]byte
+		d.seq++
+		binary.LittleEndian.PutUint16(buf[0:], d.seq)
+		binary.LittleEndian.PutUint32(buf[8:], d.levels)
+		d.notify[h].Write(buf[:])
+	}
+}
+
+func (d *daemon) state(m map[uint32]uint32, pin uint32) uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return m[pin]
+}
+
+func TestPin(t *testing.T) {
+	d := newDaemon(t)
+	defer d.close()
+	c, err := pigpio.Dial(d.addr())
+	require.Nil(t, err)
+	defer c.Close()
+	p := c.Pin(4)
+	var _ gpio.Pinner = p
+	assert.Equal(t, 4, p.Pin())
+	p.SetMode(gpio.Output)
+	assert.Equal(t, gpio.Output, p.Mode())
+	assert.Equal(t, uint32(1), d.state(d.modes, 4))
+	p.SetMode(gpio.Alt0)
+	assert.Equal(t, gpio.Alt0, p.Mode())
+	p.SetPull(gpio.PullUp)
+	assert.Equal(t, uint32(2), d.state(d.pulls, 4))
+	assert.Equal(t, gpio.Low, p.Read())
+	p.High()
+	assert.Equal(t, gpio.High, p.Read())
+	p.Low()
+	assert.Equal(t, gpio.Low, p.Read())
+	d.set(4, true)
+	assert.Equal(t, gpio.High, p.Read())
+
+	assert.Nil(t, p.SetPWM(0.25))
+	assert.Equal(t, uint32(250), d.state(d.pwm, 4))
+	assert.Equal(t, uint32(1000), d.state(d.rng, 4))
+	f, err := p.SetPWMFrequency(1234)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1200), f)
+	assert.Nil(t, c.Err())
+
+	// errors
+	bad := c.Pin(60)
+	bad.Write(gpio.High)
+	assert.Equal(t, pigpio.Error(-3), c.Err())
+	assert.Equal(t, "pigpio error -3", c.Err().Error())
+	_, err = c.Command(200, 0, 0)
+	assert.Equal(t, pigpio.Error(-41), err)
+}
+
+func TestWatch(t *testing.T) {
+	d := newDaemon(t)
+	defer d.close()
+	c, err := pigpio.Dial(d.addr())
+	require.Nil(t, err)
+	p := c.Pin(17)
+	levels := make(chan gpio.Level, 10)
+	err = p.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		levels <- pin.Read()
+	})
+	require.Nil(t, err)
+	expect := func(level gpio.Level) {
+		select {
+		case l := <-levels:
+			assert.Equal(t, level, l)
+		case <-time.After(time.Second):
+			t.Error("no edge")
+		}
+	}
+	// initial level
+	expect(gpio.Low)
+	d.set(17, true)
+	expect(gpio.High)
+	d.set(17, false)
+	expect(gpio.Low)
+	// unwatched pins don't trigger
+	d.set(18, true)
+
+	assert.Equal(t, gpio.ErrBusy, p.Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+	assert.Equal(t, pigpio.ErrInvalidPin, c.Pin(40).Watch(gpio.EdgeBoth, func(gpio.Pinner) {}))
+
+	// rising only
+	r := c.Pin(22)
+	rising := make(chan struct{}, 10)
+	require.Nil(t, r.Watch(gpio.EdgeRising, func(gpio.Pinner) {
+		rising <- struct{}{}
+	}))
+	<-rising
+	d.set(22, true)
+	d.set(22, false)
+	d.set(22, true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, rising, 2)
+
+	p.Unwatch()
+	d.set(17, true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, levels, 0)
+	assert.Nil(t, c.Err())
+	assert.Nil(t, c.Close())
+	d.mu.Lock()
+	assert.Equal(t, []uint32{0}, d.freed)
+	d.mu.Unlock()
+}
+
+func TestDialFail(t *testing.T) {
+	d := newDaemon(t)
+	addr := d.addr()
+	d.close()
+	_, err := pigpio.Dial(addr, pigpio.WithTimeout(100*time.Millisecond))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,183 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Composable filtering of edge events.
+
+package gpio
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stage is a stage of an input filter Pipeline.
+type Stage struct {
+	name string
+	// creates the state of the stage for a Filter.
+	new func() func(Event) bool
+}
+
+// NewStage creates a Stage with the given name, which identifies the stage in
+// the StageStats.
+//
+// The new function is called for each Filter created from a Pipeline
+// containing the stage, i.e. for each watch, and returns the function that
+// decides whether events pass the stage.  Any state required by the stage
+// should be captured by that function, so the Pipeline can be reused for
+// multiple pins.
+func NewStage(name string, new func() func(Event) bool) Stage {
+	return Stage{name: name, new: new}
+}
+
+// Name returns the name of the stage.
+func (s Stage) Name() string {
+	return s.name
+}
+
+// Predicate creates a stateless Stage that passes events for which the
+// predicate returns true.
+func Predicate(name string, predicate func(Event) bool) Stage {
+	return NewStage(name, func() func(Event) bool {
+		return predicate
+	})
+}
+
+// Debounce creates a Stage that discards events within the period following
+// an event passed by the stage.
+//
+// This passes the leading edge of a bouncing contact immediately.
+func Debounce(period time.Duration) Stage {
+	return NewStage("debounce", func() func(Event) bool {
+		var last time.Time
+		return func(evt Event) bool {
+			if !last.IsZero() && evt.Time.Sub(last) < period {
+				return false
+			}
+			last = evt.Time
+			return true
+		}
+	})
+}
+
+// Glitch creates a Stage that discards events within the period following
+// any event seen by the stage, passed or not.
+//
+// Unlike Debounce, a burst of edges is discarded until the input has been
+// quiet for the period, so pulses shorter than the period are discarded.
+func Glitch(period time.Duration) Stage {
+	return NewStage("glitch", func() func(Event) bool {
+		var last time.Time
+		return func(evt Event) bool {
+			quiet := last.IsZero() || evt.Time.Sub(last) >= period
+			last = evt.Time
+			return quiet
+		}
+	})
+}
+
+// RateLimit creates a Stage that passes at most n events per second, and
+// discards the remainder.
+//
+// Unlike WithMaxRate, the discarded events are not coalesced.
+func RateLimit(n int) Stage {
+	return NewStage("ratelimit", func() func(Event) bool {
+		var window time.Time
+		var count int
+		return func(evt Event) bool {
+			if evt.Time.Sub(window) >= time.Second {
+				window = evt.Time
+				count = 0
+			}
+			if count >= n {
+				return false
+			}
+			count++
+			return true
+		}
+	})
+}
+
+// Pipeline is a sequence of stages that condition the events on a watched
+// pin.
+//
+// Events are passed through the stages in order, and are discarded by the
+// first stage that rejects them.  Later stages do not see events discarded by
+// earlier stages.
+type Pipeline []Stage
+
+// NewPipeline creates a Pipeline from the stages.
+func NewPipeline(stages ...Stage) Pipeline {
+	return Pipeline(append([]Stage(nil), stages...))
+}
+
+// Then returns a Pipeline extending the pipeline with the stages.
+func (p Pipeline) Then(stages ...Stage) Pipeline {
+	return append(append(Pipeline(nil), p...), stages...)
+}
+
+// Filter creates a Filter that applies the pipeline, with its own stage state.
+//
+// Filters are created by WithPipeline for each watch, but may also be used
+// directly, such as to test a pipeline with synthesized events.
+func (p Pipeline) Filter() *Filter {
+	f := &Filter{stages: make([]*filterStage, len(p))}
+	for i, s := range p {
+		f.stages[i] = &filterStage{name: s.name, pass: s.new()}
+	}
+	return f
+}
+
+// Filter applies a Pipeline to a stream of events.
+//
+// Pass must not be called concurrently, but Stats may be called at any time.
+type Filter struct {
+	stages []*filterStage
+}
+
+type filterStage struct {
+	// first to ensure 64-bit alignment for atomic access.
+	passed    uint64
+	discarded uint64
+	name      string
+	pass      func(Event) bool
+}
+
+// StageStats contains the statistics for a stage of a Pipeline.
+type StageStats struct {
+	// Name is the name of the stage.
+	Name string
+
+	// Passed is the number of events passed by the stage.
+	Passed uint64
+
+	// Discarded is the number of events discarded by the stage.
+	Discarded uint64
+}
+
+// Pass passes the event through the stages, and returns true if it passed
+// them all.
+func (f *Filter) Pass(evt Event) bool {
+	for _, s := range f.stages {
+		if !s.pass(evt) {
+			atomic.AddUint64(&s.discarded, 1)
+			return false
+		}
+		atomic.AddUint64(&s.passed, 1)
+	}
+	return true
+}
+
+// Stats returns the statistics for each stage, in pipeline order.
+func (f *Filter) Stats() []StageStats {
+	stats := make([]StageStats, len(f.stages))
+	for i, s := range f.stages {
+		stats[i] = StageStats{
+			Name:      s.name,
+			Passed:    atomic.LoadUint64(&s.passed),
+			Discarded: atomic.LoadUint64(&s.discarded),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,69 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pass returns the offsets, in ms, of the events passed by the filter.
+func pass(f *Filter, offsets ...int) []int {
+	start := time.Now()
+	var passed []int
+	for i, o := range offsets {
+		evt := Event{
+			Level: i%2 == 0,
+			Time:  start.Add(time.Duration(o) * time.Millisecond),
+		}
+		if f.Pass(evt) {
+			passed = append(passed, o)
+		}
+	}
+	return passed
+}
+
+func TestDebounce(t *testing.T) {
+	f := NewPipeline(Debounce(10 * time.Millisecond)).Filter()
+	assert.Equal(t, []int{0, 12, 30}, pass(f, 0, 2, 5, 12, 15, 30))
+}
+
+func TestGlitch(t *testing.T) {
+	f := NewPipeline(Glitch(10 * time.Millisecond)).Filter()
+	assert.Equal(t, []int{0, 17, 40}, pass(f, 0, 2, 5, 7, 17, 20, 29, 40))
+}
+
+func TestRateLimit(t *testing.T) {
+	f := NewPipeline(RateLimit(2)).Filter()
+	assert.Equal(t, []int{0, 1, 1000, 1001}, pass(f, 0, 1, 2, 1000, 1001, 1002))
+}
+
+func TestPipeline(t *testing.T) {
+	high := Predicate("high", func(evt Event) bool {
+		return evt.Level == High
+	})
+	p := NewPipeline(Debounce(10 * time.Millisecond))
+	pp := p.Then(RateLimit(1), high)
+	assert.Len(t, p, 1)
+	assert.Len(t, pp, 3)
+	assert.Equal(t, "high", pp[2].Name())
+
+	f := pp.Filter()
+	// levels alternate from High, so the event at 1021 is Low.
+	assert.Equal(t, []int{0}, pass(f, 0, 5, 20, 1021, 1040))
+	assert.Equal(t, []StageStats{
+		{Name: "debounce", Passed: 4, Discarded: 1},
+		{Name: "ratelimit", Passed: 2, Discarded: 2},
+		{Name: "high", Passed: 1, Discarded: 1},
+	}, f.Stats())
+
+	// each filter has its own state.
+	f = pp.Filter()
+	assert.Equal(t, []int{0}, pass(f, 0))
+	assert.Equal(t, uint64(1), f.Stats()[2].Passed)
+}
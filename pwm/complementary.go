@@ -0,0 +1,252 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package pwm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Complementary drives a pair of pins with complementary software generated
+// PWM signals, such as for the high and low side switches of a half bridge.
+//
+// A dead time is inserted between one pin becoming inactive and the other
+// becoming active, so both switches are never on at the same time, and the
+// bridge cannot shoot through.  The dead time is guaranteed as both pins are
+// driven by the one goroutine, but is subject to the same jitter as PWM, so
+// will often be longer than requested.
+//
+// The high side pin is active for the duty cycle, and the low side pin for the
+// remainder of the period, less the dead times.  Duty cycles of 0 and 1 drive
+// the low side and high side constantly active respectively.
+type Complementary struct {
+	hi     gpio.Pinner
+	lo     gpio.Pinner
+	active gpio.Level
+	clock  clock.Clock
+	update chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// Guards the following
+	mu     sync.Mutex
+	period time.Duration
+	dead   time.Duration
+	duty   float64
+}
+
+// ComplementaryOption defines an option that can be applied when creating a
+// Complementary.
+type ComplementaryOption func(*Complementary)
+
+// WithComplementaryActiveLow inverts the PWMs, so the pins are driven Low when
+// active, e.g. for gate drivers with inverted inputs.
+func WithComplementaryActiveLow() ComplementaryOption {
+	return func(c *Complementary) {
+		c.active = gpio.Low
+	}
+}
+
+// WithComplementaryClock sets the clock used to time the PWMs and dead times,
+// e.g. a clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithComplementaryClock(clk clock.Clock) ComplementaryOption {
+	return func(c *Complementary) {
+		c.clock = clk
+	}
+}
+
+// NewComplementary creates a complementary PWM pair on the high and low side
+// pins, with the given frequency in Hz and dead time.
+//
+// The pins are set to Outputs, and are initially inactive.  The initial duty
+// cycle is 0, so the low side becomes active after the dead time.
+func NewComplementary(hi, lo gpio.Pinner, freq float64, dead time.Duration, options ...ComplementaryOption) *Complementary {
+	c := &Complementary{
+		hi:     hi,
+		lo:     lo,
+		active: gpio.High,
+		clock:  clock.Real,
+		update: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		period: period(freq),
+		dead:   deadTime(dead),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	hi.Write(!c.active)
+	lo.Write(!c.active)
+	hi.SetMode(gpio.Output)
+	lo.SetMode(gpio.Output)
+	c.wg.Add(1)
+	go c.run()
+	return c
+}
+
+// Close stops the PWM, and leaves both pins inactive.
+func (c *Complementary) Close() {
+	close(c.done)
+	c.wg.Wait()
+	c.hi.Write(!c.active)
+	c.lo.Write(!c.active)
+}
+
+// Duty returns the duty cycle, in the range 0 to 1.
+func (c *Complementary) Duty() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.duty
+}
+
+// SetDuty sets the duty cycle of the high side, in the range 0 to 1.
+//
+// Values outside that range are clamped.  Unlike PWM, changes to constant
+// levels are not applied immediately, as they are subject to the dead time.
+func (c *Complementary) SetDuty(duty float64) {
+	if duty < 0 {
+		duty = 0
+	} else if duty > 1 {
+		duty = 1
+	}
+	c.mu.Lock()
+	c.duty = duty
+	c.mu.Unlock()
+	c.signal()
+}
+
+// DeadTime returns the dead time inserted between transitions.
+func (c *Complementary) DeadTime() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dead
+}
+
+// SetDeadTime sets the dead time inserted between transitions.
+func (c *Complementary) SetDeadTime(dead time.Duration) {
+	c.mu.Lock()
+	c.dead = deadTime(dead)
+	c.mu.Unlock()
+}
+
+// Frequency returns the frequency of the PWM, in Hz.
+func (c *Complementary) Frequency() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return float64(time.Second) / float64(c.period)
+}
+
+// SetFrequency sets the frequency of the PWM, in Hz.
+func (c *Complementary) SetFrequency(freq float64) {
+	c.mu.Lock()
+	c.period = period(freq)
+	c.mu.Unlock()
+}
+
+func deadTime(dead time.Duration) time.Duration {
+	if dead < 0 {
+		return 0
+	}
+	return dead
+}
+
+func (c *Complementary) signal() {
+	select {
+	case c.update <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Complementary) run() {
+	defer c.wg.Done()
+	t := c.clock.NewTimer(0)
+	<-t.C()
+	sleep := func(d time.Duration) bool {
+		if d <= 0 {
+			return true
+		}
+		t.Reset(d)
+		select {
+		case <-c.done:
+			t.Stop()
+			return false
+		case <-t.C():
+			return true
+		}
+	}
+	// the state of the pins, and when one was last made inactive.
+	var hiOn, loOn bool
+	var off time.Time
+	// release makes both pins inactive.
+	release := func() {
+		if hiOn {
+			c.hi.Write(!c.active)
+			hiOn = false
+			off = c.clock.Now()
+		}
+		if loOn {
+			c.lo.Write(!c.active)
+			loOn = false
+			off = c.clock.Now()
+		}
+	}
+	// drive makes the selected side active, after the dead time has elapsed
+	// since the other side was made inactive.
+	drive := func(high bool, dead time.Duration) bool {
+		if (high && hiOn) || (!high && loOn) {
+			return true
+		}
+		release()
+		if !sleep(off.Add(dead).Sub(c.clock.Now())) {
+			return false
+		}
+		if high {
+			c.hi.Write(c.active)
+			hiOn = true
+		} else {
+			c.lo.Write(c.active)
+			loOn = true
+		}
+		return true
+	}
+	for {
+		c.mu.Lock()
+		duty, period, dead := c.duty, c.period, c.dead
+		c.mu.Unlock()
+		if duty <= 0 || duty >= 1 {
+			// constant level, so wait for a change.
+			if !drive(duty >= 1, dead) {
+				return
+			}
+			select {
+			case <-c.done:
+				return
+			case <-c.update:
+				continue
+			}
+		}
+		on := time.Duration(float64(period) * duty)
+		if !drive(true, dead) || !sleep(on) {
+			return
+		}
+		release()
+		low := period - on - 2*dead
+		if low <= 0 {
+			// no room for the low side, so just the dead times.
+			if !sleep(period - on) {
+				return
+			}
+			continue
+		}
+		if !drive(false, dead) || !sleep(low) {
+			return
+		}
+		release()
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package pwm
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// Dimmer drives a group of pins with software generated PWM signals from a
+// single goroutine, so the channels remain in phase and the cost of many
+// channels is little more than that of one.
+//
+// Levels are gamma corrected, so that equal steps in level appear as equal
+// steps in brightness, and channels can be faded together.
+type Dimmer struct {
+	pins   []gpio.Pinner
+	active gpio.Level
+	gamma  float64
+	clock  clock.Clock
+	update chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// Guards the following
+	mu     sync.Mutex
+	period time.Duration
+	ch     []channel
+}
+
+type channel struct {
+	level float64
+	// the fade in progress, if any.
+	fading   bool
+	from     float64
+	to       float64
+	start    time.Time
+	duration time.Duration
+}
+
+// DimmerOption defines an option that can be applied when creating a Dimmer.
+type DimmerOption func(*Dimmer)
+
+// WithGamma sets the gamma used to correct the levels.
+//
+// The default is 2.2.  A gamma of 1 disables correction.
+func WithGamma(gamma float64) DimmerOption {
+	return func(d *Dimmer) {
+		d.gamma = gamma
+	}
+}
+
+// WithDimmerActiveLow inverts the PWMs, so the pins are driven Low when
+// active, e.g. for LEDs connected to the supply.
+func WithDimmerActiveLow() DimmerOption {
+	return func(d *Dimmer) {
+		d.active = gpio.Low
+	}
+}
+
+// WithDimmerClock sets the clock used to time the PWMs and fades, e.g. a
+// clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithDimmerClock(c clock.Clock) DimmerOption {
+	return func(d *Dimmer) {
+		d.clock = c
+	}
+}
+
+// NewDimmer creates a Dimmer on the pins, one channel per pin, with the given
+// PWM frequency in Hz.
+//
+// The pins are set to Outputs, and are initially off.
+func NewDimmer(pins []gpio.Pinner, freq float64, options ...DimmerOption) *Dimmer {
+	d := &Dimmer{
+		pins:   pins,
+		active: gpio.High,
+		gamma:  2.2,
+		clock:  clock.Real,
+		update: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		period: period(freq),
+		ch:     make([]channel, len(pins)),
+	}
+	for _, option := range options {
+		option(d)
+	}
+	for _, p := range pins {
+		p.Write(!d.active)
+		p.SetMode(gpio.Output)
+	}
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+// Close stops the Dimmer, and leaves the pins inactive.
+func (d *Dimmer) Close() {
+	close(d.done)
+	d.wg.Wait()
+	for _, p := range d.pins {
+		p.Write(!d.active)
+	}
+}
+
+// Len returns the number of channels.
+func (d *Dimmer) Len() int {
+	return len(d.ch)
+}
+
+// Level returns the level of the channel, in the range 0 to 1.
+//
+// During a fade this is the level most recently applied by the fade.
+func (d *Dimmer) Level(ch int) float64 {
+	if ch < 0 || ch >= len(d.ch) {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ch[ch].level
+}
+
+// SetLevel sets the level of the channel, in the range 0 to 1, cancelling
+// any fade of the channel in progress.
+//
+// Values outside that range are clamped, and unknown channels are ignored.
+func (d *Dimmer) SetLevel(ch int, level float64) {
+	if ch < 0 || ch >= len(d.ch) {
+		return
+	}
+	d.mu.Lock()
+	d.ch[ch] = channel{level: clamp(level)}
+	d.mu.Unlock()
+	d.poke()
+}
+
+// Fade fades the channels from their current levels to the given levels,
+// keyed by channel, over the duration.
+//
+// The fades start together, and so finish together.  Fade returns
+// immediately, with the fade performed by the Dimmer goroutine.  The fade of a
+// channel is cancelled if its level is set, or it is included in a subsequent
+// fade, before the fade completes.
+func (d *Dimmer) Fade(levels map[int]float64, duration time.Duration) {
+	now := d.clock.Now()
+	d.mu.Lock()
+	for ch, level := range levels {
+		if ch < 0 || ch >= len(d.ch) {
+			continue
+		}
+		c := &d.ch[ch]
+		*c = channel{
+			level:    c.level,
+			fading:   true,
+			from:     c.level,
+			to:       clamp(level),
+			start:    now,
+			duration: duration,
+		}
+	}
+	d.mu.Unlock()
+	d.poke()
+}
+
+// Fading returns true if any channel is fading.
+func (d *Dimmer) Fading() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.ch {
+		if c.fading {
+			return true
+		}
+	}
+	return false
+}
+
+// Frequency returns the frequency of the PWMs, in Hz.
+func (d *Dimmer) Frequency() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return float64(time.Second) / float64(d.period)
+}
+
+// SetFrequency sets the frequency of the PWMs, in Hz.
+func (d *Dimmer) SetFrequency(freq float64) {
+	d.mu.Lock()
+	d.period = period(freq)
+	d.mu.Unlock()
+}
+
+func (d *Dimmer) poke() {
+	select {
+	case d.update <- struct{}{}:
+	default:
+	}
+}
+
+func clamp(level float64) float64 {
+	if level < 0 {
+		return 0
+	}
+	if level > 1 {
+		return 1
+	}
+	return level
+}
+
+// edge is the time, from the start of the period, that a channel turns off.
+type edge struct {
+	at time.Duration
+	ch int
+}
+
+// levels applies any fades in progress, and returns the on times of the
+// channels for the next period, and whether any channel requires switching
+// within the period, either to generate a PWM or to fade.
+func (d *Dimmer) levels(now time.Time, on []time.Duration) (time.Duration, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	active := false
+	for i := range d.ch {
+		c := &d.ch[i]
+		if c.fading {
+			active = true
+			f := 1.0
+			if c.duration > 0 {
+				f = float64(now.Sub(c.start)) / float64(c.duration)
+			}
+			if f >= 1 {
+				c.level = c.to
+				c.fading = false
+			} else {
+				c.level = c.from + (c.to-c.from)*f
+			}
+		}
+		on[i] = time.Duration(float64(d.period) * math.Pow(c.level, d.gamma))
+		if on[i] > 0 && on[i] < d.period {
+			active = true
+		}
+	}
+	return d.period, active
+}
+
+func (d *Dimmer) run() {
+	defer d.wg.Done()
+	t := d.clock.NewTimer(0)
+	<-t.C()
+	sleepUntil := func(deadline time.Time) bool {
+		t.Reset(deadline.Sub(d.clock.Now()))
+		select {
+		case <-d.done:
+			t.Stop()
+			return false
+		case <-t.C():
+			return true
+		}
+	}
+	on := make([]time.Duration, len(d.ch))
+	edges := make([]edge, 0, len(d.ch))
+	for {
+		start := d.clock.Now()
+		period, active := d.levels(start, on)
+		edges = edges[:0]
+		for i, p := range d.pins {
+			switch {
+			case on[i] <= 0:
+				p.Write(!d.active)
+			case on[i] >= period:
+				p.Write(d.active)
+			default:
+				p.Write(d.active)
+				edges = append(edges, edge{on[i], i})
+			}
+		}
+		if !active {
+			// constant levels, so wait for a change.
+			select {
+			case <-d.done:
+				return
+			case <-d.update:
+				continue
+			}
+		}
+		sort.Slice(edges, func(i, j int) bool { return edges[i].at < edges[j].at })
+		for _, e := range edges {
+			if !sleepUntil(start.Add(e.at)) {
+				return
+			}
+			d.pins[e.ch].Write(!d.active)
+		}
+		if !sleepUntil(start.Add(period)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package pwm provides software pulse width modulation on GPIO pins.
+package pwm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+)
+
+// PWM drives a pin with a software generated PWM signal.
+//
+// The signal is generated by a goroutine toggling the pin, so the timing will
+// jitter with system load.  This is fine for LEDs and motors, but not for
+// applications requiring precise timing, such as servos.
+//
+// Duty cycles of 0 and 1 drive the pin constantly inactive and active
+// respectively, and are applied immediately, so a PWM can also be used as a plain output.
+type PWM struct {
+	pin    gpio.Pinner
+	active gpio.Level
+	clock  clock.Clock
+	update chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// Guards the following and writes to the pin.
+	mu     sync.Mutex
+	period time.Duration
+	duty   float64
+}
+
+// Option defines an option that can be applied when creating a PWM.
+type Option func(*PWM)
+
+// WithActiveLow inverts the PWM, so the duty cycle is the proportion of the
+// time the pin is driven Low, e.g. for LEDs connected to the supply.
+func WithActiveLow() Option {
+	return func(p *PWM) {
+		p.active = gpio.Low
+	}
+}
+
+// WithClock sets the clock used to time the PWM, e.g. a clock.Fake for tests.
+//
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(p *PWM) {
+		p.clock = c
+	}
+}
+
+// New creates a PWM on the pin, with the given frequency in Hz.
+//
+// The pin is set to an Output, and is initially inactive, i.e. Low unless
+// WithActiveLow is specified.
+func New(pin gpio.Pinner, freq float64, options ...Option) *PWM {
+	p := &PWM{
+		pin:    pin,
+		active: gpio.High,
+		clock:  clock.Real,
+		update: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		period: period(freq),
+	}
+	for _, option := range options {
+		option(p)
+	}
+	pin.Write(!p.active)
+	pin.SetMode(gpio.Output)
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+// Close stops the PWM, and leaves the pin inactive.
+func (p *PWM) Close() {
+	close(p.done)
+	p.wg.Wait()
+	p.mu.Lock()
+	p.duty = 0
+	p.pin.Write(!p.active)
+	p.mu.Unlock()
+}
+
+// Duty returns the duty cycle, in the range 0 to 1.
+func (p *PWM) Duty() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.duty
+}
+
+// SetDuty sets the duty cycle, in the range 0 to 1.
+//
+// Values outside that range are clamped.
+func (p *PWM) SetDuty(duty float64) {
+	if duty < 0 {
+		duty = 0
+	} else if duty > 1 {
+		duty = 1
+	}
+	p.mu.Lock()
+	p.duty = duty
+	if duty == 0 {
+		p.pin.Write(!p.active)
+	} else if duty == 1 {
+		p.pin.Write(p.active)
+	}
+	p.mu.Unlock()
+	select {
+	case p.update <- struct{}{}:
+	default:
+	}
+}
+
+// Frequency returns the frequency of the PWM, in Hz.
+func (p *PWM) Frequency() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return float64(time.Second) / float64(p.period)
+}
+
+// SetFrequency sets the frequency of the PWM, in Hz.
+func (p *PWM) SetFrequency(freq float64) {
+	p.mu.Lock()
+	p.period = period(freq)
+	p.mu.Unlock()
+}
+
+func period(freq float64) time.Duration {
+	if freq <= 0 {
+		freq = 1
+	}
+	return time.Duration(float64(time.Second) / freq)
+}
+
+func (p *PWM) run() {
+	defer p.wg.Done()
+	t := p.clock.NewTimer(0)
+	<-t.C()
+	sleep := func(d time.Duration) bool {
+		t.Reset(d)
+		select {
+		case <-p.done:
+			t.Stop()
+			return false
+		case <-t.C():
+			return true
+		}
+	}
+	for {
+		p.mu.Lock()
+		duty, period := p.duty, p.period
+		if duty <= 0 || duty >= 1 {
+			// constant level, so wait for a change.
+			p.mu.Unlock()
+			select {
+			case <-p.done:
+				return
+			case <-p.update:
+				continue
+			}
+		}
+		p.pin.Write(p.active)
+		p.mu.Unlock()
+		on := time.Duration(float64(period) * duty)
+		if !sleep(on) {
+			return
+		}
+		p.mu.Lock()
+		if p.duty > 0 && p.duty < 1 {
+			p.pin.Write(!p.active)
+		}
+		p.mu.Unlock()
+		if !sleep(period - on) {
+			return
+		}
+	}
+}
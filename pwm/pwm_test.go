@@ -0,0 +1,286 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package pwm_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/clock"
+	"github.com/warthog618/gpio/mock"
+	"github.com/warthog618/gpio/pwm"
+)
+
+func TestPWM(t *testing.T) {
+	pin := mock.NewPin(1)
+	pin.Set(gpio.High)
+	p := pwm.New(pin, 1000)
+	assert.Equal(t, gpio.Output, pin.Mode())
+	assert.Equal(t, gpio.Low, pin.Read())
+	assert.InDelta(t, 1000, p.Frequency(), 0.001)
+	p.SetDuty(1)
+	assert.Equal(t, gpio.High, pin.Read())
+	assert.Equal(t, 1.0, p.Duty())
+	p.SetDuty(-1)
+	assert.Equal(t, gpio.Low, pin.Read())
+	assert.Equal(t, 0.0, p.Duty())
+	p.SetDuty(2)
+	assert.Equal(t, 1.0, p.Duty())
+
+	var rising int32
+	assert.Nil(t, pin.Watch(gpio.EdgeRising, func(gpio.Pinner) {
+		atomic.AddInt32(&rising, 1)
+	}))
+	atomic.StoreInt32(&rising, 0)
+	p.SetFrequency(200)
+	p.SetDuty(0.5)
+	time.Sleep(100 * time.Millisecond)
+	p.Close()
+	assert.Equal(t, gpio.Low, pin.Read())
+	// ~20 cycles, with generous allowance for scheduling.
+	n := atomic.LoadInt32(&rising)
+	assert.True(t, n > 5 && n <= 21, n)
+}
+
+func TestPWMActiveLow(t *testing.T) {
+	pin := mock.NewPin(1)
+	p := pwm.New(pin, 1000, pwm.WithActiveLow())
+	assert.Equal(t, gpio.High, pin.Read())
+	p.SetDuty(1)
+	assert.Equal(t, gpio.Low, pin.Read())
+	p.Close()
+	assert.Equal(t, gpio.High, pin.Read())
+}
+
+func TestDimmer(t *testing.T) {
+	pins := []*mock.Pin{mock.NewPin(1), mock.NewPin(2), mock.NewPin(3)}
+	pp := make([]gpio.Pinner, len(pins))
+	for i, p := range pins {
+		p.Set(gpio.High)
+		pp[i] = p
+	}
+	d := pwm.NewDimmer(pp, 200, pwm.WithGamma(1))
+	assert.Equal(t, 3, d.Len())
+	assert.InDelta(t, 200, d.Frequency(), 0.001)
+	for _, p := range pins {
+		assert.Equal(t, gpio.Output, p.Mode())
+		assert.Equal(t, gpio.Low, p.Read())
+	}
+	d.SetLevel(0, 1)
+	d.SetLevel(1, 2)
+	d.SetLevel(5, 1)
+	assert.Equal(t, 1.0, d.Level(0))
+	assert.Equal(t, 1.0, d.Level(1))
+	assert.Equal(t, 0.0, d.Level(2))
+	assert.Equal(t, 0.0, d.Level(5))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, gpio.High, pins[0].Read())
+	assert.Equal(t, gpio.High, pins[1].Read())
+	assert.Equal(t, gpio.Low, pins[2].Read())
+
+	var rising, falling int32
+	assert.Nil(t, pins[2].Watch(gpio.EdgeBoth, func(p gpio.Pinner) {
+		if p.Read() == gpio.High {
+			atomic.AddInt32(&rising, 1)
+		} else {
+			atomic.AddInt32(&falling, 1)
+		}
+	}))
+	atomic.StoreInt32(&falling, 0)
+	d.SetLevel(1, 0)
+	d.SetLevel(2, 0.5)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, gpio.High, pins[0].Read())
+	assert.Equal(t, gpio.Low, pins[1].Read())
+	// ~20 cycles, with generous allowance for scheduling.
+	n := atomic.LoadInt32(&rising)
+	assert.True(t, n > 5 && n <= 22, n)
+	d.Close()
+	for _, p := range pins {
+		assert.Equal(t, gpio.Low, p.Read())
+	}
+}
+
+func TestDimmerFade(t *testing.T) {
+	pp := []gpio.Pinner{mock.NewPin(1), mock.NewPin(2)}
+	clk := clock.NewFake(epoch)
+	d := pwm.NewDimmer(pp, 500, pwm.WithDimmerClock(clk))
+	defer d.Close()
+	d.SetLevel(1, 1)
+	assert.False(t, d.Fading())
+	d.Fade(map[int]float64{0: 1, 1: 0, 4: 1}, 100*time.Millisecond)
+	assert.True(t, d.Fading())
+	for clk.Now().Sub(epoch) < 50*time.Millisecond {
+		clk.BlockUntil(1)
+		clk.Advance(100 * time.Microsecond)
+	}
+	clk.BlockUntil(1)
+	l0 := d.Level(0)
+	l1 := d.Level(1)
+	// applied at the start of each 2ms period.
+	assert.InDelta(t, 0.49, l0, 0.015)
+	// the fades are synchronized.
+	assert.InDelta(t, 1, l0+l1, 0.001)
+	for d.Fading() {
+		clk.Advance(100 * time.Microsecond)
+		clk.BlockUntil(1)
+	}
+	assert.InDelta(t, 100*time.Millisecond, clk.Now().Sub(epoch), float64(2*time.Millisecond))
+	assert.Equal(t, 1.0, d.Level(0))
+	assert.Equal(t, 0.0, d.Level(1))
+	assert.Equal(t, gpio.High, pp[0].Read())
+	assert.Equal(t, gpio.Low, pp[1].Read())
+
+	// SetLevel cancels a fade.
+	d.Fade(map[int]float64{0: 0}, time.Second)
+	d.SetLevel(0, 0.25)
+	assert.False(t, d.Fading())
+	assert.Equal(t, 0.25, d.Level(0))
+}
+
+func TestDimmerActiveLow(t *testing.T) {
+	pin := mock.NewPin(1)
+	d := pwm.NewDimmer([]gpio.Pinner{pin}, 1000, pwm.WithDimmerActiveLow())
+	assert.Equal(t, gpio.High, pin.Read())
+	d.SetLevel(0, 1)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, gpio.Low, pin.Read())
+	d.Close()
+	assert.Equal(t, gpio.High, pin.Read())
+}
+
+func TestComplementary(t *testing.T) {
+	hi := mock.NewPin(1)
+	lo := mock.NewPin(2)
+	hi.Set(gpio.High)
+	lo.Set(gpio.High)
+	clk := clock.NewFake(epoch)
+	ch := make(chan transition, 10)
+	dead := 500 * time.Microsecond
+	c := pwm.NewComplementary(hi, lo, 100, dead, pwm.WithComplementaryClock(clk))
+	assert.Equal(t, gpio.Output, hi.Mode())
+	assert.Equal(t, gpio.Output, lo.Mode())
+	assert.Equal(t, dead, c.DeadTime())
+	assert.InDelta(t, 100, c.Frequency(), 0.001)
+	assert.Nil(t, hi.Watch(gpio.EdgeBoth, record(clk, ch)))
+	assert.Equal(t, transition{1, gpio.Low, 0}, waitTransition(t, ch))
+	assert.Nil(t, lo.Watch(gpio.EdgeBoth, record(clk, ch)))
+	// the low side may already be active, so skip the initial call.
+	for waitTransition(t, ch).level == gpio.Low {
+	}
+	assert.Equal(t, gpio.Low, hi.Read())
+	assert.Equal(t, gpio.High, lo.Read())
+
+	// step advances the clock once the PWM has armed its timer, and returns
+	// the resulting transition.
+	step := func(d time.Duration) transition {
+		clk.BlockUntil(1)
+		clk.Advance(d)
+		return waitTransition(t, ch)
+	}
+	c.SetDuty(0.25)
+	assert.Equal(t, transition{2, gpio.Low, 0}, waitTransition(t, ch))
+	// the high side is not driven until the dead time has elapsed.
+	clk.BlockUntil(1)
+	clk.Advance(dead - time.Microsecond)
+	assert.Len(t, ch, 0)
+	assert.Equal(t, transition{1, gpio.High, dead}, step(time.Microsecond))
+	ms := time.Millisecond
+	for i := 0; i < 3; i++ {
+		base := time.Duration(i) * 10 * ms
+		assert.Equal(t, transition{1, gpio.Low, base + 3*ms}, step(2500*time.Microsecond))
+		assert.Equal(t, transition{2, gpio.High, base + 3*ms + dead}, step(dead))
+		assert.Equal(t, transition{2, gpio.Low, base + 10*ms}, step(6500*time.Microsecond))
+		assert.Equal(t, transition{1, gpio.High, base + 10*ms + dead}, step(dead))
+	}
+
+	// changes to constant levels are applied at the end of the period, and
+	// are subject to the dead time.
+	c.SetDuty(1)
+	assert.Equal(t, transition{1, gpio.Low, 33 * ms}, step(2500*time.Microsecond))
+	assert.Equal(t, transition{2, gpio.High, 33*ms + dead}, step(dead))
+	assert.Equal(t, transition{2, gpio.Low, 40 * ms}, step(6500*time.Microsecond))
+	assert.Equal(t, transition{1, gpio.High, 40*ms + dead}, step(dead))
+	c.SetDuty(-1)
+	assert.Equal(t, 0.0, c.Duty())
+	assert.Equal(t, transition{1, gpio.Low, 40*ms + dead}, waitTransition(t, ch))
+	assert.Equal(t, transition{2, gpio.High, 40*ms + 2*dead}, step(dead))
+
+	// duty cycles that leave no room for the low side just insert the dead
+	// times.
+	c.SetDuty(0.95)
+	assert.Equal(t, transition{2, gpio.Low, 40*ms + 2*dead}, waitTransition(t, ch))
+	assert.Equal(t, transition{1, gpio.High, 40*ms + 3*dead}, step(dead))
+	assert.Equal(t, transition{1, gpio.Low, 51 * ms}, step(9500*time.Microsecond))
+	assert.Equal(t, transition{1, gpio.High, 51*ms + dead}, step(dead))
+
+	c.Close()
+	assert.Equal(t, transition{1, gpio.Low, 51*ms + dead}, waitTransition(t, ch))
+	assert.Equal(t, gpio.Low, lo.Read())
+	assert.Len(t, ch, 0)
+}
+
+func TestComplementaryActiveLow(t *testing.T) {
+	hi := mock.NewPin(1)
+	lo := mock.NewPin(2)
+	c := pwm.NewComplementary(hi, lo, 1000, 0, pwm.WithComplementaryActiveLow())
+	assert.Equal(t, gpio.High, hi.Read())
+	c.SetDeadTime(-time.Second)
+	assert.Zero(t, c.DeadTime())
+	c.SetDuty(1)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, gpio.Low, hi.Read())
+	assert.Equal(t, gpio.High, lo.Read())
+	c.Close()
+	assert.Equal(t, gpio.High, hi.Read())
+	assert.Equal(t, gpio.High, lo.Read())
+}
+
+func TestPWMFakeClock(t *testing.T) {
+	pin := mock.NewPin(1)
+	c := clock.NewFake(time.Now())
+	p := pwm.New(pin, 100, pwm.WithClock(c))
+	defer p.Close()
+	p.SetDuty(0.25)
+	for i := 0; i < 3; i++ {
+		c.BlockUntil(1)
+		assert.Equal(t, gpio.High, pin.Read())
+		c.Advance(2500 * time.Microsecond)
+		c.BlockUntil(1)
+		assert.Equal(t, gpio.Low, pin.Read())
+		c.Advance(7500 * time.Microsecond)
+	}
+}
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// transition is a change in the level of a pin, at a time relative to the
+// epoch.
+type transition struct {
+	pin   int
+	level gpio.Level
+	at    time.Duration
+}
+
+func record(clk clock.Clock, ch chan<- transition) func(gpio.Pinner) {
+	return func(p gpio.Pinner) {
+		ch <- transition{p.(*mock.Pin).Pin(), p.Read(), clk.Now().Sub(epoch)}
+	}
+}
+
+func waitTransition(t *testing.T, ch <-chan transition) transition {
+	t.Helper()
+	select {
+	case tr := <-ch:
+		return tr
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for transition")
+	}
+	return transition{}
+}
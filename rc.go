@@ -0,0 +1,37 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import "time"
+
+// ReadRC measures the time taken for an RC network connected to the pin to
+// charge past the input threshold.
+//
+// The pin is first driven Low for the discharge period to discharge the
+// capacitor, and is then switched to an Input and polled until it reads High.
+// The returned duration is relative to the resistance, so this can be used to
+// read photoresistors, thermistors and potentiometers without an ADC.  The
+// value depends on the capacitor and the input threshold, so it should be
+// calibrated for the circuit.
+//
+// Returns ErrTimeout if the pin does not read High before the timeout.
+// The pin is left as an Input.
+func (pin *Pin) ReadRC(discharge, timeout time.Duration) (time.Duration, error) {
+	pin.Write(Low)
+	pin.SetMode(Output)
+	time.Sleep(discharge)
+	pin.SetMode(Input)
+	start := time.Now()
+	for {
+		d := time.Since(start)
+		if pin.Read() == High {
+			return d, nil
+		}
+		if d > timeout {
+			return d, ErrTimeout
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//
+//  Test suite for RC timing and touch sensing.
+//
+//	Tests use J8 pins 7 (mostly) and 15 and 16 (for looped tests)
+//
+package gpio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+func TestReadRC(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	// J8p7 is pulled up, so charges quickly.
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
+	d, err := pin.ReadRC(time.Millisecond, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, d < 10*time.Millisecond)
+	assert.Equal(t, gpio.Input, pin.Mode())
+}
+
+// Looped tests require a jumper across Raspberry Pi J8 pins 15 and 16.
+func TestReadRCTimeoutLooped(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pinOut, err := gpio.NewPin(gpio.J8p16,
+		gpio.WithInitialLevel(gpio.Low),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	defer pinOut.SetMode(gpio.Input)
+	pin, err := gpio.NewPin(gpio.J8p15)
+	assert.Nil(t, err)
+	// held low by pinOut, so never charges.
+	_, err = pin.ReadRC(time.Microsecond, time.Millisecond)
+	assert.Equal(t, gpio.ErrTimeout, err)
+}
+
+func TestTouchSensor(t *testing.T) {
+	setupDIO(t)
+	defer teardownDIO()
+	pin, err := gpio.NewPin(gpio.J8p7)
+	assert.Nil(t, err)
+	ch := make(chan bool, 1)
+	ts := gpio.NewTouchSensor(pin,
+		gpio.WithTouchSamples(4),
+		gpio.WithTouchPeriod(time.Millisecond),
+		gpio.WithTouchHandler(func(touched bool) {
+			ch <- touched
+		}))
+	defer ts.Close()
+	assert.True(t, ts.Baseline() > 0)
+	// nothing is attached, so no touches.
+	select {
+	case <-ch:
+		t.Error("unexpected touch")
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.False(t, ts.Touched())
+}
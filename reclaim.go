@@ -0,0 +1,442 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Reclaiming and adoption of pins left exported on sysfs.
+
+// +build linux
+
+package gpio
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// sysfsRoot is the root of the sysfs GPIO interface.
+var sysfsRoot = "/sys/class/gpio"
+
+// adoptExports, if non-zero, allows watches to adopt pins left exported on
+// sysfs by a previous run of the program, rather than failing with ErrBusy.
+var adoptExports int32
+
+// exportsDir is the directory recording the pins exported by each process,
+// by program and pid, so the exports left by a crashed run can be identified.
+//
+// The directory, and the directory of each program within it, are created
+// 0700, and the records are only trusted if the directories are owned by the
+// effective user and are inaccessible to others.
+var exportsDir = defaultExportsDir()
+
+var (
+	// Guards the following
+	ownedMu sync.Mutex
+	// the pins exported by this process.
+	owned = make(map[int]bool)
+	// true once WithReclaim or Reclaim has been used, after which the pins
+	// exported by this process are recorded.
+	recording bool
+)
+
+// defaultExportsDir returns the runtime directory used to record exports,
+// /run/gpio for root, else within the runtime directory of the user, if any.
+func defaultExportsDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+		return filepath.Join(dir, "gpio")
+	}
+	return "/run/gpio"
+}
+
+// Reclaim removes the sysfs exports left by previous runs of the program that
+// exited, e.g. by crashing, before removing their watches.
+//
+// The pins exported by each process are recorded, so only the exports
+// recorded by runs of the same executable that are no longer running are
+// reclaimed.  Pins exported by other programs, by running instances of the
+// program, or by udev rules, init scripts or the shell, are not affected, nor
+// are pins watched by this process.
+//
+// The edge of each pin is reset to none before the pin is unexported.
+// Returns the pins reclaimed.  The pins subsequently exported by this process
+// are recorded, so they may be reclaimed by later runs.
+func Reclaim() ([]int, error) {
+	recordExports()
+	stale, err := staleExports()
+	if err != nil {
+		return nil, err
+	}
+	var pins []int
+	for pid, pp := range stale {
+		for _, n := range pp {
+			p := &Pin{pin: n}
+			if isWatched(n) || !isExported(p) {
+				continue
+			}
+			// the edge file is only writable for inputs.
+			setEdge(p, EdgeNone)
+			if err := unexport(p); err != nil {
+				return pins, err
+			}
+			logDebug("reclaimed sysfs export", "pin", n, "pid", pid)
+			pins = append(pins, n)
+		}
+		os.Remove(exportsFile(pid))
+	}
+	sort.Ints(pins)
+	return pins, nil
+}
+
+// staleExports returns the pins recorded as exported by runs of the program
+// that are no longer running, by pid.
+//
+// Returns ErrUntrustedRecords if the records may have been written by another
+// user.
+func staleExports() (map[int][]int, error) {
+	dir := filepath.Dir(exportsFile(0))
+	for _, d := range []string{exportsDir, dir} {
+		err := checkDir(d)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	ff, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	stale := make(map[int][]int)
+	for _, f := range ff {
+		pid, err := strconv.Atoi(f.Name())
+		if err != nil || pid == os.Getpid() || running(pid) {
+			continue
+		}
+		b, err := readRecord(exportsFile(pid))
+		if err != nil {
+			continue
+		}
+		var pins []int
+		for _, field := range strings.Fields(string(b)) {
+			n, err := strconv.Atoi(field)
+			if err == nil && n >= 0 && n < MaxCMGPIOPin {
+				pins = append(pins, n)
+			}
+		}
+		stale[pid] = pins
+	}
+	return stale, nil
+}
+
+// isStale returns true if the pin is recorded as exported by a run of the
+// program that is no longer running.
+func isStale(pin int) bool {
+	stale, _ := staleExports()
+	for _, pins := range stale {
+		for _, n := range pins {
+			if n == pin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// running returns true if the process is running.
+func running(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || err == unix.EPERM
+}
+
+// exportsFile returns the path of the file recording the pins exported by
+// the process.
+func exportsFile(pid int) string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	program := strings.Replace(filepath.Clean(exe), string(filepath.Separator), "_", -1)
+	return filepath.Join(exportsDir, program, strconv.Itoa(pid))
+}
+
+// recordExports enables the recording of the pins exported by this process,
+// including those already exported.
+func recordExports() {
+	ownedMu.Lock()
+	defer ownedMu.Unlock()
+	if recording {
+		return
+	}
+	recording = true
+	if len(owned) != 0 {
+		writeExports()
+	}
+}
+
+// recordExport records the pin as exported, or not, by this process.
+//
+// The record is only written once recording has been enabled by
+// recordExports.
+func recordExport(pin int, exported bool) {
+	ownedMu.Lock()
+	defer ownedMu.Unlock()
+	if exported == owned[pin] {
+		return
+	}
+	if exported {
+		owned[pin] = true
+	} else {
+		delete(owned, pin)
+	}
+	if recording {
+		writeExports()
+	}
+}
+
+// writeExports writes the record of the pins exported by this process, or
+// removes it if there are none.
+//
+// The record is replaced, rather than rewritten, so an existing file, or a
+// symlink, is never written through.  Failures are logged but otherwise
+// ignored, as they only prevent reclaiming by later runs.
+// Assumes the caller holds the ownedMu lock.
+func writeExports() {
+	path := exportsFile(os.Getpid())
+	dir := filepath.Dir(path)
+	if len(owned) == 0 {
+		if checkDir(dir) == nil {
+			os.Remove(path)
+		}
+		return
+	}
+	pins := make([]int, 0, len(owned))
+	for n := range owned {
+		pins = append(pins, n)
+	}
+	sort.Ints(pins)
+	var b strings.Builder
+	for _, n := range pins {
+		b.WriteString(strconv.Itoa(n) + "\n")
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err == nil {
+		err = checkDir(exportsDir)
+	}
+	if err == nil {
+		err = checkDir(dir)
+	}
+	if err == nil {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = writeRecord(path, b.String())
+	}
+	if err != nil {
+		logWarn("recording sysfs exports failed", "path", path, "err", err)
+	}
+}
+
+// writeRecord creates the record file, which must not already exist.
+func writeRecord(path, record string) error {
+	f, err := os.OpenFile(path,
+		os.O_WRONLY|os.O_CREATE|os.O_EXCL|unix.O_NOFOLLOW, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(record)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readRecord returns the contents of the record file, which must not be a
+// symlink.
+func readRecord(path string) ([]byte, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// checkDir returns nil if the path is a directory, rather than a symlink,
+// that is owned by the effective user and is inaccessible to others, so only
+// this user can have written the records within it.
+func checkDir(path string) error {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		return &os.PathError{Op: "lstat", Path: path, Err: err}
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR ||
+		int(st.Uid) != os.Geteuid() ||
+		st.Mode&0077 != 0 {
+		return ErrUntrustedRecords
+	}
+	return nil
+}
+
+// Export describes the sysfs export of a pin, and the use of its line, as
+// found by LookupExport.
+type Export struct {
+	// Pin is the number of the pin.
+	Pin int
+
+	// Exported is true if the pin is exported on sysfs.
+	Exported bool
+
+	// Mode is the direction of the export, Input or Output.
+	Mode Mode
+
+	// Edge is the edge set on the export.
+	Edge Edge
+
+	// Used is true if the line is in use, by sysfs, a kernel driver, or
+	// another process, as reported by the GPIO character device.
+	Used bool
+
+	// Consumer is the label of the user of the line, e.g. "sysfs" for
+	// exports, or the name of the kernel driver, if reported by the GPIO
+	// character device.
+	Consumer string
+
+	// Watched is true if the pin is watched by this process.
+	Watched bool
+}
+
+// LookupExport returns the state of the sysfs export of the pin, and who is
+// using the line, where that can be determined.
+//
+// This allows a program to check for pins configured by udev rules or init
+// scripts before watching them, and to adopt such exports using WithAdopt.
+// The use of the line is found via the GPIO character device, if available,
+// so pins claimed by kernel drivers, e.g. gpio-keys or w1-gpio, are reported
+// as Used, even though they are not exported.
+func LookupExport(pin int) (Export, error) {
+	if pin < 0 || pin >= MaxCMGPIOPin {
+		return Export{}, ErrInvalidPin
+	}
+	p := &Pin{pin: pin}
+	e := Export{Pin: pin, Watched: isWatched(pin)}
+	e.Used, e.Consumer = lineUsage(pin)
+	if !isExported(p) {
+		return e, nil
+	}
+	e.Exported = true
+	dir, err := readSysfs(p, "direction")
+	if err != nil {
+		return e, err
+	}
+	if dir == "out" {
+		e.Mode = Output
+	}
+	edge, err := readSysfs(p, "edge")
+	if err != nil {
+		return e, err
+	}
+	e.Edge = Edge(edge)
+	return e, nil
+}
+
+// lineUsage returns whether the line of the pin is in use, and the consumer
+// of the line, as reported by the character device providing the header
+// pins.
+//
+// Returns false if no such character device is available.
+func lineUsage(pin int) (bool, string) {
+	memlock.Lock()
+	defer memlock.Unlock()
+	c := cdev
+	if c == nil {
+		c = findHeaderChip()
+		if c == nil {
+			return false, ""
+		}
+		defer c.close()
+	}
+	if pin >= c.lines {
+		return false, ""
+	}
+	li, err := c.lineInfo(pin)
+	if err != nil {
+		return false, ""
+	}
+	return li.Flags&lineFlagKernel != 0, cstring(li.Consumer[:])
+}
+
+// findHeaderChip opens the character device providing the header pins, or
+// returns nil if there is none.
+func findHeaderChip() *charDev {
+	paths, _ := filepath.Glob("/dev/gpiochip*")
+	for _, path := range paths {
+		c, err := openCharDev(path)
+		if err != nil {
+			continue
+		}
+		if c.chipset() != 0 {
+			return c
+		}
+		c.close()
+	}
+	return nil
+}
+
+// readSysfs returns the contents of the sysfs file of the pin, without the
+// trailing newline.
+func readSysfs(p *Pin, name string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(sysfsPath(p), name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// isWatched returns true if the pin is watched via sysfs by the default
+// watcher.
+func isWatched(pin int) bool {
+	memlock.Lock()
+	w := defaultWatcher
+	memlock.Unlock()
+	if w == nil {
+		return false
+	}
+	w.Lock()
+	defer w.Unlock()
+	_, ok := w.interruptFds[pinID{pin: pin}]
+	return ok
+}
+
+// isExported returns true if the pin is exported on sysfs.
+func isExported(p *Pin) bool {
+	_, err := os.Stat(filepath.Join(sysfsPath(p), "value"))
+	return err == nil
+}
+
+func sysfsPath(p *Pin) string {
+	return filepath.Join(sysfsRoot, "gpio"+strconv.Itoa(p.pin))
+}
+
+func adopting() bool {
+	return atomic.LoadInt32(&adoptExports) != 0
+}
+
+var (
+	// ErrUntrustedRecords indicates the directory recording the pins exported
+	// by each process is not owned by the user, or is accessible to other
+	// users, so the records cannot be trusted.
+	ErrUntrustedRecords = errors.New("untrusted export records")
+)
@@ -0,0 +1,258 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package gpio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSysfs creates a sysfs GPIO tree with the pins exported.
+func fakeSysfs(t *testing.T, pins ...string) func() {
+	dir, err := ioutil.TempDir("", "sysfs")
+	require.Nil(t, err)
+	for _, f := range []string{"export", "unexport"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, f), nil, 0644))
+	}
+	for _, p := range pins {
+		pd := filepath.Join(dir, p)
+		require.Nil(t, os.Mkdir(pd, 0755))
+		for _, f := range []string{"value", "edge"} {
+			require.Nil(t, ioutil.WriteFile(filepath.Join(pd, f), []byte("both"), 0644))
+		}
+	}
+	old := sysfsRoot
+	sysfsRoot = dir
+	return func() {
+		sysfsRoot = old
+		os.RemoveAll(dir)
+	}
+}
+
+// fakeExports records the pins as exported by the process.
+func fakeExports(t *testing.T, pid int, pins string) {
+	path := exportsFile(pid)
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.Nil(t, ioutil.WriteFile(path, []byte(pins), 0600))
+}
+
+// fakeExportsDir records exports in a temporary directory, with recording
+// enabled as per recording.
+func fakeExportsDir(t *testing.T, enabled bool) (string, func()) {
+	dir, err := ioutil.TempDir("", "exports")
+	require.Nil(t, err)
+	old := exportsDir
+	exportsDir = dir
+	ownedMu.Lock()
+	oldRecording := recording
+	recording = enabled
+	ownedMu.Unlock()
+	return dir, func() {
+		ownedMu.Lock()
+		recording = oldRecording
+		ownedMu.Unlock()
+		exportsDir = old
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReclaim(t *testing.T) {
+	cleanup := fakeSysfs(t, "gpio17", "gpio4", "gpio5", "gpio6", "gpiochip0", "gpio200")
+	defer cleanup()
+	dir, cleanupExports := fakeExportsDir(t, false)
+	defer cleanupExports()
+
+	// beyond the pid limit, so not running.
+	dead := 1<<22 + 1
+	fakeExports(t, dead, "17\n4\n200\n")
+	// running, so left alone.
+	fakeExports(t, 1, "5\n")
+	// gpio6 is not recorded, so is exported by something else.
+	pins, err := Reclaim()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{4, 17}, pins)
+	for _, p := range []string{"gpio4", "gpio17"} {
+		edge, err := ioutil.ReadFile(filepath.Join(sysfsRoot, p, "edge"))
+		assert.Nil(t, err)
+		assert.Equal(t, "none", string(edge[:4]), p)
+	}
+	// out of range, running and unrecorded pins are left alone.
+	for _, p := range []string{"gpio200", "gpio5", "gpio6"} {
+		edge, err := ioutil.ReadFile(filepath.Join(sysfsRoot, p, "edge"))
+		assert.Nil(t, err)
+		assert.Equal(t, "both", string(edge), p)
+	}
+	// the record of the dead run is removed.
+	_, err = os.Stat(exportsFile(dead))
+	assert.True(t, os.IsNotExist(err))
+	assert.False(t, isStale(5))
+
+	// and subsequent exports are recorded.
+	ownedMu.Lock()
+	assert.True(t, recording)
+	ownedMu.Unlock()
+
+	// records that may have been written by others are not trusted.
+	fakeExports(t, dead, "17\n")
+	require.Nil(t, os.Chmod(filepath.Dir(exportsFile(dead)), 0777))
+	pins, err = Reclaim()
+	assert.Equal(t, ErrUntrustedRecords, err)
+	assert.Empty(t, pins)
+	assert.False(t, isStale(17))
+
+	os.RemoveAll(dir)
+	pins, err = Reclaim()
+	assert.Nil(t, err)
+	assert.Empty(t, pins)
+}
+
+func TestRecordExport(t *testing.T) {
+	_, cleanup := fakeExportsDir(t, false)
+	defer cleanup()
+
+	// not recorded unless enabled.
+	path := exportsFile(os.Getpid())
+	recordExport(17, true)
+	_, err := os.Stat(filepath.Dir(path))
+	assert.True(t, os.IsNotExist(err))
+
+	// enabling records those already exported.
+	recordExports()
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "17\n", string(b))
+	for _, p := range []string{path, filepath.Dir(path)} {
+		fi, err := os.Stat(p)
+		require.Nil(t, err)
+		assert.Equal(t, os.FileMode(0), fi.Mode().Perm()&0077, p)
+	}
+
+	recordExport(4, true)
+	b, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "4\n17\n", string(b))
+
+	// a symlink planted in place of the record is replaced, not followed.
+	target := filepath.Join(filepath.Dir(exportsDir), filepath.Base(exportsDir)+".target")
+	require.Nil(t, ioutil.WriteFile(target, []byte("precious"), 0600))
+	defer os.Remove(target)
+	require.Nil(t, os.Remove(path))
+	require.Nil(t, os.Symlink(target, path))
+	recordExport(17, false)
+	b, err = ioutil.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, "precious", string(b))
+	fi, err := os.Lstat(path)
+	require.Nil(t, err)
+	assert.True(t, fi.Mode().IsRegular())
+	b, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "4\n", string(b))
+
+	// nor is it written to a directory accessible to others.
+	require.Nil(t, os.Chmod(filepath.Dir(path), 0777))
+	recordExport(5, true)
+	b, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "4\n", string(b))
+	require.Nil(t, os.Chmod(filepath.Dir(path), 0700))
+
+	recordExport(5, false)
+	recordExport(4, false)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIsExported(t *testing.T) {
+	cleanup := fakeSysfs(t, "gpio4")
+	defer cleanup()
+	assert.True(t, isExported(&Pin{pin: 4}))
+	assert.False(t, isExported(&Pin{pin: 5}))
+}
+
+func TestLookupExport(t *testing.T) {
+	cleanup := fakeSysfs(t, "gpio4")
+	defer cleanup()
+	dir := filepath.Join(sysfsRoot, "gpio4", "direction")
+	require.Nil(t, ioutil.WriteFile(dir, []byte("out\n"), 0644))
+	e, err := LookupExport(4)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, e.Pin)
+	assert.True(t, e.Exported)
+	assert.Equal(t, Output, e.Mode)
+	assert.Equal(t, EdgeBoth, e.Edge)
+	assert.False(t, e.Watched)
+
+	e, err = LookupExport(5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, e.Pin)
+	assert.False(t, e.Exported)
+
+	_, err = LookupExport(MaxCMGPIOPin)
+	assert.Equal(t, ErrInvalidPin, err)
+}
+
+func TestAdoptExport(t *testing.T) {
+	cleanup := fakeSysfs(t, "gpio4")
+	defer cleanup()
+	edgePath := filepath.Join(sysfsRoot, "gpio4", "edge")
+
+	// the edge of the export takes precedence.
+	intr := &interrupt{pin: &Pin{pin: 4}}
+	edge, err := adoptExport(intr, EdgeRising)
+	assert.Nil(t, err)
+	assert.True(t, intr.adopted)
+	assert.Equal(t, EdgeBoth, edge)
+	intr.releaseAdopted()
+	b, err := ioutil.ReadFile(edgePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "both", string(b))
+
+	// unless the export has no edge.
+	require.Nil(t, ioutil.WriteFile(edgePath, []byte("none\n"), 0644))
+	intr = &interrupt{pin: &Pin{pin: 4}}
+	edge, err = adoptExport(intr, EdgeRising)
+	assert.Nil(t, err)
+	assert.Equal(t, EdgeRising, edge)
+	require.Nil(t, setEdge(intr.pin, edge))
+	intr.releaseAdopted()
+	b, err = ioutil.ReadFile(edgePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "none", string(b[:4]))
+}
+
+func TestOpenFailedOptions(t *testing.T) {
+	defer fakeSysfs(t)()
+	timeout := exportTimeout
+	opts := []OpenOption{
+		WithReclaim(),
+		WithStrictOutput(),
+		WithExportTimeout(time.Minute),
+		WithSharing(ShareExclusive),
+	}
+	for _, oo := range [][]OpenOption{
+		append(opts, WithBase(0x3F000000), WithGPIOOffset(4)),
+		append(opts, WithBase(0x3F000000), WithDevice("/dev/nonexistent")),
+		append(opts, WithCharDev("nonexistent")),
+	} {
+		assert.NotNil(t, Open(oo...))
+		assert.Equal(t, timeout, exportTimeout)
+		assert.Equal(t, int32(0), strictOutput)
+		assert.Equal(t, int32(0), adoptExports)
+		assert.Equal(t, int64(0), periphBase)
+		pinRegistry.mu.Lock()
+		assert.Equal(t, ShareIndependent, pinRegistry.sharing)
+		pinRegistry.mu.Unlock()
+	}
+}
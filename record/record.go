@@ -0,0 +1,237 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package record provides recording of pin activity, and replay of those
+// recordings onto mock pins.
+//
+// A recording is a text file with one event per line, each of the form:
+//
+//	<time ns> <pin name> <event> <value>
+//
+// where the event is one of read, write, mode, or edge.  The value is 0 or 1
+// for levels, and the gpio.Mode for modes.
+package record
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/mock"
+)
+
+// Events recorded for pins.
+const (
+	// EventRead is the level returned by a Read.
+	EventRead = "read"
+
+	// EventWrite is the level set by a Write.
+	EventWrite = "write"
+
+	// EventMode is the mode set by a SetMode.
+	EventMode = "mode"
+
+	// EventEdge is the level of the pin when a watch handler is called.
+	EventEdge = "edge"
+)
+
+// Event is a single recorded event.
+type Event struct {
+	// Time is the time of the event relative to the start of the recording.
+	Time time.Duration
+
+	// Pin is the name of the pin.
+	Pin string
+
+	// Event is the type of event.
+	Event string
+
+	// Value is the level, 0 or 1, or mode associated with the event.
+	Value int
+}
+
+// Recorder records the activity of a set of pins to a writer.
+type Recorder struct {
+	start time.Time
+	// Guards the following
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewRecorder creates a Recorder that writes the recording to w.
+//
+// Event times are relative to the creation of the Recorder.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, start: time.Now()}
+}
+
+// Err returns the first error encountered writing the recording, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Pin wraps the pin so that its activity is recorded under the given name.
+//
+// The name must not contain whitespace.
+func (r *Recorder) Pin(name string, pin gpio.Pinner) gpio.Pinner {
+	return &recPin{r: r, name: name, pin: pin}
+}
+
+func (r *Recorder) record(name, event string, value int) {
+	t := time.Since(r.start)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	_, r.err = fmt.Fprintf(r.w, "%d %s %s %d\n", t.Nanoseconds(), name, event, value)
+}
+
+// recPin is a Pinner that records the activity of the wrapped pin.
+type recPin struct {
+	r    *Recorder
+	name string
+	pin  gpio.Pinner
+}
+
+func (p *recPin) Read() gpio.Level {
+	level := p.pin.Read()
+	p.r.record(p.name, EventRead, levelValue(level))
+	return level
+}
+
+func (p *recPin) Write(level gpio.Level) {
+	p.r.record(p.name, EventWrite, levelValue(level))
+	p.pin.Write(level)
+}
+
+func (p *recPin) SetMode(mode gpio.Mode) {
+	p.r.record(p.name, EventMode, int(mode))
+	p.pin.SetMode(mode)
+}
+
+func (p *recPin) Watch(edge gpio.Edge, handler func(gpio.Pinner)) error {
+	return p.pin.Watch(edge, func(pin gpio.Pinner) {
+		level := pin.Read()
+		p.r.record(p.name, EventEdge, levelValue(level))
+		handler(p)
+	})
+}
+
+func (p *recPin) Unwatch() {
+	p.pin.Unwatch()
+}
+
+func levelValue(level gpio.Level) int {
+	if level {
+		return 1
+	}
+	return 0
+}
+
+// Parse reads a recording.
+func Parse(r io.Reader) ([]Event, error) {
+	var ee []Event
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ff := strings.Fields(line)
+		if len(ff) != 4 {
+			return nil, ErrInvalidRecording{n}
+		}
+		t, err := strconv.ParseInt(ff[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidRecording{n}
+		}
+		v, err := strconv.Atoi(ff[3])
+		if err != nil {
+			return nil, ErrInvalidRecording{n}
+		}
+		switch ff[2] {
+		case EventRead, EventWrite, EventMode, EventEdge:
+		default:
+			return nil, ErrInvalidRecording{n}
+		}
+		ee = append(ee, Event{time.Duration(t), ff[1], ff[2], v})
+	}
+	return ee, s.Err()
+}
+
+// Replayer replays the inputs from a recording onto mock pins.
+//
+// The levels seen by reads and edges in the recording are driven onto the
+// corresponding mock pins, so application logic sees the same inputs as in
+// the recording.  Writes and mode changes are outputs of the application,
+// and so are not replayed, but are available from Events for comparison.
+type Replayer struct {
+	events []Event
+	pins   map[string]*mock.Pin
+}
+
+// NewReplayer creates a Replayer from a recording.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	ee, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	rp := &Replayer{events: ee, pins: map[string]*mock.Pin{}}
+	for _, e := range ee {
+		if rp.pins[e.Pin] == nil {
+			rp.pins[e.Pin] = mock.NewPin(len(rp.pins))
+		}
+	}
+	return rp, nil
+}
+
+// Events returns the events in the recording.
+func (rp *Replayer) Events() []Event {
+	return rp.events
+}
+
+// Pin returns the mock pin for the named pin, or nil if the pin does not
+// appear in the recording.
+func (rp *Replayer) Pin(name string) *mock.Pin {
+	return rp.pins[name]
+}
+
+// Play replays the recording, with the original timing scaled by speed.
+//
+// A speed of 1 replays in real time, 2 at double speed, and so on.  A speed of
+// 0 replays the inputs as fast as possible.
+func (rp *Replayer) Play(speed float64) {
+	start := time.Now()
+	for _, e := range rp.events {
+		if e.Event != EventRead && e.Event != EventEdge {
+			continue
+		}
+		if speed > 0 {
+			due := time.Duration(float64(e.Time) / speed)
+			if d := due - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		rp.pins[e.Pin].Set(e.Value != 0)
+	}
+}
+
+// ErrInvalidRecording indicates a line of the recording could not be parsed.
+type ErrInvalidRecording struct {
+	Line int
+}
+
+func (e ErrInvalidRecording) Error() string {
+	return "invalid recording at line " + strconv.Itoa(e.Line)
+}
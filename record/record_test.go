@@ -0,0 +1,75 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package record_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/mock"
+	"github.com/warthog618/gpio/record"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var buf bytes.Buffer
+	r := record.NewRecorder(&buf)
+	button := mock.NewPin(1)
+	led := mock.NewPin(2)
+	rb := r.Pin("button", button)
+	rl := r.Pin("led", led)
+	rl.SetMode(gpio.Output)
+	assert.Nil(t, rb.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		rl.Write(pin.Read())
+	}))
+	button.Set(gpio.High)
+	button.Set(gpio.Low)
+	assert.Nil(t, r.Err())
+
+	ee, err := record.Parse(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	var got []string
+	for _, e := range ee {
+		got = append(got, e.Pin+" "+e.Event)
+	}
+	assert.Equal(t, []string{
+		"led mode",
+		"button edge", "button read", "led write",
+		"button edge", "button read", "led write",
+		"button edge", "button read", "led write",
+	}, got)
+
+	rp, err := record.NewReplayer(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, ee, rp.Events())
+	assert.Nil(t, rp.Pin("nonexistent"))
+	var levels []gpio.Level
+	assert.Nil(t, rp.Pin("button").Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		levels = append(levels, pin.Read())
+	}))
+	rp.Play(0)
+	assert.Equal(t, []gpio.Level{gpio.Low, gpio.High, gpio.Low}, levels)
+}
+
+func TestParseInvalid(t *testing.T) {
+	patterns := []struct {
+		name string
+		in   string
+		line int
+	}{
+		{"fields", "1 button edge\n", 1},
+		{"time", "# comment\nx button edge 1\n", 2},
+		{"value", "1 button edge x\n", 1},
+		{"event", "\n1 button blah 1\n", 2},
+	}
+	for _, p := range patterns {
+		ee, err := record.Parse(strings.NewReader(p.in))
+		assert.Equal(t, record.ErrInvalidRecording{p.line}, err, p.name)
+		assert.Nil(t, ee, p.name)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Detection of conflicting use of pins within the process.
+
+package gpio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Sharing defines how NewPin handles requests for a pin that has already been
+// created.
+type Sharing int
+
+const (
+	// ShareIndependent creates an independent Pin for each request.
+	//
+	// This is the default.
+	ShareIndependent Sharing = iota
+
+	// ShareReuse returns the existing Pin for subsequent requests.
+	//
+	// The options of subsequent requests are applied to the existing Pin.
+	ShareReuse
+
+	// ShareExclusive returns ErrBusy for subsequent requests, until the
+	// existing Pin is released.
+	ShareExclusive
+)
+
+// ConflictError describes a conflicting change to the mode of a pin.
+type ConflictError struct {
+	// Pin is the number of the pin.
+	Pin int
+
+	// Mode is the mode set by the owner of the pin.
+	Mode Mode
+
+	// Requested is the conflicting mode.
+	Requested Mode
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("pin %d mode conflict: mode %d changed to %d", e.Pin, e.Mode, e.Requested)
+}
+
+// registry tracks the pins created by the process, and the modes set on them.
+type registry struct {
+	// Guards the following
+	mu       sync.Mutex
+	sharing  Sharing
+	conflict func(*ConflictError)
+	pins     map[pinID]*regEntry
+}
+
+type regEntry struct {
+	pin *Pin
+	// the pin that last set the mode, if any.
+	owner *Pin
+	mode  Mode
+}
+
+var pinRegistry = registry{pins: make(map[pinID]*regEntry)}
+
+// configure resets the registry with the sharing policy and conflict handler.
+func (r *registry) configure(sharing Sharing, conflict func(*ConflictError)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sharing = sharing
+	r.conflict = conflict
+	r.pins = make(map[pinID]*regEntry)
+}
+
+// claim registers a newly created pin, returning the pin to be returned by
+// NewPin, as per the sharing policy.
+func (r *registry) claim(pin *Pin) (*Pin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.pins[pin.id()]
+	if !ok {
+		e = &regEntry{}
+		r.pins[pin.id()] = e
+	}
+	if e.pin == nil {
+		e.pin = pin
+		return pin, nil
+	}
+	switch r.sharing {
+	case ShareReuse:
+		return e.pin, nil
+	case ShareExclusive:
+		return nil, ErrBusy
+	}
+	return pin, nil
+}
+
+// remove releases the pin, if it is the registered pin.
+func (r *registry) remove(pin *Pin) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.pins[pin.id()]; ok && e.pin == pin {
+		delete(r.pins, pin.id())
+	}
+}
+
+// setMode records the mode set on the pin, reporting a conflict if the mode
+// was previously set to a different mode via another Pin.
+func (r *registry) setMode(pin *Pin, mode Mode) {
+	r.mu.Lock()
+	e, ok := r.pins[pin.id()]
+	if !ok {
+		e = &regEntry{}
+		r.pins[pin.id()] = e
+	}
+	var cerr *ConflictError
+	if e.owner != nil && e.owner != pin && e.mode != mode {
+		cerr = &ConflictError{Pin: pin.pin, Mode: e.mode, Requested: mode}
+	}
+	e.owner = pin
+	e.mode = mode
+	conflict := r.conflict
+	r.mu.Unlock()
+	if cerr != nil {
+		logWarn("pin mode conflict", "pin", cerr.Pin, "mode", cerr.Mode, "requested", cerr.Requested)
+		if conflict != nil {
+			conflict(cerr)
+		}
+	}
+}
+
+// Release removes the pin from the registry of pins created by the process,
+// so a subsequent NewPin for the same pin creates a new Pin.
+//
+// This is only necessary with the ShareExclusive and ShareReuse policies.
+// The pin itself is unaffected.
+func (pin *Pin) Release() {
+	pinRegistry.remove(pin)
+}
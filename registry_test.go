@@ -0,0 +1,109 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryClaim(t *testing.T) {
+	r := registry{}
+
+	r.configure(ShareIndependent, nil)
+	p1, p2 := &Pin{pin: 4}, &Pin{pin: 4}
+	p, err := r.claim(p1)
+	assert.Nil(t, err)
+	assert.Equal(t, p1, p)
+	p, err = r.claim(p2)
+	assert.Nil(t, err)
+	assert.True(t, p == p2)
+
+	r.configure(ShareReuse, nil)
+	p, err = r.claim(p1)
+	assert.Nil(t, err)
+	assert.True(t, p == p1)
+	p, err = r.claim(p2)
+	assert.Nil(t, err)
+	assert.True(t, p == p1)
+	// other pins are unaffected.
+	p3 := &Pin{pin: 5}
+	p, err = r.claim(p3)
+	assert.Nil(t, err)
+	assert.True(t, p == p3)
+
+	r.configure(ShareExclusive, nil)
+	_, err = r.claim(p1)
+	assert.Nil(t, err)
+	p, err = r.claim(p2)
+	assert.Equal(t, ErrBusy, err)
+	assert.Nil(t, p)
+	// only the registered pin can release.
+	r.remove(p2)
+	_, err = r.claim(p2)
+	assert.Equal(t, ErrBusy, err)
+	r.remove(p1)
+	p, err = r.claim(p2)
+	assert.Nil(t, err)
+	assert.True(t, p == p2)
+}
+
+func TestRegistrySetMode(t *testing.T) {
+	r := registry{}
+	var conflicts []*ConflictError
+	r.configure(ShareIndependent, func(e *ConflictError) {
+		conflicts = append(conflicts, e)
+	})
+	p1, p2 := &Pin{pin: 4}, &Pin{pin: 4}
+	r.setMode(p1, Output)
+	r.setMode(p1, Input)
+	r.setMode(p1, Output)
+	assert.Empty(t, conflicts)
+	// same mode via another pin is not a conflict.
+	r.setMode(p2, Output)
+	assert.Empty(t, conflicts)
+	r.setMode(p1, Input)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, &ConflictError{Pin: 4, Mode: Output, Requested: Input}, conflicts[0])
+		assert.Equal(t, "pin 4 mode conflict: mode 1 changed to 0", conflicts[0].Error())
+	}
+	// other pins are unaffected.
+	r.setMode(&Pin{pin: 5}, Output)
+	assert.Len(t, conflicts, 1)
+}
+
+func TestRegistryGroupSetMode(t *testing.T) {
+	old := mem
+	mem = make([]uint32, memLength/4)
+	var conflicts []*ConflictError
+	pinRegistry.configure(ShareIndependent, func(e *ConflictError) {
+		conflicts = append(conflicts, e)
+	})
+	defer func() {
+		mem = old
+		pinRegistry.configure(ShareIndependent, nil)
+	}()
+
+	p1, err := NewPin(4)
+	require.Nil(t, err)
+	p2, err := NewPin(4)
+	require.Nil(t, err)
+	p1.Output(Low)
+	g, err := NewPinGroup(p2)
+	require.Nil(t, err)
+	g.SetMode(Input)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, &ConflictError{Pin: 4, Mode: Output, Requested: Input}, conflicts[0])
+	}
+	// p2 is now the owner.
+	SetModes(map[*Pin]Mode{p2: Output})
+	p2.SetMode(Output)
+	assert.Len(t, conflicts, 1)
+	p1.SetMode(Input)
+	assert.Len(t, conflicts, 2)
+}
@@ -0,0 +1,46 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureSample(t *testing.T) {
+	old := mem
+	mem = make([]uint32, memLength/4)
+	defer func() {
+		mem = old
+	}()
+
+	// bank 1 pins are only available on some boards, so the pins are
+	// constructed directly.
+	var pins []*Pin
+	for _, n := range []int{4, 40, 17} {
+		pins = append(pins, &Pin{pin: n, levelReg: 13 + n/32, mask: 1 << uint(n&0x1f)})
+	}
+	c, err := NewCapture(pins)
+	require.Nil(t, err)
+	// one mapping per level register.
+	assert.Equal(t, []sampleBank{
+		{13, []uint32{1 << 4, 1 << 17}, []uint64{0x1, 0x4}},
+		{14, []uint32{1 << 8}, []uint64{0x2}},
+	}, c.banks)
+	assert.Empty(t, c.lines)
+
+	assert.Equal(t, uint64(0), c.sample())
+	mem[13] = 1<<4 | 1<<5
+	mem[14] = 1 << 8
+	assert.Equal(t, uint64(0x3), c.sample())
+	mem[13] = 1 << 17
+	assert.Equal(t, uint64(0x6), c.sample())
+
+	_, err = NewCapture([]*Pin{pins[0], nil})
+	assert.Equal(t, ErrInvalidCapture, err)
+}
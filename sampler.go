@@ -0,0 +1,149 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Periodic sampling of pin levels.
+
+package gpio
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sampler reads the levels of a set of pins at a fixed rate, and delivers the
+// samples on a channel.
+//
+// Unlike a Capture, which samples as fast as possible into a buffer, the
+// Sampler provides uniformly sampled levels, e.g. for software debouncing or
+// simple signal processing.
+//
+// Sampling is scheduled against the start time rather than the previous
+// sample, so sampling does not drift with scheduling delays.  If the sampler
+// falls more than a period behind, the missed samples are skipped.
+type Sampler struct {
+	// first to ensure 64-bit alignment for atomic access.
+	dropped uint64
+	missed  uint64
+
+	// C delivers the samples.  It is closed when the Sampler is stopped.
+	C <-chan Sample
+
+	pins    []Pinner
+	period  time.Duration
+	c       chan Sample
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// SamplerOption defines an option that can be applied when creating a
+// Sampler.
+type SamplerOption func(*Sampler)
+
+// WithSampleBuffer sets the number of samples buffered in the channel.
+//
+// Samples are dropped if the channel is full.
+// The default is 64.
+func WithSampleBuffer(size int) SamplerOption {
+	return func(s *Sampler) {
+		if size >= 0 {
+			s.c = make(chan Sample, size)
+		}
+	}
+}
+
+// NewSampler creates a Sampler that samples the pins every period, e.g.
+// time.Millisecond for 1kHz, and starts sampling.
+//
+// At most 64 pins can be sampled.
+func NewSampler(pins []Pinner, period time.Duration, options ...SamplerOption) (*Sampler, error) {
+	if len(pins) == 0 || len(pins) > 64 || period <= 0 {
+		return nil, ErrInvalidSampler
+	}
+	s := &Sampler{
+		pins:    pins,
+		period:  period,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.c == nil {
+		s.c = make(chan Sample, 64)
+	}
+	s.C = s.c
+	go s.run()
+	return s, nil
+}
+
+// Stop stops sampling, and closes the channel.
+func (s *Sampler) Stop() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+}
+
+// Dropped returns the number of samples dropped as the channel was full.
+func (s *Sampler) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Missed returns the number of sample periods skipped as the sampler fell
+// behind.
+func (s *Sampler) Missed() uint64 {
+	return atomic.LoadUint64(&s.missed)
+}
+
+func (s *Sampler) run() {
+	defer close(s.stopped)
+	defer close(s.c)
+	start := time.Now()
+	t := time.NewTimer(0)
+	defer t.Stop()
+	var n int64
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		sample := Sample{Time: now.Sub(start), Levels: s.sample()}
+		select {
+		case s.c <- sample:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+		n++
+		next := time.Duration(n) * s.period
+		if behind := now.Sub(start) - next; behind >= 0 {
+			skip := int64(behind/s.period) + 1
+			atomic.AddUint64(&s.missed, uint64(skip))
+			n += skip
+			next = time.Duration(n) * s.period
+		}
+		t.Reset(next - time.Since(start))
+	}
+}
+
+// sample reads the levels of the pins.
+func (s *Sampler) sample() uint64 {
+	var levels uint64
+	for i, p := range s.pins {
+		if p.Read() {
+			levels |= 1 << uint(i)
+		}
+	}
+	return levels
+}
+
+var (
+	// ErrInvalidSampler indicates the sampler pins or period are invalid.
+	ErrInvalidSampler = errors.New("invalid sampler")
+)
@@ -0,0 +1,90 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// levelPin is a Pinner with a settable level.
+type levelPin struct {
+	level int32
+}
+
+func (p *levelPin) Read() Level {
+	return atomic.LoadInt32(&p.level) != 0
+}
+
+func (p *levelPin) Write(level Level) {
+	var v int32
+	if level {
+		v = 1
+	}
+	atomic.StoreInt32(&p.level, v)
+}
+
+func (p *levelPin) SetMode(Mode) {}
+
+func (p *levelPin) Watch(Edge, func(Pinner)) error {
+	return nil
+}
+
+func (p *levelPin) Unwatch() {}
+
+func TestNewSampler(t *testing.T) {
+	_, err := NewSampler(nil, time.Millisecond)
+	assert.Equal(t, ErrInvalidSampler, err)
+	_, err = NewSampler([]Pinner{&levelPin{}}, 0)
+	assert.Equal(t, ErrInvalidSampler, err)
+}
+
+func TestSampler(t *testing.T) {
+	a, b := &levelPin{}, &levelPin{}
+	b.Write(High)
+	s, err := NewSampler([]Pinner{a, b}, 2*time.Millisecond)
+	require.Nil(t, err)
+	var samples []Sample
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			a.Write(High)
+		}
+		select {
+		case sample := <-s.C:
+			samples = append(samples, sample)
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("no sample")
+		}
+	}
+	s.Stop()
+	s.Stop()
+	_, ok := <-s.C
+	assert.False(t, ok)
+	for i, sample := range samples {
+		assert.Equal(t, High, sample.Level(1))
+		if i > 0 {
+			// scheduled against the start time, so not drifting.
+			assert.True(t, sample.Time > samples[i-1].Time)
+		}
+	}
+	assert.Equal(t, Low, samples[0].Level(0))
+	assert.Equal(t, High, samples[9].Level(0))
+	last := samples[9].Time
+	assert.True(t, last >= 18*time.Millisecond, last)
+	assert.True(t, last < time.Duration(10+s.Missed())*2*time.Millisecond, last)
+}
+
+func TestSamplerDropped(t *testing.T) {
+	s, err := NewSampler([]Pinner{&levelPin{}}, time.Millisecond, WithSampleBuffer(0))
+	require.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+	s.Stop()
+	assert.NotZero(t, s.Dropped())
+}
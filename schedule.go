@@ -0,0 +1,108 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Writes scheduled at absolute times.
+
+package gpio
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// spinWindow is the period before a scheduled write during which the
+// scheduler busy-waits, rather than relying on the timer, which may fire
+// late.
+var spinWindow = 500 * time.Microsecond
+
+const (
+	schedPending uint32 = iota
+	schedCancelled
+	schedWritten
+)
+
+// ScheduledWrite is a write scheduled to be performed at a particular time.
+type ScheduledWrite struct {
+	state  uint32
+	at     time.Time
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+// WriteAt schedules the pin to be set to the level at time t.
+//
+// The scheduler arms a timer for shortly before t, then busy-waits the final
+// microseconds, so the write occurs as close to t as possible, e.g. to
+// synchronize outputs with the wall clock, or with events observed on other
+// pins.  If t has already passed the write is performed immediately.
+//
+// WriteAt does not block.  The returned ScheduledWrite may be used to wait
+// for, or cancel, the write.
+func (pin *Pin) WriteAt(level Level, t time.Time) *ScheduledWrite {
+	return schedule(t, func() {
+		pin.Write(level)
+	})
+}
+
+// WriteAt schedules the pins in the group to be set to the levels at time t,
+// as per Pin.WriteAt and PinGroup.Write.
+func (g *PinGroup) WriteAt(levels uint64, t time.Time) *ScheduledWrite {
+	return schedule(t, func() {
+		g.Write(levels)
+	})
+}
+
+// schedule calls write at time t.
+func schedule(t time.Time, write func()) *ScheduledWrite {
+	s := &ScheduledWrite{
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run(t, write)
+	return s
+}
+
+func (s *ScheduledWrite) run(t time.Time, write func()) {
+	defer close(s.done)
+	if d := time.Until(t) - spinWindow; d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-s.cancel:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+	for time.Now().Before(t) {
+		if atomic.LoadUint32(&s.state) == schedCancelled {
+			return
+		}
+	}
+	if !atomic.CompareAndSwapUint32(&s.state, schedPending, schedWritten) {
+		return
+	}
+	write()
+	s.at = time.Now()
+}
+
+// Cancel cancels the write, if it has not yet been performed.
+//
+// Returns true if the write was cancelled.
+func (s *ScheduledWrite) Cancel() bool {
+	if !atomic.CompareAndSwapUint32(&s.state, schedPending, schedCancelled) {
+		return false
+	}
+	close(s.cancel)
+	return true
+}
+
+// Wait blocks until the write has been performed, or cancelled, and returns
+// the time the write completed.
+//
+// Returns the zero time if the write was cancelled.
+func (s *ScheduledWrite) Wait() time.Time {
+	<-s.done
+	return s.at
+}
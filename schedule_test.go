@@ -0,0 +1,56 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	var written time.Time
+	at := time.Now().Add(10 * time.Millisecond)
+	s := schedule(at, func() {
+		written = time.Now()
+	})
+	done := s.Wait()
+	assert.False(t, written.Before(at))
+	assert.True(t, written.Sub(at) < time.Millisecond, written.Sub(at))
+	assert.False(t, done.Before(written))
+	assert.False(t, s.Cancel())
+
+	// past
+	var called bool
+	s = schedule(time.Now().Add(-time.Second), func() {
+		called = true
+	})
+	assert.False(t, s.Wait().IsZero())
+	assert.True(t, called)
+}
+
+func TestScheduleCancel(t *testing.T) {
+	var called bool
+	s := schedule(time.Now().Add(50*time.Millisecond), func() {
+		called = true
+	})
+	assert.True(t, s.Cancel())
+	assert.False(t, s.Cancel())
+	assert.True(t, s.Wait().IsZero())
+	assert.False(t, called)
+
+	// cancelled while spinning
+	s = schedule(time.Now().Add(spinWindow/2), func() {
+		called = true
+	})
+	if s.Cancel() {
+		assert.True(t, s.Wait().IsZero())
+		assert.False(t, called)
+	} else {
+		s.Wait()
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Package script provides simple sequencing of pin outputs, such as traffic
+// light sequences or test jigs, without bespoke goroutine code.
+//
+// A Script is built from steps that set pins, wait, loop, and branch on the
+// level of input pins, and is executed by a Runner:
+//
+//	s := script.New().
+//		High(red).Wait(3 * time.Second).
+//		High(amber).Wait(time.Second).
+//		Low(red).Low(amber).High(green).Wait(3 * time.Second).
+//		Low(green).High(amber).Wait(time.Second).Low(amber)
+//	r := script.Run(script.New().Loop(0, s))
+//	...
+//	r.Stop()
+package script
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio"
+)
+
+// Script is a sequence of steps.
+//
+// The builder methods append a step to the script and return the script, so
+// steps can be chained.
+type Script struct {
+	steps []step
+}
+
+// step is a single step of a script, returning ErrStopped if the runner is
+// stopped.
+type step func(r *Runner) error
+
+// New creates an empty Script.
+func New() *Script {
+	return &Script{}
+}
+
+// Set sets the level of the pin.
+func (s *Script) Set(pin gpio.Pinner, level gpio.Level) *Script {
+	return s.add(func(r *Runner) error {
+		pin.Write(level)
+		return nil
+	})
+}
+
+// High sets the pin high.
+func (s *Script) High(pin gpio.Pinner) *Script {
+	return s.Set(pin, gpio.High)
+}
+
+// Low sets the pin low.
+func (s *Script) Low(pin gpio.Pinner) *Script {
+	return s.Set(pin, gpio.Low)
+}
+
+// Wait waits for the duration.
+//
+// Waits are measured from the end of the previous wait, rather than from
+// when the wait step is reached, so the time taken by other steps does not
+// accumulate, and the timing of the script does not drift.
+func (s *Script) Wait(d time.Duration) *Script {
+	return s.add(func(r *Runner) error {
+		r.deadline = r.deadline.Add(d)
+		return r.sleep(time.Until(r.deadline))
+	})
+}
+
+// WaitFor waits until the pin is at the level, polling every millisecond,
+// for at most the timeout.
+//
+// If the timeout expires the script fails with ErrTimeout.  A timeout of 0
+// waits indefinitely.
+func (s *Script) WaitFor(pin gpio.Pinner, level gpio.Level, timeout time.Duration) *Script {
+	return s.add(func(r *Runner) error {
+		start := time.Now()
+		for pin.Read() != level {
+			if timeout > 0 && time.Since(start) >= timeout {
+				return ErrTimeout
+			}
+			if err := r.sleep(time.Millisecond); err != nil {
+				return err
+			}
+		}
+		// subsequent waits are measured from when the level was reached.
+		r.deadline = time.Now()
+		return nil
+	})
+}
+
+// Loop executes the body n times, or indefinitely if n is 0.
+func (s *Script) Loop(n int, body *Script) *Script {
+	return s.add(func(r *Runner) error {
+		for i := 0; n <= 0 || i < n; i++ {
+			if r.isStopped() {
+				return ErrStopped
+			}
+			if err := r.exec(body); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// If executes then if the pin is at the level, else executes otherwise.
+//
+// Either script may be nil.
+func (s *Script) If(pin gpio.Pinner, level gpio.Level, then, otherwise *Script) *Script {
+	return s.add(func(r *Runner) error {
+		if pin.Read() == level {
+			return r.exec(then)
+		}
+		return r.exec(otherwise)
+	})
+}
+
+// Call calls the function, e.g. to log progress or to perform a step not
+// otherwise supported.
+//
+// The function is called from the runner goroutine, so must not block.
+func (s *Script) Call(f func()) *Script {
+	return s.add(func(r *Runner) error {
+		f()
+		return nil
+	})
+}
+
+func (s *Script) add(st step) *Script {
+	s.steps = append(s.steps, st)
+	return s
+}
+
+// Runner executes a Script in a dedicated goroutine.
+type Runner struct {
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	err     error
+	// the end of the most recent wait, used only by the runner goroutine.
+	deadline time.Time
+}
+
+// Run starts executing the script in a new goroutine.
+func Run(s *Script) *Runner {
+	r := &Runner{
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(r.stopped)
+		r.deadline = time.Now()
+		r.err = r.exec(s)
+	}()
+	return r
+}
+
+// Stop stops the script, and waits for the runner to exit.
+//
+// The pins are left at their current levels.
+func (r *Runner) Stop() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+	<-r.stopped
+}
+
+// Done returns a channel that is closed when the script completes or is
+// stopped.
+func (r *Runner) Done() <-chan struct{} {
+	return r.stopped
+}
+
+// Wait waits for the script to complete, and returns the error that stopped
+// it, if any.
+//
+// ErrStopped is returned if the script was stopped by Stop.
+func (r *Runner) Wait() error {
+	<-r.stopped
+	return r.err
+}
+
+func (r *Runner) exec(s *Script) error {
+	if s == nil {
+		return nil
+	}
+	for _, st := range s.steps {
+		if r.isStopped() {
+			return ErrStopped
+		}
+		if err := st(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) isStopped() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep sleeps for the duration, returning ErrStopped if the runner is
+// stopped.
+func (r *Runner) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-r.done:
+		return ErrStopped
+	case <-t.C:
+		return nil
+	}
+}
+
+var (
+	// ErrStopped indicates the script was stopped before it completed.
+	ErrStopped = errors.New("script stopped")
+
+	// ErrTimeout indicates a WaitFor timed out.
+	ErrTimeout = errors.New("timeout")
+)
@@ -0,0 +1,111 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package script_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/mock"
+	"github.com/warthog618/gpio/script"
+)
+
+func TestSequence(t *testing.T) {
+	red := mock.NewPin(1)
+	red.SetMode(gpio.Output)
+	green := mock.NewPin(2)
+	green.SetMode(gpio.Output)
+	var levels []gpio.Level
+	record := func() {
+		levels = append(levels, red.Read(), green.Read())
+	}
+	s := script.New().
+		High(red).Call(record).
+		Wait(5 * time.Millisecond).
+		Low(red).High(green).Call(record).
+		Wait(5 * time.Millisecond).
+		Low(green).Call(record)
+	start := time.Now()
+	r := script.Run(s)
+	assert.Nil(t, r.Wait())
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+	assert.Equal(t, []gpio.Level{
+		gpio.High, gpio.Low,
+		gpio.Low, gpio.High,
+		gpio.Low, gpio.Low}, levels)
+	select {
+	case <-r.Done():
+	default:
+		t.Error("not done")
+	}
+}
+
+func TestLoop(t *testing.T) {
+	pin := mock.NewPin(1)
+	count := 0
+	body := script.New().High(pin).Low(pin).Call(func() { count++ })
+	assert.Nil(t, script.Run(script.New().Loop(3, body)).Wait())
+	assert.Equal(t, 3, count)
+
+	// loops indefinitely until stopped.
+	count = 0
+	done := make(chan struct{})
+	r := script.Run(script.New().Loop(0, script.New().
+		Call(func() {
+			if count++; count == 5 {
+				close(done)
+			}
+		}).
+		Wait(time.Millisecond)))
+	<-done
+	r.Stop()
+	r.Stop()
+	assert.Equal(t, script.ErrStopped, r.Wait())
+}
+
+func TestNoDrift(t *testing.T) {
+	// the time taken by steps between waits does not accumulate.
+	slow := func() { time.Sleep(time.Millisecond) }
+	s := script.New().Loop(10, script.New().Call(slow).Wait(2*time.Millisecond))
+	start := time.Now()
+	assert.Nil(t, script.Run(s).Wait())
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 20*time.Millisecond, elapsed)
+	assert.True(t, elapsed < 29*time.Millisecond, elapsed)
+}
+
+func TestIf(t *testing.T) {
+	in := mock.NewPin(1)
+	out := mock.NewPin(2)
+	out.SetMode(gpio.Output)
+	s := script.New().If(in, gpio.High, script.New().High(out), script.New().Low(out))
+	out.Write(gpio.High)
+	assert.Nil(t, script.Run(s).Wait())
+	assert.Equal(t, gpio.Low, out.Read())
+	in.Set(gpio.High)
+	assert.Nil(t, script.Run(s).Wait())
+	assert.Equal(t, gpio.High, out.Read())
+	// nil branches are skipped.
+	assert.Nil(t, script.Run(script.New().If(in, gpio.Low, nil, nil)).Wait())
+}
+
+func TestWaitFor(t *testing.T) {
+	in := mock.NewPin(1)
+	out := mock.NewPin(2)
+	out.SetMode(gpio.Output)
+	s := script.New().WaitFor(in, gpio.High, time.Second).High(out)
+	r := script.Run(s)
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, gpio.Low, out.Read())
+	in.Set(gpio.High)
+	assert.Nil(t, r.Wait())
+	assert.Equal(t, gpio.High, out.Read())
+
+	s = script.New().WaitFor(in, gpio.Low, 5*time.Millisecond)
+	assert.Equal(t, script.ErrTimeout, script.Run(s).Wait())
+}
@@ -0,0 +1,62 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package sim
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/gpio"
+)
+
+func TestNewMockup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sim")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	current := filepath.Join(dir, "gpio-mockup")
+	old := filepath.Join(dir, "gpio-mockup-event")
+	defer func(dirs []string) {
+		debugfsDirs = dirs
+	}(debugfsDirs)
+	debugfsDirs = []string{current, old}
+
+	s, err := NewMockup("gpiochip2", 4)
+	assert.Equal(t, ErrNotAvailable, err)
+	assert.Nil(t, s)
+
+	// older kernels
+	oldChip := filepath.Join(old, "gpiochip2")
+	require.Nil(t, os.MkdirAll(oldChip, 0755))
+	s, err = NewMockup("gpiochip2", 4)
+	require.Nil(t, err)
+	assert.Equal(t, oldChip, s.attrs)
+
+	// current kernels take precedence
+	chip := filepath.Join(current, "gpiochip2")
+	require.Nil(t, os.MkdirAll(chip, 0755))
+	s, err = NewMockup("gpiochip2", 4)
+	require.Nil(t, err)
+	assert.Equal(t, "gpiochip2", s.Chip())
+	assert.Equal(t, 4, s.Lines())
+	assert.Equal(t, chip, s.attrs)
+
+	// lines are driven and read via the per offset attribute
+	require.Nil(t, s.Pull(3, gpio.PullUp))
+	v, err := ioutil.ReadFile(filepath.Join(chip, "3"))
+	require.Nil(t, err)
+	assert.Equal(t, "1", string(v))
+	l, err := s.Level(3)
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.High, l)
+	assert.Equal(t, gpio.ErrInvalidPin, s.Pull(4, gpio.PullUp))
+	assert.Nil(t, s.Close())
+}
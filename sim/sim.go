@@ -0,0 +1,198 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+// Package sim provides simulated GPIO chips for testing, using the gpio-sim or
+// gpio-mockup kernel modules.
+//
+// The simulated chips are real GPIO character devices, so they exercise the
+// same kernel interfaces as physical hardware, and can be used with the
+// gpio.WithCharDev option.  The lines of the chip are driven from the test
+// side using Pull, and outputs are observed using Level.
+//
+// This requires root, and either the gpio-sim module (Linux v5.17 or later)
+// with configfs mounted, or the gpio-mockup module and debugfs.
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/warthog618/gpio"
+)
+
+var (
+	configfsDir = "/sys/kernel/config/gpio-sim"
+	platformDir = "/sys/devices/platform"
+	// the gpio-mockup debugfs directories, current first, then that used by
+	// kernels prior to v5.2.
+	debugfsDirs = []string{
+		"/sys/kernel/debug/gpio-mockup",
+		"/sys/kernel/debug/gpio-mockup-event",
+	}
+)
+
+// Sim is a simulated GPIO chip.
+type Sim struct {
+	// the name of the GPIO chip, e.g. gpiochip2.
+	chip string
+	// the number of lines on the chip.
+	lines int
+	// the gpio-sim configfs directory, if created by gpio-sim.
+	config string
+	// the directory containing the line attributes.
+	attrs string
+	// true if driven through gpio-mockup rather than gpio-sim.
+	mockup bool
+}
+
+// New creates a simulated GPIO chip with the given number of lines using
+// gpio-sim.
+//
+// The name identifies the chip within configfs, and is also used as the chip
+// label.  The chip must be removed with Close when no longer required.
+func New(name string, lines int) (*Sim, error) {
+	if _, err := os.Stat(configfsDir); err != nil {
+		return nil, ErrNotAvailable
+	}
+	dir := filepath.Join(configfsDir, name)
+	bank := filepath.Join(dir, "bank0")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Sim{lines: lines, config: dir}
+	if err := os.Mkdir(bank, 0755); err != nil {
+		s.Close()
+		return nil, err
+	}
+	err := writeAttr(filepath.Join(bank, "num_lines"), strconv.Itoa(lines))
+	if err == nil {
+		err = writeAttr(filepath.Join(bank, "label"), name)
+	}
+	if err == nil {
+		err = writeAttr(filepath.Join(dir, "live"), "1")
+	}
+	var dev string
+	if err == nil {
+		dev, err = readAttr(filepath.Join(dir, "dev_name"))
+	}
+	if err == nil {
+		s.chip, err = readAttr(filepath.Join(bank, "chip_name"))
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.attrs = filepath.Join(platformDir, dev, s.chip)
+	return s, nil
+}
+
+// NewMockup wraps an existing gpio-mockup chip, e.g. gpiochip2, with the given
+// number of lines.
+//
+// gpio-mockup chips are created when the module is loaded, e.g.
+//
+//	modprobe gpio-mockup gpio_mockup_ranges=-1,8
+//
+// The line attributes are found in debugfs, in gpio-mockup/<chip>, or in
+// gpio-mockup-event/<chip> for older kernels.
+func NewMockup(chip string, lines int) (*Sim, error) {
+	for _, dir := range debugfsDirs {
+		attrs := filepath.Join(dir, chip)
+		if _, err := os.Stat(attrs); err == nil {
+			return &Sim{chip: chip, lines: lines, attrs: attrs, mockup: true}, nil
+		}
+	}
+	return nil, ErrNotAvailable
+}
+
+// Close removes the simulated chip, if it was created by New.
+func (s *Sim) Close() error {
+	if s.config == "" {
+		return nil
+	}
+	live := filepath.Join(s.config, "live")
+	if v, err := readAttr(live); err == nil && v == "1" {
+		writeAttr(live, "0")
+	}
+	os.Remove(filepath.Join(s.config, "bank0"))
+	err := os.Remove(s.config)
+	s.config = ""
+	return err
+}
+
+// Chip returns the name of the GPIO chip, e.g. gpiochip2, suitable for
+// passing to gpio.WithCharDev.
+func (s *Sim) Chip() string {
+	return s.chip
+}
+
+// Lines returns the number of lines on the chip.
+func (s *Sim) Lines() int {
+	return s.lines
+}
+
+// Pull sets the level driven onto the line from the test side.
+//
+// This is the level read by the line when it is an input.
+// PullNone is treated as PullDown.
+func (s *Sim) Pull(offset int, pull gpio.Pull) error {
+	if offset < 0 || offset >= s.lines {
+		return gpio.ErrInvalidPin
+	}
+	if s.mockup {
+		v := "0"
+		if pull == gpio.PullUp {
+			v = "1"
+		}
+		return writeAttr(filepath.Join(s.attrs, strconv.Itoa(offset)), v)
+	}
+	v := "pull-down"
+	if pull == gpio.PullUp {
+		v = "pull-up"
+	}
+	return writeAttr(s.lineAttr(offset, "pull"), v)
+}
+
+// Level returns the level of the line, as seen from the test side.
+//
+// This is the level driven by the line when it is an output.
+func (s *Sim) Level(offset int) (gpio.Level, error) {
+	if offset < 0 || offset >= s.lines {
+		return gpio.Low, gpio.ErrInvalidPin
+	}
+	if s.mockup {
+		// the debugfs attribute reports the line value when read.
+		v, err := readAttr(filepath.Join(s.attrs, strconv.Itoa(offset)))
+		return v == "1", err
+	}
+	v, err := readAttr(s.lineAttr(offset, "value"))
+	return v == "1", err
+}
+
+func (s *Sim) lineAttr(offset int, attr string) string {
+	return filepath.Join(s.attrs, fmt.Sprintf("sim_gpio%d", offset), attr)
+}
+
+func readAttr(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	return strings.TrimSpace(string(b)), err
+}
+
+func writeAttr(path, value string) error {
+	return ioutil.WriteFile(path, []byte(value), 0644)
+}
+
+var (
+	// ErrNotAvailable indicates the simulator module is not loaded, or its
+	// filesystem is not mounted.
+	ErrNotAvailable = errors.New("simulator not available")
+)
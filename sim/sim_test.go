@@ -0,0 +1,94 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+//
+//	Tests exercise the character device backend on a gpio-sim chip, and are
+//	skipped if gpio-sim is not available.
+//
+package sim_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+	"github.com/warthog618/gpio/sim"
+)
+
+func setupSim(t *testing.T) *sim.Sim {
+	s, err := sim.New("gpio-test", 8)
+	if err != nil {
+		t.Skip("gpio-sim not available:", err)
+	}
+	if err = gpio.Open(gpio.WithCharDev(s.Chip())); err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s
+}
+
+func teardownSim(s *sim.Sim) {
+	gpio.Close()
+	s.Close()
+}
+
+func TestSimRead(t *testing.T) {
+	s := setupSim(t)
+	defer teardownSim(s)
+	assert.Equal(t, 8, s.Lines())
+	assert.Equal(t, gpio.ErrInvalidPin, s.Pull(8, gpio.PullUp))
+	pin, err := gpio.NewPin(3, gpio.WithMode(gpio.Input))
+	assert.Nil(t, err)
+	assert.Nil(t, s.Pull(3, gpio.PullUp))
+	assert.Equal(t, gpio.High, pin.Read())
+	assert.Nil(t, s.Pull(3, gpio.PullDown))
+	assert.Equal(t, gpio.Low, pin.Read())
+}
+
+func TestSimWrite(t *testing.T) {
+	s := setupSim(t)
+	defer teardownSim(s)
+	pin, err := gpio.NewPin(2,
+		gpio.WithInitialLevel(gpio.High),
+		gpio.WithMode(gpio.Output))
+	assert.Nil(t, err)
+	l, err := s.Level(2)
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.High, l)
+	pin.Low()
+	l, err = s.Level(2)
+	assert.Nil(t, err)
+	assert.Equal(t, gpio.Low, l)
+}
+
+func TestSimWatch(t *testing.T) {
+	s := setupSim(t)
+	defer teardownSim(s)
+	pin, err := gpio.NewPin(1)
+	assert.Nil(t, err)
+	ich := make(chan gpio.Level, 3)
+	assert.Nil(t, pin.Watch(gpio.EdgeBoth, func(pin gpio.Pinner) {
+		ich <- pin.Read()
+	}))
+	defer pin.Unwatch()
+	for i, expected := range []gpio.Level{gpio.Low, gpio.High, gpio.Low} {
+		if i > 0 {
+			pull := gpio.PullDown
+			if expected {
+				pull = gpio.PullUp
+			}
+			assert.Nil(t, s.Pull(1, pull))
+		}
+		select {
+		case v := <-ich:
+			assert.Equal(t, expected, v)
+		case <-time.After(100 * time.Millisecond):
+			t.Error("missed interrupt, expected", expected)
+		}
+	}
+}
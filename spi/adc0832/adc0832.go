@@ -16,14 +16,18 @@ import (
 //
 // The two data pins, di and do, may be tied and connected to a single GPIO pin.
 type ADC0832 struct {
-	spi.SPI
+	*spi.SPI
 	// time to allow mux to settle after clocking out ODD/SIGN
 	tset time.Duration
 }
 
 // New creates a ADC0832.
-func New(tclk, tset time.Duration, clk, csz, di, do int) *ADC0832 {
-	return &ADC0832{*spi.New(tclk, clk, csz, di, do), tset}
+func New(tclk, tset time.Duration, clk, csz, di, do int) (*ADC0832, error) {
+	s, err := spi.New(tclk, clk, csz, di, do)
+	if err != nil {
+		return nil, err
+	}
+	return &ADC0832{s, tset}, nil
 }
 
 // Read returns the value of a single channel read from the ADC.
@@ -40,8 +44,7 @@ func (adc *ADC0832) read(ch int, sgl gpio.Level) uint8 {
 	adc.Mu.Lock()
 	adc.Ssz.High()
 	adc.Sclk.Low()
-	adc.Mosi.High()
-	adc.Mosi.Output()
+	adc.Mosi.Output(gpio.High)
 	time.Sleep(adc.Tclk)
 	adc.Ssz.Low()
 
@@ -20,23 +20,27 @@ import (
 // and the c the number of channels.
 // The two data pins, di and do, may be tied and connected to a single GPIO pin.
 type MCP3w0c struct {
-	spi.SPI
+	*spi.SPI
 	width uint
 }
 
 // New creates a MCP3w0c.
-func New(tclk time.Duration, clk, csz, di, do int, width uint) *MCP3w0c {
-	return &MCP3w0c{*spi.New(tclk, clk, csz, di, do), width}
+func New(tclk time.Duration, clk, csz, di, do int, width uint) (*MCP3w0c, error) {
+	s, err := spi.New(tclk, clk, csz, di, do)
+	if err != nil {
+		return nil, err
+	}
+	return &MCP3w0c{s, width}, nil
 }
 
 // NewMCP3008 creates a MCP3008.
-func NewMCP3008(tclk time.Duration, clk, csz, di, do int) *MCP3w0c {
-	return &MCP3w0c{*spi.New(tclk, clk, csz, di, do), 10}
+func NewMCP3008(tclk time.Duration, clk, csz, di, do int) (*MCP3w0c, error) {
+	return New(tclk, clk, csz, di, do, 10)
 }
 
 // NewMCP3208 creates a MCP3208.
-func NewMCP3208(tclk time.Duration, clk, csz, di, do int) *MCP3w0c {
-	return &MCP3w0c{*spi.New(tclk, clk, csz, di, do), 12}
+func NewMCP3208(tclk time.Duration, clk, csz, di, do int) (*MCP3w0c, error) {
+	return New(tclk, clk, csz, di, do, 12)
 }
 
 // Read returns the value of a single channel read from the ADC.
@@ -53,8 +57,7 @@ func (adc *MCP3w0c) read(ch int, sgl gpio.Level) uint16 {
 	adc.Mu.Lock()
 	adc.Ssz.High()
 	adc.Sclk.Low()
-	adc.Mosi.High()
-	adc.Mosi.Output()
+	adc.Mosi.Output(gpio.High)
 	time.Sleep(adc.Tclk)
 	adc.Ssz.Low()
 
@@ -30,20 +30,25 @@ type SPI struct {
 }
 
 // New creates a SPI.
-func New(tclk time.Duration, sclk, ssz, mosi, miso int) *SPI {
-	spi := &SPI{
-		Tclk: tclk,
-		Sclk: gpio.NewPin(sclk),
-		Ssz:  gpio.NewPin(ssz),
-		Mosi: gpio.NewPin(mosi),
-		Miso: gpio.NewPin(miso),
-	}
+func New(tclk time.Duration, sclk, ssz, mosi, miso int) (*SPI, error) {
+	spi := &SPI{Tclk: tclk}
+	var err error
 	// hold SPI reset until needed...
-	spi.Sclk.Low()
-	spi.Sclk.Output()
-	spi.Ssz.High()
-	spi.Ssz.Output()
-	return spi
+	if spi.Sclk, err = gpio.NewPin(sclk,
+		gpio.WithInitialLevel(gpio.Low), gpio.WithMode(gpio.Output)); err != nil {
+		return nil, err
+	}
+	if spi.Ssz, err = gpio.NewPin(ssz,
+		gpio.WithInitialLevel(gpio.High), gpio.WithMode(gpio.Output)); err != nil {
+		return nil, err
+	}
+	if spi.Mosi, err = gpio.NewPin(mosi); err != nil {
+		return nil, err
+	}
+	if spi.Miso, err = gpio.NewPin(miso); err != nil {
+		return nil, err
+	}
+	return spi, nil
 }
 
 // Close disables the output pins used to drive the SPI device.
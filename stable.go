@@ -0,0 +1,51 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Debounced reads of pin levels.
+
+package gpio
+
+import (
+	"errors"
+	"time"
+)
+
+// ReadStable returns the level of the pin, only if the level is held for the
+// whole of the window.
+//
+// The level is sampled the given number of times, evenly spaced over the
+// window, with the first sample taken immediately and the last at the end of
+// the window, so ReadStable blocks for the duration of the window.  At least
+// two samples are always taken.
+//
+// If any sample differs from the first then ErrUnstable is returned, along
+// with the level of the last sample read.
+//
+// This provides a simple debounced read for code that polls the pin
+// occasionally, rather than watching for edges.
+func (pin *Pin) ReadStable(window time.Duration, samples int) (Level, error) {
+	return readStable(pin.Read, window, samples)
+}
+
+func readStable(read func() Level, window time.Duration, samples int) (Level, error) {
+	if samples < 2 {
+		samples = 2
+	}
+	interval := window / time.Duration(samples-1)
+	first := read()
+	for i := 1; i < samples; i++ {
+		time.Sleep(interval)
+		if level := read(); level != first {
+			return level, ErrUnstable
+		}
+	}
+	return first, nil
+}
+
+var (
+	// ErrUnstable indicates the level of the pin was not stable for the
+	// required window.
+	ErrUnstable = errors.New("level unstable")
+)
@@ -0,0 +1,46 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadStable(t *testing.T) {
+	levels := func(ll ...Level) (func() Level, *int) {
+		n := 0
+		return func() Level {
+			l := ll[n%len(ll)]
+			n++
+			return l
+		}, &n
+	}
+
+	read, n := levels(High)
+	start := time.Now()
+	level, err := readStable(read, 20*time.Millisecond, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, High, level)
+	assert.Equal(t, 5, *n)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	// bounce aborts immediately, returning the latest level.
+	read, n = levels(Low, Low, High)
+	level, err = readStable(read, 10*time.Millisecond, 10)
+	assert.Equal(t, ErrUnstable, err)
+	assert.Equal(t, High, level)
+	assert.Equal(t, 3, *n)
+
+	// at least two samples are taken.
+	read, n = levels(Low)
+	level, err = readStable(read, time.Millisecond, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, Low, level)
+	assert.Equal(t, 2, *n)
+}
@@ -0,0 +1,415 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Stubs for platforms other than Linux.
+//
+// GPIO access requires Linux, but the stubs allow applications using the
+// package to be built, and their other code tested, on development machines.
+// Open returns ErrUnsupported, and so no Pins can be created.  The mock
+// package may be used to provide pins for testing instead.
+
+// +build !linux
+
+package gpio
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpio/clock"
+)
+
+// Chipset identifies the GPIO chip.
+type Chipset int
+
+const (
+	// Unknown by default
+	_ Chipset = iota
+
+	// BCM2835 indicates the chipset is BCM2825 or compatible.
+	BCM2835
+
+	// BCM2711 indicates the chipset is BCM2711.
+	BCM2711
+)
+
+var (
+	chipset Chipset
+	memlock sync.Mutex
+	mem     []uint32
+	cdev    *charDev
+)
+
+// Open returns ErrUnsupported, as GPIO access is only supported on Linux.
+func Open(options ...OpenOption) error {
+	return ErrUnsupported
+}
+
+// Chip identifies the chipset on the system.
+func Chip() Chipset {
+	return chipset
+}
+
+// Close does nothing, as the package cannot be opened.
+func Close() error {
+	return nil
+}
+
+// Reclaim does nothing, as there is no sysfs.
+func Reclaim() ([]int, error) {
+	return nil, nil
+}
+
+// Export describes the sysfs export of a pin, and the use of its line.
+type Export struct {
+	Pin      int
+	Exported bool
+	Mode     Mode
+	Edge     Edge
+	Used     bool
+	Consumer string
+	Watched  bool
+}
+
+// LookupExport reports the pin as not exported, as there is no sysfs.
+func LookupExport(pin int) (Export, error) {
+	return Export{Pin: pin}, nil
+}
+
+// charDev stands in for the GPIO character device, which cannot be opened.
+type charDev struct {
+	name  string
+	label string
+	lines int
+}
+
+type lineInfo struct {
+	Name [32]byte
+}
+
+func openCharDev(chip string) (*charDev, error) {
+	return nil, ErrUnsupported
+}
+
+func getCharDev(id string) (*charDev, error) {
+	return nil, ErrUnsupported
+}
+
+func (c *charDev) close() error {
+	return nil
+}
+
+func (c *charDev) lineInfo(offset int) (lineInfo, error) {
+	return lineInfo{}, ErrUnsupported
+}
+
+func (c *charDev) requestLine(offset int) (*line, error) {
+	return nil, ErrUnsupported
+}
+
+func (c *charDev) readRequested() uint64 {
+	return 0
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// line stands in for a line requested from a character device.
+type line struct {
+	chip *charDev
+}
+
+func (l *line) mode() Mode {
+	return Input
+}
+
+func (l *line) driveMode() Drive {
+	return DrivePushPull
+}
+
+func (l *line) read() Level {
+	return Low
+}
+
+func (l *line) write(level Level) {}
+
+func (l *line) setMode(mode Mode, level Level) {}
+
+func (l *line) setDrive(drive Drive, level Level) {}
+
+func (l *line) setPull(pull Pull, level Level) {}
+
+// MaxGPIOInterrupt is the maximum pin number.
+const MaxGPIOInterrupt = MaxGPIOPin
+
+// Edge represents the change in Pin level that triggers an interrupt.
+type Edge string
+
+const (
+	// EdgeNone indicates no level transitions will trigger an interrupt
+	EdgeNone Edge = "none"
+
+	// EdgeRising indicates an interrupt is triggered when the pin transitions from low to high.
+	EdgeRising Edge = "rising"
+
+	// EdgeFalling indicates an interrupt is triggered when the pin transitions from high to low.
+	EdgeFalling Edge = "falling"
+
+	// EdgeBoth indicates an interrupt is triggered when the pin changes level.
+	EdgeBoth Edge = "both"
+)
+
+// Event describes an edge event on a watched pin.
+type Event struct {
+	// Pin is the pin that triggered the event.
+	Pin *Pin
+
+	// Level is the level of the pin when the event was read.
+	Level Level
+
+	// Time is the time of the event.
+	Time time.Time
+}
+
+type interrupt struct{}
+
+// WatchOption defines an option that can be applied to a watch.
+type WatchOption func(*interrupt)
+
+// WithFilter discards events for which the filter returns false.
+func WithFilter(filter func(Event) bool) WatchOption {
+	return func(*interrupt) {}
+}
+
+// WithPipeline discards events that do not pass the stages of the pipeline.
+func WithPipeline(p Pipeline) WatchOption {
+	return func(*interrupt) {}
+}
+
+// WithDedup suppresses events that report the same level as the previous
+// event.
+func WithDedup() WatchOption {
+	return func(*interrupt) {}
+}
+
+// WithAdopt attaches the watch to an existing sysfs export of the pin.
+func WithAdopt() WatchOption {
+	return func(*interrupt) {}
+}
+
+// WithMaxRate limits the events dispatched to the handler to at most n per
+// second.
+func WithMaxRate(n int) WatchOption {
+	return func(*interrupt) {}
+}
+
+// WithClock sets the clock used to time the events on the watch.
+func WithClock(c clock.Clock) WatchOption {
+	return func(*interrupt) {}
+}
+
+// WatchStats contains statistics on the handler invocations for a watched
+// pin.
+type WatchStats struct {
+	Events        uint64
+	Rate          uint64
+	Latency       time.Duration
+	MaxLatency    time.Duration
+	TotalLatency  time.Duration
+	Duration      time.Duration
+	MaxDuration   time.Duration
+	TotalDuration time.Duration
+	Suppressed    uint64
+	Stages        []StageStats
+}
+
+// WatchEvent describes a single instrumented handler invocation.
+type WatchEvent struct {
+	Pin      *Pin
+	Latency  time.Duration
+	Duration time.Duration
+}
+
+// Watcher monitors the pins for level transitions.
+type Watcher struct{}
+
+// NewWatcher creates a Watcher.
+func NewWatcher() *Watcher {
+	return &Watcher{}
+}
+
+func getDefaultWatcher() *Watcher {
+	return &Watcher{}
+}
+
+// Close does nothing.
+func (w *Watcher) Close() {}
+
+// RegisterPin returns ErrUnsupported.
+func (w *Watcher) RegisterPin(pin *Pin, edge Edge, handler func(*Pin), options ...WatchOption) error {
+	return ErrUnsupported
+}
+
+// UnregisterPin does nothing.
+func (w *Watcher) UnregisterPin(pin *Pin) {}
+
+// Instrument does nothing.
+func (w *Watcher) Instrument(callback func(WatchEvent)) {}
+
+// Stats returns false, as no pins are watched.
+func (w *Watcher) Stats(pin *Pin) (WatchStats, bool) {
+	return WatchStats{}, false
+}
+
+// Instrument does nothing.
+func Instrument(callback func(WatchEvent)) {}
+
+// WatchStats returns false, as no pins are watched.
+func (p *Pin) WatchStats() (WatchStats, bool) {
+	return WatchStats{}, false
+}
+
+// EdgeCounter counts the edges on a pin.
+type EdgeCounter struct{}
+
+// EdgeCounter returns ErrUnsupported.
+func (p *Pin) EdgeCounter(edge Edge) (*EdgeCounter, error) {
+	return nil, ErrUnsupported
+}
+
+// Count returns 0.
+func (c *EdgeCounter) Count() uint64 {
+	return 0
+}
+
+// Reset returns 0.
+func (c *EdgeCounter) Reset() uint64 {
+	return 0
+}
+
+// Close does nothing.
+func (c *EdgeCounter) Close() {}
+
+// Latch records whether an edge has occurred on a pin.
+type Latch struct{}
+
+// Latch returns ErrUnsupported.
+func (p *Pin) Latch(edge Edge) (*Latch, error) {
+	return nil, ErrUnsupported
+}
+
+// Occurred returns false.
+func (l *Latch) Occurred() bool {
+	return false
+}
+
+// Clear returns false.
+func (l *Latch) Clear() bool {
+	return false
+}
+
+// Close does nothing.
+func (l *Latch) Close() {}
+
+// WatchEvents returns ErrUnsupported.
+func (p *Pin) WatchEvents(edge Edge, handler func(Event), options ...WatchOption) error {
+	return ErrUnsupported
+}
+
+func withEdgeHandler(handler func(Event)) WatchOption {
+	return func(*interrupt) {}
+}
+
+// Watch returns ErrUnsupported.
+func (p *Pin) Watch(edge Edge, handler func(Pinner)) error {
+	return ErrUnsupported
+}
+
+// WatchWith returns ErrUnsupported.
+func (p *Pin) WatchWith(edge Edge, handler func(Pinner), options ...WatchOption) error {
+	return ErrUnsupported
+}
+
+// Unwatch does nothing.
+func (p *Pin) Unwatch() {}
+
+// ClockSource identifies the source of a general purpose clock.
+type ClockSource int
+
+const (
+	// ClockGround stops the clock.
+	ClockGround ClockSource = 0
+
+	// ClockOscillator is the crystal oscillator.
+	ClockOscillator ClockSource = 1
+
+	// ClockPLLC is PLLC, which varies with the core clock.
+	ClockPLLC ClockSource = 5
+
+	// ClockPLLD is PLLD.
+	ClockPLLD ClockSource = 6
+
+	// ClockHDMI is the HDMI auxiliary clock.
+	ClockHDMI ClockSource = 7
+)
+
+// Clock is a general purpose clock output.
+type Clock struct{}
+
+// NewClock returns ErrUnsupported.
+func NewClock(pin int) (*Clock, error) {
+	return nil, ErrUnsupported
+}
+
+// SourceFrequency returns 0.
+func SourceFrequency(src ClockSource) int {
+	return 0
+}
+
+// Configure returns ErrUnsupported.
+func (c *Clock) Configure(src ClockSource, divi, divf, mash int) error {
+	return ErrUnsupported
+}
+
+// SetFrequency returns ErrUnsupported.
+func (c *Clock) SetFrequency(freq int) (int, error) {
+	return 0, ErrUnsupported
+}
+
+// Stop does nothing.
+func (c *Clock) Stop() {}
+
+var (
+	// ErrTimeout indicates the operation could not be performed within the
+	// expected time.
+	ErrTimeout = errors.New("timeout")
+
+	// ErrBusy indicates the operation is already active on the pin.
+	ErrBusy = errors.New("pin already in use")
+
+	// ErrAlreadyOpen indicates the mem is already open.
+	ErrAlreadyOpen = errors.New("already open")
+
+	// ErrInvalidAddress indicates the GPIO register address is not page
+	// aligned.
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrUnknownChip indicates no GPIO chip matches the name or label.
+	ErrUnknownChip = errors.New("unknown chip")
+
+	// ErrInvalidClock indicates the clock configuration is invalid.
+	ErrInvalidClock = errors.New("invalid clock")
+
+	// ErrUntrustedRecords indicates the records of the pins exported by each
+	// process cannot be trusted.
+	ErrUntrustedRecords = errors.New("untrusted export records")
+)
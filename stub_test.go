@@ -0,0 +1,25 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package gpio_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/gpio"
+)
+
+func TestStubOpen(t *testing.T) {
+	assert.Equal(t, gpio.ErrUnsupported, gpio.Open())
+	assert.Nil(t, gpio.Close())
+	_, err := gpio.Line{Chip: "gpiochip0"}.Pin()
+	assert.Equal(t, gpio.ErrUnsupported, err)
+	cc, err := gpio.Chips()
+	assert.Nil(t, err)
+	assert.Empty(t, cc)
+}
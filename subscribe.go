@@ -0,0 +1,189 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Multiple subscribers to the edge events on a pin.
+
+package gpio
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Subscription is a subscription to the edge events on a pin.
+//
+// A pin can have any number of subscriptions, so independent modules can
+// observe the same input.  The events are fanned out to the subscribers by the
+// watcher, which holds a single watch on the pin while any subscriptions
+// remain.
+type Subscription struct {
+	// first to ensure 64-bit alignment for atomic access.
+	dropped uint64
+
+	// C delivers the events for subscriptions created by SubscribeChan.  It
+	// is closed when the subscription is removed.
+	//
+	// C is nil for subscriptions created by Subscribe.
+	C <-chan Event
+
+	hub  *hub
+	edge Edge
+	c    chan Event
+	once sync.Once
+}
+
+// hub fans out the events on a pin to its subscribers.
+type hub struct {
+	pin     *Pin
+	watcher *Watcher
+	// Guards the following
+	mu   sync.Mutex
+	subs []*Subscription
+}
+
+var (
+	// Guards the following
+	hubsMu sync.Mutex
+	hubs   = make(map[pinID]*hub)
+)
+
+// subscriptionBuffer is the number of events buffered for each subscriber.
+const subscriptionBuffer = 64
+
+// Subscribe adds a subscriber that calls the handler with each edge event on
+// the pin.
+//
+// The handler is called from a goroutine dedicated to the subscription, in
+// order, so a slow handler does not delay other subscribers, or the watcher.
+// Events are dropped if the handler falls too far behind.
+//
+// The pin is watched on both edges while subscribed, and the events filtered
+// to the edge for each subscriber, so a pin that is subscribed cannot also be
+// watched with Watch or WatchEvents, and vice versa.
+func (p *Pin) Subscribe(edge Edge, handler func(Event)) (*Subscription, error) {
+	s, err := p.subscribe(edge, subscriptionBuffer)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for evt := range s.c {
+			handler(evt)
+		}
+	}()
+	return s, nil
+}
+
+// SubscribeChan adds a subscriber that delivers each edge event on the pin to
+// the subscription channel, C, which buffers up to size events.
+//
+// Events are dropped if the channel is full.
+func (p *Pin) SubscribeChan(edge Edge, size int) (*Subscription, error) {
+	if size < 0 {
+		size = 0
+	}
+	s, err := p.subscribe(edge, size)
+	if err != nil {
+		return nil, err
+	}
+	s.C = s.c
+	return s, nil
+}
+
+func (p *Pin) subscribe(edge Edge, size int) (*Subscription, error) {
+	// the watcher is found before locking the hubs, as Close holds the
+	// memlock while removing the hubs.
+	watcher := getDefaultWatcher()
+	hubsMu.Lock()
+	defer hubsMu.Unlock()
+	h, ok := hubs[p.id()]
+	if !ok {
+		h = &hub{pin: p, watcher: watcher}
+		if err := watcher.RegisterPin(p, EdgeBoth, nil, withEdgeHandler(h.fanout)); err != nil {
+			return nil, err
+		}
+		hubs[p.id()] = h
+	}
+	s := &Subscription{hub: h, edge: edge, c: make(chan Event, size)}
+	h.mu.Lock()
+	h.subs = append(h.subs, s)
+	h.mu.Unlock()
+	return s, nil
+}
+
+// Unsubscribe removes the subscription.
+//
+// The watch on the pin is removed with the last subscription.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		hubsMu.Lock()
+		defer hubsMu.Unlock()
+		h := s.hub
+		h.mu.Lock()
+		for i, sub := range h.subs {
+			if sub == s {
+				h.subs = append(h.subs[:i], h.subs[i+1:]...)
+				break
+			}
+		}
+		close(s.c)
+		last := len(h.subs) == 0
+		h.mu.Unlock()
+		if last && hubs[h.pin.id()] == h {
+			delete(hubs, h.pin.id())
+			h.watcher.UnregisterPin(h.pin)
+		}
+	})
+}
+
+// Dropped returns the number of events dropped as the subscriber fell behind.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// fanout passes the event to the subscribers to the edge.
+//
+// This is called from the watcher goroutine, so must not block.
+func (h *hub) fanout(evt Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.subs {
+		switch s.edge {
+		case EdgeNone:
+			continue
+		case EdgeRising:
+			if evt.Level != High {
+				continue
+			}
+		case EdgeFalling:
+			if evt.Level != Low {
+				continue
+			}
+		}
+		select {
+		case s.c <- evt:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// closeSubscriptions removes all subscriptions, closing their channels.
+//
+// The watches are removed by the closing of the watcher.
+func closeSubscriptions() {
+	hubsMu.Lock()
+	defer hubsMu.Unlock()
+	for id, h := range hubs {
+		h.mu.Lock()
+		for _, s := range h.subs {
+			s.once.Do(func() {
+				close(s.c)
+			})
+		}
+		h.subs = nil
+		h.mu.Unlock()
+		delete(hubs, id)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanout(t *testing.T) {
+	h := &hub{}
+	sub := func(edge Edge, size int) *Subscription {
+		s := &Subscription{hub: h, edge: edge, c: make(chan Event, size)}
+		s.C = s.c
+		h.subs = append(h.subs, s)
+		return s
+	}
+	both := sub(EdgeBoth, 4)
+	rising := sub(EdgeRising, 4)
+	falling := sub(EdgeFalling, 1)
+	none := sub(EdgeNone, 4)
+
+	now := time.Now()
+	h.fanout(Event{Level: High, Time: now})
+	h.fanout(Event{Level: Low, Time: now.Add(time.Millisecond)})
+	h.fanout(Event{Level: High, Time: now.Add(2 * time.Millisecond)})
+	h.fanout(Event{Level: Low, Time: now.Add(3 * time.Millisecond)})
+
+	levels := func(s *Subscription) []Level {
+		var ll []Level
+		for len(s.C) > 0 {
+			ll = append(ll, (<-s.C).Level)
+		}
+		return ll
+	}
+	assert.Equal(t, []Level{High, Low, High, Low}, levels(both))
+	assert.Equal(t, []Level{High, High}, levels(rising))
+	assert.Equal(t, []Level{Low}, levels(falling))
+	assert.Empty(t, levels(none))
+	assert.Zero(t, both.Dropped())
+	assert.Equal(t, uint64(1), falling.Dropped())
+}
+
+func TestCloseSubscriptions(t *testing.T) {
+	h := &hub{}
+	s := &Subscription{hub: h, edge: EdgeBoth, c: make(chan Event, 1)}
+	s.C = s.c
+	h.subs = append(h.subs, s)
+	hubsMu.Lock()
+	hubs[pinID{}] = h
+	hubsMu.Unlock()
+
+	closeSubscriptions()
+	_, ok := <-s.C
+	assert.False(t, ok)
+	assert.Empty(t, hubs)
+	// no longer subscribed, so a no-op.
+	s.Unsubscribe()
+	h.fanout(Event{Level: High})
+}
@@ -0,0 +1,243 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TouchSensor detects touches on a pin connected to a touch pad.
+//
+// The pin is repeatedly discharged and then allowed to charge through the
+// internal pull up, and the rise time is compared against a baseline.
+// A finger on the pad increases the capacitance, and so the rise time.
+//
+// The baseline, and the noise on it, are calibrated when the sensor is
+// created, and then track slow drifts, such as from temperature or humidity,
+// while the pad is not touched.  By default the threshold is tuned to the
+// noise, so the sensor adapts to the pad and wiring without configuration.
+type TouchSensor struct {
+	pin *Pin
+	// the fixed threshold, relative to the baseline, or 0 if tuned to the
+	// noise.
+	threshold float64
+	samples   int
+	period    time.Duration
+	handler   func(bool)
+	done      chan struct{}
+	once      sync.Once
+	wg        sync.WaitGroup
+	// Guards the following
+	mu       sync.Mutex
+	baseline time.Duration
+	// the variance of the measurements of the untouched pad.
+	variance float64
+	touched  bool
+}
+
+const (
+	// the number of measurements used to calibrate the baseline and noise.
+	touchCalibrations = 8
+	// the tuned threshold, in standard deviations of the noise above the
+	// baseline.
+	touchSigmas = 6
+	// the minimum tuned threshold, relative to the baseline, so a sensor
+	// calibrated with little noise is not overly sensitive.
+	touchMinThreshold = 0.05
+	// the weight of each new measurement in the tracked baseline and noise.
+	touchTracking = 16
+)
+
+// TouchOption defines an option that can be applied when creating a
+// TouchSensor.
+type TouchOption func(*TouchSensor)
+
+// WithTouchSamples sets the number of rise times summed for each measurement.
+//
+// More samples are less susceptible to noise, but take longer.
+// The default is 16.
+func WithTouchSamples(n int) TouchOption {
+	return func(t *TouchSensor) {
+		if n > 0 {
+			t.samples = n
+		}
+	}
+}
+
+// WithTouchThreshold sets a fixed increase in rise time, relative to the
+// baseline, that is considered a touch, e.g. 0.2 for 20% above the baseline.
+//
+// The default is to tune the threshold to the noise on the baseline, which
+// is measured during calibration, and tracked while the pad is not touched.
+func WithTouchThreshold(threshold float64) TouchOption {
+	return func(t *TouchSensor) {
+		t.threshold = threshold
+	}
+}
+
+// WithTouchPeriod sets the period between measurements.
+//
+// The default is 20ms.
+func WithTouchPeriod(period time.Duration) TouchOption {
+	return func(t *TouchSensor) {
+		t.period = period
+	}
+}
+
+// WithTouchHandler sets a handler to be called when the pad is touched or
+// released.
+//
+// The handler is called from the sensor goroutine, so should not block.
+func WithTouchHandler(handler func(touched bool)) TouchOption {
+	return func(t *TouchSensor) {
+		t.handler = handler
+	}
+}
+
+// NewTouchSensor creates a TouchSensor on the pin and starts monitoring it.
+//
+// The pad must not be touched while the sensor is calibrated.
+func NewTouchSensor(pin *Pin, options ...TouchOption) *TouchSensor {
+	t := &TouchSensor{
+		pin:     pin,
+		samples: 16,
+		period:  20 * time.Millisecond,
+		done:    make(chan struct{}),
+	}
+	for _, option := range options {
+		option(t)
+	}
+	pin.SetPull(PullUp)
+	t.Calibrate()
+	t.wg.Add(1)
+	go t.monitor()
+	return t
+}
+
+// Close stops monitoring the pin.
+//
+// Close may be called more than once.
+func (t *TouchSensor) Close() {
+	t.once.Do(func() {
+		close(t.done)
+	})
+	t.wg.Wait()
+}
+
+// Calibrate resets the baseline, and the noise, to those of the current rise
+// time.
+//
+// The pad must not be touched while the sensor is calibrated.
+func (t *TouchSensor) Calibrate() {
+	var mm [touchCalibrations]time.Duration
+	for i := range mm {
+		mm[i] = t.measure()
+	}
+	t.calibrate(mm[:])
+}
+
+// calibrate sets the baseline and the noise from the measurements.
+func (t *TouchSensor) calibrate(mm []time.Duration) {
+	var sum float64
+	for _, m := range mm {
+		sum += float64(m)
+	}
+	mean := sum / float64(len(mm))
+	var variance float64
+	for _, m := range mm {
+		d := float64(m) - mean
+		variance += d * d
+	}
+	if len(mm) > 1 {
+		variance /= float64(len(mm) - 1)
+	}
+	t.mu.Lock()
+	t.baseline = time.Duration(mean)
+	t.variance = variance
+	t.touched = false
+	t.mu.Unlock()
+}
+
+// Baseline returns the rise time of the untouched pad.
+func (t *TouchSensor) Baseline() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.baseline
+}
+
+// Threshold returns the rise time above which the pad is considered touched.
+func (t *TouchSensor) Threshold() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit()
+}
+
+// limit returns the rise time above which the pad is considered touched.
+//
+// Assumes the caller holds the mu lock.
+func (t *TouchSensor) limit() time.Duration {
+	base := float64(t.baseline)
+	if t.threshold != 0 {
+		return time.Duration(base * (1 + t.threshold))
+	}
+	margin := touchSigmas * math.Sqrt(t.variance)
+	if min := base * touchMinThreshold; margin < min {
+		margin = min
+	}
+	return time.Duration(base + margin)
+}
+
+// Touched returns true if the pad is currently touched.
+func (t *TouchSensor) Touched() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.touched
+}
+
+func (t *TouchSensor) monitor() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.update(t.measure())
+		}
+	}
+}
+
+// update determines the touch state from the measurement m, and tracks the
+// baseline and noise while the pad is untouched.
+func (t *TouchSensor) update(m time.Duration) {
+	t.mu.Lock()
+	touched := m > t.limit()
+	if !touched {
+		// track slow drifts in the baseline and noise.
+		d := m - t.baseline
+		t.baseline += d / touchTracking
+		t.variance += (float64(d)*float64(d) - t.variance) / touchTracking
+	}
+	changed := touched != t.touched
+	t.touched = touched
+	t.mu.Unlock()
+	if changed && t.handler != nil {
+		t.handler(touched)
+	}
+}
+
+// measure returns the sum of the rise times of the samples.
+func (t *TouchSensor) measure() time.Duration {
+	var sum time.Duration
+	for i := 0; i < t.samples; i++ {
+		d, _ := t.pin.ReadRC(time.Microsecond, time.Millisecond)
+		sum += d
+	}
+	return sum
+}
@@ -0,0 +1,57 @@
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+//
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gpio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTouchThreshold(t *testing.T) {
+	var changes []bool
+	ts := &TouchSensor{handler: func(touched bool) {
+		changes = append(changes, touched)
+	}}
+
+	// quiet, so the minimum threshold applies.
+	ts.calibrate([]time.Duration{1000, 1000, 1000, 1000})
+	assert.Equal(t, time.Duration(1050), ts.Threshold())
+
+	// noisy, so the threshold is tuned to the noise.
+	ts.calibrate([]time.Duration{980, 1020, 980, 1020})
+	assert.Equal(t, time.Duration(1000), ts.Baseline())
+	th := ts.Threshold()
+	assert.True(t, th > 1130 && th < 1145, th)
+	ts.update(1100)
+	assert.False(t, ts.Touched())
+	base := ts.Baseline()
+	ts.update(1500)
+	assert.True(t, ts.Touched())
+	// the baseline is not tracked while touched.
+	assert.Equal(t, base, ts.Baseline())
+	ts.update(1000)
+	assert.False(t, ts.Touched())
+	assert.Equal(t, []bool{true, false}, changes)
+
+	// the noise is tracked while untouched, decaying to the minimum.
+	for i := 0; i < 200; i++ {
+		ts.update(ts.Baseline())
+	}
+	base = ts.Baseline()
+	assert.Equal(t, base+base/20, ts.Threshold())
+
+	// fixed
+	ts.threshold = 0.2
+	assert.Equal(t, base+base/5, ts.Threshold())
+}
+
+func TestTouchClose(t *testing.T) {
+	ts := &TouchSensor{done: make(chan struct{})}
+	ts.Close()
+	assert.NotPanics(t, ts.Close)
+}